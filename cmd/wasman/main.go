@@ -20,9 +20,11 @@ var maxToll = flag.Uint64("max-toll", 0, "the maximum toll in simple toll statio
 
 var strExternModules = flag.String("extern-files", "", "external modules files")
 
-var stdout = os.Stdout // for wasi
-
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		os.Exit(run(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
 	flag.Parse()
 
 	externModules := strings.Split(*strExternModules, ",")
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/c0mm4nd/wasman"
+	"github.com/c0mm4nd/wasman/config"
+	"github.com/c0mm4nd/wasman/wasi"
+)
+
+// listFlag is the flag which is repeatable
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// run runs the WASI command module by `wasman run [flags] module.wasm [args...]` on the stdio, and returns its exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var dirs, env listFlag
+	flags.Var(&dirs, "dir", "the host directory preopened as the guest one in the form of host:guest, repeatable")
+	flags.Var(&env, "env", "the environment variable of the guest in the form of KEY=value, repeatable")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: wasman run [flags] module.wasm [args...]")
+		fmt.Fprintln(flags.Output(), "the args after module.wasm, flags included, are passed to the guest, and a leading -- is dropped")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	file, guestArgs := flags.Arg(0), flags.Args()[1:]
+	if len(guestArgs) > 0 && guestArgs[0] == "--" {
+		guestArgs = guestArgs[1:]
+	}
+
+	for _, kv := range env {
+		if !strings.Contains(kv, "=") {
+			return fail(stderr, fmt.Errorf("invalid env %q: should input with --env KEY=value", kv))
+		}
+	}
+
+	conf := config.WASIConfig{
+		Args:   append([]string{file}, guestArgs...),
+		Env:    env,
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	}
+	for _, dir := range dirs {
+		host, guest, ok := strings.Cut(dir, ":")
+		if !ok {
+			guest = host
+		}
+		conf.Preopens = append(conf.Preopens, config.Preopen{GuestPath: guest, HostPath: host})
+	}
+
+	err := runCommand(file, conf)
+	var exit *wasi.ExitError
+	if errors.As(err, &exit) {
+		return int(exit.Code)
+	}
+	if err != nil {
+		return fail(stderr, err)
+	}
+
+	return 0
+}
+
+// runCommand instantiates the module with the WASI and calls its _start
+func runCommand(file string, conf config.WASIConfig) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	mod, err := wasman.NewModule(config.ModuleConfig{}, f)
+	if err != nil {
+		return err
+	}
+
+	l := wasman.NewLinker(config.LinkerConfig{})
+	if err := l.DefineWASI(conf); err != nil {
+		return err
+	}
+	ins, err := l.Instantiate(mod)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = ins.CallExportedFunc("_start")
+	return err
+}
+
+// fail prints the err and returns the exit code of the failure
+func fail(stderr io.Writer, err error) int {
+	fmt.Fprintln(stderr, "wasman:", err)
+	return 1
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// size encodes the size in the unsigned LEB128
+func size(n int) []byte {
+	var b []byte
+	for ; n >= 0x80; n >>= 7 {
+		b = append(b, byte(n)|0x80)
+	}
+
+	return append(b, byte(n))
+}
+
+func section(id byte, content ...byte) []byte {
+	return append(append([]byte{id}, size(len(content))...), content...)
+}
+
+func name(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+// echoModule is the command writing its args, its env, and the content of "a.txt" on the first preopen if any
+// to the stdout, then exiting with the number of its args
+//
+//	(func (export "_start")
+//	  (drop (call $args_sizes_get (i32.const 0) (i32.const 4)))
+//	  (drop (call $args_get (i32.const 64) (i32.const 256)))
+//	  (i32.store (i32.const 16) (i32.const 256))
+//	  (i32.store (i32.const 20) (i32.load (i32.const 4)))
+//	  (drop (call $fd_write (i32.const 1) (i32.const 16) (i32.const 1) (i32.const 24)))
+//	  (drop (call $environ_sizes_get (i32.const 8) (i32.const 12)))
+//	  (drop (call $environ_get (i32.const 64) (i32.const 512)))
+//	  (i32.store (i32.const 16) (i32.const 512))
+//	  (i32.store (i32.const 20) (i32.load (i32.const 12)))
+//	  (drop (call $fd_write (i32.const 1) (i32.const 16) (i32.const 1) (i32.const 24)))
+//	  (if (i32.eqz (call $path_open (i32.const 3) (i32.const 0) (i32.const 32) (i32.const 5)
+//	                 (i32.const 0) (i64.const 2) (i64.const 0) (i32.const 0) (i32.const 28)))
+//	    (then
+//	      (i32.store (i32.const 16) (i32.const 768))
+//	      (i32.store (i32.const 20) (i32.const 64))
+//	      (drop (call $fd_read (i32.load (i32.const 28)) (i32.const 16) (i32.const 1) (i32.const 24)))
+//	      (i32.store (i32.const 20) (i32.load (i32.const 24)))
+//	      (drop (call $fd_write (i32.const 1) (i32.const 16) (i32.const 1) (i32.const 24)))))
+//	  (call $proc_exit (i32.load (i32.const 0))))
+//
+// with "a.txt" at 32 in the memory
+func echoModule() []byte {
+	const (
+		i32 = 0x7f
+		i64 = 0x7e
+	)
+	imports := []struct {
+		name   string
+		params []byte
+		result bool
+	}{
+		{"args_sizes_get", []byte{i32, i32}, true},
+		{"args_get", []byte{i32, i32}, true},
+		{"environ_sizes_get", []byte{i32, i32}, true},
+		{"environ_get", []byte{i32, i32}, true},
+		{"fd_write", []byte{i32, i32, i32, i32}, true},
+		{"path_open", []byte{i32, i32, i32, i32, i32, i64, i64, i32, i32}, true},
+		{"fd_read", []byte{i32, i32, i32, i32}, true},
+		{"proc_exit", []byte{i32}, false},
+	}
+
+	typeSec := []byte{byte(len(imports) + 1)}
+	importSec := []byte{byte(len(imports))}
+	for i, imp := range imports {
+		typeSec = append(append(typeSec, 0x60, byte(len(imp.params))), imp.params...)
+		if imp.result {
+			typeSec = append(typeSec, 0x01, i32)
+		} else {
+			typeSec = append(typeSec, 0x00)
+		}
+		importSec = append(append(append(importSec, name("wasi_snapshot_preview1")...), name(imp.name)...), 0x00, byte(i))
+	}
+	typeSec = append(typeSec, 0x60, 0x00, 0x00)
+
+	store := func(addr byte, value ...byte) []byte {
+		return append(append([]byte{0x41, addr}, value...), 0x36, 0x02, 0x00)
+	}
+	load := func(addr byte) []byte {
+		return []byte{0x41, addr, 0x28, 0x02, 0x00}
+	}
+	write := []byte{0x41, 0x01, 0x41, 0x10, 0x41, 0x01, 0x41, 0x18, 0x10, 0x04, 0x1a}
+
+	body := []byte{0x00}
+	body = append(body, 0x41, 0x00, 0x41, 0x04, 0x10, 0x00, 0x1a)
+	body = append(body, 0x41, 0xc0, 0x00, 0x41, 0x80, 0x02, 0x10, 0x01, 0x1a)
+	body = append(body, store(0x10, 0x41, 0x80, 0x02)...)
+	body = append(body, store(0x14, load(0x04)...)...)
+	body = append(body, write...)
+	body = append(body, 0x41, 0x08, 0x41, 0x0c, 0x10, 0x02, 0x1a)
+	body = append(body, 0x41, 0xc0, 0x00, 0x41, 0x80, 0x04, 0x10, 0x03, 0x1a)
+	body = append(body, store(0x10, 0x41, 0x80, 0x04)...)
+	body = append(body, store(0x14, load(0x0c)...)...)
+	body = append(body, write...)
+	body = append(body,
+		0x41, 0x03, 0x41, 0x00, 0x41, 0x20, 0x41, 0x05, 0x41, 0x00, 0x42, 0x02, 0x42, 0x00, 0x41, 0x00, 0x41, 0x1c, 0x10, 0x05,
+		0x45, 0x04, 0x40,
+	)
+	body = append(body, store(0x10, 0x41, 0x80, 0x06)...)
+	body = append(body, store(0x14, 0x41, 0xc0, 0x00)...)
+	body = append(body, load(0x1c)...)
+	body = append(body, 0x41, 0x10, 0x41, 0x01, 0x41, 0x18, 0x10, 0x06, 0x1a)
+	body = append(body, store(0x14, load(0x18)...)...)
+	body = append(body, write...)
+	body = append(body, 0x0b)
+	body = append(body, load(0x00)...)
+	body = append(body, 0x10, 0x07, 0x0b)
+
+	bin := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	bin = append(bin, section(0x01, typeSec...)...)
+	bin = append(bin, section(0x02, importSec...)...)
+	bin = append(bin, section(0x03, 0x01, byte(len(imports)))...)
+	bin = append(bin, section(0x05, 0x01, 0x00, 0x01)...)
+	bin = append(bin, section(0x07, append(append([]byte{0x01}, name("_start")...), 0x00, byte(len(imports)))...)...)
+	bin = append(bin, section(0x0a, append(append([]byte{0x01}, size(len(body))...), body...)...)...)
+	bin = append(bin, section(0x0b, append([]byte{0x01, 0x00, 0x41, 0x20, 0x0b}, name("a.txt")...)...)...)
+
+	return bin
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "echo.wasm")
+	if err := os.WriteFile(file, echoModule(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	host := t.TempDir()
+	if err := os.WriteFile(filepath.Join(host, "a.txt"), []byte("from the host"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name   string
+		args   []string
+		code   int
+		stdout string
+	}{
+		{
+			name:   "args",
+			args:   []string{file, "a", "--env", "-dir=x"},
+			code:   4,
+			stdout: file + "\x00a\x00--env\x00-dir=x\x00",
+		},
+		{
+			name:   "dashes",
+			args:   []string{file, "--", "-b"},
+			code:   2,
+			stdout: file + "\x00-b\x00",
+		},
+		{
+			name:   "env and dir",
+			args:   []string{"--env", "K=v", "--env=L=w", "--dir", host + ":/data", file, "b"},
+			code:   2,
+			stdout: file + "\x00b\x00K=v\x00L=w\x00from the host",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(c.args, nil, &stdout, &stderr); code != c.code {
+				t.Errorf("got exit code %d, want %d: %s", code, c.code, stderr.String())
+			}
+			if stdout.String() != c.stdout {
+				t.Errorf("got %q, want %q", stdout.String(), c.stdout)
+			}
+		})
+	}
+}
+
+func TestRun_fail(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		args   []string
+		code   int
+		stderr string
+	}{
+		{name: "no module", args: nil, code: 2, stderr: "usage: wasman run"},
+		{name: "unknown flag", args: []string{"--unknown", "a.wasm"}, code: 2, stderr: "flag provided but not defined"},
+		{name: "invalid env", args: []string{"--env", "K", "a.wasm"}, code: 1, stderr: `invalid env "K"`},
+		{name: "missing file", args: []string{filepath.Join(t.TempDir(), "missing.wasm")}, code: 1, stderr: "no such file"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			if code := run(c.args, nil, &bytes.Buffer{}, &stderr); code != c.code || !strings.Contains(stderr.String(), c.stderr) {
+				t.Errorf("got %d, %q", code, stderr.String())
+			}
+		})
+	}
+}
@@ -16,6 +16,15 @@ const (
 	DefaultMemoryMaxPages = 65536
 	// MemoryPageSizeInBits satisfies the relation: "1 << MemoryPageSizeInBits == MemoryPageSize".
 	DefaultMemoryPageSizeInBits = 16
+	// DefaultCallDepthLimit is the max depth of the nested calls when ModuleConfig.CallDepthLimit is nil,
+	// which keeps the recursion inside the goroutine stack
+	DefaultCallDepthLimit = 1 << 16
+	// DefaultMemoryLimitPages is the max pages each memory of the instance can grow to on the host
+	// when ModuleConfig.MemoryLimitPages is nil, 4GiB as the max of the memory32
+	DefaultMemoryLimitPages = 1 << 16
+	// DefaultTableLimit is the max elements each table of the instance can grow to on the host
+	// when ModuleConfig.TableLimit is nil, same to the limit of the browsers
+	DefaultTableLimit = 10000000
 )
 
 var (
@@ -25,11 +34,19 @@ var (
 
 // ModuleConfig is the config applied to the wasman.Module
 type ModuleConfig struct {
-	DisableFloatPoint bool
+	DisableFloatPoint bool // reject the module using the f32 or f64 in NewModule
+	TrapFloatPoint    bool // with DisableFloatPoint, load the module but trap on executing its float instructions
+	CanonicalizeNaN   bool // replace the NaN results of the float instructions with the canonical NaN, for the bit-identical results
 	TollStation       tollstation.TollStation
-	CallDepthLimit    *uint64
-	Recover           bool // avoid panic inside vm
+	CallDepthLimit    *uint64 // the max depth of the nested calls, DefaultCallDepthLimit if nil
+	OperandStackLimit *uint64 // the max height of the operand stack, no limit if nil
+	LabelStackLimit   *uint64 // the max height of the label stack in each call, no limit if nil
+	MemoryLimitPages  *uint64 // the max pages each memory defined by the module can grow to, DefaultMemoryLimitPages if nil
+	TableLimit        *uint64 // the max elements each table defined by the module can grow to, DefaultTableLimit if nil
+	Recover           bool    // avoid panic inside vm
 	Logger            func(string)
+	EnableValidation  bool // validate the module by the spec in NewModule, before any instantiation
+	Optimize          bool // run the func bodies lowered into the superinstructions of the ir package instead of the plain ones
 }
 
 // LinkerConfig is the config applied to the wasman.Linker
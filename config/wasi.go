@@ -1,5 +1,47 @@
 package config
 
-// WASIConfig : TODO
+import (
+	"io"
+
+	"github.com/c0mm4nd/wasman/tollstation"
+	"github.com/c0mm4nd/wasman/wasi/vfs"
+)
+
+// WASIConfig is the config applied to the WASI host module of the wasi package
 type WASIConfig struct {
+	Args []string // the command line args, the first of which is the program name
+	Env  []string // the environment variables in the form of "KEY=value", never inherited from the host
+
+	Stdin  io.Reader // read as the fd 0, empty if nil
+	Stdout io.Writer // written as the fd 1, discarded if nil
+	Stderr io.Writer // written as the fd 2, discarded if nil
+
+	Preopens []Preopen // the directories preopened as the fds from 3 in order
+
+	// the virtual clocks replace the host clocks when ClockStep or ClockToll is set. Their monotonic time starts
+	// at 0 and advances by the ClockStep on each reading, by the toll consumed since the start, and by the timeouts
+	// of poll_oneoff without sleeping
+	ClockStep  uint64                  // the nanoseconds the virtual clocks advance on each reading
+	ClockToll  tollstation.TollStation // the toll station, usually the one of the guest module, whose toll counts as nanoseconds
+	ClockEpoch uint64                  // the realtime of the virtual clocks at the start, in nanoseconds since the Unix epoch
+
+	RandSeed *int64 // the seed of the pseudo random source of random_get instead of crypto/rand, if not nil
+
+	// Deterministic denies the clocks, poll_oneoff and random_get with ENOSYS unless they are made
+	// reproducible by the virtual clocks and the RandSeed. The fd_read on the stdin fills the buffers in full
+	// from the Stdin, EOF if nil, so that the results never depend on how the host delivers its bytes,
+	// and sched_yield returns at once without yielding to the host scheduler.
+	//
+	// The run still depends on the content of the Stdin, which should be a fixed input like a bytes.Reader
+	// instead of the os.Stdin, and on the files of the preopens, which should be a vfs.NewMemFS or a read-only FS.
+	// The writes to the Stdout and the Stderr which fail on the host also surface to the guest
+	Deterministic bool
+}
+
+// Preopen is a directory preopened for the guest, which is the FS or else the host directory
+type Preopen struct {
+	GuestPath string // the path seen by the guest, like "/" or "/data"
+	HostPath  string // the directory on the host, used as vfs.Dir if the FS is nil
+	FS        vfs.FS // the filesystem of the directory, like vfs.NewMemFS() or vfs.ReadOnly(embedFS)
+	ReadOnly  bool   // whether the guest is denied modifying the files with EROFS
 }
@@ -3,6 +3,7 @@ package expr
 import (
 	"bytes"
 	"fmt"
+	"io"
 
 	"github.com/c0mm4nd/wasman/leb128decode"
 	"github.com/c0mm4nd/wasman/types"
@@ -10,6 +11,8 @@ import (
 )
 
 // Expression is sequences of instructions terminated by an end marker.
+// The constant expressions of the extended-const proposal can have several instructions,
+// then the Data holds the immediates of the OpCode followed by the rest instructions without the end.
 type Expression struct {
 	OpCode OpCode
 	Data   []byte
@@ -26,8 +29,34 @@ func ReadExpression(r *bytes.Reader) (*Expression, error) {
 	offsetAtData := r.Size() - remainingBeforeData
 
 	op := OpCode(b)
+	for {
+		if err := readConstInstrImmediates(r, b); err != nil {
+			return nil, err
+		}
 
-	switch op {
+		if b, err = r.ReadByte(); err != nil {
+			return nil, fmt.Errorf("look for end opcode: %v", err)
+		}
+
+		if b == byte(OpCodeEnd) {
+			break
+		}
+	}
+
+	data := make([]byte, remainingBeforeData-int64(r.Len())-1)
+	if _, err := r.ReadAt(data, offsetAtData); err != nil {
+		return nil, fmt.Errorf("error re-buffering Expression Data")
+	}
+
+	return &Expression{
+		OpCode: op,
+		Data:   data,
+	}, nil
+}
+
+// readConstInstrImmediates skips the immediates of one instruction allowed in the constant expressions
+func readConstInstrImmediates(r *bytes.Reader, b byte) (err error) {
+	switch OpCode(b) {
 	case OpCodeI32Const:
 		_, _, err = leb128decode.DecodeInt32(r)
 	case OpCodeI64Const:
@@ -36,31 +65,27 @@ func ReadExpression(r *bytes.Reader) (*Expression, error) {
 		_, err = utils.ReadFloat32(r)
 	case OpCodeF64Const:
 		_, err = utils.ReadFloat64(r)
-	case OpCodeGlobalGet:
+	case OpCodeGlobalGet, OpCodeFunc:
 		_, _, err = leb128decode.DecodeUint32(r)
+	case OpCodeNull:
+		_, err = r.ReadByte()
+	case OpCodeSIMDPrefix:
+		var op SIMDOpCode
+		op, _, err = leb128decode.DecodeUint32(r)
+		if err == nil && op != OpCodeV128Const {
+			return fmt.Errorf("%v for opcodes.SIMDOpCode: %#x", types.ErrInvalidTypeByte, op)
+		}
+		if err == nil {
+			_, err = io.ReadFull(r, make([]byte, 16))
+		}
+	case OpCodeI32Add, OpCodeI32Sub, OpCodeI32Mul, OpCodeI64Add, OpCodeI64Sub, OpCodeI64Mul: // extended-const
 	default:
-		return nil, fmt.Errorf("%v for opcodes.OpCode: %#x", types.ErrInvalidTypeByte, b)
+		return fmt.Errorf("%v for opcodes.OpCode: %#x", types.ErrInvalidTypeByte, b)
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("read value: %v", err)
+		return fmt.Errorf("read value: %v", err)
 	}
 
-	if b, err = r.ReadByte(); err != nil {
-		return nil, fmt.Errorf("look for end opcode: %v", err)
-	}
-
-	if b != byte(OpCodeEnd) {
-		return nil, fmt.Errorf("constant expression has not terminated")
-	}
-
-	data := make([]byte, remainingBeforeData-int64(r.Len())-1)
-	if _, err := r.ReadAt(data, offsetAtData); err != nil {
-		return nil, fmt.Errorf("error re-buffering Expression Data")
-	}
-
-	return &Expression{
-		OpCode: op,
-		Data:   data,
-	}, nil
+	return nil
 }
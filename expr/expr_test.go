@@ -11,10 +11,13 @@ import (
 func TestReadExpr(t *testing.T) {
 	t.Run("error", func(t *testing.T) {
 		for _, b := range [][]byte{
-			{}, {0xaa}, {0x41, 0x1}, {0x41, 0x01, 0x41}, // all invalid
+			{}, {0xaa}, {0x41, 0x1}, {0x41, 0x01, 0x41}, {0xfd, 0x0f, 0x0b}, // all invalid
+			{0x41, 0x01, 0x41, 0x02, 0x6d, 0x0b}, // i32.div_s is not constant
 		} {
 			_, err := expr.ReadExpression(bytes.NewReader(b))
-			t.Log(err)
+			if err == nil {
+				t.Fail()
+			}
 		}
 	})
 
@@ -31,10 +34,28 @@ func TestReadExpr(t *testing.T) {
 				bytes: []byte{0x43, 0x40, 0xe1, 0x47, 0x40, 0x0b},
 				exp:   &expr.Expression{OpCode: expr.OpCodeF32Const, Data: []byte{0x40, 0xe1, 0x47, 0x40}},
 			},
+			{
+				bytes: []byte{0xd2, 0x02, 0x0b},
+				exp:   &expr.Expression{OpCode: expr.OpCodeFunc, Data: []byte{0x02}},
+			},
+			{
+				bytes: []byte{0xd0, 0x70, 0x0b},
+				exp:   &expr.Expression{OpCode: expr.OpCodeNull, Data: []byte{0x70}},
+			},
 			{
 				bytes: []byte{0x23, 0x01, 0x0b},
 				exp:   &expr.Expression{OpCode: expr.OpCodeGlobalGet, Data: []byte{0x01}},
 			},
+			{
+				bytes: []byte{0xfd, 0x0c, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0b},
+				exp: &expr.Expression{OpCode: expr.OpCodeSIMDPrefix, Data: []byte{0x0c, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+					0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+			},
+			{
+				// (i32.add (global.get 0) (i32.mul (i32.const 2) (i32.const 3)))
+				bytes: []byte{0x23, 0x00, 0x41, 0x02, 0x41, 0x03, 0x6c, 0x6a, 0x0b},
+				exp:   &expr.Expression{OpCode: expr.OpCodeGlobalGet, Data: []byte{0x00, 0x41, 0x02, 0x41, 0x03, 0x6c, 0x6a}},
+			},
 		} {
 			actual, err := expr.ReadExpression(bytes.NewReader(c.bytes))
 			if err != nil {
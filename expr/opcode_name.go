@@ -19,9 +19,18 @@ func GetOpCodeName(op OpCode) string {
 			OpCodeCall:         "Call",
 			OpCodeCallIndirect: "CallIndirect",
 
+			OpCodeReturnCall:         "ReturnCall",
+			OpCodeReturnCallIndirect: "ReturnCallIndirect",
+
+			// exception handling instruction
+			OpCodeThrow:    "Throw",
+			OpCodeThrowRef: "ThrowRef",
+			OpCodeTryTable: "TryTable",
+
 			// parametric instruction
-			OpCodeDrop:   "Drop",
-			OpCodeSelect: "Select",
+			OpCodeDrop:    "Drop",
+			OpCodeSelect:  "Select",
+			OpCodeSelectT: "SelectT",
 
 			// variable instruction
 			OpCodeLocalGet:  "LocalGet",
@@ -30,6 +39,10 @@ func GetOpCodeName(op OpCode) string {
 			OpCodeGlobalGet: "GlobalGet",
 			OpCodeGlobalSet: "GlobalSet",
 
+			// table instruction
+			OpCodeTableGet: "TableGet",
+			OpCodeTableSet: "TableSet",
+
 			// memory instruction
 			OpCodeI32Load:    "I32Load",
 			OpCodeI64Load:    "I64Load",
@@ -208,9 +221,372 @@ func GetOpCodeName(op OpCode) string {
 			OpCodeNull:   "Null",
 			OpCodeIsNull: "IsNull",
 			OpCodeFunc:   "Func",
+
+			OpCodeMiscPrefix:   "MiscPrefix",
+			OpCodeSIMDPrefix:   "SIMDPrefix",
+			OpCodeAtomicPrefix: "AtomicPrefix",
 		}
 
 	}
 
 	return names[op]
 }
+
+var miscNames map[MiscOpCode]string // on load
+
+func GetMiscOpCodeName(op MiscOpCode) string {
+	if miscNames == nil {
+		miscNames = map[MiscOpCode]string{
+			// non-trapping float-to-int conversion
+			OpCodeI32TruncSatF32S: "I32TruncSatF32S",
+			OpCodeI32TruncSatF32U: "I32TruncSatF32U",
+			OpCodeI32TruncSatF64S: "I32TruncSatF64S",
+			OpCodeI32TruncSatF64U: "I32TruncSatF64U",
+			OpCodeI64TruncSatF32S: "I64TruncSatF32S",
+			OpCodeI64TruncSatF32U: "I64TruncSatF32U",
+			OpCodeI64TruncSatF64S: "I64TruncSatF64S",
+			OpCodeI64TruncSatF64U: "I64TruncSatF64U",
+
+			// bulk memory instruction
+			OpCodeMemoryInit: "MemoryInit",
+			OpCodeDataDrop:   "DataDrop",
+			OpCodeMemoryCopy: "MemoryCopy",
+			OpCodeMemoryFill: "MemoryFill",
+			OpCodeTableInit:  "TableInit",
+			OpCodeElemDrop:   "ElemDrop",
+			OpCodeTableCopy:  "TableCopy",
+
+			// table instruction
+			OpCodeTableGrow: "TableGrow",
+			OpCodeTableSize: "TableSize",
+			OpCodeTableFill: "TableFill",
+		}
+	}
+
+	return miscNames[op]
+}
+
+var simdNames map[SIMDOpCode]string // on load
+
+func GetSIMDOpCodeName(op SIMDOpCode) string {
+	if simdNames == nil {
+		simdNames = map[SIMDOpCode]string{
+			OpCodeV128Load:                  "V128Load",
+			OpCodeV128Load8x8S:              "V128Load8x8S",
+			OpCodeV128Load8x8U:              "V128Load8x8U",
+			OpCodeV128Load16x4S:             "V128Load16x4S",
+			OpCodeV128Load16x4U:             "V128Load16x4U",
+			OpCodeV128Load32x2S:             "V128Load32x2S",
+			OpCodeV128Load32x2U:             "V128Load32x2U",
+			OpCodeV128Load8Splat:            "V128Load8Splat",
+			OpCodeV128Load16Splat:           "V128Load16Splat",
+			OpCodeV128Load32Splat:           "V128Load32Splat",
+			OpCodeV128Load64Splat:           "V128Load64Splat",
+			OpCodeV128Store:                 "V128Store",
+			OpCodeV128Const:                 "V128Const",
+			OpCodeI8x16Shuffle:              "I8x16Shuffle",
+			OpCodeI8x16Swizzle:              "I8x16Swizzle",
+			OpCodeI8x16Splat:                "I8x16Splat",
+			OpCodeI16x8Splat:                "I16x8Splat",
+			OpCodeI32x4Splat:                "I32x4Splat",
+			OpCodeI64x2Splat:                "I64x2Splat",
+			OpCodeF32x4Splat:                "F32x4Splat",
+			OpCodeF64x2Splat:                "F64x2Splat",
+			OpCodeI8x16ExtractLaneS:         "I8x16ExtractLaneS",
+			OpCodeI8x16ExtractLaneU:         "I8x16ExtractLaneU",
+			OpCodeI8x16ReplaceLane:          "I8x16ReplaceLane",
+			OpCodeI16x8ExtractLaneS:         "I16x8ExtractLaneS",
+			OpCodeI16x8ExtractLaneU:         "I16x8ExtractLaneU",
+			OpCodeI16x8ReplaceLane:          "I16x8ReplaceLane",
+			OpCodeI32x4ExtractLane:          "I32x4ExtractLane",
+			OpCodeI32x4ReplaceLane:          "I32x4ReplaceLane",
+			OpCodeI64x2ExtractLane:          "I64x2ExtractLane",
+			OpCodeI64x2ReplaceLane:          "I64x2ReplaceLane",
+			OpCodeF32x4ExtractLane:          "F32x4ExtractLane",
+			OpCodeF32x4ReplaceLane:          "F32x4ReplaceLane",
+			OpCodeF64x2ExtractLane:          "F64x2ExtractLane",
+			OpCodeF64x2ReplaceLane:          "F64x2ReplaceLane",
+			OpCodeI8x16Eq:                   "I8x16Eq",
+			OpCodeI8x16Ne:                   "I8x16Ne",
+			OpCodeI8x16LtS:                  "I8x16LtS",
+			OpCodeI8x16LtU:                  "I8x16LtU",
+			OpCodeI8x16GtS:                  "I8x16GtS",
+			OpCodeI8x16GtU:                  "I8x16GtU",
+			OpCodeI8x16LeS:                  "I8x16LeS",
+			OpCodeI8x16LeU:                  "I8x16LeU",
+			OpCodeI8x16GeS:                  "I8x16GeS",
+			OpCodeI8x16GeU:                  "I8x16GeU",
+			OpCodeI16x8Eq:                   "I16x8Eq",
+			OpCodeI16x8Ne:                   "I16x8Ne",
+			OpCodeI16x8LtS:                  "I16x8LtS",
+			OpCodeI16x8LtU:                  "I16x8LtU",
+			OpCodeI16x8GtS:                  "I16x8GtS",
+			OpCodeI16x8GtU:                  "I16x8GtU",
+			OpCodeI16x8LeS:                  "I16x8LeS",
+			OpCodeI16x8LeU:                  "I16x8LeU",
+			OpCodeI16x8GeS:                  "I16x8GeS",
+			OpCodeI16x8GeU:                  "I16x8GeU",
+			OpCodeI32x4Eq:                   "I32x4Eq",
+			OpCodeI32x4Ne:                   "I32x4Ne",
+			OpCodeI32x4LtS:                  "I32x4LtS",
+			OpCodeI32x4LtU:                  "I32x4LtU",
+			OpCodeI32x4GtS:                  "I32x4GtS",
+			OpCodeI32x4GtU:                  "I32x4GtU",
+			OpCodeI32x4LeS:                  "I32x4LeS",
+			OpCodeI32x4LeU:                  "I32x4LeU",
+			OpCodeI32x4GeS:                  "I32x4GeS",
+			OpCodeI32x4GeU:                  "I32x4GeU",
+			OpCodeF32x4Eq:                   "F32x4Eq",
+			OpCodeF32x4Ne:                   "F32x4Ne",
+			OpCodeF32x4Lt:                   "F32x4Lt",
+			OpCodeF32x4Gt:                   "F32x4Gt",
+			OpCodeF32x4Le:                   "F32x4Le",
+			OpCodeF32x4Ge:                   "F32x4Ge",
+			OpCodeF64x2Eq:                   "F64x2Eq",
+			OpCodeF64x2Ne:                   "F64x2Ne",
+			OpCodeF64x2Lt:                   "F64x2Lt",
+			OpCodeF64x2Gt:                   "F64x2Gt",
+			OpCodeF64x2Le:                   "F64x2Le",
+			OpCodeF64x2Ge:                   "F64x2Ge",
+			OpCodeV128Not:                   "V128Not",
+			OpCodeV128And:                   "V128And",
+			OpCodeV128Andnot:                "V128Andnot",
+			OpCodeV128Or:                    "V128Or",
+			OpCodeV128Xor:                   "V128Xor",
+			OpCodeV128Bitselect:             "V128Bitselect",
+			OpCodeV128AnyTrue:               "V128AnyTrue",
+			OpCodeV128Load8Lane:             "V128Load8Lane",
+			OpCodeV128Load16Lane:            "V128Load16Lane",
+			OpCodeV128Load32Lane:            "V128Load32Lane",
+			OpCodeV128Load64Lane:            "V128Load64Lane",
+			OpCodeV128Store8Lane:            "V128Store8Lane",
+			OpCodeV128Store16Lane:           "V128Store16Lane",
+			OpCodeV128Store32Lane:           "V128Store32Lane",
+			OpCodeV128Store64Lane:           "V128Store64Lane",
+			OpCodeV128Load32Zero:            "V128Load32Zero",
+			OpCodeV128Load64Zero:            "V128Load64Zero",
+			OpCodeF32x4DemoteF64x2Zero:      "F32x4DemoteF64x2Zero",
+			OpCodeF64x2PromoteLowF32x4:      "F64x2PromoteLowF32x4",
+			OpCodeI8x16Abs:                  "I8x16Abs",
+			OpCodeI8x16Neg:                  "I8x16Neg",
+			OpCodeI8x16Popcnt:               "I8x16Popcnt",
+			OpCodeI8x16AllTrue:              "I8x16AllTrue",
+			OpCodeI8x16Bitmask:              "I8x16Bitmask",
+			OpCodeI8x16NarrowI16x8S:         "I8x16NarrowI16x8S",
+			OpCodeI8x16NarrowI16x8U:         "I8x16NarrowI16x8U",
+			OpCodeF32x4Ceil:                 "F32x4Ceil",
+			OpCodeF32x4Floor:                "F32x4Floor",
+			OpCodeF32x4Trunc:                "F32x4Trunc",
+			OpCodeF32x4Nearest:              "F32x4Nearest",
+			OpCodeI8x16Shl:                  "I8x16Shl",
+			OpCodeI8x16ShrS:                 "I8x16ShrS",
+			OpCodeI8x16ShrU:                 "I8x16ShrU",
+			OpCodeI8x16Add:                  "I8x16Add",
+			OpCodeI8x16AddSatS:              "I8x16AddSatS",
+			OpCodeI8x16AddSatU:              "I8x16AddSatU",
+			OpCodeI8x16Sub:                  "I8x16Sub",
+			OpCodeI8x16SubSatS:              "I8x16SubSatS",
+			OpCodeI8x16SubSatU:              "I8x16SubSatU",
+			OpCodeF64x2Ceil:                 "F64x2Ceil",
+			OpCodeF64x2Floor:                "F64x2Floor",
+			OpCodeI8x16MinS:                 "I8x16MinS",
+			OpCodeI8x16MinU:                 "I8x16MinU",
+			OpCodeI8x16MaxS:                 "I8x16MaxS",
+			OpCodeI8x16MaxU:                 "I8x16MaxU",
+			OpCodeF64x2Trunc:                "F64x2Trunc",
+			OpCodeI8x16AvgrU:                "I8x16AvgrU",
+			OpCodeI16x8ExtaddPairwiseI8x16S: "I16x8ExtaddPairwiseI8x16S",
+			OpCodeI16x8ExtaddPairwiseI8x16U: "I16x8ExtaddPairwiseI8x16U",
+			OpCodeI32x4ExtaddPairwiseI16x8S: "I32x4ExtaddPairwiseI16x8S",
+			OpCodeI32x4ExtaddPairwiseI16x8U: "I32x4ExtaddPairwiseI16x8U",
+			OpCodeI16x8Abs:                  "I16x8Abs",
+			OpCodeI16x8Neg:                  "I16x8Neg",
+			OpCodeI16x8Q15mulrSatS:          "I16x8Q15mulrSatS",
+			OpCodeI16x8AllTrue:              "I16x8AllTrue",
+			OpCodeI16x8Bitmask:              "I16x8Bitmask",
+			OpCodeI16x8NarrowI32x4S:         "I16x8NarrowI32x4S",
+			OpCodeI16x8NarrowI32x4U:         "I16x8NarrowI32x4U",
+			OpCodeI16x8ExtendLowI8x16S:      "I16x8ExtendLowI8x16S",
+			OpCodeI16x8ExtendHighI8x16S:     "I16x8ExtendHighI8x16S",
+			OpCodeI16x8ExtendLowI8x16U:      "I16x8ExtendLowI8x16U",
+			OpCodeI16x8ExtendHighI8x16U:     "I16x8ExtendHighI8x16U",
+			OpCodeI16x8Shl:                  "I16x8Shl",
+			OpCodeI16x8ShrS:                 "I16x8ShrS",
+			OpCodeI16x8ShrU:                 "I16x8ShrU",
+			OpCodeI16x8Add:                  "I16x8Add",
+			OpCodeI16x8AddSatS:              "I16x8AddSatS",
+			OpCodeI16x8AddSatU:              "I16x8AddSatU",
+			OpCodeI16x8Sub:                  "I16x8Sub",
+			OpCodeI16x8SubSatS:              "I16x8SubSatS",
+			OpCodeI16x8SubSatU:              "I16x8SubSatU",
+			OpCodeF64x2Nearest:              "F64x2Nearest",
+			OpCodeI16x8Mul:                  "I16x8Mul",
+			OpCodeI16x8MinS:                 "I16x8MinS",
+			OpCodeI16x8MinU:                 "I16x8MinU",
+			OpCodeI16x8MaxS:                 "I16x8MaxS",
+			OpCodeI16x8MaxU:                 "I16x8MaxU",
+			OpCodeI16x8AvgrU:                "I16x8AvgrU",
+			OpCodeI16x8ExtmulLowI8x16S:      "I16x8ExtmulLowI8x16S",
+			OpCodeI16x8ExtmulHighI8x16S:     "I16x8ExtmulHighI8x16S",
+			OpCodeI16x8ExtmulLowI8x16U:      "I16x8ExtmulLowI8x16U",
+			OpCodeI16x8ExtmulHighI8x16U:     "I16x8ExtmulHighI8x16U",
+			OpCodeI32x4Abs:                  "I32x4Abs",
+			OpCodeI32x4Neg:                  "I32x4Neg",
+			OpCodeI32x4AllTrue:              "I32x4AllTrue",
+			OpCodeI32x4Bitmask:              "I32x4Bitmask",
+			OpCodeI32x4ExtendLowI16x8S:      "I32x4ExtendLowI16x8S",
+			OpCodeI32x4ExtendHighI16x8S:     "I32x4ExtendHighI16x8S",
+			OpCodeI32x4ExtendLowI16x8U:      "I32x4ExtendLowI16x8U",
+			OpCodeI32x4ExtendHighI16x8U:     "I32x4ExtendHighI16x8U",
+			OpCodeI32x4Shl:                  "I32x4Shl",
+			OpCodeI32x4ShrS:                 "I32x4ShrS",
+			OpCodeI32x4ShrU:                 "I32x4ShrU",
+			OpCodeI32x4Add:                  "I32x4Add",
+			OpCodeI32x4Sub:                  "I32x4Sub",
+			OpCodeI32x4Mul:                  "I32x4Mul",
+			OpCodeI32x4MinS:                 "I32x4MinS",
+			OpCodeI32x4MinU:                 "I32x4MinU",
+			OpCodeI32x4MaxS:                 "I32x4MaxS",
+			OpCodeI32x4MaxU:                 "I32x4MaxU",
+			OpCodeI32x4DotI16x8S:            "I32x4DotI16x8S",
+			OpCodeI32x4ExtmulLowI16x8S:      "I32x4ExtmulLowI16x8S",
+			OpCodeI32x4ExtmulHighI16x8S:     "I32x4ExtmulHighI16x8S",
+			OpCodeI32x4ExtmulLowI16x8U:      "I32x4ExtmulLowI16x8U",
+			OpCodeI32x4ExtmulHighI16x8U:     "I32x4ExtmulHighI16x8U",
+			OpCodeI64x2Abs:                  "I64x2Abs",
+			OpCodeI64x2Neg:                  "I64x2Neg",
+			OpCodeI64x2AllTrue:              "I64x2AllTrue",
+			OpCodeI64x2Bitmask:              "I64x2Bitmask",
+			OpCodeI64x2ExtendLowI32x4S:      "I64x2ExtendLowI32x4S",
+			OpCodeI64x2ExtendHighI32x4S:     "I64x2ExtendHighI32x4S",
+			OpCodeI64x2ExtendLowI32x4U:      "I64x2ExtendLowI32x4U",
+			OpCodeI64x2ExtendHighI32x4U:     "I64x2ExtendHighI32x4U",
+			OpCodeI64x2Shl:                  "I64x2Shl",
+			OpCodeI64x2ShrS:                 "I64x2ShrS",
+			OpCodeI64x2ShrU:                 "I64x2ShrU",
+			OpCodeI64x2Add:                  "I64x2Add",
+			OpCodeI64x2Sub:                  "I64x2Sub",
+			OpCodeI64x2Mul:                  "I64x2Mul",
+			OpCodeI64x2Eq:                   "I64x2Eq",
+			OpCodeI64x2Ne:                   "I64x2Ne",
+			OpCodeI64x2LtS:                  "I64x2LtS",
+			OpCodeI64x2GtS:                  "I64x2GtS",
+			OpCodeI64x2LeS:                  "I64x2LeS",
+			OpCodeI64x2GeS:                  "I64x2GeS",
+			OpCodeI64x2ExtmulLowI32x4S:      "I64x2ExtmulLowI32x4S",
+			OpCodeI64x2ExtmulHighI32x4S:     "I64x2ExtmulHighI32x4S",
+			OpCodeI64x2ExtmulLowI32x4U:      "I64x2ExtmulLowI32x4U",
+			OpCodeI64x2ExtmulHighI32x4U:     "I64x2ExtmulHighI32x4U",
+			OpCodeF32x4Abs:                  "F32x4Abs",
+			OpCodeF32x4Neg:                  "F32x4Neg",
+			OpCodeF32x4Sqrt:                 "F32x4Sqrt",
+			OpCodeF32x4Add:                  "F32x4Add",
+			OpCodeF32x4Sub:                  "F32x4Sub",
+			OpCodeF32x4Mul:                  "F32x4Mul",
+			OpCodeF32x4Div:                  "F32x4Div",
+			OpCodeF32x4Min:                  "F32x4Min",
+			OpCodeF32x4Max:                  "F32x4Max",
+			OpCodeF32x4Pmin:                 "F32x4Pmin",
+			OpCodeF32x4Pmax:                 "F32x4Pmax",
+			OpCodeF64x2Abs:                  "F64x2Abs",
+			OpCodeF64x2Neg:                  "F64x2Neg",
+			OpCodeF64x2Sqrt:                 "F64x2Sqrt",
+			OpCodeF64x2Add:                  "F64x2Add",
+			OpCodeF64x2Sub:                  "F64x2Sub",
+			OpCodeF64x2Mul:                  "F64x2Mul",
+			OpCodeF64x2Div:                  "F64x2Div",
+			OpCodeF64x2Min:                  "F64x2Min",
+			OpCodeF64x2Max:                  "F64x2Max",
+			OpCodeF64x2Pmin:                 "F64x2Pmin",
+			OpCodeF64x2Pmax:                 "F64x2Pmax",
+			OpCodeI32x4TruncSatF32x4S:       "I32x4TruncSatF32x4S",
+			OpCodeI32x4TruncSatF32x4U:       "I32x4TruncSatF32x4U",
+			OpCodeF32x4ConvertI32x4S:        "F32x4ConvertI32x4S",
+			OpCodeF32x4ConvertI32x4U:        "F32x4ConvertI32x4U",
+			OpCodeI32x4TruncSatF64x2SZero:   "I32x4TruncSatF64x2SZero",
+			OpCodeI32x4TruncSatF64x2UZero:   "I32x4TruncSatF64x2UZero",
+			OpCodeF64x2ConvertLowI32x4S:     "F64x2ConvertLowI32x4S",
+			OpCodeF64x2ConvertLowI32x4U:     "F64x2ConvertLowI32x4U",
+		}
+	}
+
+	return simdNames[op]
+}
+
+var atomicNames map[AtomicOpCode]string // on load
+
+func GetAtomicOpCodeName(op AtomicOpCode) string {
+	if atomicNames == nil {
+		atomicNames = map[AtomicOpCode]string{
+			OpCodeMemoryAtomicNotify:     "MemoryAtomicNotify",
+			OpCodeMemoryAtomicWait32:     "MemoryAtomicWait32",
+			OpCodeMemoryAtomicWait64:     "MemoryAtomicWait64",
+			OpCodeAtomicFence:            "AtomicFence",
+			OpCodeI32AtomicLoad:          "I32AtomicLoad",
+			OpCodeI64AtomicLoad:          "I64AtomicLoad",
+			OpCodeI32AtomicLoad8U:        "I32AtomicLoad8U",
+			OpCodeI32AtomicLoad16U:       "I32AtomicLoad16U",
+			OpCodeI64AtomicLoad8U:        "I64AtomicLoad8U",
+			OpCodeI64AtomicLoad16U:       "I64AtomicLoad16U",
+			OpCodeI64AtomicLoad32U:       "I64AtomicLoad32U",
+			OpCodeI32AtomicStore:         "I32AtomicStore",
+			OpCodeI64AtomicStore:         "I64AtomicStore",
+			OpCodeI32AtomicStore8:        "I32AtomicStore8",
+			OpCodeI32AtomicStore16:       "I32AtomicStore16",
+			OpCodeI64AtomicStore8:        "I64AtomicStore8",
+			OpCodeI64AtomicStore16:       "I64AtomicStore16",
+			OpCodeI64AtomicStore32:       "I64AtomicStore32",
+			OpCodeI32AtomicRmwAdd:        "I32AtomicRmwAdd",
+			OpCodeI64AtomicRmwAdd:        "I64AtomicRmwAdd",
+			OpCodeI32AtomicRmw8AddU:      "I32AtomicRmw8AddU",
+			OpCodeI32AtomicRmw16AddU:     "I32AtomicRmw16AddU",
+			OpCodeI64AtomicRmw8AddU:      "I64AtomicRmw8AddU",
+			OpCodeI64AtomicRmw16AddU:     "I64AtomicRmw16AddU",
+			OpCodeI64AtomicRmw32AddU:     "I64AtomicRmw32AddU",
+			OpCodeI32AtomicRmwSub:        "I32AtomicRmwSub",
+			OpCodeI64AtomicRmwSub:        "I64AtomicRmwSub",
+			OpCodeI32AtomicRmw8SubU:      "I32AtomicRmw8SubU",
+			OpCodeI32AtomicRmw16SubU:     "I32AtomicRmw16SubU",
+			OpCodeI64AtomicRmw8SubU:      "I64AtomicRmw8SubU",
+			OpCodeI64AtomicRmw16SubU:     "I64AtomicRmw16SubU",
+			OpCodeI64AtomicRmw32SubU:     "I64AtomicRmw32SubU",
+			OpCodeI32AtomicRmwAnd:        "I32AtomicRmwAnd",
+			OpCodeI64AtomicRmwAnd:        "I64AtomicRmwAnd",
+			OpCodeI32AtomicRmw8AndU:      "I32AtomicRmw8AndU",
+			OpCodeI32AtomicRmw16AndU:     "I32AtomicRmw16AndU",
+			OpCodeI64AtomicRmw8AndU:      "I64AtomicRmw8AndU",
+			OpCodeI64AtomicRmw16AndU:     "I64AtomicRmw16AndU",
+			OpCodeI64AtomicRmw32AndU:     "I64AtomicRmw32AndU",
+			OpCodeI32AtomicRmwOr:         "I32AtomicRmwOr",
+			OpCodeI64AtomicRmwOr:         "I64AtomicRmwOr",
+			OpCodeI32AtomicRmw8OrU:       "I32AtomicRmw8OrU",
+			OpCodeI32AtomicRmw16OrU:      "I32AtomicRmw16OrU",
+			OpCodeI64AtomicRmw8OrU:       "I64AtomicRmw8OrU",
+			OpCodeI64AtomicRmw16OrU:      "I64AtomicRmw16OrU",
+			OpCodeI64AtomicRmw32OrU:      "I64AtomicRmw32OrU",
+			OpCodeI32AtomicRmwXor:        "I32AtomicRmwXor",
+			OpCodeI64AtomicRmwXor:        "I64AtomicRmwXor",
+			OpCodeI32AtomicRmw8XorU:      "I32AtomicRmw8XorU",
+			OpCodeI32AtomicRmw16XorU:     "I32AtomicRmw16XorU",
+			OpCodeI64AtomicRmw8XorU:      "I64AtomicRmw8XorU",
+			OpCodeI64AtomicRmw16XorU:     "I64AtomicRmw16XorU",
+			OpCodeI64AtomicRmw32XorU:     "I64AtomicRmw32XorU",
+			OpCodeI32AtomicRmwXchg:       "I32AtomicRmwXchg",
+			OpCodeI64AtomicRmwXchg:       "I64AtomicRmwXchg",
+			OpCodeI32AtomicRmw8XchgU:     "I32AtomicRmw8XchgU",
+			OpCodeI32AtomicRmw16XchgU:    "I32AtomicRmw16XchgU",
+			OpCodeI64AtomicRmw8XchgU:     "I64AtomicRmw8XchgU",
+			OpCodeI64AtomicRmw16XchgU:    "I64AtomicRmw16XchgU",
+			OpCodeI64AtomicRmw32XchgU:    "I64AtomicRmw32XchgU",
+			OpCodeI32AtomicRmwCmpxchg:    "I32AtomicRmwCmpxchg",
+			OpCodeI64AtomicRmwCmpxchg:    "I64AtomicRmwCmpxchg",
+			OpCodeI32AtomicRmw8CmpxchgU:  "I32AtomicRmw8CmpxchgU",
+			OpCodeI32AtomicRmw16CmpxchgU: "I32AtomicRmw16CmpxchgU",
+			OpCodeI64AtomicRmw8CmpxchgU:  "I64AtomicRmw8CmpxchgU",
+			OpCodeI64AtomicRmw16CmpxchgU: "I64AtomicRmw16CmpxchgU",
+			OpCodeI64AtomicRmw32CmpxchgU: "I64AtomicRmw32CmpxchgU",
+		}
+	}
+
+	return atomicNames[op]
+}
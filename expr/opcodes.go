@@ -18,9 +18,19 @@ const (
 	OpCodeCall         OpCode = 0x10
 	OpCodeCallIndirect OpCode = 0x11
 
+	// tail call instruction
+	OpCodeReturnCall         OpCode = 0x12
+	OpCodeReturnCallIndirect OpCode = 0x13
+
+	// exception handling instruction
+	OpCodeThrow    OpCode = 0x08
+	OpCodeThrowRef OpCode = 0x0a
+	OpCodeTryTable OpCode = 0x1f
+
 	// parametric instruction
-	OpCodeDrop   OpCode = 0x1a
-	OpCodeSelect OpCode = 0x1b
+	OpCodeDrop    OpCode = 0x1a
+	OpCodeSelect  OpCode = 0x1b
+	OpCodeSelectT OpCode = 0x1c // select with the explicit value types
 
 	// variable instruction
 	OpCodeLocalGet  OpCode = 0x20
@@ -29,6 +39,10 @@ const (
 	OpCodeGlobalGet OpCode = 0x23
 	OpCodeGlobalSet OpCode = 0x24
 
+	// table instruction
+	OpCodeTableGet OpCode = 0x25
+	OpCodeTableSet OpCode = 0x26
+
 	// memory instruction
 	OpCodeI32Load    OpCode = 0x28
 	OpCodeI64Load    OpCode = 0x29
@@ -208,5 +222,366 @@ const (
 	OpCodeIsNull OpCode = 0xd1
 	OpCodeFunc   OpCode = 0xd2
 
-	// TODO: 0xfc
+	// OpCodeMiscPrefix leads the instructions which are identified by a following MiscOpCode
+	OpCodeMiscPrefix OpCode = 0xfc
+	// OpCodeSIMDPrefix leads the instructions which are identified by a following SIMDOpCode
+	OpCodeSIMDPrefix OpCode = 0xfd
+	// OpCodeAtomicPrefix leads the instructions which are identified by a following AtomicOpCode
+	OpCodeAtomicPrefix OpCode = 0xfe
+)
+
+// CatchKind is the kind of a catch clause of the try_table, which tells what is caught and passed to its label
+type CatchKind = byte
+
+const (
+	CatchKindCatch       CatchKind = 0x00 // catches the tag and passes the payload
+	CatchKindCatchRef    CatchKind = 0x01 // catches the tag and passes the payload and the exnref
+	CatchKindCatchAll    CatchKind = 0x02 // catches any exception and passes nothing
+	CatchKindCatchAllRef CatchKind = 0x03 // catches any exception and passes the exnref
+)
+
+// MiscOpCode is the sub opcode following the OpCodeMiscPrefix, encoded as an u32 in the binary
+type MiscOpCode = uint32
+
+const (
+	// non-trapping float-to-int conversion
+	OpCodeI32TruncSatF32S MiscOpCode = 0x00
+	OpCodeI32TruncSatF32U MiscOpCode = 0x01
+	OpCodeI32TruncSatF64S MiscOpCode = 0x02
+	OpCodeI32TruncSatF64U MiscOpCode = 0x03
+	OpCodeI64TruncSatF32S MiscOpCode = 0x04
+	OpCodeI64TruncSatF32U MiscOpCode = 0x05
+	OpCodeI64TruncSatF64S MiscOpCode = 0x06
+	OpCodeI64TruncSatF64U MiscOpCode = 0x07
+
+	// bulk memory instruction
+	OpCodeMemoryInit MiscOpCode = 0x08
+	OpCodeDataDrop   MiscOpCode = 0x09
+	OpCodeMemoryCopy MiscOpCode = 0x0a
+	OpCodeMemoryFill MiscOpCode = 0x0b
+	OpCodeTableInit  MiscOpCode = 0x0c
+	OpCodeElemDrop   MiscOpCode = 0x0d
+	OpCodeTableCopy  MiscOpCode = 0x0e
+
+	// table instruction
+	OpCodeTableGrow MiscOpCode = 0x0f
+	OpCodeTableSize MiscOpCode = 0x10
+	OpCodeTableFill MiscOpCode = 0x11
+)
+
+// SIMDOpCode is the sub opcode following the OpCodeSIMDPrefix, encoded as an u32 in the binary
+type SIMDOpCode = uint32
+
+// fixed-width SIMD instruction
+const (
+	OpCodeV128Load                  SIMDOpCode = 0x00
+	OpCodeV128Load8x8S              SIMDOpCode = 0x01
+	OpCodeV128Load8x8U              SIMDOpCode = 0x02
+	OpCodeV128Load16x4S             SIMDOpCode = 0x03
+	OpCodeV128Load16x4U             SIMDOpCode = 0x04
+	OpCodeV128Load32x2S             SIMDOpCode = 0x05
+	OpCodeV128Load32x2U             SIMDOpCode = 0x06
+	OpCodeV128Load8Splat            SIMDOpCode = 0x07
+	OpCodeV128Load16Splat           SIMDOpCode = 0x08
+	OpCodeV128Load32Splat           SIMDOpCode = 0x09
+	OpCodeV128Load64Splat           SIMDOpCode = 0x0a
+	OpCodeV128Store                 SIMDOpCode = 0x0b
+	OpCodeV128Const                 SIMDOpCode = 0x0c
+	OpCodeI8x16Shuffle              SIMDOpCode = 0x0d
+	OpCodeI8x16Swizzle              SIMDOpCode = 0x0e
+	OpCodeI8x16Splat                SIMDOpCode = 0x0f
+	OpCodeI16x8Splat                SIMDOpCode = 0x10
+	OpCodeI32x4Splat                SIMDOpCode = 0x11
+	OpCodeI64x2Splat                SIMDOpCode = 0x12
+	OpCodeF32x4Splat                SIMDOpCode = 0x13
+	OpCodeF64x2Splat                SIMDOpCode = 0x14
+	OpCodeI8x16ExtractLaneS         SIMDOpCode = 0x15
+	OpCodeI8x16ExtractLaneU         SIMDOpCode = 0x16
+	OpCodeI8x16ReplaceLane          SIMDOpCode = 0x17
+	OpCodeI16x8ExtractLaneS         SIMDOpCode = 0x18
+	OpCodeI16x8ExtractLaneU         SIMDOpCode = 0x19
+	OpCodeI16x8ReplaceLane          SIMDOpCode = 0x1a
+	OpCodeI32x4ExtractLane          SIMDOpCode = 0x1b
+	OpCodeI32x4ReplaceLane          SIMDOpCode = 0x1c
+	OpCodeI64x2ExtractLane          SIMDOpCode = 0x1d
+	OpCodeI64x2ReplaceLane          SIMDOpCode = 0x1e
+	OpCodeF32x4ExtractLane          SIMDOpCode = 0x1f
+	OpCodeF32x4ReplaceLane          SIMDOpCode = 0x20
+	OpCodeF64x2ExtractLane          SIMDOpCode = 0x21
+	OpCodeF64x2ReplaceLane          SIMDOpCode = 0x22
+	OpCodeI8x16Eq                   SIMDOpCode = 0x23
+	OpCodeI8x16Ne                   SIMDOpCode = 0x24
+	OpCodeI8x16LtS                  SIMDOpCode = 0x25
+	OpCodeI8x16LtU                  SIMDOpCode = 0x26
+	OpCodeI8x16GtS                  SIMDOpCode = 0x27
+	OpCodeI8x16GtU                  SIMDOpCode = 0x28
+	OpCodeI8x16LeS                  SIMDOpCode = 0x29
+	OpCodeI8x16LeU                  SIMDOpCode = 0x2a
+	OpCodeI8x16GeS                  SIMDOpCode = 0x2b
+	OpCodeI8x16GeU                  SIMDOpCode = 0x2c
+	OpCodeI16x8Eq                   SIMDOpCode = 0x2d
+	OpCodeI16x8Ne                   SIMDOpCode = 0x2e
+	OpCodeI16x8LtS                  SIMDOpCode = 0x2f
+	OpCodeI16x8LtU                  SIMDOpCode = 0x30
+	OpCodeI16x8GtS                  SIMDOpCode = 0x31
+	OpCodeI16x8GtU                  SIMDOpCode = 0x32
+	OpCodeI16x8LeS                  SIMDOpCode = 0x33
+	OpCodeI16x8LeU                  SIMDOpCode = 0x34
+	OpCodeI16x8GeS                  SIMDOpCode = 0x35
+	OpCodeI16x8GeU                  SIMDOpCode = 0x36
+	OpCodeI32x4Eq                   SIMDOpCode = 0x37
+	OpCodeI32x4Ne                   SIMDOpCode = 0x38
+	OpCodeI32x4LtS                  SIMDOpCode = 0x39
+	OpCodeI32x4LtU                  SIMDOpCode = 0x3a
+	OpCodeI32x4GtS                  SIMDOpCode = 0x3b
+	OpCodeI32x4GtU                  SIMDOpCode = 0x3c
+	OpCodeI32x4LeS                  SIMDOpCode = 0x3d
+	OpCodeI32x4LeU                  SIMDOpCode = 0x3e
+	OpCodeI32x4GeS                  SIMDOpCode = 0x3f
+	OpCodeI32x4GeU                  SIMDOpCode = 0x40
+	OpCodeF32x4Eq                   SIMDOpCode = 0x41
+	OpCodeF32x4Ne                   SIMDOpCode = 0x42
+	OpCodeF32x4Lt                   SIMDOpCode = 0x43
+	OpCodeF32x4Gt                   SIMDOpCode = 0x44
+	OpCodeF32x4Le                   SIMDOpCode = 0x45
+	OpCodeF32x4Ge                   SIMDOpCode = 0x46
+	OpCodeF64x2Eq                   SIMDOpCode = 0x47
+	OpCodeF64x2Ne                   SIMDOpCode = 0x48
+	OpCodeF64x2Lt                   SIMDOpCode = 0x49
+	OpCodeF64x2Gt                   SIMDOpCode = 0x4a
+	OpCodeF64x2Le                   SIMDOpCode = 0x4b
+	OpCodeF64x2Ge                   SIMDOpCode = 0x4c
+	OpCodeV128Not                   SIMDOpCode = 0x4d
+	OpCodeV128And                   SIMDOpCode = 0x4e
+	OpCodeV128Andnot                SIMDOpCode = 0x4f
+	OpCodeV128Or                    SIMDOpCode = 0x50
+	OpCodeV128Xor                   SIMDOpCode = 0x51
+	OpCodeV128Bitselect             SIMDOpCode = 0x52
+	OpCodeV128AnyTrue               SIMDOpCode = 0x53
+	OpCodeV128Load8Lane             SIMDOpCode = 0x54
+	OpCodeV128Load16Lane            SIMDOpCode = 0x55
+	OpCodeV128Load32Lane            SIMDOpCode = 0x56
+	OpCodeV128Load64Lane            SIMDOpCode = 0x57
+	OpCodeV128Store8Lane            SIMDOpCode = 0x58
+	OpCodeV128Store16Lane           SIMDOpCode = 0x59
+	OpCodeV128Store32Lane           SIMDOpCode = 0x5a
+	OpCodeV128Store64Lane           SIMDOpCode = 0x5b
+	OpCodeV128Load32Zero            SIMDOpCode = 0x5c
+	OpCodeV128Load64Zero            SIMDOpCode = 0x5d
+	OpCodeF32x4DemoteF64x2Zero      SIMDOpCode = 0x5e
+	OpCodeF64x2PromoteLowF32x4      SIMDOpCode = 0x5f
+	OpCodeI8x16Abs                  SIMDOpCode = 0x60
+	OpCodeI8x16Neg                  SIMDOpCode = 0x61
+	OpCodeI8x16Popcnt               SIMDOpCode = 0x62
+	OpCodeI8x16AllTrue              SIMDOpCode = 0x63
+	OpCodeI8x16Bitmask              SIMDOpCode = 0x64
+	OpCodeI8x16NarrowI16x8S         SIMDOpCode = 0x65
+	OpCodeI8x16NarrowI16x8U         SIMDOpCode = 0x66
+	OpCodeF32x4Ceil                 SIMDOpCode = 0x67
+	OpCodeF32x4Floor                SIMDOpCode = 0x68
+	OpCodeF32x4Trunc                SIMDOpCode = 0x69
+	OpCodeF32x4Nearest              SIMDOpCode = 0x6a
+	OpCodeI8x16Shl                  SIMDOpCode = 0x6b
+	OpCodeI8x16ShrS                 SIMDOpCode = 0x6c
+	OpCodeI8x16ShrU                 SIMDOpCode = 0x6d
+	OpCodeI8x16Add                  SIMDOpCode = 0x6e
+	OpCodeI8x16AddSatS              SIMDOpCode = 0x6f
+	OpCodeI8x16AddSatU              SIMDOpCode = 0x70
+	OpCodeI8x16Sub                  SIMDOpCode = 0x71
+	OpCodeI8x16SubSatS              SIMDOpCode = 0x72
+	OpCodeI8x16SubSatU              SIMDOpCode = 0x73
+	OpCodeF64x2Ceil                 SIMDOpCode = 0x74
+	OpCodeF64x2Floor                SIMDOpCode = 0x75
+	OpCodeI8x16MinS                 SIMDOpCode = 0x76
+	OpCodeI8x16MinU                 SIMDOpCode = 0x77
+	OpCodeI8x16MaxS                 SIMDOpCode = 0x78
+	OpCodeI8x16MaxU                 SIMDOpCode = 0x79
+	OpCodeF64x2Trunc                SIMDOpCode = 0x7a
+	OpCodeI8x16AvgrU                SIMDOpCode = 0x7b
+	OpCodeI16x8ExtaddPairwiseI8x16S SIMDOpCode = 0x7c
+	OpCodeI16x8ExtaddPairwiseI8x16U SIMDOpCode = 0x7d
+	OpCodeI32x4ExtaddPairwiseI16x8S SIMDOpCode = 0x7e
+	OpCodeI32x4ExtaddPairwiseI16x8U SIMDOpCode = 0x7f
+	OpCodeI16x8Abs                  SIMDOpCode = 0x80
+	OpCodeI16x8Neg                  SIMDOpCode = 0x81
+	OpCodeI16x8Q15mulrSatS          SIMDOpCode = 0x82
+	OpCodeI16x8AllTrue              SIMDOpCode = 0x83
+	OpCodeI16x8Bitmask              SIMDOpCode = 0x84
+	OpCodeI16x8NarrowI32x4S         SIMDOpCode = 0x85
+	OpCodeI16x8NarrowI32x4U         SIMDOpCode = 0x86
+	OpCodeI16x8ExtendLowI8x16S      SIMDOpCode = 0x87
+	OpCodeI16x8ExtendHighI8x16S     SIMDOpCode = 0x88
+	OpCodeI16x8ExtendLowI8x16U      SIMDOpCode = 0x89
+	OpCodeI16x8ExtendHighI8x16U     SIMDOpCode = 0x8a
+	OpCodeI16x8Shl                  SIMDOpCode = 0x8b
+	OpCodeI16x8ShrS                 SIMDOpCode = 0x8c
+	OpCodeI16x8ShrU                 SIMDOpCode = 0x8d
+	OpCodeI16x8Add                  SIMDOpCode = 0x8e
+	OpCodeI16x8AddSatS              SIMDOpCode = 0x8f
+	OpCodeI16x8AddSatU              SIMDOpCode = 0x90
+	OpCodeI16x8Sub                  SIMDOpCode = 0x91
+	OpCodeI16x8SubSatS              SIMDOpCode = 0x92
+	OpCodeI16x8SubSatU              SIMDOpCode = 0x93
+	OpCodeF64x2Nearest              SIMDOpCode = 0x94
+	OpCodeI16x8Mul                  SIMDOpCode = 0x95
+	OpCodeI16x8MinS                 SIMDOpCode = 0x96
+	OpCodeI16x8MinU                 SIMDOpCode = 0x97
+	OpCodeI16x8MaxS                 SIMDOpCode = 0x98
+	OpCodeI16x8MaxU                 SIMDOpCode = 0x99
+	OpCodeI16x8AvgrU                SIMDOpCode = 0x9b
+	OpCodeI16x8ExtmulLowI8x16S      SIMDOpCode = 0x9c
+	OpCodeI16x8ExtmulHighI8x16S     SIMDOpCode = 0x9d
+	OpCodeI16x8ExtmulLowI8x16U      SIMDOpCode = 0x9e
+	OpCodeI16x8ExtmulHighI8x16U     SIMDOpCode = 0x9f
+	OpCodeI32x4Abs                  SIMDOpCode = 0xa0
+	OpCodeI32x4Neg                  SIMDOpCode = 0xa1
+	OpCodeI32x4AllTrue              SIMDOpCode = 0xa3
+	OpCodeI32x4Bitmask              SIMDOpCode = 0xa4
+	OpCodeI32x4ExtendLowI16x8S      SIMDOpCode = 0xa7
+	OpCodeI32x4ExtendHighI16x8S     SIMDOpCode = 0xa8
+	OpCodeI32x4ExtendLowI16x8U      SIMDOpCode = 0xa9
+	OpCodeI32x4ExtendHighI16x8U     SIMDOpCode = 0xaa
+	OpCodeI32x4Shl                  SIMDOpCode = 0xab
+	OpCodeI32x4ShrS                 SIMDOpCode = 0xac
+	OpCodeI32x4ShrU                 SIMDOpCode = 0xad
+	OpCodeI32x4Add                  SIMDOpCode = 0xae
+	OpCodeI32x4Sub                  SIMDOpCode = 0xb1
+	OpCodeI32x4Mul                  SIMDOpCode = 0xb5
+	OpCodeI32x4MinS                 SIMDOpCode = 0xb6
+	OpCodeI32x4MinU                 SIMDOpCode = 0xb7
+	OpCodeI32x4MaxS                 SIMDOpCode = 0xb8
+	OpCodeI32x4MaxU                 SIMDOpCode = 0xb9
+	OpCodeI32x4DotI16x8S            SIMDOpCode = 0xba
+	OpCodeI32x4ExtmulLowI16x8S      SIMDOpCode = 0xbc
+	OpCodeI32x4ExtmulHighI16x8S     SIMDOpCode = 0xbd
+	OpCodeI32x4ExtmulLowI16x8U      SIMDOpCode = 0xbe
+	OpCodeI32x4ExtmulHighI16x8U     SIMDOpCode = 0xbf
+	OpCodeI64x2Abs                  SIMDOpCode = 0xc0
+	OpCodeI64x2Neg                  SIMDOpCode = 0xc1
+	OpCodeI64x2AllTrue              SIMDOpCode = 0xc3
+	OpCodeI64x2Bitmask              SIMDOpCode = 0xc4
+	OpCodeI64x2ExtendLowI32x4S      SIMDOpCode = 0xc7
+	OpCodeI64x2ExtendHighI32x4S     SIMDOpCode = 0xc8
+	OpCodeI64x2ExtendLowI32x4U      SIMDOpCode = 0xc9
+	OpCodeI64x2ExtendHighI32x4U     SIMDOpCode = 0xca
+	OpCodeI64x2Shl                  SIMDOpCode = 0xcb
+	OpCodeI64x2ShrS                 SIMDOpCode = 0xcc
+	OpCodeI64x2ShrU                 SIMDOpCode = 0xcd
+	OpCodeI64x2Add                  SIMDOpCode = 0xce
+	OpCodeI64x2Sub                  SIMDOpCode = 0xd1
+	OpCodeI64x2Mul                  SIMDOpCode = 0xd5
+	OpCodeI64x2Eq                   SIMDOpCode = 0xd6
+	OpCodeI64x2Ne                   SIMDOpCode = 0xd7
+	OpCodeI64x2LtS                  SIMDOpCode = 0xd8
+	OpCodeI64x2GtS                  SIMDOpCode = 0xd9
+	OpCodeI64x2LeS                  SIMDOpCode = 0xda
+	OpCodeI64x2GeS                  SIMDOpCode = 0xdb
+	OpCodeI64x2ExtmulLowI32x4S      SIMDOpCode = 0xdc
+	OpCodeI64x2ExtmulHighI32x4S     SIMDOpCode = 0xdd
+	OpCodeI64x2ExtmulLowI32x4U      SIMDOpCode = 0xde
+	OpCodeI64x2ExtmulHighI32x4U     SIMDOpCode = 0xdf
+	OpCodeF32x4Abs                  SIMDOpCode = 0xe0
+	OpCodeF32x4Neg                  SIMDOpCode = 0xe1
+	OpCodeF32x4Sqrt                 SIMDOpCode = 0xe3
+	OpCodeF32x4Add                  SIMDOpCode = 0xe4
+	OpCodeF32x4Sub                  SIMDOpCode = 0xe5
+	OpCodeF32x4Mul                  SIMDOpCode = 0xe6
+	OpCodeF32x4Div                  SIMDOpCode = 0xe7
+	OpCodeF32x4Min                  SIMDOpCode = 0xe8
+	OpCodeF32x4Max                  SIMDOpCode = 0xe9
+	OpCodeF32x4Pmin                 SIMDOpCode = 0xea
+	OpCodeF32x4Pmax                 SIMDOpCode = 0xeb
+	OpCodeF64x2Abs                  SIMDOpCode = 0xec
+	OpCodeF64x2Neg                  SIMDOpCode = 0xed
+	OpCodeF64x2Sqrt                 SIMDOpCode = 0xef
+	OpCodeF64x2Add                  SIMDOpCode = 0xf0
+	OpCodeF64x2Sub                  SIMDOpCode = 0xf1
+	OpCodeF64x2Mul                  SIMDOpCode = 0xf2
+	OpCodeF64x2Div                  SIMDOpCode = 0xf3
+	OpCodeF64x2Min                  SIMDOpCode = 0xf4
+	OpCodeF64x2Max                  SIMDOpCode = 0xf5
+	OpCodeF64x2Pmin                 SIMDOpCode = 0xf6
+	OpCodeF64x2Pmax                 SIMDOpCode = 0xf7
+	OpCodeI32x4TruncSatF32x4S       SIMDOpCode = 0xf8
+	OpCodeI32x4TruncSatF32x4U       SIMDOpCode = 0xf9
+	OpCodeF32x4ConvertI32x4S        SIMDOpCode = 0xfa
+	OpCodeF32x4ConvertI32x4U        SIMDOpCode = 0xfb
+	OpCodeI32x4TruncSatF64x2SZero   SIMDOpCode = 0xfc
+	OpCodeI32x4TruncSatF64x2UZero   SIMDOpCode = 0xfd
+	OpCodeF64x2ConvertLowI32x4S     SIMDOpCode = 0xfe
+	OpCodeF64x2ConvertLowI32x4U     SIMDOpCode = 0xff
+)
+
+// AtomicOpCode is the sub opcode following the OpCodeAtomicPrefix, encoded as an u32 in the binary
+type AtomicOpCode = uint32
+
+// threads and atomic instruction
+const (
+	OpCodeMemoryAtomicNotify     AtomicOpCode = 0x00
+	OpCodeMemoryAtomicWait32     AtomicOpCode = 0x01
+	OpCodeMemoryAtomicWait64     AtomicOpCode = 0x02
+	OpCodeAtomicFence            AtomicOpCode = 0x03
+	OpCodeI32AtomicLoad          AtomicOpCode = 0x10
+	OpCodeI64AtomicLoad          AtomicOpCode = 0x11
+	OpCodeI32AtomicLoad8U        AtomicOpCode = 0x12
+	OpCodeI32AtomicLoad16U       AtomicOpCode = 0x13
+	OpCodeI64AtomicLoad8U        AtomicOpCode = 0x14
+	OpCodeI64AtomicLoad16U       AtomicOpCode = 0x15
+	OpCodeI64AtomicLoad32U       AtomicOpCode = 0x16
+	OpCodeI32AtomicStore         AtomicOpCode = 0x17
+	OpCodeI64AtomicStore         AtomicOpCode = 0x18
+	OpCodeI32AtomicStore8        AtomicOpCode = 0x19
+	OpCodeI32AtomicStore16       AtomicOpCode = 0x1a
+	OpCodeI64AtomicStore8        AtomicOpCode = 0x1b
+	OpCodeI64AtomicStore16       AtomicOpCode = 0x1c
+	OpCodeI64AtomicStore32       AtomicOpCode = 0x1d
+	OpCodeI32AtomicRmwAdd        AtomicOpCode = 0x1e
+	OpCodeI64AtomicRmwAdd        AtomicOpCode = 0x1f
+	OpCodeI32AtomicRmw8AddU      AtomicOpCode = 0x20
+	OpCodeI32AtomicRmw16AddU     AtomicOpCode = 0x21
+	OpCodeI64AtomicRmw8AddU      AtomicOpCode = 0x22
+	OpCodeI64AtomicRmw16AddU     AtomicOpCode = 0x23
+	OpCodeI64AtomicRmw32AddU     AtomicOpCode = 0x24
+	OpCodeI32AtomicRmwSub        AtomicOpCode = 0x25
+	OpCodeI64AtomicRmwSub        AtomicOpCode = 0x26
+	OpCodeI32AtomicRmw8SubU      AtomicOpCode = 0x27
+	OpCodeI32AtomicRmw16SubU     AtomicOpCode = 0x28
+	OpCodeI64AtomicRmw8SubU      AtomicOpCode = 0x29
+	OpCodeI64AtomicRmw16SubU     AtomicOpCode = 0x2a
+	OpCodeI64AtomicRmw32SubU     AtomicOpCode = 0x2b
+	OpCodeI32AtomicRmwAnd        AtomicOpCode = 0x2c
+	OpCodeI64AtomicRmwAnd        AtomicOpCode = 0x2d
+	OpCodeI32AtomicRmw8AndU      AtomicOpCode = 0x2e
+	OpCodeI32AtomicRmw16AndU     AtomicOpCode = 0x2f
+	OpCodeI64AtomicRmw8AndU      AtomicOpCode = 0x30
+	OpCodeI64AtomicRmw16AndU     AtomicOpCode = 0x31
+	OpCodeI64AtomicRmw32AndU     AtomicOpCode = 0x32
+	OpCodeI32AtomicRmwOr         AtomicOpCode = 0x33
+	OpCodeI64AtomicRmwOr         AtomicOpCode = 0x34
+	OpCodeI32AtomicRmw8OrU       AtomicOpCode = 0x35
+	OpCodeI32AtomicRmw16OrU      AtomicOpCode = 0x36
+	OpCodeI64AtomicRmw8OrU       AtomicOpCode = 0x37
+	OpCodeI64AtomicRmw16OrU      AtomicOpCode = 0x38
+	OpCodeI64AtomicRmw32OrU      AtomicOpCode = 0x39
+	OpCodeI32AtomicRmwXor        AtomicOpCode = 0x3a
+	OpCodeI64AtomicRmwXor        AtomicOpCode = 0x3b
+	OpCodeI32AtomicRmw8XorU      AtomicOpCode = 0x3c
+	OpCodeI32AtomicRmw16XorU     AtomicOpCode = 0x3d
+	OpCodeI64AtomicRmw8XorU      AtomicOpCode = 0x3e
+	OpCodeI64AtomicRmw16XorU     AtomicOpCode = 0x3f
+	OpCodeI64AtomicRmw32XorU     AtomicOpCode = 0x40
+	OpCodeI32AtomicRmwXchg       AtomicOpCode = 0x41
+	OpCodeI64AtomicRmwXchg       AtomicOpCode = 0x42
+	OpCodeI32AtomicRmw8XchgU     AtomicOpCode = 0x43
+	OpCodeI32AtomicRmw16XchgU    AtomicOpCode = 0x44
+	OpCodeI64AtomicRmw8XchgU     AtomicOpCode = 0x45
+	OpCodeI64AtomicRmw16XchgU    AtomicOpCode = 0x46
+	OpCodeI64AtomicRmw32XchgU    AtomicOpCode = 0x47
+	OpCodeI32AtomicRmwCmpxchg    AtomicOpCode = 0x48
+	OpCodeI64AtomicRmwCmpxchg    AtomicOpCode = 0x49
+	OpCodeI32AtomicRmw8CmpxchgU  AtomicOpCode = 0x4a
+	OpCodeI32AtomicRmw16CmpxchgU AtomicOpCode = 0x4b
+	OpCodeI64AtomicRmw8CmpxchgU  AtomicOpCode = 0x4c
+	OpCodeI64AtomicRmw16CmpxchgU AtomicOpCode = 0x4d
+	OpCodeI64AtomicRmw32CmpxchgU AtomicOpCode = 0x4e
 )
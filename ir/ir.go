@@ -0,0 +1,151 @@
+// Package ir fuses the common sequences of the pre-decoded wasm stack code into the superinstructions,
+// which read the locals and the constants in place. It is a peephole pass: the fused code still runs
+// on the operand stack like the wasm, there are no registers nor slot-addressed operands.
+//
+// The lowering is a pure pass on the instructions, the execution of the IR is left to the interpreter
+package ir
+
+import "github.com/c0mm4nd/wasman/expr"
+
+// Op is the opcode of the IR, the wasm instructions keep their single byte opcode (the prefix for the prefixed ones)
+// and the superinstructions are numbered after them
+type Op uint16
+
+const (
+	// OpLocalGet2 pushes the locals Imm[0] and Imm[1]
+	OpLocalGet2 Op = 0x100 + iota
+	// OpLocalGet2I32Add pushes the sum of the i32 locals Imm[0] and Imm[1]
+	OpLocalGet2I32Add
+	// OpLocalGet2I32Sub pushes the i32 local Imm[0] minus the i32 local Imm[1]
+	OpLocalGet2I32Sub
+	// OpLocalGetI32AddConst pushes the i32 local Imm[0] plus the constant Imm[1]
+	OpLocalGetI32AddConst
+	// OpI32AddConst adds the constant Imm[0] to the i32 on the top of the stack
+	OpI32AddConst
+	// OpI32MulConst multiplies the i32 on the top of the stack by the constant Imm[0],
+	// the OpI32*Const after it apply the other i32 binary instructions on the top and the constant in the same way
+	OpI32MulConst
+	OpI32AndConst
+	OpI32OrConst
+	OpI32XorConst
+	OpI32ShlConst
+	OpI32ShrSConst
+	OpI32ShrUConst
+	// OpI32EqzBrIf pops the i32 and branches to the label Imm[0] if it is zero
+	OpI32EqzBrIf
+	// OpI32EqBrIf pops two i32 and branches to the label Imm[0] if they are equal,
+	// the OpI32*BrIf after it follow the order of the i32 comparisons in the binary format
+	OpI32EqBrIf
+	OpI32NeBrIf
+	OpI32LtSBrIf
+	OpI32LtUBrIf
+	OpI32GtSBrIf
+	OpI32GtUBrIf
+	OpI32LeSBrIf
+	OpI32LeUBrIf
+	OpI32GeSBrIf
+	OpI32GeUBrIf
+
+	// OpEnd is the end of the superinstructions
+	OpEnd
+)
+
+// constOps are the i32 binary instructions fused with the i32.const before them, besides the i32.add and i32.sub
+var constOps = map[Op]Op{
+	Op(expr.OpCodeI32Mul):  OpI32MulConst,
+	Op(expr.OpCodeI32And):  OpI32AndConst,
+	Op(expr.OpCodeI32Or):   OpI32OrConst,
+	Op(expr.OpCodeI32Xor):  OpI32XorConst,
+	Op(expr.OpCodeI32Shl):  OpI32ShlConst,
+	Op(expr.OpCodeI32ShrS): OpI32ShrSConst,
+	Op(expr.OpCodeI32ShrU): OpI32ShrUConst,
+}
+
+// IsSuper returns whether the op is a superinstruction
+func (op Op) IsSuper() bool {
+	return op >= OpLocalGet2 && op < OpEnd
+}
+
+// Instr is the instruction of the IR. The wasm instruction only needs to carry the immediates
+// read by the fusion, which are the local index, the i32 constant and the label index in Imm[0]
+type Instr struct {
+	Op  Op
+	Imm [2]uint64
+	Len int // the number of the wasm instructions lowered into this
+}
+
+// Lower fuses the wasm instructions into the superinstructions from the beginning, taking the longest sequence on each step.
+// Only the straight-line instructions are fused and a br_if can only end the sequence,
+// so no branch lands inside a superinstruction.
+//
+// It returns the IR and the index of the IR instruction which each wasm instruction is lowered into,
+// with an extra one for the end of the code
+func Lower(code []Instr) (out []Instr, index []int) {
+	out = make([]Instr, 0, len(code))
+	index = make([]int, len(code)+1)
+	for i := 0; i < len(code); {
+		in := fuse(code[i:])
+		for j := 0; j < in.Len; j++ {
+			index[i+j] = len(out)
+		}
+		out = append(out, in)
+		i += in.Len
+	}
+	index[len(code)] = len(out)
+
+	return out, index
+}
+
+// fuse lowers the beginning of the code into one instruction
+func fuse(code []Instr) Instr {
+	is := func(i int, ops ...expr.OpCode) bool {
+		if i >= len(code) {
+			return false
+		}
+		for _, op := range ops {
+			if code[i].Op == Op(op) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	switch first := code[0]; {
+	case is(0, expr.OpCodeLocalGet) && is(1, expr.OpCodeLocalGet) && is(2, expr.OpCodeI32Add, expr.OpCodeI32Sub):
+		op := OpLocalGet2I32Add
+		if is(2, expr.OpCodeI32Sub) {
+			op = OpLocalGet2I32Sub
+		}
+
+		return Instr{Op: op, Imm: [2]uint64{first.Imm[0], code[1].Imm[0]}, Len: 3}
+	case is(0, expr.OpCodeLocalGet) && is(1, expr.OpCodeI32Const) && is(2, expr.OpCodeI32Add, expr.OpCodeI32Sub):
+		return Instr{Op: OpLocalGetI32AddConst, Imm: [2]uint64{first.Imm[0], addend(code[1:])}, Len: 3}
+	case is(0, expr.OpCodeI32Eqz) && is(1, expr.OpCodeBrIf):
+		return Instr{Op: OpI32EqzBrIf, Imm: [2]uint64{code[1].Imm[0]}, Len: 2}
+	case first.Op >= Op(expr.OpCodeI32Eq) && first.Op <= Op(expr.OpCodeI32GeU) && is(1, expr.OpCodeBrIf):
+		op := OpI32EqBrIf + first.Op - Op(expr.OpCodeI32Eq)
+
+		return Instr{Op: op, Imm: [2]uint64{code[1].Imm[0]}, Len: 2}
+	case is(0, expr.OpCodeI32Const) && is(1, expr.OpCodeI32Add, expr.OpCodeI32Sub):
+		return Instr{Op: OpI32AddConst, Imm: [2]uint64{addend(code)}, Len: 2}
+	case is(0, expr.OpCodeI32Const) && len(code) > 1 && constOps[code[1].Op] != 0:
+		return Instr{Op: constOps[code[1].Op], Imm: [2]uint64{first.Imm[0]}, Len: 2}
+	case is(0, expr.OpCodeLocalGet) && is(1, expr.OpCodeLocalGet):
+		return Instr{Op: OpLocalGet2, Imm: [2]uint64{first.Imm[0], code[1].Imm[0]}, Len: 2}
+	default:
+		first.Len = 1
+		return first
+	}
+}
+
+// addend returns the constant of the i32.const followed by the i32.add or i32.sub as an addend,
+// the subtrahend is negated in the wrapping arithmetic
+func addend(code []Instr) uint64 {
+	c := int32(code[0].Imm[0])
+	if code[1].Op == Op(expr.OpCodeI32Sub) {
+		c = -c
+	}
+
+	return uint64(uint32(c))
+}
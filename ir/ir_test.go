@@ -0,0 +1,112 @@
+package ir_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/ir"
+)
+
+func wasmInstr(op expr.OpCode, imm uint64) ir.Instr {
+	return ir.Instr{Op: ir.Op(op), Imm: [2]uint64{imm}}
+}
+
+func TestLower(t *testing.T) {
+	for i, c := range []struct {
+		code  []ir.Instr
+		exp   []ir.Instr
+		index []int
+	}{
+		{
+			code:  []ir.Instr{},
+			exp:   []ir.Instr{},
+			index: []int{0},
+		},
+		{
+			code: []ir.Instr{
+				wasmInstr(expr.OpCodeLocalGet, 1),
+				wasmInstr(expr.OpCodeLocalGet, 2),
+				wasmInstr(expr.OpCodeI32Add, 0),
+				wasmInstr(expr.OpCodeEnd, 0),
+			},
+			exp: []ir.Instr{
+				{Op: ir.OpLocalGet2I32Add, Imm: [2]uint64{1, 2}, Len: 3},
+				{Op: ir.Op(expr.OpCodeEnd), Len: 1},
+			},
+			index: []int{0, 0, 0, 1, 2},
+		},
+		{
+			code: []ir.Instr{
+				wasmInstr(expr.OpCodeLocalGet, 0),
+				wasmInstr(expr.OpCodeI32Const, 3),
+				wasmInstr(expr.OpCodeI32Sub, 0),
+				wasmInstr(expr.OpCodeI32Const, 5),
+				wasmInstr(expr.OpCodeI32Add, 0),
+			},
+			exp: []ir.Instr{
+				{Op: ir.OpLocalGetI32AddConst, Imm: [2]uint64{0, 0xffff_fffd}, Len: 3},
+				{Op: ir.OpI32AddConst, Imm: [2]uint64{5}, Len: 2},
+			},
+			index: []int{0, 0, 0, 1, 1, 2},
+		},
+		{
+			// the compare fused with the br_if is preferred to the local.get pair
+			code: []ir.Instr{
+				wasmInstr(expr.OpCodeLoop, 0),
+				wasmInstr(expr.OpCodeLocalGet, 0),
+				wasmInstr(expr.OpCodeLocalGet, 1),
+				wasmInstr(expr.OpCodeI32LtU, 0),
+				wasmInstr(expr.OpCodeBrIf, 0),
+				wasmInstr(expr.OpCodeI32Eqz, 0),
+				wasmInstr(expr.OpCodeBrIf, 1),
+				wasmInstr(expr.OpCodeEnd, 0),
+			},
+			exp: []ir.Instr{
+				{Op: ir.Op(expr.OpCodeLoop), Len: 1},
+				{Op: ir.OpLocalGet2, Imm: [2]uint64{0, 1}, Len: 2},
+				{Op: ir.OpI32LtUBrIf, Len: 2},
+				{Op: ir.OpI32EqzBrIf, Imm: [2]uint64{1}, Len: 2},
+				{Op: ir.Op(expr.OpCodeEnd), Len: 1},
+			},
+			index: []int{0, 1, 1, 2, 2, 3, 3, 4, 5},
+		},
+		{
+			// nothing is fused across the control instructions
+			code: []ir.Instr{
+				wasmInstr(expr.OpCodeI32Const, 1),
+				wasmInstr(expr.OpCodeEnd, 0),
+				wasmInstr(expr.OpCodeI32Add, 0),
+				wasmInstr(expr.OpCodeBrIf, 0),
+				wasmInstr(expr.OpCodeMiscPrefix, 0),
+			},
+			exp: []ir.Instr{
+				{Op: ir.Op(expr.OpCodeI32Const), Imm: [2]uint64{1}, Len: 1},
+				{Op: ir.Op(expr.OpCodeEnd), Len: 1},
+				{Op: ir.Op(expr.OpCodeI32Add), Len: 1},
+				{Op: ir.Op(expr.OpCodeBrIf), Len: 1},
+				{Op: ir.Op(expr.OpCodeMiscPrefix), Len: 1},
+			},
+			index: []int{0, 1, 2, 3, 4, 5},
+		},
+	} {
+		out, index := ir.Lower(c.code)
+		if !reflect.DeepEqual(out, c.exp) {
+			t.Errorf("%d: got %v, want %v", i, out, c.exp)
+		}
+		if !reflect.DeepEqual(index, c.index) {
+			t.Errorf("%d: got index %v, want %v", i, index, c.index)
+		}
+	}
+}
+
+func TestOp_IsSuper(t *testing.T) {
+	if ir.Op(expr.OpCodeI32Add).IsSuper() || ir.OpEnd.IsSuper() {
+		t.Fail()
+	}
+	for op := ir.OpLocalGet2; op < ir.OpEnd; op++ {
+		if !op.IsSuper() {
+			t.Errorf("%#x is not super", op)
+		}
+	}
+}
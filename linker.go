@@ -1,15 +1,20 @@
 package wasman
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
+	"reflect"
+	"sync"
 
 	"github.com/c0mm4nd/wasman/config"
+	"github.com/c0mm4nd/wasman/wasi"
 	"github.com/c0mm4nd/wasman/wasm"
 
 	"github.com/c0mm4nd/wasman/segments"
 	"github.com/c0mm4nd/wasman/types"
+	"github.com/c0mm4nd/wasman/utils"
 )
 
 // errors on linking modules
@@ -73,6 +78,28 @@ func DefineFunc21[A, B, Z Primitive](l *Linker, modName, funcName string, f func
 	return l.defineFunc(modName, funcName, wrapFunc21(f), []any{*new(A), *new(B)}, []any{*new(Z)})
 }
 
+// DefineFunc puts any go func into the Linker's modules by reflection, whose params and results are the Primitive types.
+// The func can take the context.Context of the call or the calling *Instance as the first param,
+// and return an error as the last result, which stops the call with the error wrapped in the wasm.Trap.
+//
+// The signature is only reflected on defining, where the common shapes are specialised into the generic wrappers
+// of the DefineFuncXY, which run as fast as them: at most 2 params of int32, uint32, int64, uint64, float32 or float64,
+// or 3 to 4 params of int32 or int64, optionally after the *Instance, and no result or 1 result of the same types.
+// The other shapes, like the ones taking the context.Context, returning an error, multiple results or the named types,
+// still go through reflect.Value.Call on every call, with the arg values cached per instance,
+// which costs tens of times the generic wrappers, so take the *Instance and call its Context() on the hot paths
+func DefineFunc(l *Linker, modName, funcName string, f any) error {
+	hf, err := reflectFunc(f)
+	if err != nil {
+		return err
+	}
+	if gen := genericFunc(f); gen != nil {
+		hf.Generator = gen
+	}
+
+	return l.defineHostFunc(modName, funcName, hf)
+}
+
 // DefineFunc puts a simple go style func into Linker's modules.
 // This f should be a simply func which doesnt handle ins's fields.
 func (l *Linker) defineFunc(modName, funcName string, f wasm.RawHostFunc, ins []any, outs []any) error {
@@ -87,6 +114,16 @@ func (l *Linker) defineFunc(modName, funcName string, f wasm.RawHostFunc, ins []
 		return err
 	}
 
+	return l.defineHostFunc(modName, funcName, &wasm.HostFunc{
+		Generator: func(_ *Instance) wasm.RawHostFunc {
+			return f
+		},
+		Signature: sig,
+	})
+}
+
+// defineHostFunc puts the host func into the Linker's modules
+func (l *Linker) defineHostFunc(modName, funcName string, f *wasm.HostFunc) error {
 	mod, exists := l.Modules[modName]
 	if !exists {
 		mod = &Module{IndexSpace: new(wasm.IndexSpace), ExportSection: map[string]*segments.ExportSegment{}}
@@ -105,12 +142,7 @@ func (l *Linker) defineFunc(modName, funcName string, f wasm.RawHostFunc, ins []
 		},
 	}
 
-	mod.IndexSpace.Functions = append(mod.IndexSpace.Functions, &wasm.HostFunc{
-		Generator: func(_ *Instance) wasm.RawHostFunc {
-			return f
-		},
-		Signature: sig,
-	})
+	mod.IndexSpace.Functions = append(mod.IndexSpace.Functions, f)
 
 	return nil
 }
@@ -175,8 +207,11 @@ func (l *Linker) DefineTable(modName, tableName string, table []*uint32) error {
 	}
 
 	mod.IndexSpace.Tables = append(mod.IndexSpace.Tables, &wasm.Table{
-		TableType: *mod.TableSection[0],
-		Value:     table,
+		TableType: types.TableType{
+			Elem:   types.ValueTypeFuncRef,
+			Limits: &types.Limits{Min: uint64(len(table))},
+		},
+		Value: table,
 	})
 
 	return nil
@@ -203,13 +238,81 @@ func (l *Linker) DefineMemory(modName, memName string, mem []byte) error {
 	}
 
 	mod.IndexSpace.Memories = append(mod.IndexSpace.Memories, &wasm.Memory{
-		MemoryType: *mod.MemorySection[0],
+		MemoryType: types.MemoryType{Min: uint64(utils.CalcPageSize(len(mem), config.DefaultMemoryPageSize))},
 		Value:      mem,
 	})
 
 	return nil
 }
 
+// DefineSharedMemory will defined an external memory created by wasm.NewSharedMemory for the main modules,
+// all the instances importing it share the same memory and can run on different goroutines
+func (l *Linker) DefineSharedMemory(modName, memName string, mem *wasm.Memory) error {
+	mod, exists := l.Modules[modName]
+	if !exists {
+		mod = &Module{IndexSpace: new(wasm.IndexSpace), ExportSection: map[string]*segments.ExportSegment{}}
+		l.Modules[modName] = mod
+	}
+
+	if l.DisableShadowing && mod.ExportSection[memName] != nil {
+		return config.ErrShadowing
+	}
+
+	mod.ExportSection[memName] = &segments.ExportSegment{
+		Name: memName,
+		Desc: &segments.ExportDesc{
+			Kind:  segments.KindMem,
+			Index: uint32(len(mod.IndexSpace.Memories)),
+		},
+	}
+
+	mod.IndexSpace.Memories = append(mod.IndexSpace.Memories, mem)
+
+	return nil
+}
+
+// DefineTag will defined an external tag for the main module,
+// the tag created by wasm.NewTag is also used by the host functions to throw and the embedder to catch
+func (l *Linker) DefineTag(modName, tagName string, tag *wasm.Tag) error {
+	mod, exists := l.Modules[modName]
+	if !exists {
+		mod = &Module{IndexSpace: new(wasm.IndexSpace), ExportSection: map[string]*segments.ExportSegment{}}
+		l.Modules[modName] = mod
+	}
+
+	if l.DisableShadowing && mod.ExportSection[tagName] != nil {
+		return config.ErrShadowing
+	}
+
+	mod.ExportSection[tagName] = &segments.ExportSegment{
+		Name: tagName,
+		Desc: &segments.ExportDesc{
+			Kind:  segments.KindTag,
+			Index: uint32(len(mod.IndexSpace.Tags)),
+		},
+	}
+
+	mod.IndexSpace.Tags = append(mod.IndexSpace.Tags, tag)
+
+	return nil
+}
+
+// DefineWASI puts the WASI preview1 host module on the conf into the Linker as wasi.ModuleName,
+// whose fd table is shared by the modules instantiated by the Linker
+func (l *Linker) DefineWASI(conf config.WASIConfig) error {
+	if l.DisableShadowing && l.Modules[wasi.ModuleName] != nil {
+		return config.ErrShadowing
+	}
+
+	mod, err := wasi.NewModule(conf)
+	if err != nil {
+		return err
+	}
+	l.Modules[wasi.ModuleName] = mod
+
+	return nil
+}
+
 // Instantiate will instantiate a Module into an runnable Instance
 func (l *Linker) Instantiate(mainModule *Module) (*Instance, error) {
 	return NewInstance(mainModule, l.Modules)
@@ -234,15 +337,25 @@ func getTypeOf(def any) (types.ValueType, error) {
 		return types.ValueTypeF64, nil
 	case float32:
 		return types.ValueTypeF32, nil
-	case int32, uint32, int, int16, int8, bool:
+	case int32, uint32, int, int16, int8, uint16, uint8, bool:
 		return types.ValueTypeI32, nil
 	case int64, uint64, uintptr, uint:
 		return types.ValueTypeI64, nil
+	case wasm.V128:
+		return types.ValueTypeV128, nil
 	default:
 		return 0x00, fmt.Errorf("invalid type: %T", def)
 	}
 }
 
+func wrapFunc00(f func()) wasm.RawHostFunc {
+	wrapper := func(a []uint64) []uint64 {
+		f()
+		return []uint64{}
+	}
+	return wrapper
+}
+
 func wrapFunc01[Z Primitive](f func() Z) wasm.RawHostFunc {
 	wrapper := func(a []uint64) []uint64 {
 		r1 := f()
@@ -289,24 +402,382 @@ func wrapFunc21[A, B, Z Primitive](f func(A, B) Z) wasm.RawHostFunc {
 	return wrapper
 }
 
+func wrapFunc30[A, B, C Primitive](f func(A, B, C)) wasm.RawHostFunc {
+	wrapper := func(a []uint64) []uint64 {
+		f(fromU[A](a[0]), fromU[B](a[1]), fromU[C](a[2]))
+		return []uint64{}
+	}
+	return wrapper
+}
+
+func wrapFunc31[A, B, C, Z Primitive](f func(A, B, C) Z) wasm.RawHostFunc {
+	wrapper := func(a []uint64) []uint64 {
+		r1 := f(fromU[A](a[0]), fromU[B](a[1]), fromU[C](a[2]))
+		return []uint64{toU(r1)}
+	}
+	return wrapper
+}
+
+func wrapFunc40[A, B, C, D Primitive](f func(A, B, C, D)) wasm.RawHostFunc {
+	wrapper := func(a []uint64) []uint64 {
+		f(fromU[A](a[0]), fromU[B](a[1]), fromU[C](a[2]), fromU[D](a[3]))
+		return []uint64{}
+	}
+	return wrapper
+}
+
+func wrapFunc41[A, B, C, D, Z Primitive](f func(A, B, C, D) Z) wasm.RawHostFunc {
+	wrapper := func(a []uint64) []uint64 {
+		r1 := f(fromU[A](a[0]), fromU[B](a[1]), fromU[C](a[2]), fromU[D](a[3]))
+		return []uint64{toU(r1)}
+	}
+	return wrapper
+}
+
+// fromU converts the wasm val into the go value, in which the i32 is sign-extended for the signed types
 func fromU[T Primitive](val uint64) T {
 	switch any(*new(T)).(type) {
 	case float32:
-		return T(float32(math.Float64frombits(val)))
+		return T(math.Float32frombits(uint32(val)))
 	case float64:
 		return T(math.Float64frombits(val))
+	case int, int32, int16, int8:
+		return T(int32(val))
 	default:
 		return T(val)
 	}
 }
 
+// toU converts the go value into the wasm val, in which the i32 is zero-extended like the other i32 producers
 func toU[T Primitive](val T) uint64 {
 	switch v := any(val).(type) {
 	case float32:
-		return math.Float64bits(float64(v))
+		return uint64(math.Float32bits(v))
 	case float64:
 		return math.Float64bits(v)
+	case int, int32, int16, int8, uint32, uint16, uint8:
+		return uint64(uint32(val))
 	default:
 		return uint64(val)
 	}
 }
+
+// generator is the Generator of the wasm.HostFunc, which makes the RawHostFunc for the calling instance
+type generator = func(ins *Instance) wasm.RawHostFunc
+
+// genericFunc returns the generator of the generic wrapper for the func, or nil when its shape is not specialised.
+// The shapes are indexed by their func types once, so defining only looks the type up
+func genericFunc(f any) generator {
+	genericShapesOnce.Do(func() {
+		genericShapes = make(map[reflect.Type]func(any) generator)
+		addShapes0(genericShapes)
+	})
+	if wrap, ok := genericShapes[reflect.TypeOf(f)]; ok {
+		return wrap(f)
+	}
+
+	return nil
+}
+
+var (
+	genericShapesOnce sync.Once
+	genericShapes     map[reflect.Type]func(any) generator
+)
+
+// addShape indexes the wrapper by the func type it wraps
+func addShape[F any](shapes map[reflect.Type]func(any) generator, wrap func(F) generator) {
+	shapes[reflect.TypeOf(wrap).In(0)] = func(f any) generator {
+		return wrap(f.(F))
+	}
+}
+
+// addRawShape indexes the wrapper, whose RawHostFunc is shared by all the instances, by the func type it wraps
+func addRawShape[F any](shapes map[reflect.Type]func(any) generator, wrap func(F) wasm.RawHostFunc) {
+	shapes[reflect.TypeOf(wrap).In(0)] = func(f any) generator {
+		raw := wrap(f.(F))
+		return func(_ *Instance) wasm.RawHostFunc {
+			return raw
+		}
+	}
+}
+
+// addShapes0 indexes the shapes of no param, and then the ones of more params, all with or without the leading *Instance.
+// The funcs of at most 2 params take and return any of int32, uint32, int64, uint64, float32 and float64,
+// and the ones of 3 or 4 params, mostly the pointers and lengths into the memory, take and return the int32 and int64.
+// Each shape is instantiated on compiling, so the others are left to the reflection instead of growing the binary
+func addShapes0(shapes map[reflect.Type]func(any) generator) {
+	addRawShape(shapes, wrapFunc00)
+	addShape(shapes, func(f func(*Instance)) generator {
+		return func(ins *Instance) wasm.RawHostFunc {
+			return wrapFunc00(func() { f(ins) })
+		}
+	})
+	addResults0[int32](shapes)
+	addResults0[uint32](shapes)
+	addResults0[int64](shapes)
+	addResults0[uint64](shapes)
+	addResults0[float32](shapes)
+	addResults0[float64](shapes)
+
+	addShapes1[int32](shapes)
+	addShapes1[uint32](shapes)
+	addShapes1[int64](shapes)
+	addShapes1[uint64](shapes)
+	addShapes1[float32](shapes)
+	addShapes1[float64](shapes)
+
+	addShapes3s[int32, int32](shapes)
+	addShapes3s[int32, int64](shapes)
+	addShapes3s[int64, int32](shapes)
+	addShapes3s[int64, int64](shapes)
+}
+
+func addResults0[Z Primitive](shapes map[reflect.Type]func(any) generator) {
+	addRawShape(shapes, wrapFunc01[Z])
+	addShape(shapes, func(f func(*Instance) Z) generator {
+		return func(ins *Instance) wasm.RawHostFunc {
+			return wrapFunc01(func() Z { return f(ins) })
+		}
+	})
+}
+
+func addShapes1[A Primitive](shapes map[reflect.Type]func(any) generator) {
+	addRawShape(shapes, wrapFunc10[A])
+	addShape(shapes, func(f func(*Instance, A)) generator {
+		return func(ins *Instance) wasm.RawHostFunc {
+			return wrapFunc10(func(a A) { f(ins, a) })
+		}
+	})
+	addResults1[A, int32](shapes)
+	addResults1[A, uint32](shapes)
+	addResults1[A, int64](shapes)
+	addResults1[A, uint64](shapes)
+	addResults1[A, float32](shapes)
+	addResults1[A, float64](shapes)
+
+	addShapes2[A, int32](shapes)
+	addShapes2[A, uint32](shapes)
+	addShapes2[A, int64](shapes)
+	addShapes2[A, uint64](shapes)
+	addShapes2[A, float32](shapes)
+	addShapes2[A, float64](shapes)
+}
+
+func addResults1[A, Z Primitive](shapes map[reflect.Type]func(any) generator) {
+	addRawShape(shapes, wrapFunc11[A, Z])
+	addShape(shapes, func(f func(*Instance, A) Z) generator {
+		return func(ins *Instance) wasm.RawHostFunc {
+			return wrapFunc11(func(a A) Z { return f(ins, a) })
+		}
+	})
+}
+
+func addShapes2[A, B Primitive](shapes map[reflect.Type]func(any) generator) {
+	addRawShape(shapes, wrapFunc20[A, B])
+	addShape(shapes, func(f func(*Instance, A, B)) generator {
+		return func(ins *Instance) wasm.RawHostFunc {
+			return wrapFunc20(func(a A, b B) { f(ins, a, b) })
+		}
+	})
+	addResults2[A, B, int32](shapes)
+	addResults2[A, B, uint32](shapes)
+	addResults2[A, B, int64](shapes)
+	addResults2[A, B, uint64](shapes)
+	addResults2[A, B, float32](shapes)
+	addResults2[A, B, float64](shapes)
+}
+
+func addResults2[A, B, Z Primitive](shapes map[reflect.Type]func(any) generator) {
+	addRawShape(shapes, wrapFunc21[A, B, Z])
+	addShape(shapes, func(f func(*Instance, A, B) Z) generator {
+		return func(ins *Instance) wasm.RawHostFunc {
+			return wrapFunc21(func(a A, b B) Z { return f(ins, a, b) })
+		}
+	})
+}
+
+func addShapes3s[A, B Primitive](shapes map[reflect.Type]func(any) generator) {
+	addShapes3[A, B, int32](shapes)
+	addShapes3[A, B, int64](shapes)
+}
+
+func addShapes3[A, B, C Primitive](shapes map[reflect.Type]func(any) generator) {
+	addRawShape(shapes, wrapFunc30[A, B, C])
+	addShape(shapes, func(f func(*Instance, A, B, C)) generator {
+		return func(ins *Instance) wasm.RawHostFunc {
+			return wrapFunc30(func(a A, b B, c C) { f(ins, a, b, c) })
+		}
+	})
+	addResults3[A, B, C, int32](shapes)
+	addResults3[A, B, C, int64](shapes)
+
+	addShapes4[A, B, C, int32](shapes)
+	addShapes4[A, B, C, int64](shapes)
+}
+
+func addResults3[A, B, C, Z Primitive](shapes map[reflect.Type]func(any) generator) {
+	addRawShape(shapes, wrapFunc31[A, B, C, Z])
+	addShape(shapes, func(f func(*Instance, A, B, C) Z) generator {
+		return func(ins *Instance) wasm.RawHostFunc {
+			return wrapFunc31(func(a A, b B, c C) Z { return f(ins, a, b, c) })
+		}
+	})
+}
+
+func addShapes4[A, B, C, D Primitive](shapes map[reflect.Type]func(any) generator) {
+	addRawShape(shapes, wrapFunc40[A, B, C, D])
+	addShape(shapes, func(f func(*Instance, A, B, C, D)) generator {
+		return func(ins *Instance) wasm.RawHostFunc {
+			return wrapFunc40(func(a A, b B, c C, d D) { f(ins, a, b, c, d) })
+		}
+	})
+	addResults4[A, B, C, D, int32](shapes)
+	addResults4[A, B, C, D, int64](shapes)
+}
+
+func addResults4[A, B, C, D, Z Primitive](shapes map[reflect.Type]func(any) generator) {
+	addRawShape(shapes, wrapFunc41[A, B, C, D, Z])
+	addShape(shapes, func(f func(*Instance, A, B, C, D) Z) generator {
+		return func(ins *Instance) wasm.RawHostFunc {
+			return wrapFunc41(func(a A, b B, c C, d D) Z { return f(ins, a, b, c, d) })
+		}
+	})
+}
+
+var (
+	contextType  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	instanceType = reflect.TypeOf((*Instance)(nil))
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// reflectFunc converts the go func into the host func. The conversions of its params and results are
+// resolved here once, so that the calls only set the cached arg values and call the func
+func reflectFunc(f any) (*wasm.HostFunc, error) {
+	fv := reflect.ValueOf(f)
+	if !fv.IsValid() || fv.Kind() != reflect.Func || fv.IsNil() || fv.Type().IsVariadic() {
+		return nil, fmt.Errorf("%w: %T is not a func of fixed params", ErrInvalidSign, f)
+	}
+	ft := fv.Type()
+
+	// the leading param which is not from the wasm
+	var leading func(ins *Instance) reflect.Value
+	first := 0
+	if ft.NumIn() > 0 {
+		switch ft.In(0) {
+		case contextType:
+			leading = func(ins *Instance) reflect.Value { return reflect.ValueOf(ins.Context()) }
+			first = 1
+		case instanceType:
+			leading = func(ins *Instance) reflect.Value { return reflect.ValueOf(ins) }
+			first = 1
+		}
+	}
+
+	numOut := ft.NumOut()
+	returnsErr := numOut > 0 && ft.Out(numOut-1) == errorType
+	if returnsErr {
+		numOut--
+	}
+
+	sig := &types.FuncType{
+		InputTypes:  make([]types.ValueType, ft.NumIn()-first),
+		ReturnTypes: make([]types.ValueType, numOut),
+	}
+	setters := make([]func(reflect.Value, uint64), len(sig.InputTypes))
+	getters := make([]func(reflect.Value) uint64, numOut)
+	var err error
+	for i := range setters {
+		if sig.InputTypes[i], err = getTypeOfKind(ft.In(first + i)); err != nil {
+			return nil, err
+		}
+		setters[i] = setterOf(ft.In(first+i).Kind(), sig.InputTypes[i])
+	}
+	for i := range getters {
+		if sig.ReturnTypes[i], err = getTypeOfKind(ft.Out(i)); err != nil {
+			return nil, err
+		}
+		getters[i] = getterOf(ft.Out(i).Kind(), sig.ReturnTypes[i])
+	}
+
+	return &wasm.HostFunc{
+		Signature: sig,
+		Generator: func(ins *Instance) wasm.RawHostFunc {
+			// the arg values are reused by the calls, which is safe as Call copies them before any reentrance
+			in := make([]reflect.Value, ft.NumIn())
+			for i := first; i < len(in); i++ {
+				in[i] = reflect.New(ft.In(i)).Elem()
+			}
+
+			return func(args []uint64) []uint64 {
+				if leading != nil {
+					in[0] = leading(ins)
+				}
+				for i, set := range setters {
+					set(in[first+i], args[i])
+				}
+
+				out := fv.Call(in)
+				if returnsErr && !out[numOut].IsNil() {
+					ins.Abort(out[numOut].Interface().(error))
+				}
+
+				results := make([]uint64, numOut)
+				for i, get := range getters {
+					results[i] = get(out[i])
+				}
+
+				return results
+			}
+		},
+	}, nil
+}
+
+// getTypeOfKind converts the go type of the Primitive kind into wasm val type, same to getTypeOf
+func getTypeOfKind(t reflect.Type) (types.ValueType, error) {
+	switch t.Kind() {
+	case reflect.Float64:
+		return types.ValueTypeF64, nil
+	case reflect.Float32:
+		return types.ValueTypeF32, nil
+	case reflect.Int32, reflect.Uint32, reflect.Int, reflect.Int16, reflect.Int8, reflect.Uint16, reflect.Uint8:
+		return types.ValueTypeI32, nil
+	case reflect.Int64, reflect.Uint64, reflect.Uintptr, reflect.Uint:
+		return types.ValueTypeI64, nil
+	default:
+		return 0x00, fmt.Errorf("%w: invalid type: %s", ErrInvalidSign, t)
+	}
+}
+
+// setterOf returns the func setting the wasm val into the go value of the kind
+func setterOf(kind reflect.Kind, ty types.ValueType) func(reflect.Value, uint64) {
+	switch {
+	case kind == reflect.Float32:
+		return func(v reflect.Value, val uint64) { v.SetFloat(float64(math.Float32frombits(uint32(val)))) }
+	case kind == reflect.Float64:
+		return func(v reflect.Value, val uint64) { v.SetFloat(math.Float64frombits(val)) }
+	case kind >= reflect.Int && kind <= reflect.Int64 && ty == types.ValueTypeI32:
+		return func(v reflect.Value, val uint64) { v.SetInt(int64(int32(val))) }
+	case kind >= reflect.Int && kind <= reflect.Int64:
+		return func(v reflect.Value, val uint64) { v.SetInt(int64(val)) }
+	default:
+		return func(v reflect.Value, val uint64) { v.SetUint(val) }
+	}
+}
+
+// getterOf returns the func getting the wasm val from the go value of the kind
+func getterOf(kind reflect.Kind, ty types.ValueType) func(reflect.Value) uint64 {
+	switch {
+	case kind == reflect.Float32:
+		return func(v reflect.Value) uint64 { return uint64(math.Float32bits(float32(v.Float()))) }
+	case kind == reflect.Float64:
+		return func(v reflect.Value) uint64 { return math.Float64bits(v.Float()) }
+	case kind >= reflect.Int && kind <= reflect.Int64 && ty == types.ValueTypeI32:
+		return func(v reflect.Value) uint64 { return uint64(uint32(v.Int())) }
+	case kind >= reflect.Int && kind <= reflect.Int64:
+		return func(v reflect.Value) uint64 { return uint64(v.Int()) }
+	case ty == types.ValueTypeI32:
+		return func(v reflect.Value) uint64 { return uint64(uint32(v.Uint())) }
+	default:
+		return func(v reflect.Value) uint64 { return v.Uint() }
+	}
+}
@@ -0,0 +1,242 @@
+package wasman_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/c0mm4nd/wasman"
+	"github.com/c0mm4nd/wasman/config"
+	"github.com/c0mm4nd/wasman/types"
+	"github.com/c0mm4nd/wasman/wasm"
+)
+
+// hostFunc returns the raw func of the host func defined on the Linker
+func hostFunc(t testing.TB, l *wasman.Linker, modName, funcName string, ins *wasman.Instance) (*wasm.HostFunc, wasm.RawHostFunc) {
+	mod := l.Modules[modName]
+	f := mod.IndexSpace.Functions[mod.ExportSection[funcName].Desc.Index].(*wasm.HostFunc)
+
+	return f, f.Generator(ins)
+}
+
+type handle uint16
+
+// call2 calls the host func of the env taking the args and returning one result
+func call2(t testing.TB, l *wasman.Linker, funcName string, args ...uint64) uint64 {
+	_, call := hostFunc(t, l, "env", funcName, nil)
+
+	return call(args)[0]
+}
+
+func TestDefineFunc(t *testing.T) {
+	l := wasman.NewLinker(config.LinkerConfig{})
+	err := wasman.DefineFunc(l, "env", "mix", func(a int8, b int32, c uint64, d float32, e float64, h handle) (int32, float32, float64, uint32, int64) {
+		return int32(a) * b, d * 2, e / 2, uint32(h) + 1, int64(c) - 1
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, call := hostFunc(t, l, "env", "mix", nil)
+	i32, i64, f32, f64 := types.ValueTypeI32, types.ValueTypeI64, types.ValueTypeF32, types.ValueTypeF64
+	if exp := (&types.FuncType{
+		InputTypes:  []types.ValueType{i32, i32, i64, f32, f64, i32},
+		ReturnTypes: []types.ValueType{i32, f32, f64, i32, i64},
+	}); !reflect.DeepEqual(f.Signature, exp) {
+		t.Fatalf("got %v, want %v", f.Signature, exp)
+	}
+
+	neg := uint64(uint32(0xffffffff)) // -1 as i32
+	got := call([]uint64{neg, 3, 0, uint64(math.Float32bits(1.5)), math.Float64bits(3), 9})
+	exp := []uint64{uint64(uint32(0xfffffffd)), uint64(math.Float32bits(3)), math.Float64bits(1.5), 10, math.MaxUint64}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %#x, want %#x", got, exp)
+	}
+
+	t.Run("generic", func(t *testing.T) {
+		if err := wasman.DefineFunc(l, "env", "scale", func(a int32, b float32) float32 { return float32(a) * b }); err != nil {
+			t.Fatal(err)
+		}
+		if err := wasman.DefineFunc(l, "env", "neg", func(a int32) int32 { return -a }); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := call2(t, l, "scale", uint64(uint32(0xfffffffe)), uint64(math.Float32bits(1.5))); got != uint64(math.Float32bits(-3)) {
+			t.Errorf("got %#x", got)
+		}
+		if got := call2(t, l, "neg", 5); got != 0xfffffffb {
+			t.Errorf("got %#x", got)
+		}
+
+		ins := &wasman.Instance{}
+		if err := wasman.DefineFunc(l, "env", "sum", func(got *wasman.Instance, a int32, b int64, c, d int32) int64 {
+			if got != ins {
+				t.Errorf("got %p, want %p", got, ins)
+			}
+			return int64(a) + b + int64(c) + int64(d)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		f, call := hostFunc(t, l, "env", "sum", ins)
+		if len(f.Signature.InputTypes) != 4 {
+			t.Errorf("got %v", f.Signature)
+		}
+		if got := call([]uint64{uint64(uint32(0xffffffff)), 10, 2, 3})[0]; got != 14 {
+			t.Errorf("got %d", got)
+		}
+	})
+
+	t.Run("leading", func(t *testing.T) {
+		ins := &wasman.Instance{}
+		if err := wasman.DefineFunc(l, "env", "ctx", func(ctx context.Context, a uint32) uint32 {
+			if ctx == nil {
+				t.Error("no context")
+			}
+			return a
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := wasman.DefineFunc(l, "env", "ins", func(got *wasman.Instance) {
+			if got != ins {
+				t.Errorf("got %p, want %p", got, ins)
+			}
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if f, call := hostFunc(t, l, "env", "ctx", ins); len(f.Signature.InputTypes) != 1 || call([]uint64{7})[0] != 7 {
+			t.Errorf("got %v", f.Signature)
+		}
+		if f, call := hostFunc(t, l, "env", "ins", ins); len(f.Signature.InputTypes) != 0 || len(call(nil)) != 0 {
+			t.Errorf("got %v", f.Signature)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, f := range []any{
+			1,
+			func(...int32) {},
+			func(string) {},
+			func() (error, int32) { return nil, 0 },
+			func(int32, context.Context) {},
+		} {
+			if err := wasman.DefineFunc(l, "env", "invalid", f); !errors.Is(err, wasman.ErrInvalidSign) {
+				t.Errorf("%T: got %v", f, err)
+			}
+		}
+	})
+}
+
+// divModule is the module calling the div of the env
+//
+//	(func (export "run") (param i32) (result i32) (call $div (local.get 0)))
+var divModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	0x01, 0x06, 0x01, 0x60, 0x01, 0x7f, 0x01, 0x7f,
+	0x02, 0x0b, 0x01, 0x03, 'e', 'n', 'v', 0x03, 'd', 'i', 'v', 0x00, 0x00,
+	0x03, 0x02, 0x01, 0x00,
+	0x07, 0x07, 0x01, 0x03, 'r', 'u', 'n', 0x00, 0x01,
+	0x0a, 0x08, 0x01, 0x06, 0x00, 0x20, 0x00, 0x10, 0x00, 0x0b,
+}
+
+func TestDefineFuncXY(t *testing.T) {
+	l := wasman.NewLinker(config.LinkerConfig{})
+	for _, err := range []error{
+		wasman.DefineFunc01(l, "env", "pi", func() float32 { return math.Pi }),
+		wasman.DefineFunc11(l, "env", "half", func(a float32) float32 { return a / 2 }),
+		wasman.DefineFunc11(l, "env", "neg32", func(a int32) int32 { return -a }),
+		wasman.DefineFunc11(l, "env", "neg64", func(a int64) int64 { return -a }),
+		wasman.DefineFunc11(l, "env", "byte", func(a uint8) uint8 { return a / 2 }),
+		wasman.DefineFunc21(l, "env", "sum", func(a int8, b int16) int32 { return int32(a) + int32(b) }),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range []struct {
+		name string
+		args []uint64
+		exp  uint64
+	}{
+		// the f32 is on the low 32 bits of the slot as the float32 bits, like the wasm f32 values
+		{name: "pi", exp: uint64(math.Float32bits(math.Pi))},
+		{name: "half", args: []uint64{uint64(math.Float32bits(-3))}, exp: uint64(math.Float32bits(-1.5))},
+		// the i32 result is zero-extended, and the i32 arg with the sign bit is negative
+		{name: "neg32", args: []uint64{5}, exp: 0xfffffffb},
+		{name: "neg32", args: []uint64{0xfffffffb}, exp: 5},
+		{name: "neg64", args: []uint64{5}, exp: 0xfffffffffffffffb},
+		// the narrow ints take the low bits of the i32
+		{name: "byte", args: []uint64{0xfffffffe}, exp: 0x7f},
+		{name: "sum", args: []uint64{0xffffffff, 0xfffffffe}, exp: 0xfffffffd},
+		{name: "sum", args: []uint64{0x7f, 0x7fff}, exp: 0x807e},
+	} {
+		_, call := hostFunc(t, l, "env", c.name, nil)
+		if got := call(c.args); got[0] != c.exp {
+			t.Errorf("%s(%#x): got %#x, want %#x", c.name, c.args, got[0], c.exp)
+		}
+	}
+}
+
+func TestDefineFunc_error(t *testing.T) {
+	errDivByZero := errors.New("divided by zero")
+	l := wasman.NewLinker(config.LinkerConfig{})
+	if err := wasman.DefineFunc(l, "env", "div", func(a int32) (int32, error) {
+		if a == 0 {
+			return 0, errDivByZero
+		}
+		return 100 / a, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	mod, err := wasman.NewModule(config.ModuleConfig{}, bytes.NewReader(divModule))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins, err := l.Instantiate(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, _, err := ins.CallExportedFunc("run", 4); err != nil || r[0] != 25 {
+		t.Fatalf("got %v, %v", r, err)
+	}
+
+	_, _, err = ins.CallExportedFunc("run", 0)
+	var trap *wasm.Trap
+	if !errors.Is(err, errDivByZero) || !errors.As(err, &trap) {
+		t.Errorf("got %v", err)
+	}
+}
+
+func BenchmarkDefineFunc(b *testing.B) {
+	add := func(a, b int32) int32 { return a + b }
+	l := wasman.NewLinker(config.LinkerConfig{})
+	if err := wasman.DefineFunc21(l, "env", "DefineFunc21", add); err != nil {
+		b.Fatal(err)
+	}
+	if err := wasman.DefineFunc(l, "env", "DefineFunc", add); err != nil {
+		b.Fatal(err)
+	}
+	if err := wasman.DefineFunc(l, "env", "instance", func(_ *wasman.Instance, a, b, c int32) int32 { return a + b + c }); err != nil {
+		b.Fatal(err)
+	}
+	if err := wasman.DefineFunc(l, "env", "reflect", func(_ context.Context, a, b, c int32) int32 { return a + b + c }); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, name := range []string{"DefineFunc21", "DefineFunc", "instance", "reflect"} {
+		b.Run(name, func(b *testing.B) {
+			_, call := hostFunc(b, l, "env", name, &wasman.Instance{})
+			args := []uint64{1, 2, 3}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				call(args)
+			}
+		})
+	}
+}
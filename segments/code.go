@@ -2,19 +2,59 @@ package segments
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 
 	"github.com/c0mm4nd/wasman/expr"
 	"github.com/c0mm4nd/wasman/leb128decode"
+	"github.com/c0mm4nd/wasman/types"
 )
 
+// MaxLocals is the max number of the locals declared in a CodeSegment, as the other engines limit
+const MaxLocals = 50000
+
+var (
+	ErrTooManyLocals = errors.New("too many locals")
+)
+
+// LocalEntry is a run of the declared locals of the same type
+type LocalEntry struct {
+	Count uint32
+	Type  types.ValueType
+}
+
 // CodeSegment is one unit in the wasman.Module's CodeSection
 type CodeSegment struct {
 	NumLocals uint32
+	Locals    []LocalEntry // the runs of the declared locals, excluding the params
 	Body      []byte
 }
 
+// LocalTypes expands the Locals into the types of each declared local
+func (c *CodeSegment) LocalTypes() []types.ValueType {
+	localTypes := make([]types.ValueType, 0, c.NumLocals)
+	for _, l := range c.Locals {
+		for j := uint32(0); j < l.Count; j++ {
+			localTypes = append(localTypes, l.Type)
+		}
+	}
+
+	return localTypes
+}
+
+// RunTypes returns the type of each nonempty run of the Locals, which are scanned without expanding the runs
+func (c *CodeSegment) RunTypes() []types.ValueType {
+	runTypes := make([]types.ValueType, 0, len(c.Locals))
+	for _, l := range c.Locals {
+		if l.Count > 0 {
+			runTypes = append(runTypes, l.Type)
+		}
+	}
+
+	return runTypes
+}
+
 // ReadCodeSegment reads one CodeSegment from the io.Reader
 func ReadCodeSegment(r *bytes.Reader) (*CodeSegment, error) {
 	ss, _, err := leb128decode.DecodeUint32(r)
@@ -33,6 +73,7 @@ func ReadCodeSegment(r *bytes.Reader) (*CodeSegment, error) {
 	}
 
 	var numLocals uint32
+	var locals []LocalEntry
 	var n uint32
 	for i := uint32(0); i < ls; i++ {
 		n, bytesRead, err = leb128decode.DecodeUint32(r)
@@ -42,11 +83,17 @@ func ReadCodeSegment(r *bytes.Reader) (*CodeSegment, error) {
 		} else if remaining < 0 {
 			return nil, io.EOF
 		}
+		if uint64(numLocals)+uint64(n) > MaxLocals {
+			return nil, fmt.Errorf("%w: more than %d", ErrTooManyLocals, MaxLocals)
+		}
 		numLocals += n
 
-		if _, err := r.ReadByte(); err != nil {
-			return nil, fmt.Errorf("read type of local") // TODO: save read localType
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("read type of local")
 		}
+
+		locals = append(locals, LocalEntry{Count: n, Type: types.ValueType(b)})
 	}
 
 	// extract body
@@ -63,5 +110,6 @@ func ReadCodeSegment(r *bytes.Reader) (*CodeSegment, error) {
 	return &CodeSegment{
 		Body:      body[:len(body)-1],
 		NumLocals: numLocals,
+		Locals:    locals,
 	}, nil
 }
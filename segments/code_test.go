@@ -2,16 +2,19 @@ package segments_test
 
 import (
 	"bytes"
+	"errors"
 	"reflect"
 	"testing"
 
 	"github.com/c0mm4nd/wasman/segments"
+	"github.com/c0mm4nd/wasman/types"
 )
 
 func TestReadCodeSegment(t *testing.T) {
 	buf := []byte{0x9, 0x1, 0x1, 0x1, 0x1, 0x1, 0x12, 0x3, 0x01, 0x0b}
 	exp := &segments.CodeSegment{
 		NumLocals: 0x01,
+		Locals:    []segments.LocalEntry{{Count: 0x1, Type: 0x1}},
 		Body:      []byte{0x1, 0x1, 0x12, 0x3, 0x01},
 	}
 	actual, err := segments.ReadCodeSegment(bytes.NewReader(buf))
@@ -22,3 +25,33 @@ func TestReadCodeSegment(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestReadCodeSegment_locals(t *testing.T) {
+	// (local i32 i32 i32 i64) declared in two runs
+	actual, err := segments.ReadCodeSegment(bytes.NewReader([]byte{0x6, 0x2, 0x3, 0x7f, 0x1, 0x7e, 0x0b}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i32, i64 := types.ValueTypeI32, types.ValueTypeI64
+	if exp := []types.ValueType{i32, i32, i32, i64}; !reflect.DeepEqual(actual.LocalTypes(), exp) {
+		t.Errorf("got %v, want %v", actual.LocalTypes(), exp)
+	}
+	if exp := []types.ValueType{i32, i64}; !reflect.DeepEqual(actual.RunTypes(), exp) {
+		t.Errorf("got %v, want %v", actual.RunTypes(), exp)
+	}
+
+	for _, c := range []struct {
+		buf []byte
+		err error
+	}{
+		{buf: []byte{0x8, 0x1, 0xff, 0xff, 0xff, 0xff, 0x0f, 0x7f, 0x0b}, err: segments.ErrTooManyLocals},                                     // 2^32-1 in one run
+		{buf: []byte{0xe, 0x2, 0x80, 0x80, 0x80, 0x80, 0x08, 0x7f, 0x80, 0x80, 0x80, 0x80, 0x08, 0x7f, 0x0b}, err: segments.ErrTooManyLocals}, // 2^31 + 2^31 overflowing uint32
+		{buf: []byte{0xa, 0x2, 0xa8, 0xc3, 0x01, 0x7f, 0xa9, 0xc3, 0x01, 0x7e, 0x0b}, err: segments.ErrTooManyLocals},                         // 25000 + 25001
+		{buf: []byte{0x8, 0x2, 0xa8, 0xc3, 0x01, 0x7f, 0x01, 0x7e, 0x0b}},                                                                     // 25000 + 1
+	} {
+		_, err := segments.ReadCodeSegment(bytes.NewReader(c.buf))
+		if !errors.Is(err, c.err) {
+			t.Errorf("%x: got %v, want %v", c.buf, err, c.err)
+		}
+	}
+}
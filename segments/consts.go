@@ -11,4 +11,19 @@ const (
 	KindTable    Kind = 0x01
 	KindMem      Kind = 0x02
 	KindGlobal   Kind = 0x03
+	KindTag      Kind = 0x04
+)
+
+// SegmentMode tells how the data and element segments are used
+// https://webassembly.github.io/spec/core/syntax/modules.html#data-segments
+type SegmentMode = byte
+
+// available segment modes
+const (
+	// SegmentModeActive segments copy their contents into the memory or table during instantiation
+	SegmentModeActive SegmentMode = 0x00
+	// SegmentModePassive segments can be copied later with memory.init or table.init
+	SegmentModePassive SegmentMode = 0x01
+	// SegmentModeDeclarative segments only forward-declare the references formed by ref.func
+	SegmentModeDeclarative SegmentMode = 0x02
 )
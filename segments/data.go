@@ -13,44 +13,58 @@ import (
 // a range of memory, at a given offset, with a static vector of bytes
 //
 // https://www.w3.org/TR/wasm-core-1/#data-segments%E2%91%A0
+// https://webassembly.github.io/spec/core/binary/modules.html#data-section
 type DataSegment struct {
-	MemoryIndex      uint32 // supposed to be zero
-	OffsetExpression *expr.Expression
+	Mode             SegmentMode
+	MemoryIndex      uint32           // only for the active segments
+	OffsetExpression *expr.Expression // only for the active segments
 	Init             []byte
 }
 
 // ReadDataSegment reads one DataSegment from the io.Reader
 func ReadDataSegment(r *bytes.Reader) (*DataSegment, error) {
-	d, _, err := leb128decode.DecodeUint32(r)
+	flag, _, err := leb128decode.DecodeUint32(r)
 	if err != nil {
-		return nil, fmt.Errorf("read memory index: %w", err)
+		return nil, fmt.Errorf("read data segment flag: %w", err)
 	}
 
-	if d != 0 {
-		return nil, fmt.Errorf("invalid memory index: %d", d)
+	ret := &DataSegment{}
+	switch flag {
+	case 0x00: // active, on memory 0
+	case 0x01:
+		ret.Mode = SegmentModePassive
+	case 0x02: // active, with memory index
+		ret.MemoryIndex, _, err = leb128decode.DecodeUint32(r)
+		if err != nil {
+			return nil, fmt.Errorf("read memory index: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid data segment flag: %d", flag)
 	}
 
-	expression, err := expr.ReadExpression(r)
-	if err != nil {
-		return nil, fmt.Errorf("read offset expression: %w", err)
-	}
+	if ret.Mode == SegmentModeActive {
+		expression, err := expr.ReadExpression(r)
+		if err != nil {
+			return nil, fmt.Errorf("read offset expression: %w", err)
+		}
 
-	if expression.OpCode != expr.OpCodeI32Const {
-		return nil, fmt.Errorf("offset expression must have i32.const opcodes.OpCode but go %#x", expression.OpCode)
+		// the extended constant expression is typed on the instantiation, i32 or i64 for the memory64
+
+		ret.OffsetExpression = expression
 	}
 
 	vs, _, err := leb128decode.DecodeUint32(r)
 	if err != nil {
 		return nil, fmt.Errorf("get the size of vector: %w", err)
 	}
+	if int64(vs) > int64(r.Len()) {
+		return nil, fmt.Errorf("read bytes for init: %w", io.ErrUnexpectedEOF)
+	}
 
-	b := make([]byte, vs)
-	if _, err := io.ReadFull(r, b); err != nil {
+	ret.Init = make([]byte, vs)
+	if _, err := io.ReadFull(r, ret.Init); err != nil {
 		return nil, fmt.Errorf("read bytes for init: %w", err)
 	}
 
-	return &DataSegment{
-		OffsetExpression: expression,
-		Init:             b,
-	}, nil
+	return ret, nil
 }
@@ -11,6 +11,13 @@ import (
 )
 
 func TestDataSegment(t *testing.T) {
+	t.Run("error", func(t *testing.T) {
+		_, err := segments.ReadDataSegment(bytes.NewReader([]byte{0x03, 0x01, 0x0a}))
+		if err == nil {
+			t.Fail()
+		}
+	})
+
 	for i, c := range []struct {
 		bytes []byte
 		exp   *segments.DataSegment
@@ -35,6 +42,34 @@ func TestDataSegment(t *testing.T) {
 				Init: []byte{0x0a},
 			},
 		},
+		{
+			bytes: []byte{0x01, 0x02, 0x05, 0x07},
+			exp: &segments.DataSegment{
+				Mode: segments.SegmentModePassive,
+				Init: []byte{5, 7},
+			},
+		},
+		{
+			bytes: []byte{0x02, 0x01, 0x41, 0x04, 0x0b, 0x01, 0x0a},
+			exp: &segments.DataSegment{
+				MemoryIndex: 1,
+				OffsetExpression: &expr.Expression{
+					OpCode: expr.OpCodeI32Const,
+					Data:   []byte{0x04},
+				},
+				Init: []byte{0x0a},
+			},
+		},
+		{
+			bytes: []byte{0x0, 0x42, 0x80, 0x80, 0x80, 0x80, 0x20, 0x0b, 0x01, 0x0a},
+			exp: &segments.DataSegment{
+				OffsetExpression: &expr.Expression{
+					OpCode: expr.OpCodeI64Const,
+					Data:   []byte{0x80, 0x80, 0x80, 0x80, 0x20},
+				},
+				Init: []byte{0x0a},
+			},
+		},
 	} {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
 			actual, err := segments.ReadDataSegment(bytes.NewReader(c.bytes))
@@ -3,54 +3,117 @@ package segments
 import (
 	"bytes"
 	"fmt"
+	"io"
 
 	"github.com/c0mm4nd/wasman/expr"
 	"github.com/c0mm4nd/wasman/leb128decode"
+	"github.com/c0mm4nd/wasman/types"
 )
 
 // ElemSegment is one unit of the wasm.Module's ElementsSection, initializing
 // a subrange of a table, at a given offset, from a static vector of elements.
 //
 // https://www.w3.org/TR/wasm-core-1/#element-segments%E2%91%A0
+// https://webassembly.github.io/spec/core/binary/modules.html#element-section
 type ElemSegment struct {
-	TableIndex uint32
-	OffsetExpr *expr.Expression
-	Init       []uint32
+	Mode       SegmentMode
+	TableIndex uint32           // only for the active segments
+	OffsetExpr *expr.Expression // only for the active segments
+	Type       types.ValueType  // the type of the elements, funcref or externref
+
+	// the elements are either function indices in Init
+	// or constant expressions (ref.func or ref.null) in InitExprs
+	Init      []uint32
+	InitExprs []*expr.Expression
 }
 
 // ReadElemSegment reads one ElemSegment from the io.Reader
 func ReadElemSegment(r *bytes.Reader) (*ElemSegment, error) {
-	ti, _, err := leb128decode.DecodeUint32(r)
+	flag, _, err := leb128decode.DecodeUint32(r)
 	if err != nil {
-		return nil, fmt.Errorf("get table index: %w", err)
+		return nil, fmt.Errorf("get element segment flag: %w", err)
 	}
 
-	expression, err := expr.ReadExpression(r)
-	if err != nil {
-		return nil, fmt.Errorf("read expr for offset: %w", err)
+	if flag > 0x07 {
+		return nil, fmt.Errorf("invalid element segment flag: %d", flag)
+	}
+
+	ret := &ElemSegment{Type: types.ValueTypeFuncRef}
+	switch {
+	case flag&0x01 == 0:
+		// ret.Mode = SegmentModeActive
+	case flag&0x02 == 0:
+		ret.Mode = SegmentModePassive
+	default:
+		ret.Mode = SegmentModeDeclarative
+	}
+
+	if ret.Mode == SegmentModeActive {
+		if flag&0x02 != 0 {
+			ret.TableIndex, _, err = leb128decode.DecodeUint32(r)
+			if err != nil {
+				return nil, fmt.Errorf("get table index: %w", err)
+			}
+		}
+
+		expression, err := expr.ReadExpression(r)
+		if err != nil {
+			return nil, fmt.Errorf("read expr for offset: %w", err)
+		}
+
+		// the extended constant expression is typed on the instantiation
+
+		ret.OffsetExpr = expression
 	}
 
-	if expression.OpCode != expr.OpCodeI32Const {
-		return nil, fmt.Errorf("offset expression must be i32.const but go %#x", expression.OpCode)
+	// the flag 0 and 4 use the funcref implicitly
+	if flag&0x03 != 0 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("read element kind: %w", err)
+		}
+
+		switch {
+		case flag&0x04 == 0 && b == 0x00: // elemkind funcref
+		case flag&0x04 != 0 && types.ValueType(b).IsRefType():
+			ret.Type = types.ValueType(b)
+		default:
+			return nil, fmt.Errorf("%w: invalid element type %#x", types.ErrInvalidTypeByte, b)
+		}
 	}
 
 	vs, _, err := leb128decode.DecodeUint32(r)
 	if err != nil {
 		return nil, fmt.Errorf("get size of vector: %w", err)
 	}
+	if int64(vs) > int64(r.Len()) {
+		return nil, fmt.Errorf("get size of vector: %w", io.ErrUnexpectedEOF)
+	}
+
+	if flag&0x04 != 0 {
+		ret.InitExprs = make([]*expr.Expression, vs)
+		for i := range ret.InitExprs {
+			ret.InitExprs[i], err = expr.ReadExpression(r)
+			if err != nil {
+				return nil, fmt.Errorf("read element expression: %w", err)
+			}
+
+			if op := ret.InitExprs[i].OpCode; op != expr.OpCodeFunc && op != expr.OpCodeNull {
+				return nil, fmt.Errorf("element expression must be ref.func or ref.null but got %#x", op)
+			}
+		}
+
+		return ret, nil
+	}
 
-	init := make([]uint32, vs)
-	for i := range init {
+	ret.Init = make([]uint32, vs)
+	for i := range ret.Init {
 		fIDx, _, err := leb128decode.DecodeUint32(r)
 		if err != nil {
 			return nil, fmt.Errorf("read function index: %w", err)
 		}
-		init[i] = fIDx
+		ret.Init[i] = fIDx
 	}
 
-	return &ElemSegment{
-		TableIndex: ti,
-		OffsetExpr: expression,
-		Init:       init,
-	}, nil
+	return ret, nil
 }
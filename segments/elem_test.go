@@ -8,35 +8,114 @@ import (
 
 	"github.com/c0mm4nd/wasman/expr"
 	"github.com/c0mm4nd/wasman/segments"
+	"github.com/c0mm4nd/wasman/types"
 )
 
 func TestReadElementSegment(t *testing.T) {
+	t.Run("error", func(t *testing.T) {
+		for _, b := range [][]byte{
+			{0x08, 0x41, 0x1, 0x0b, 0x00},             // invalid flag
+			{0x02, 0x00, 0x41, 0x1, 0x0b, 0x01, 0x00}, // invalid elemkind
+			{0x05, 0x70, 0x01, 0x41, 0x01, 0x0b},      // not a reference expression
+			{0x05, 0x7f, 0x01, 0xd0, 0x70, 0x0b},      // not a reference type
+		} {
+			_, err := segments.ReadElemSegment(bytes.NewReader(b))
+			if err == nil {
+				t.Fail()
+			}
+			t.Log(err)
+		}
+	})
+
 	for i, c := range []struct {
 		bytes []byte
 		exp   *segments.ElemSegment
 	}{
 		{
-			bytes: []byte{0xa, 0x41, 0x1, 0x0b, 0x02, 0x05, 0x07},
+			bytes: []byte{0x00, 0x41, 0x1, 0x0b, 0x02, 0x05, 0x07},
+			exp: &segments.ElemSegment{
+				OffsetExpr: &expr.Expression{
+					OpCode: expr.OpCodeI32Const,
+					Data:   []byte{0x01},
+				},
+				Type: 0x70,
+				Init: []uint32{5, 7},
+			},
+		},
+		{
+			bytes: []byte{0x02, 0xa, 0x41, 0x1, 0x0b, 0x00, 0x02, 0x05, 0x07},
 			exp: &segments.ElemSegment{
 				TableIndex: 10,
 				OffsetExpr: &expr.Expression{
 					OpCode: expr.OpCodeI32Const,
 					Data:   []byte{0x01},
 				},
+				Type: 0x70,
 				Init: []uint32{5, 7},
 			},
 		},
 		{
-			bytes: []byte{0x3, 0x41, 0x04, 0x0b, 0x01, 0x0a},
+			bytes: []byte{0x02, 0x3, 0x41, 0x04, 0x0b, 0x00, 0x01, 0x0a},
 			exp: &segments.ElemSegment{
 				TableIndex: 3,
 				OffsetExpr: &expr.Expression{
 					OpCode: expr.OpCodeI32Const,
 					Data:   []byte{0x04},
 				},
+				Type: 0x70,
 				Init: []uint32{10},
 			},
 		},
+		{
+			bytes: []byte{0x01, 0x00, 0x02, 0x05, 0x07},
+			exp: &segments.ElemSegment{
+				Mode: segments.SegmentModePassive,
+				Type: 0x70,
+				Init: []uint32{5, 7},
+			},
+		},
+		{
+			bytes: []byte{0x03, 0x00, 0x01, 0x05},
+			exp: &segments.ElemSegment{
+				Mode: segments.SegmentModeDeclarative,
+				Type: 0x70,
+				Init: []uint32{5},
+			},
+		},
+		{
+			bytes: []byte{0x04, 0x41, 0x1, 0x0b, 0x02, 0xd2, 0x05, 0x0b, 0xd0, 0x70, 0x0b},
+			exp: &segments.ElemSegment{
+				OffsetExpr: &expr.Expression{
+					OpCode: expr.OpCodeI32Const,
+					Data:   []byte{0x01},
+				},
+				Type: 0x70,
+				InitExprs: []*expr.Expression{
+					{OpCode: expr.OpCodeFunc, Data: []byte{0x05}},
+					{OpCode: expr.OpCodeNull, Data: []byte{0x70}},
+				},
+			},
+		},
+		{
+			bytes: []byte{0x05, 0x70, 0x01, 0xd2, 0x07, 0x0b},
+			exp: &segments.ElemSegment{
+				Mode: segments.SegmentModePassive,
+				Type: 0x70,
+				InitExprs: []*expr.Expression{
+					{OpCode: expr.OpCodeFunc, Data: []byte{0x07}},
+				},
+			},
+		},
+		{
+			bytes: []byte{0x05, 0x6f, 0x01, 0xd0, 0x6f, 0x0b},
+			exp: &segments.ElemSegment{
+				Mode: segments.SegmentModePassive,
+				Type: types.ValueTypeExternRef,
+				InitExprs: []*expr.Expression{
+					{OpCode: expr.OpCodeNull, Data: []byte{0x6f}},
+				},
+			},
+		},
 	} {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
 			actual, err := segments.ReadElemSegment(bytes.NewReader(c.bytes))
@@ -23,7 +23,7 @@ func ReadExportDesc(r *bytes.Reader) (*ExportDesc, error) {
 	}
 
 	kind := b[0]
-	if kind >= 0x04 {
+	if kind > KindTag {
 		return nil, fmt.Errorf("%w: invalid byte for exportdesc: %#x", types.ErrInvalidTypeByte, kind)
 	}
 
@@ -14,7 +14,7 @@ import (
 
 func TestReadExportDesc(t *testing.T) {
 	t.Run("ng", func(t *testing.T) {
-		buf := []byte{0x04}
+		buf := []byte{0x05}
 		_, err := segments.ReadExportDesc(bytes.NewReader(buf))
 		if !errors.Is(err, types.ErrInvalidTypeByte) {
 			t.Log(err)
@@ -42,6 +42,10 @@ func TestReadExportDesc(t *testing.T) {
 			bytes: []byte{0x03, 0x0b},
 			exp:   &segments.ExportDesc{Kind: 3, Index: 11},
 		},
+		{
+			bytes: []byte{0x04, 0x02},
+			exp:   &segments.ExportDesc{Kind: 4, Index: 2},
+		},
 	} {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
 			actual, err := segments.ReadExportDesc(bytes.NewReader(c.bytes))
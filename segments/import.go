@@ -17,6 +17,7 @@ type ImportDesc struct {
 	TableTypePtr  *types.TableType  // => table tt
 	MemTypePtr    *types.MemoryType // => mem mt
 	GlobalTypePtr *types.GlobalType // => global gt
+	TagTypePtr    *types.TagType    // => tag tt
 }
 
 // ReadImportDesc reads one ImportDesc from the io.Reader
@@ -64,6 +65,16 @@ func ReadImportDesc(r *bytes.Reader) (*ImportDesc, error) {
 			Kind:          0x03,
 			GlobalTypePtr: gt,
 		}, nil
+	case KindTag:
+		tt, err := types.ReadTagType(r)
+		if err != nil {
+			return nil, fmt.Errorf("read tag type: %w", err)
+		}
+
+		return &ImportDesc{
+			Kind:       0x04,
+			TagTypePtr: tt,
+		}, nil
 	default:
 		return nil, fmt.Errorf("%w: invalid byte for importdesc: %#x", types.ErrInvalidTypeByte, b[0])
 	}
@@ -14,7 +14,7 @@ import (
 
 func TestReadImportDesc(t *testing.T) {
 	t.Run("ng", func(t *testing.T) {
-		buf := []byte{0x04}
+		buf := []byte{0x05}
 		_, err := segments.ReadImportDesc(bytes.NewReader(buf))
 		if !errors.Is(err, types.ErrInvalidTypeByte) {
 			t.Log(err)
@@ -57,6 +57,13 @@ func TestReadImportDesc(t *testing.T) {
 				GlobalTypePtr: &types.GlobalType{ValType: types.ValueTypeI64, Mutable: true},
 			},
 		},
+		{
+			bytes: []byte{0x04, 0x00, 0x02},
+			exp: &segments.ImportDesc{
+				Kind:       4,
+				TagTypePtr: &types.TagType{Attribute: types.TagAttributeException, TypeIndex: 2},
+			},
+		},
 	} {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
 			actual, err := segments.ReadImportDesc(bytes.NewReader(c.bytes))
@@ -7,9 +7,18 @@ const (
 
 // Label acts as a signal on the workflow of the control instr
 type Label struct {
-	Arity          int
+	Arity          int // the number of values carried by a branch to the label
+	Height         int // the OperandStack pointer under the params of the block
 	EndPC          uint64
 	ContinuationPC uint64
+	Catches        []Catch // the handlers of the try_table, nil on the other blocks
+}
+
+// Catch is one catch clause of the try_table
+type Catch struct {
+	Kind  byte   // one of catch, catch_ref, catch_all and catch_all_ref
+	Tag   uint32 // the tag index, unused by catch_all and catch_all_ref
+	Label uint32 // the label index to branch to, relative to the labels outside the try_table
 }
 
 // NewLabelStack creates a new LabelStack
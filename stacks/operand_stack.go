@@ -5,10 +5,65 @@ const (
 	InitialOperandStackHeight = 1024
 )
 
+// OperandStack is the stack of the values operated by the instr.
+// Every slot holds one value, the v128 keeps its low 64 bits in Values and the high 64 bits in High
+type OperandStack struct {
+	Stack[uint64]
+	High []uint64 // the high halves of the v128 values, meaningless on the slots of the other types
+}
+
 // NewOperandStack creates a new OperandStack with no limit
-func NewOperandStack() *Stack[uint64] {
-	return &Stack[uint64]{
-		Values: make([]uint64, InitialOperandStackHeight),
-		Ptr:    -1,
+func NewOperandStack() *OperandStack {
+	return &OperandStack{
+		Stack: Stack[uint64]{
+			Values: make([]uint64, InitialOperandStackHeight),
+			Ptr:    -1,
+		},
+		High: make([]uint64, InitialOperandStackHeight),
+	}
+}
+
+// PushV128 pushes the v128 value made of the low and high 64 bits
+func (s *OperandStack) PushV128(lo, hi uint64) {
+	s.Push(lo)
+	s.SetHigh(s.Ptr, hi)
+}
+
+// PopV128 pops the v128 value as the low and high 64 bits
+func (s *OperandStack) PopV128() (lo, hi uint64) {
+	hi = s.GetHigh(s.Ptr)
+	lo = s.Pop()
+
+	return lo, hi
+}
+
+// PeekV128 returns the v128 value on the Ptr like PopV128 but Ptr does not get backspace
+func (s *OperandStack) PeekV128() (lo, hi uint64) {
+	return s.Peek(), s.GetHigh(s.Ptr)
+}
+
+// GetHigh returns the high 64 bits of the slot
+func (s *OperandStack) GetHigh(i int) uint64 {
+	if i >= len(s.High) {
+		return 0
+	}
+
+	return s.High[i]
+}
+
+// SetHigh sets the high 64 bits of the slot, High grows with the Values
+func (s *OperandStack) SetHigh(i int, hi uint64) {
+	if i >= len(s.High) {
+		s.High = append(s.High, make([]uint64, len(s.Values)-len(s.High))...)
+	}
+
+	s.High[i] = hi
+}
+
+// Move copies both halves of the slot src to the slot dst
+func (s *OperandStack) Move(dst, src int) {
+	s.Values[dst] = s.Values[src]
+	if src < len(s.High) || dst < len(s.High) {
+		s.SetHigh(dst, s.GetHigh(src))
 	}
 }
@@ -1,12 +1,24 @@
 package stacks
 
+import "errors"
+
+var (
+	// ErrStackOverflow is the panic of pushing onto the Stack full to its Limit
+	ErrStackOverflow = errors.New("stack overflow")
+)
+
 type Stack[T any] struct {
 	Values []T
 	Ptr    int
+	Limit  int // the max number of values, no limit if 0
 }
 
 func (s *Stack[T]) Push(val T) {
 	if s.Ptr+1 >= len(s.Values) {
+		if s.Limit > 0 && s.Ptr+1 >= s.Limit {
+			panic(ErrStackOverflow)
+		}
+
 		// grow stack
 		s.Values = append(s.Values, val)
 	} else {
@@ -16,6 +28,14 @@ func (s *Stack[T]) Push(val T) {
 	s.Ptr++
 }
 
+// SetLimit sets the Limit and shortens the Values over it, so that only the growth checks the Limit
+func (s *Stack[T]) SetLimit(limit int) {
+	s.Limit = limit
+	if limit > 0 && len(s.Values) > limit {
+		s.Values = s.Values[:limit]
+	}
+}
+
 // Pop will return the value on current Ptr, and backspace the Ptr
 func (s *Stack[T]) Pop() T {
 	ret := s.Values[s.Ptr]
@@ -76,3 +76,60 @@ func TestVirtualMachineLabelStack(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestVirtualMachineOperandStackV128(t *testing.T) {
+	s := stacks.NewOperandStack()
+	s.PushV128(1, 2)
+	s.Push(3)
+	if lo, hi := s.PeekV128(); lo != 3 || hi != 0 {
+		t.Fail()
+	}
+
+	s.Move(s.Ptr, s.Ptr-1)
+	if lo, hi := s.PopV128(); lo != 1 || hi != 2 {
+		t.Fail()
+	}
+
+	// verify the High grows with the Values
+	for i := 0; i < stacks.InitialOperandStackHeight+1; i++ {
+		s.PushV128(uint64(i), uint64(i)+1)
+	}
+	if len(s.High) <= stacks.InitialOperandStackHeight {
+		t.Fail()
+	}
+	if lo, hi := s.PopV128(); lo != stacks.InitialOperandStackHeight || hi != stacks.InitialOperandStackHeight+1 {
+		t.Fail()
+	}
+}
+
+func TestStack_SetLimit(t *testing.T) {
+	s := stacks.NewOperandStack()
+	s.SetLimit(3)
+	if len(s.Values) != 3 {
+		t.Fail()
+	}
+
+	overflow := func() (v interface{}) {
+		defer func() {
+			v = recover()
+		}()
+		s.Push(1)
+
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		if overflow() != nil {
+			t.Fatalf("overflow on %d values", i)
+		}
+	}
+	if overflow() != stacks.ErrStackOverflow || s.Ptr != 2 {
+		t.Fail()
+	}
+
+	// the limit over the length keeps the values
+	l := stacks.NewLabelStack()
+	l.SetLimit(stacks.InitialLabelStackHeight + 1)
+	if len(l.Values) != stacks.InitialLabelStackHeight {
+		t.Fail()
+	}
+}
@@ -11,8 +11,10 @@ import (
 // Limits classify the size range of resizeable storage associated with memory types and table types
 // https://www.w3.org/TR/wasm-core-1/#limits%E2%91%A0
 type Limits struct {
-	Min uint32
-	Max *uint32 // can be nil
+	Min    uint64
+	Max    *uint64 // can be nil
+	Is64   bool    // the memory64 flag, the memory is addressed by i64
+	Shared bool    // the threads flag, the memory is shared between the instances running concurrently
 }
 
 // ReadLimits will read a types.Limits from the io.Reader
@@ -23,25 +25,42 @@ func ReadLimits(r *bytes.Reader) (*Limits, error) {
 		return nil, fmt.Errorf("read leading byte: %w", err)
 	}
 
+	// the bits of the leading byte: 0x01 has max, 0x02 shared, 0x04 memory64
 	ret := &Limits{}
 	switch b[0] {
-	case 0x00:
-		ret.Min, _, err = leb128decode.DecodeUint32(r)
-		if err != nil {
-			return nil, fmt.Errorf("read min of limit: %w", err)
-		}
-	case 0x01:
-		ret.Min, _, err = leb128decode.DecodeUint32(r)
-		if err != nil {
-			return nil, fmt.Errorf("read min of limit: %w", err)
-		}
-		m, _, err := leb128decode.DecodeUint32(r)
+	case 0x00, 0x01:
+	case 0x03:
+		ret.Shared = true
+	case 0x04, 0x05:
+		ret.Is64 = true
+	case 0x07:
+		ret.Is64, ret.Shared = true, true
+	default:
+		return nil, fmt.Errorf("%w for limits: %#x != 0x00, 0x01, 0x03, 0x04, 0x05 or 0x07", ErrInvalidTypeByte, b[0])
+	}
+
+	ret.Min, err = readLimit(r, ret.Is64)
+	if err != nil {
+		return nil, fmt.Errorf("read min of limit: %w", err)
+	}
+
+	if b[0]&0x01 != 0 {
+		m, err := readLimit(r, ret.Is64)
 		if err != nil {
-			return nil, fmt.Errorf("read min of limit: %w", err)
+			return nil, fmt.Errorf("read max of limit: %w", err)
 		}
 		ret.Max = &m
-	default:
-		return nil, fmt.Errorf("%w for limits: %#x != 0x00 or 0x01", ErrInvalidTypeByte, b[0])
 	}
+
 	return ret, nil
 }
+
+func readLimit(r *bytes.Reader, is64 bool) (uint64, error) {
+	if is64 {
+		v, _, err := leb128decode.DecodeUint64(r)
+		return v, err
+	}
+
+	v, _, err := leb128decode.DecodeUint32(r)
+	return uint64(v), err
+}
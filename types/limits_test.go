@@ -17,7 +17,14 @@ func TestReadLimitsType(t *testing.T) {
 		exp   *types.Limits
 	}{
 		{bytes: []byte{0x00, 0xa}, exp: &types.Limits{Min: 10}},
-		{bytes: []byte{0x01, 0xa, 0xa}, exp: &types.Limits{Min: 10, Max: utils.Uint32Ptr(10)}},
+		{bytes: []byte{0x01, 0xa, 0xa}, exp: &types.Limits{Min: 10, Max: utils.Uint64Ptr(10)}},
+		{bytes: []byte{0x04, 0xa}, exp: &types.Limits{Min: 10, Is64: true}},
+		{
+			bytes: []byte{0x05, 0x01, 0x80, 0x80, 0x80, 0x80, 0x80, 0x02},
+			exp:   &types.Limits{Min: 1, Max: utils.Uint64Ptr(1 << 36), Is64: true},
+		},
+		{bytes: []byte{0x03, 0x01, 0x02}, exp: &types.Limits{Min: 1, Max: utils.Uint64Ptr(2), Shared: true}},
+		{bytes: []byte{0x07, 0x01, 0x02}, exp: &types.Limits{Min: 1, Max: utils.Uint64Ptr(2), Is64: true, Shared: true}},
 	} {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
 			actual, err := types.ReadLimits(bytes.NewReader(c.bytes))
@@ -17,7 +17,7 @@ func TestReadMemoryType(t *testing.T) {
 		exp   *types.MemoryType
 	}{
 		{bytes: []byte{0x00, 0xa}, exp: &types.MemoryType{Min: 10}},
-		{bytes: []byte{0x01, 0xa, 0xa}, exp: &types.MemoryType{Min: 10, Max: utils.Uint32Ptr(10)}},
+		{bytes: []byte{0x01, 0xa, 0xa}, exp: &types.MemoryType{Min: 10, Max: utils.Uint64Ptr(10)}},
 	} {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
 			actual, err := types.ReadMemoryType(bytes.NewReader(c.bytes))
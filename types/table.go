@@ -9,7 +9,7 @@ import (
 // TableType classify tables over elements of element types within a size range.
 // https://www.w3.org/TR/wasm-core-1/#table-types%E2%91%A0
 type TableType struct {
-	Elem   byte
+	Elem   ValueType // funcref or externref
 	Limits *Limits
 }
 
@@ -20,8 +20,9 @@ func ReadTableType(r *bytes.Reader) (*TableType, error) {
 		return nil, fmt.Errorf("read leading byte: %w", err)
 	}
 
-	if b[0] != 0x70 {
-		return nil, fmt.Errorf("%w: invalid element type %#x != %#x", ErrInvalidTypeByte, b[0], 0x70)
+	elem := ValueType(b[0])
+	if !elem.IsRefType() {
+		return nil, fmt.Errorf("%w: invalid element type %#x", ErrInvalidTypeByte, b[0])
 	}
 
 	lm, err := ReadLimits(r)
@@ -29,8 +30,12 @@ func ReadTableType(r *bytes.Reader) (*TableType, error) {
 		return nil, fmt.Errorf("read limits: %w", err)
 	}
 
+	if lm.Shared {
+		return nil, fmt.Errorf("%w: table cannot be shared", ErrInvalidTypeByte)
+	}
+
 	return &TableType{
-		Elem:   0x70,
+		Elem:   elem,
 		Limits: lm,
 	}, nil
 }
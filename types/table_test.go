@@ -37,7 +37,14 @@ func TestReadTableType(t *testing.T) {
 			bytes: []byte{0x70, 0x01, 0x01, 0xa},
 			exp: &types.TableType{
 				Elem:   0x70,
-				Limits: &types.Limits{Min: 1, Max: utils.Uint32Ptr(10)},
+				Limits: &types.Limits{Min: 1, Max: utils.Uint64Ptr(10)},
+			},
+		},
+		{
+			bytes: []byte{0x6f, 0x00, 0x2},
+			exp: &types.TableType{
+				Elem:   types.ValueTypeExternRef,
+				Limits: &types.Limits{Min: 2},
 			},
 		},
 	} {
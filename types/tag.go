@@ -0,0 +1,38 @@
+package types
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/c0mm4nd/wasman/leb128decode"
+)
+
+// TagAttributeException is the only attribute of the tags, which means the tag is used by the exceptions
+const TagAttributeException byte = 0x00
+
+// TagType classify the exception tags by the function type whose params are the payload of the exceptions
+// https://webassembly.github.io/exception-handling/core/syntax/types.html#tag-types
+type TagType struct {
+	Attribute byte
+	TypeIndex uint32
+}
+
+// ReadTagType will read a types.TagType from the io.Reader
+func ReadTagType(r *bytes.Reader) (*TagType, error) {
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("read attribute: %w", err)
+	}
+
+	if b[0] != TagAttributeException {
+		return nil, fmt.Errorf("%w for tag attribute: %#x != 0x00", ErrInvalidTypeByte, b[0])
+	}
+
+	ti, _, err := leb128decode.DecodeUint32(r)
+	if err != nil {
+		return nil, fmt.Errorf("read type index: %w", err)
+	}
+
+	return &TagType{Attribute: b[0], TypeIndex: ti}, nil
+}
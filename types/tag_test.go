@@ -0,0 +1,40 @@
+package types_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/c0mm4nd/wasman/types"
+)
+
+func TestReadTagType(t *testing.T) {
+	t.Run("ng", func(t *testing.T) {
+		buf := []byte{0x01, 0x00}
+		_, err := types.ReadTagType(bytes.NewReader(buf))
+		if !errors.Is(err, types.ErrInvalidTypeByte) {
+			t.Log(err)
+			t.Fail()
+		}
+	})
+
+	for i, c := range []struct {
+		bytes []byte
+		exp   *types.TagType
+	}{
+		{bytes: []byte{0x00, 0x00}, exp: &types.TagType{Attribute: types.TagAttributeException, TypeIndex: 0}},
+		{bytes: []byte{0x00, 0x80, 0x01}, exp: &types.TagType{Attribute: types.TagAttributeException, TypeIndex: 128}},
+	} {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			actual, err := types.ReadTagType(bytes.NewReader(c.bytes))
+			if err != nil {
+				t.Fail()
+			}
+			if !reflect.DeepEqual(c.exp, actual) {
+				t.Fail()
+			}
+		})
+	}
+}
@@ -26,6 +26,14 @@ const (
 	ValueTypeF32 ValueType = 0x7d
 	// ValueTypeF64 classify 64 bit floating-point data, known as double
 	ValueTypeF64 ValueType = 0x7c
+	// ValueTypeV128 classify 128 bit vectors of packed integer or floating-point data
+	ValueTypeV128 ValueType = 0x7b
+	// ValueTypeFuncRef classify the references to functions
+	ValueTypeFuncRef ValueType = 0x70
+	// ValueTypeExternRef classify the opaque references to the objects owned by the host
+	ValueTypeExternRef ValueType = 0x6f
+	// ValueTypeExnRef classify the references to the exceptions caught by try_table
+	ValueTypeExnRef ValueType = 0x69
 )
 
 // String will convert the types.ValueType into a string
@@ -39,6 +47,14 @@ func (v ValueType) String() string {
 		return "f32"
 	case ValueTypeF64:
 		return "f64"
+	case ValueTypeV128:
+		return "v128"
+	case ValueTypeFuncRef:
+		return "funcref"
+	case ValueTypeExternRef:
+		return "externref"
+	case ValueTypeExnRef:
+		return "exnref"
 	default:
 		return "unknown value type"
 	}
@@ -46,6 +62,10 @@ func (v ValueType) String() string {
 
 // ReadValueTypes will read a types.ValueType from the io.Reader
 func ReadValueTypes(r io.Reader, num uint32) ([]ValueType, error) {
+	if l, ok := r.(interface{ Len() int }); ok && int64(num) > int64(l.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
 	ret := make([]ValueType, num)
 	buf := make([]byte, num)
 	_, err := io.ReadFull(r, buf)
@@ -55,7 +75,7 @@ func ReadValueTypes(r io.Reader, num uint32) ([]ValueType, error) {
 
 	for i, v := range buf {
 		switch vt := ValueType(v); vt {
-		case ValueTypeI32, ValueTypeF32, ValueTypeI64, ValueTypeF64:
+		case ValueTypeI32, ValueTypeF32, ValueTypeI64, ValueTypeF64, ValueTypeV128, ValueTypeFuncRef, ValueTypeExternRef, ValueTypeExnRef:
 			ret[i] = vt
 		default:
 			return nil, fmt.Errorf("invalid value type: %d", vt)
@@ -70,6 +90,9 @@ func ReadNameValue(r *bytes.Reader) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("read size of name: %w", err)
 	}
+	if int64(vs) > int64(r.Len()) {
+		return "", fmt.Errorf("read bytes of name: %w", io.ErrUnexpectedEOF)
+	}
 
 	buf := make([]byte, vs)
 	if _, err := io.ReadFull(r, buf); err != nil {
@@ -79,6 +102,11 @@ func ReadNameValue(r *bytes.Reader) (string, error) {
 	return string(buf), nil
 }
 
+// IsRefType reports whether the types.ValueType is a reference type
+func (v ValueType) IsRefType() bool {
+	return v == ValueTypeFuncRef || v == ValueTypeExternRef || v == ValueTypeExnRef
+}
+
 // HasSameSignature will verify whether the two types.ValueType are same
 func HasSameSignature(a []ValueType, b []ValueType) bool {
 	if len(a) != len(b) {
@@ -28,6 +28,15 @@ func TestReadValueTypes(t *testing.T) {
 			bytes: []byte{0x7f, 0x7e, 0x7d, 0x7c}, num: 4,
 			exp: []types.ValueType{types.ValueTypeI32, types.ValueTypeI64, types.ValueTypeF32, types.ValueTypeF64},
 		},
+		{
+			bytes: []byte{0x7b}, num: 1, exp: []types.ValueType{types.ValueTypeV128},
+		},
+		{
+			bytes: []byte{0x70, 0x6f}, num: 2, exp: []types.ValueType{types.ValueTypeFuncRef, types.ValueTypeExternRef},
+		},
+		{
+			bytes: []byte{0x69}, num: 1, exp: []types.ValueType{types.ValueTypeExnRef},
+		},
 	} {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
 			actual, err := types.ReadValueTypes(bytes.NewReader(c.bytes), c.num)
@@ -3,3 +3,7 @@ package utils
 func Uint32Ptr(u uint32) *uint32 {
 	return &u
 }
+
+func Uint64Ptr(u uint64) *uint64 {
+	return &u
+}
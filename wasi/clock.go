@@ -0,0 +1,203 @@
+package wasi
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/c0mm4nd/wasman/wasm"
+)
+
+// the clock ids
+const (
+	clockRealtime  = 0
+	clockMonotonic = 1
+)
+
+// the layouts of poll_oneoff
+const (
+	subscriptionSize = 48
+	eventSize        = 32
+
+	eventTypeClock   = 0
+	eventTypeFdRead  = 1
+	eventTypeFdWrite = 2
+
+	subscriptionClockAbstime = 1
+)
+
+// virtual reports whether the clocks are the virtual ones of the config
+func (s *system) virtual() bool {
+	return s.ClockStep != 0 || s.ClockToll != nil
+}
+
+// checkClock returns the errno of reading the clock
+func (s *system) checkClock(id uint32) Errno {
+	switch {
+	case id != clockRealtime && id != clockMonotonic:
+		return EINVAL
+	case s.Deterministic && !s.virtual():
+		return ENOSYS
+	default:
+		return ESUCCESS
+	}
+}
+
+// now returns the time of the clock in nanoseconds, which advances the virtual clocks by the step
+func (s *system) now(id uint32) (uint64, Errno) {
+	if errno := s.checkClock(id); errno != ESUCCESS {
+		return 0, errno
+	}
+
+	if s.virtual() {
+		s.mu.Lock()
+		s.elapsed += s.ClockStep
+		t := s.elapsed
+		s.mu.Unlock()
+
+		if s.ClockToll != nil {
+			t += s.ClockToll.GetToll() - s.tollBase
+		}
+		if id == clockRealtime {
+			t += s.ClockEpoch
+		}
+
+		return t, ESUCCESS
+	}
+
+	if id == clockRealtime {
+		return uint64(time.Now().UnixNano()), ESUCCESS
+	}
+
+	return uint64(time.Since(s.start).Nanoseconds()), ESUCCESS
+}
+
+// sleep waits for the timeout in nanoseconds, interrupted by the context of the instance.
+// The virtual clocks are advanced by the timeout instead
+func (s *system) sleep(ins *wasm.Instance, timeout uint64) Errno {
+	if s.virtual() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.elapsed > math.MaxUint64-timeout {
+			s.elapsed = math.MaxUint64
+		} else {
+			s.elapsed += timeout
+		}
+
+		return ESUCCESS
+	}
+
+	d := time.Duration(math.MaxInt64)
+	if timeout < math.MaxInt64 {
+		d = time.Duration(timeout)
+	}
+	timer := time.NewTimer(d)
+	select {
+	case <-timer.C:
+		return ESUCCESS
+	case <-ins.Context().Done():
+		timer.Stop()
+		return EINTR
+	}
+}
+
+func (s *system) clockResGet(ins *wasm.Instance, args []uint64) Errno {
+	if errno := s.checkClock(uint32(args[0])); errno != ESUCCESS {
+		return errno
+	}
+
+	return errnoOf(memoryOf(ins).putUint64(uint32(args[1]), 1))
+}
+
+func (s *system) clockTimeGet(ins *wasm.Instance, args []uint64) Errno {
+	t, errno := s.now(uint32(args[0]))
+	if errno != ESUCCESS {
+		return errno
+	}
+
+	return errnoOf(memoryOf(ins).putUint64(uint32(args[2]), t))
+}
+
+// pollOneoff waits for the earliest clock subscriptions. The fd subscriptions are always ready,
+// and the wait is interrupted by the context of the instance
+func (s *system) pollOneoff(ins *wasm.Instance, args []uint64) Errno {
+	if s.Deterministic && !s.virtual() {
+		return ENOSYS
+	}
+
+	mem := memoryOf(ins)
+	in, out, n := uint32(args[0]), uint32(args[1]), uint32(args[2])
+	if n == 0 || n > math.MaxUint32/subscriptionSize {
+		return EINVAL
+	}
+
+	subs, err := mem.read(in, n*subscriptionSize)
+	if err != nil {
+		return errnoOf(err)
+	}
+
+	// the events ready right now, or else the clocks waited by their timeouts
+	var ready, clocks [][]byte
+	var timeouts []uint64
+	for i := uint32(0); i < n; i++ {
+		sub := subs[i*subscriptionSize : (i+1)*subscriptionSize]
+		event := make([]byte, eventSize)
+		copy(event, sub[:8]) // userdata
+		event[10] = sub[8]
+
+		switch sub[8] {
+		case eventTypeClock:
+			id := binary.LittleEndian.Uint32(sub[16:])
+			timeout := binary.LittleEndian.Uint64(sub[24:])
+			now, errno := s.now(id)
+			if errno != ESUCCESS {
+				binary.LittleEndian.PutUint16(event[8:], uint16(errno))
+				ready = append(ready, event)
+				continue
+			}
+			if binary.LittleEndian.Uint16(sub[40:])&subscriptionClockAbstime != 0 {
+				if timeout > now {
+					timeout -= now
+				} else {
+					timeout = 0
+				}
+			}
+			clocks, timeouts = append(clocks, event), append(timeouts, timeout)
+		case eventTypeFdRead, eventTypeFdWrite:
+			if s.file(binary.LittleEndian.Uint32(sub[16:])) == nil {
+				binary.LittleEndian.PutUint16(event[8:], uint16(EBADF))
+			}
+			ready = append(ready, event)
+		default:
+			return EINVAL
+		}
+	}
+
+	if len(ready) == 0 {
+		min := timeouts[0]
+		for _, t := range timeouts {
+			if t < min {
+				min = t
+			}
+		}
+
+		if errno := s.sleep(ins, min); errno != ESUCCESS {
+			return errno
+		}
+
+		for i, t := range timeouts {
+			if t == min {
+				ready = append(ready, clocks[i])
+			}
+		}
+	}
+
+	for i, event := range ready {
+		if err := mem.write(out+uint32(i)*eventSize, event); err != nil {
+			return errnoOf(err)
+		}
+	}
+
+	return errnoOf(mem.putUint32(uint32(args[3]), uint32(len(ready))))
+}
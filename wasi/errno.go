@@ -0,0 +1,70 @@
+package wasi
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+
+	"github.com/c0mm4nd/wasman/wasi/vfs"
+	"github.com/c0mm4nd/wasman/wasm"
+)
+
+// Errno is the error code returned by the WASI syscalls, https://github.com/WebAssembly/WASI/blob/main/legacy/preview1/docs.md#errno
+type Errno uint32
+
+// the errno used by the syscalls
+const (
+	ESUCCESS     Errno = 0
+	EACCES       Errno = 2
+	EBADF        Errno = 8
+	EEXIST       Errno = 20
+	EFAULT       Errno = 21
+	EINTR        Errno = 27
+	EINVAL       Errno = 28
+	EIO          Errno = 29
+	EISDIR       Errno = 31
+	ENAMETOOLONG Errno = 37
+	ENOENT       Errno = 44
+	ENOSYS       Errno = 52
+	ENOTDIR      Errno = 54
+	ENOTEMPTY    Errno = 55
+	ENOTSUP      Errno = 58
+	EPERM        Errno = 63
+	EROFS        Errno = 69
+	ESPIPE       Errno = 70
+	ENOTCAPABLE  Errno = 76
+)
+
+// errnoOf converts the error of the memory or the filesystems into the Errno
+func errnoOf(err error) Errno {
+	switch {
+	case err == nil:
+		return ESUCCESS
+	case errors.Is(err, wasm.ErrPtrOutOfBounds):
+		return EFAULT
+	case errors.Is(err, vfs.ErrEscape):
+		return ENOTCAPABLE
+	case errors.Is(err, vfs.ErrReadOnly), errors.Is(err, syscall.EROFS):
+		return EROFS
+	case errors.Is(err, fs.ErrNotExist):
+		return ENOENT
+	case errors.Is(err, fs.ErrExist):
+		return EEXIST
+	case errors.Is(err, fs.ErrPermission):
+		return EACCES
+	case errors.Is(err, fs.ErrClosed):
+		return EBADF
+	case errors.Is(err, fs.ErrInvalid):
+		return EINVAL
+	case errors.Is(err, syscall.EISDIR):
+		return EISDIR
+	case errors.Is(err, syscall.ENOTDIR):
+		return ENOTDIR
+	case errors.Is(err, syscall.ENOTEMPTY):
+		return ENOTEMPTY
+	case errors.Is(err, syscall.ESPIPE):
+		return ESPIPE
+	default:
+		return EIO
+	}
+}
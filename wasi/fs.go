@@ -0,0 +1,412 @@
+package wasi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/c0mm4nd/wasman/wasi/vfs"
+	"github.com/c0mm4nd/wasman/wasm"
+)
+
+// the file types
+const (
+	filetypeCharacterDevice = 2
+	filetypeDirectory       = 3
+	filetypeRegularFile     = 4
+)
+
+// the flags of path_open
+const (
+	oflagsCreat     = 1 << 0
+	oflagsDirectory = 1 << 1
+	oflagsExcl      = 1 << 2
+	oflagsTrunc     = 1 << 3
+
+	fdflagsAppend = 1 << 0
+)
+
+// the rights
+const (
+	rightFdRead  = 1 << 1
+	rightFdWrite = 1 << 6
+	rightsAll    = 1<<29 - 1
+)
+
+// the layouts of fd_fdstat_get and fd_prestat_get
+const (
+	fdstatSize  = 24
+	prestatSize = 8
+	iovecSize   = 8
+)
+
+// fileDesc is an entry of the fd table
+type fileDesc struct {
+	file     interface{} // the io.Reader, io.Writer, io.Seeker and io.Closer it implements, nil for the directories
+	readable bool
+	writable bool
+	closable bool // whether the file is closed with the fd, false for the stdio
+	full     bool // whether the fd_read fills the buffers by io.ReadFull, for the stdin of the Deterministic
+	filetype uint8
+
+	fsys     vfs.FS // the filesystem of the directory, nil for the files
+	dir      string // the path of the directory in the fsys
+	readOnly bool   // whether the files under the directory are read-only
+	preopen  string // the guest path of the preopened directory, empty for the others
+}
+
+// openFiles fills the fd table with the stdio and the preopens
+func (s *system) openFiles() error {
+	var stdin io.Reader = bytes.NewReader(nil)
+	if s.Stdin != nil {
+		stdin = s.Stdin
+	}
+	stdout, stderr := io.Discard, io.Discard
+	if s.Stdout != nil {
+		stdout = s.Stdout
+	}
+	if s.Stderr != nil {
+		stderr = s.Stderr
+	}
+
+	s.files = []*fileDesc{
+		{file: stdin, readable: true, full: s.Deterministic, filetype: filetypeCharacterDevice},
+		{file: stdout, writable: true, filetype: filetypeCharacterDevice},
+		{file: stderr, writable: true, filetype: filetypeCharacterDevice},
+	}
+
+	for _, p := range s.Preopens {
+		fsys := p.FS
+		if fsys == nil {
+			fsys = vfs.Dir(p.HostPath)
+		}
+
+		info, err := fsys.Stat(".")
+		if err != nil {
+			return fmt.Errorf("preopen %s: %w", p.GuestPath, err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("preopen %s: the root is not a directory", p.GuestPath)
+		}
+
+		s.files = append(s.files, &fileDesc{
+			filetype: filetypeDirectory,
+			fsys:     fsys,
+			dir:      ".",
+			readOnly: p.ReadOnly,
+			preopen:  p.GuestPath,
+		})
+	}
+
+	return nil
+}
+
+// file returns the entry of the fd, nil if it is not open
+func (s *system) file(fd uint32) *fileDesc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if fd >= uint32(len(s.files)) {
+		return nil
+	}
+
+	return s.files[fd]
+}
+
+// addFile puts the entry on the least closed fd after the stdio
+func (s *system) addFile(f *fileDesc) uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for fd := 3; fd < len(s.files); fd++ {
+		if s.files[fd] == nil {
+			s.files[fd] = f
+			return uint32(fd)
+		}
+	}
+	s.files = append(s.files, f)
+
+	return uint32(len(s.files) - 1)
+}
+
+// iovecs reads the buffers of the iovec array in the memory, which are copied out of the memory
+func (m memory) iovecs(iovs, n uint32) ([][]byte, []uint32, error) {
+	if n > math.MaxUint32/iovecSize {
+		return nil, nil, wasm.ErrPtrOutOfBounds
+	}
+	arr, err := m.read(iovs, n*iovecSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bufs := make([][]byte, n)
+	ptrs := make([]uint32, n)
+	for i := range bufs {
+		ptrs[i] = binary.LittleEndian.Uint32(arr[i*iovecSize:])
+		bufs[i], err = m.read(ptrs[i], binary.LittleEndian.Uint32(arr[i*iovecSize+4:]))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return bufs, ptrs, nil
+}
+
+func (s *system) fdRead(ins *wasm.Instance, args []uint64) Errno {
+	f := s.file(uint32(args[0]))
+	if f == nil || !f.readable {
+		return EBADF
+	}
+	r, ok := f.file.(io.Reader)
+	if !ok {
+		return EBADF
+	}
+
+	mem := memoryOf(ins)
+	bufs, ptrs, err := mem.iovecs(uint32(args[1]), uint32(args[2]))
+	if err != nil {
+		return errnoOf(err)
+	}
+
+	var total uint32
+	for i, buf := range bufs {
+		var n int
+		var err error
+		if f.full {
+			n, err = io.ReadFull(r, buf)
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+		} else {
+			n, err = r.Read(buf)
+		}
+		if werr := mem.write(ptrs[i], buf[:n]); werr != nil {
+			return errnoOf(werr)
+		}
+		total += uint32(n)
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errnoOf(err)
+		}
+		if n < len(buf) {
+			break
+		}
+	}
+
+	return errnoOf(mem.putUint32(uint32(args[3]), total))
+}
+
+func (s *system) fdWrite(ins *wasm.Instance, args []uint64) Errno {
+	f := s.file(uint32(args[0]))
+	if f == nil || !f.writable {
+		return EBADF
+	}
+	w, ok := f.file.(io.Writer)
+	if !ok {
+		return EBADF
+	}
+
+	mem := memoryOf(ins)
+	bufs, _, err := mem.iovecs(uint32(args[1]), uint32(args[2]))
+	if err != nil {
+		return errnoOf(err)
+	}
+
+	var total uint32
+	for _, buf := range bufs {
+		n, err := w.Write(buf)
+		total += uint32(n)
+		if err != nil {
+			return errnoOf(err)
+		}
+	}
+
+	return errnoOf(mem.putUint32(uint32(args[3]), total))
+}
+
+func (s *system) fdSeek(ins *wasm.Instance, args []uint64) Errno {
+	f := s.file(uint32(args[0]))
+	if f == nil || f.file == nil {
+		return EBADF
+	}
+	seeker, ok := f.file.(io.Seeker)
+	if !ok || f.filetype == filetypeCharacterDevice {
+		return ESPIPE
+	}
+
+	whence := uint32(args[2])
+	if whence > io.SeekEnd {
+		return EINVAL
+	}
+
+	pos, err := seeker.Seek(int64(args[1]), int(whence))
+	if err != nil {
+		return errnoOf(err)
+	}
+
+	return errnoOf(memoryOf(ins).putUint64(uint32(args[3]), uint64(pos)))
+}
+
+func (s *system) fdClose(_ *wasm.Instance, args []uint64) Errno {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fd := uint32(args[0])
+	if fd >= uint32(len(s.files)) || s.files[fd] == nil {
+		return EBADF
+	}
+
+	f := s.files[fd]
+	s.files[fd] = nil
+	if c, ok := f.file.(io.Closer); ok && f.closable {
+		return errnoOf(c.Close())
+	}
+
+	return ESUCCESS
+}
+
+func (s *system) fdFdstatGet(ins *wasm.Instance, args []uint64) Errno {
+	f := s.file(uint32(args[0]))
+	if f == nil {
+		return EBADF
+	}
+
+	// the stdio has no right to seek, which makes them the tty for the libc
+	var rights uint64 = rightsAll
+	if f.filetype == filetypeCharacterDevice {
+		rights = 0
+		if f.readable {
+			rights |= rightFdRead
+		}
+		if f.writable {
+			rights |= rightFdWrite
+		}
+	}
+
+	stat := make([]byte, fdstatSize)
+	stat[0] = f.filetype
+	binary.LittleEndian.PutUint64(stat[8:], rights)
+	binary.LittleEndian.PutUint64(stat[16:], rights)
+
+	return errnoOf(memoryOf(ins).write(uint32(args[1]), stat))
+}
+
+func (s *system) fdPrestatGet(ins *wasm.Instance, args []uint64) Errno {
+	f := s.file(uint32(args[0]))
+	if f == nil || f.preopen == "" {
+		return EBADF
+	}
+
+	stat := make([]byte, prestatSize) // the tag 0 is the directory
+	binary.LittleEndian.PutUint32(stat[4:], uint32(len(f.preopen)))
+
+	return errnoOf(memoryOf(ins).write(uint32(args[1]), stat))
+}
+
+func (s *system) fdPrestatDirName(ins *wasm.Instance, args []uint64) Errno {
+	f := s.file(uint32(args[0]))
+	if f == nil || f.preopen == "" {
+		return EBADF
+	}
+	if uint32(args[2]) < uint32(len(f.preopen)) {
+		return ENAMETOOLONG
+	}
+
+	return errnoOf(memoryOf(ins).write(uint32(args[1]), []byte(f.preopen)))
+}
+
+// resolve joins the relative path onto the directory, rejecting the absolute path and the one going out of the dir lexically
+func resolve(dir, p string) (string, Errno) {
+	clean := path.Clean(p)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", ENOTCAPABLE
+	}
+
+	return path.Join(dir, clean), ESUCCESS
+}
+
+func (s *system) pathOpen(ins *wasm.Instance, args []uint64) Errno {
+	d := s.file(uint32(args[0]))
+	if d == nil {
+		return EBADF
+	}
+	if d.fsys == nil {
+		return ENOTDIR
+	}
+
+	mem := memoryOf(ins)
+	p, err := mem.read(uint32(args[2]), uint32(args[3]))
+	if err != nil {
+		return errnoOf(err)
+	}
+	name, errno := resolve(d.dir, string(p))
+	if errno != ESUCCESS {
+		return errno
+	}
+	dir := &fileDesc{filetype: filetypeDirectory, fsys: d.fsys, dir: name, readOnly: d.readOnly}
+
+	oflags, rights, fdflags := uint32(args[4]), args[5], uint32(args[7])
+	if oflags&oflagsDirectory != 0 {
+		info, err := d.fsys.Stat(name)
+		if err != nil {
+			return errnoOf(err)
+		}
+		if !info.IsDir() {
+			return ENOTDIR
+		}
+
+		return errnoOf(mem.putUint32(uint32(args[8]), s.addFile(dir)))
+	}
+
+	readable, writable := rights&rightFdRead != 0, rights&rightFdWrite != 0
+	flag := os.O_RDONLY
+	switch {
+	case readable && writable:
+		flag = os.O_RDWR
+	case writable:
+		flag = os.O_WRONLY
+	default:
+		readable = true
+	}
+	if oflags&oflagsCreat != 0 {
+		flag |= os.O_CREATE
+	}
+	if oflags&oflagsExcl != 0 {
+		flag |= os.O_EXCL
+	}
+	if oflags&oflagsTrunc != 0 {
+		flag |= os.O_TRUNC
+	}
+	if fdflags&fdflagsAppend != 0 {
+		flag |= os.O_APPEND
+	}
+	if d.readOnly && flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0 {
+		return EROFS
+	}
+
+	file, err := d.fsys.OpenFile(name, flag, 0o644)
+	if err != nil {
+		return errnoOf(err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errnoOf(err)
+	}
+
+	f := &fileDesc{file: file, readable: readable, writable: writable, closable: true, filetype: filetypeRegularFile}
+	if info.IsDir() {
+		file.Close()
+		f = dir
+	}
+
+	return errnoOf(mem.putUint32(uint32(args[8]), s.addFile(f)))
+}
@@ -0,0 +1,14 @@
+package vfs
+
+// dirFS is the FS rooted at a directory on the host
+type dirFS string
+
+// Dir returns the FS of the files under the host directory root. The names are neither
+// allowed to go out of the root lexically nor through the symlinks, failing with ErrEscape.
+//
+// On linux, the names are walked from the root by openat with O_NOFOLLOW on each component,
+// so the symlinks swapped in by the host during the walk cannot lead out of the root.
+// On the others, the real path is checked before the open, which races with such a swap
+func Dir(root string) FS {
+	return dirFS(root)
+}
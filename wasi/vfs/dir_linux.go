@@ -0,0 +1,144 @@
+package vfs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// maxSymlinks is the max symlinks followed in a name, same to the MAXSYMLINKS of linux
+	maxSymlinks = 40
+	// oPath is the O_PATH, opening the file only for the fd itself, which the syscall lacks on some arches
+	oPath = 0x200000
+)
+
+// open opens the name under the root by walking it from the fd of the root. The symlinks are read
+// and resolved here, and every component is opened by openat with O_NOFOLLOW relative to its parent,
+// so a symlink swapped in after being read fails the open instead of leading out of the root
+func (d dirFS) open(name string, flag int, perm fs.FileMode) (int, error) {
+	if !fs.ValidPath(name) {
+		return -1, ErrEscape
+	}
+
+	root, err := syscall.Open(string(d), syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	dirs := []int{root} // the fds of the directories walked from the root
+	defer func() {
+		for _, fd := range dirs {
+			syscall.Close(fd)
+		}
+	}()
+
+	parts := strings.Split(name, "/")
+	for links := 0; ; {
+		for len(parts) > 0 && (parts[0] == "." || parts[0] == "") {
+			parts = parts[1:]
+		}
+		dir := dirs[len(dirs)-1]
+		if len(parts) == 0 {
+			return syscall.Openat(dir, ".", flag|syscall.O_CLOEXEC, uint32(perm.Perm()))
+		}
+
+		part := parts[0]
+		parts = parts[1:]
+		if part == ".." {
+			if len(dirs) == 1 {
+				return -1, ErrEscape
+			}
+			syscall.Close(dir)
+			dirs = dirs[:len(dirs)-1]
+			continue
+		}
+
+		target, err := readlinkat(dir, part)
+		switch err {
+		case nil:
+			if links++; links > maxSymlinks {
+				return -1, syscall.ELOOP
+			}
+			if filepath.IsAbs(target) {
+				if target, err = d.relative(target); err != nil {
+					return -1, err
+				}
+				for _, fd := range dirs[1:] {
+					syscall.Close(fd)
+				}
+				dirs = dirs[:1]
+			}
+			parts = append(strings.Split(target, "/"), parts...)
+			continue
+		case syscall.EINVAL, syscall.ENOENT: // not a symlink, or created by the open
+		default:
+			return -1, err
+		}
+
+		if len(parts) == 0 {
+			return syscall.Openat(dir, part, flag|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, uint32(perm.Perm()))
+		}
+		fd, err := syscall.Openat(dir, part, oPath|syscall.O_DIRECTORY|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return -1, err
+		}
+		dirs = append(dirs, fd)
+	}
+}
+
+// relative converts the absolute target of a symlink into the slash-separated path relative to the real root
+func (d dirFS) relative(target string) (string, error) {
+	root, err := filepath.EvalSymlinks(string(d))
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrEscape
+	}
+
+	return filepath.ToSlash(rel), nil
+}
+
+// readlinkat reads the symlink name in the directory fd, failing with EINVAL if it is not a symlink
+func readlinkat(fd int, name string) (string, error) {
+	p, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return "", err
+	}
+
+	for buf := make([]byte, 256); ; buf = make([]byte, len(buf)*2) {
+		n, _, errno := syscall.Syscall6(syscall.SYS_READLINKAT, uintptr(fd), uintptr(unsafe.Pointer(p)),
+			uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0, 0)
+		if errno != 0 {
+			return "", errno
+		}
+		if int(n) < len(buf) {
+			return string(buf[:n]), nil
+		}
+	}
+}
+
+func (d dirFS) OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	fd, err := d.open(name, flag, perm)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return os.NewFile(uintptr(fd), filepath.Join(string(d), name)), nil
+}
+
+func (d dirFS) Stat(name string) (fs.FileInfo, error) {
+	fd, err := d.open(name, oPath, 0)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	f := os.NewFile(uintptr(fd), filepath.Join(string(d), name))
+	defer f.Close()
+
+	return f.Stat()
+}
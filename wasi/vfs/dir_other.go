@@ -0,0 +1,76 @@
+//go:build !linux
+
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// path converts the name into the host path after checking it stays under the root.
+// The check is done on the path, so a symlink swapped in between the check and the use is not caught
+func (d dirFS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: ErrEscape}
+	}
+
+	root, err := filepath.EvalSymlinks(string(d))
+	if err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	p := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := within(root, p); err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	return p, nil
+}
+
+// within checks the real path of p is under the real root. The missing p is checked by its
+// nearest existing parent, but the dangling symlink is rejected as it would be created through
+func within(root, p string) error {
+	for {
+		real, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			rel, err := filepath.Rel(root, real)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return ErrEscape
+			}
+			return nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if _, err := os.Lstat(p); err == nil {
+			return ErrEscape
+		}
+
+		parent := filepath.Dir(p)
+		if parent == p {
+			return ErrEscape
+		}
+		p = parent
+	}
+}
+
+func (d dirFS) OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	p, err := d.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(p, flag, perm)
+}
+
+func (d dirFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := d.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Stat(p)
+}
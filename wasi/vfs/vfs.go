@@ -0,0 +1,47 @@
+// Package vfs provides the filesystems preopened for the WASI guests
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+var (
+	ErrReadOnly = errors.New("read-only filesystem")
+	ErrEscape   = errors.New("path escapes from the root")
+)
+
+// FS is the filesystem on which the guest opens the files.
+// The names are slash-separated and unrooted as fs.ValidPath, in which "." is the root.
+//
+// The files opened for writing implement io.Writer, and the seekable ones implement io.Seeker
+type FS interface {
+	OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error)
+	Stat(name string) (fs.FileInfo, error)
+}
+
+// writeFlags are the flags of os.OpenFile modifying the files
+const writeFlags = os.O_WRONLY | os.O_RDWR | os.O_CREATE | os.O_TRUNC | os.O_APPEND
+
+// readOnlyFS adapts the fs.FS
+type readOnlyFS struct {
+	fsys fs.FS
+}
+
+// ReadOnly adapts the fs.FS, like the embed.FS, into the FS which fails opening the files for writing
+func ReadOnly(fsys fs.FS) FS {
+	return readOnlyFS{fsys: fsys}
+}
+
+func (r readOnlyFS) OpenFile(name string, flag int, _ fs.FileMode) (fs.File, error) {
+	if flag&writeFlags != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrReadOnly}
+	}
+
+	return r.fsys.Open(name)
+}
+
+func (r readOnlyFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(r.fsys, name)
+}
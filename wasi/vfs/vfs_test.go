@@ -0,0 +1,170 @@
+package vfs_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"testing/fstest"
+
+	"github.com/c0mm4nd/wasman/wasi/vfs"
+)
+
+func TestDir(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "out")); err != nil {
+		t.Skip(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "new.txt"), filepath.Join(root, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(root, "in")); err != nil {
+		t.Fatal(err)
+	}
+
+	real, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(real, "a.txt"), filepath.Join(root, "abs")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../a.txt", filepath.Join(root, "sub", "up")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../a.txt", filepath.Join(root, "sub", "above")); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := vfs.Dir(root)
+	for _, name := range []string{"a.txt", "in", "abs", "sub/up"} {
+		f, err := fsys.OpenFile(name, os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		f.Close()
+	}
+
+	f, err := fsys.OpenFile("sub.txt", os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	for _, name := range []string{"../a.txt", "/etc", "out", "out/new.txt", "dangling", "sub/above"} {
+		if _, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0o644); !errors.Is(err, vfs.ErrEscape) {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("created out of the root: %v", err)
+	}
+
+	if _, err := fsys.Stat("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v", err)
+	}
+	if info, err := fsys.Stat("sub/up"); err != nil || info.Size() != 1 {
+		t.Errorf("got %v, %v", info, err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	fsys := vfs.ReadOnly(fstest.MapFS{"dir/a.txt": {Data: []byte("a")}})
+
+	f, err := fsys.OpenFile("dir/a.txt", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := io.ReadAll(f); err != nil || string(b) != "a" {
+		t.Errorf("got %q, %v", b, err)
+	}
+
+	for _, flag := range []int{os.O_WRONLY, os.O_RDWR, os.O_RDONLY | os.O_CREATE, os.O_RDONLY | os.O_TRUNC} {
+		if _, err := fsys.OpenFile("dir/a.txt", flag, 0); !errors.Is(err, vfs.ErrReadOnly) {
+			t.Errorf("%#x: got %v", flag, err)
+		}
+	}
+
+	if info, err := fsys.Stat("dir"); err != nil || !info.IsDir() {
+		t.Errorf("got %v, %v", info, err)
+	}
+}
+
+func TestMemFS(t *testing.T) {
+	m := vfs.NewMemFS()
+	if err := m.Mkdir("dir", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteFile("dir/a.txt", []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// rewrite the middle, then append
+	f, err := m.OpenFile("dir/a.txt", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.(io.Seeker).Seek(1, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.(io.Writer).Write([]byte("EL")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := io.ReadAll(f); err != nil || string(b) != "lo" {
+		t.Errorf("got %q, %v", b, err)
+	}
+	f.Close()
+	if _, err := f.Read(nil); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("got %v", err)
+	}
+
+	f, err = m.OpenFile("dir/a.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.(io.Writer).Write([]byte("!"))
+	f.Close()
+
+	if b, err := fs.ReadFile(m, "dir/a.txt"); err != nil || string(b) != "hELlo!" {
+		t.Errorf("got %q, %v", b, err)
+	}
+	if info, err := m.Stat("dir/a.txt"); err != nil || info.Size() != 6 || info.Name() != "a.txt" {
+		t.Errorf("got %v, %v", info, err)
+	}
+
+	for _, c := range []struct {
+		name string
+		flag int
+		err  error
+	}{
+		{"missing", os.O_RDONLY, fs.ErrNotExist},
+		{"missing/a.txt", os.O_WRONLY | os.O_CREATE, fs.ErrNotExist},
+		{"dir/a.txt/b", os.O_WRONLY | os.O_CREATE, syscall.ENOTDIR},
+		{"dir/a.txt", os.O_WRONLY | os.O_CREATE | os.O_EXCL, fs.ErrExist},
+		{"dir", os.O_WRONLY, syscall.EISDIR},
+		{"../a.txt", os.O_RDONLY, fs.ErrInvalid},
+	} {
+		if _, err := m.OpenFile(c.name, c.flag, 0o644); !errors.Is(err, c.err) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.err)
+		}
+	}
+
+	f, err = m.OpenFile("dir/a.txt", os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if b, _ := fs.ReadFile(m, "dir/a.txt"); len(b) != 0 {
+		t.Errorf("got %q", b)
+	}
+}
@@ -0,0 +1,237 @@
+// Package wasi implements the host module of the WASI preview1, https://github.com/WebAssembly/WASI/blob/main/legacy/preview1/docs.md
+package wasi
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	mathrand "math/rand"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/c0mm4nd/wasman/config"
+	"github.com/c0mm4nd/wasman/segments"
+	"github.com/c0mm4nd/wasman/types"
+	"github.com/c0mm4nd/wasman/wasm"
+)
+
+// ModuleName is the name of the module imported by the WASI preview1 guests
+const ModuleName = "wasi_snapshot_preview1"
+
+// ExitError is the error of the call stopped by proc_exit, which is wrapped into the wasm.Trap
+type ExitError struct {
+	Code uint32
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// system is the state of the WASI module, shared by the instances importing it
+type system struct {
+	config.WASIConfig
+
+	start    time.Time // the origin of the monotonic host clock
+	tollBase uint64    // the toll of the ClockToll at the start
+
+	mu      sync.Mutex
+	files   []*fileDesc    // the fd table, nil for the closed fds
+	elapsed uint64         // the steps and the sleeps of the virtual clocks in nanoseconds
+	rand    *mathrand.Rand // the pseudo random source seeded by the RandSeed
+}
+
+// sysFunc is the host func of the WASI, which returns the Errno
+type sysFunc func(s *system, ins *wasm.Instance, args []uint64) Errno
+
+var (
+	i32 = types.ValueTypeI32
+	i64 = types.ValueTypeI64
+)
+
+// syscalls are the funcs of the module by their names
+var syscalls = []struct {
+	name   string
+	params []types.ValueType
+	fn     sysFunc
+}{
+	{"args_get", []types.ValueType{i32, i32}, (*system).argsGet},
+	{"args_sizes_get", []types.ValueType{i32, i32}, (*system).argsSizesGet},
+	{"environ_get", []types.ValueType{i32, i32}, (*system).environGet},
+	{"environ_sizes_get", []types.ValueType{i32, i32}, (*system).environSizesGet},
+	{"clock_res_get", []types.ValueType{i32, i32}, (*system).clockResGet},
+	{"clock_time_get", []types.ValueType{i32, i64, i32}, (*system).clockTimeGet},
+	{"random_get", []types.ValueType{i32, i32}, (*system).randomGet},
+	{"poll_oneoff", []types.ValueType{i32, i32, i32, i32}, (*system).pollOneoff},
+	{"sched_yield", nil, (*system).schedYield},
+	{"fd_read", []types.ValueType{i32, i32, i32, i32}, (*system).fdRead},
+	{"fd_write", []types.ValueType{i32, i32, i32, i32}, (*system).fdWrite},
+	{"fd_seek", []types.ValueType{i32, i64, i32, i32}, (*system).fdSeek},
+	{"fd_close", []types.ValueType{i32}, (*system).fdClose},
+	{"fd_fdstat_get", []types.ValueType{i32, i32}, (*system).fdFdstatGet},
+	{"fd_prestat_get", []types.ValueType{i32, i32}, (*system).fdPrestatGet},
+	{"fd_prestat_dir_name", []types.ValueType{i32, i32, i32}, (*system).fdPrestatDirName},
+	{"path_open", []types.ValueType{i32, i32, i32, i32, i32, i64, i64, i32, i32}, (*system).pathOpen},
+}
+
+// NewModule creates the host module of the WASI preview1 on the conf, to be defined on the Linker as the ModuleName.
+// The instances importing the same module share its fd table
+func NewModule(conf config.WASIConfig) (*wasm.Module, error) {
+	s := &system{WASIConfig: conf, start: time.Now()}
+	if s.ClockToll != nil {
+		s.tollBase = s.ClockToll.GetToll()
+	}
+	if s.RandSeed != nil {
+		s.rand = mathrand.New(mathrand.NewSource(*s.RandSeed))
+	}
+	if err := s.openFiles(); err != nil {
+		return nil, err
+	}
+
+	mod := &wasm.Module{IndexSpace: new(wasm.IndexSpace), ExportSection: map[string]*segments.ExportSegment{}}
+	define := func(name string, f *wasm.HostFunc) {
+		mod.ExportSection[name] = &segments.ExportSegment{
+			Name: name,
+			Desc: &segments.ExportDesc{Kind: segments.KindFunction, Index: uint32(len(mod.IndexSpace.Functions))},
+		}
+		mod.IndexSpace.Functions = append(mod.IndexSpace.Functions, f)
+	}
+
+	for _, sc := range syscalls {
+		fn := sc.fn
+		define(sc.name, &wasm.HostFunc{
+			Signature: &types.FuncType{InputTypes: sc.params, ReturnTypes: []types.ValueType{i32}},
+			Generator: func(ins *wasm.Instance) wasm.RawHostFunc {
+				return func(args []uint64) []uint64 {
+					return []uint64{uint64(fn(s, ins, args))}
+				}
+			},
+		})
+	}
+
+	define("proc_exit", &wasm.HostFunc{
+		Signature: &types.FuncType{InputTypes: []types.ValueType{i32}},
+		Generator: func(ins *wasm.Instance) wasm.RawHostFunc {
+			return func(args []uint64) []uint64 {
+				ins.Abort(&ExitError{Code: uint32(args[0])})
+				return nil
+			}
+		},
+	})
+
+	return mod, nil
+}
+
+// memory is the memory of the calling instance, whose accessors return wasm.ErrPtrOutOfBounds without the memory
+type memory struct {
+	*wasm.Memory
+}
+
+func memoryOf(ins *wasm.Instance) memory {
+	return memory{ins.Memory}
+}
+
+func (m memory) read(offset, n uint32) ([]byte, error) {
+	if m.Memory == nil {
+		return nil, wasm.ErrPtrOutOfBounds
+	}
+
+	return m.ReadBytes(uint64(offset), uint64(n))
+}
+
+func (m memory) write(offset uint32, p []byte) error {
+	if m.Memory == nil {
+		return wasm.ErrPtrOutOfBounds
+	}
+
+	return m.WriteBytes(uint64(offset), p)
+}
+
+func (m memory) putUint32(offset, v uint32) error {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+
+	return m.write(offset, b[:])
+}
+
+func (m memory) putUint64(offset uint32, v uint64) error {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+
+	return m.write(offset, b[:])
+}
+
+// putStrings writes the strings terminated by NUL onto the buf, and their pointers onto the ptrs
+func (m memory) putStrings(strs []string, ptrs, buf uint32) error {
+	for _, str := range strs {
+		if err := m.putUint32(ptrs, buf); err != nil {
+			return err
+		}
+		if err := m.write(buf, append([]byte(str), 0)); err != nil {
+			return err
+		}
+		ptrs += 4
+		buf += uint32(len(str)) + 1
+	}
+
+	return nil
+}
+
+// putSizes writes the number of the strings and their size in bytes terminated by NUL
+func (m memory) putSizes(strs []string, count, size uint32) error {
+	var n uint32
+	for _, str := range strs {
+		n += uint32(len(str)) + 1
+	}
+
+	if err := m.putUint32(count, uint32(len(strs))); err != nil {
+		return err
+	}
+
+	return m.putUint32(size, n)
+}
+
+func (s *system) argsGet(ins *wasm.Instance, args []uint64) Errno {
+	return errnoOf(memoryOf(ins).putStrings(s.Args, uint32(args[0]), uint32(args[1])))
+}
+
+func (s *system) argsSizesGet(ins *wasm.Instance, args []uint64) Errno {
+	return errnoOf(memoryOf(ins).putSizes(s.Args, uint32(args[0]), uint32(args[1])))
+}
+
+func (s *system) environGet(ins *wasm.Instance, args []uint64) Errno {
+	return errnoOf(memoryOf(ins).putStrings(s.Env, uint32(args[0]), uint32(args[1])))
+}
+
+func (s *system) environSizesGet(ins *wasm.Instance, args []uint64) Errno {
+	return errnoOf(memoryOf(ins).putSizes(s.Env, uint32(args[0]), uint32(args[1])))
+}
+
+func (s *system) randomGet(ins *wasm.Instance, args []uint64) Errno {
+	if s.rand == nil && s.Deterministic {
+		return ENOSYS
+	}
+
+	mem := memoryOf(ins)
+	buf, err := mem.read(uint32(args[0]), uint32(args[1]))
+	if err != nil {
+		return errnoOf(err)
+	}
+	if s.rand != nil {
+		s.mu.Lock()
+		s.rand.Read(buf)
+		s.mu.Unlock()
+	} else if _, err := rand.Read(buf); err != nil {
+		return EIO
+	}
+
+	return errnoOf(mem.write(uint32(args[0]), buf))
+}
+
+func (s *system) schedYield(_ *wasm.Instance, _ []uint64) Errno {
+	if !s.Deterministic {
+		runtime.Gosched()
+	}
+
+	return ESUCCESS
+}
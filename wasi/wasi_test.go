@@ -0,0 +1,488 @@
+package wasi_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"testing/iotest"
+	"time"
+
+	"github.com/c0mm4nd/wasman"
+	"github.com/c0mm4nd/wasman/config"
+	"github.com/c0mm4nd/wasman/tollstation"
+	"github.com/c0mm4nd/wasman/wasi"
+	"github.com/c0mm4nd/wasman/wasi/vfs"
+	"github.com/c0mm4nd/wasman/wasm"
+)
+
+func section(id byte, content ...byte) []byte {
+	return append([]byte{id, byte(len(content))}, content...)
+}
+
+func name(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+// guest assembles the module importing the WASI funcs of the types in order, and exporting the memory with the data at 16,
+// and "_start" of the body after the imports
+func guest(types [][]byte, imports []string, body, data []byte) []byte {
+	bin := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	typeSec := []byte{byte(len(types) + 1)}
+	for _, typ := range types {
+		typeSec = append(append(typeSec, 0x60), typ...)
+	}
+	bin = append(bin, section(0x01, append(typeSec, 0x60, 0x00, 0x00)...)...)
+	importSec := []byte{byte(len(imports))}
+	for i, imp := range imports {
+		importSec = append(append(append(importSec, name(wasi.ModuleName)...), name(imp)...), 0x00, byte(i))
+	}
+	bin = append(bin, section(0x02, importSec...)...)
+	bin = append(bin, section(0x03, 0x01, byte(len(types)))...)
+	bin = append(bin, section(0x05, 0x01, 0x00, 0x01)...)
+	exports := []byte{0x02}
+	exports = append(append(exports, name("memory")...), 0x02, 0x00)
+	exports = append(append(exports, name("_start")...), 0x00, byte(len(imports)))
+	bin = append(bin, section(0x07, exports...)...)
+	body = append([]byte{0x00}, body...)
+	bin = append(bin, section(0x0a, append([]byte{0x01, byte(len(body))}, body...)...)...)
+	bin = append(bin, section(0x0b, append([]byte{0x01, 0x00, 0x41, 0x10, 0x0b}, name(string(data))...)...)...)
+
+	return bin
+}
+
+// helloModule is the command writing "hello\n" to the stdout and exiting with 3
+//
+//	(func (export "_start")
+//	  (i32.store (i32.const 0) (i32.const 16))
+//	  (i32.store (i32.const 4) (i32.const 6))
+//	  (drop (call $fd_write (i32.const 1) (i32.const 0) (i32.const 1) (i32.const 8)))
+//	  (call $proc_exit (i32.const 3)))
+func helloModule() []byte {
+	return guest(
+		[][]byte{{0x04, 0x7f, 0x7f, 0x7f, 0x7f, 0x01, 0x7f}, {0x01, 0x7f, 0x00}},
+		[]string{"fd_write", "proc_exit"},
+		[]byte{
+			0x41, 0x00, 0x41, 0x10, 0x36, 0x02, 0x00,
+			0x41, 0x04, 0x41, 0x06, 0x36, 0x02, 0x00,
+			0x41, 0x01, 0x41, 0x00, 0x41, 0x01, 0x41, 0x08, 0x10, 0x00, 0x1a,
+			0x41, 0x03, 0x10, 0x01,
+			0x0b,
+		},
+		[]byte("hello\n"),
+	)
+}
+
+// clockModule is the command writing the clocks and the random bytes into the memory
+//
+//	(func (export "_start")
+//	  (drop (call $clock_time_get (i32.const 1) (i64.const 0) (i32.const 0)))
+//	  (drop (call $random_get (i32.const 8) (i32.const 32)))
+//	  (drop (call $clock_time_get (i32.const 0) (i64.const 0) (i32.const 40)))
+//	  (drop (call $clock_time_get (i32.const 1) (i64.const 0) (i32.const 48))))
+func clockModule() []byte {
+	return guest(
+		[][]byte{{0x03, 0x7f, 0x7e, 0x7f, 0x01, 0x7f}, {0x02, 0x7f, 0x7f, 0x01, 0x7f}},
+		[]string{"clock_time_get", "random_get"},
+		[]byte{
+			0x41, 0x01, 0x42, 0x00, 0x41, 0x00, 0x10, 0x00, 0x1a,
+			0x41, 0x08, 0x41, 0x20, 0x10, 0x01, 0x1a,
+			0x41, 0x00, 0x42, 0x00, 0x41, 0x28, 0x10, 0x00, 0x1a,
+			0x41, 0x01, 0x42, 0x00, 0x41, 0x30, 0x10, 0x00, 0x1a,
+			0x0b,
+		},
+		nil,
+	)
+}
+
+func TestLinker_DefineWASI(t *testing.T) {
+	var stdout bytes.Buffer
+	l := wasman.NewLinker(config.LinkerConfig{})
+	if err := l.DefineWASI(config.WASIConfig{Stdout: &stdout}); err != nil {
+		t.Fatal(err)
+	}
+
+	mod, err := wasman.NewModule(config.ModuleConfig{}, bytes.NewReader(helloModule()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins, err := l.Instantiate(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = ins.CallExportedFunc("_start")
+	var exit *wasi.ExitError
+	var trap *wasm.Trap
+	if !errors.As(err, &exit) || exit.Code != 3 || !errors.As(err, &trap) || len(trap.Stack) != 1 {
+		t.Fatalf("got %v", err)
+	}
+	if stdout.String() != "hello\n" {
+		t.Errorf("got %q", stdout.String())
+	}
+}
+
+// sys calls the funcs of the module on the bare instance with a memory of one page
+type sys struct {
+	t   *testing.T
+	mod *wasm.Module
+	ins *wasm.Instance
+}
+
+func newSys(t *testing.T, conf config.WASIConfig) *sys {
+	mod, err := wasi.NewModule(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &sys{t: t, mod: mod, ins: &wasm.Instance{Memory: &wasm.Memory{Value: make([]byte, config.DefaultMemoryPageSize)}}}
+}
+
+func (s *sys) call(name string, args ...uint64) wasi.Errno {
+	exp, ok := s.mod.ExportSection[name]
+	if !ok {
+		s.t.Fatalf("%s is not exported", name)
+	}
+	f := s.mod.IndexSpace.Functions[exp.Desc.Index].(*wasm.HostFunc)
+
+	return wasi.Errno(f.Generator(s.ins)(args)[0])
+}
+
+func (s *sys) mem() []byte {
+	return s.ins.Memory.Value
+}
+
+func (s *sys) u32(offset int) uint32 {
+	return binary.LittleEndian.Uint32(s.mem()[offset:])
+}
+
+// open calls path_open with the path at 200, and returns the opened fd written at 16
+func (s *sys) open(dirfd uint32, path string, oflags uint32, rights uint64) (uint32, wasi.Errno) {
+	copy(s.mem()[200:], path)
+	errno := s.call("path_open", uint64(dirfd), 0, 200, uint64(len(path)), uint64(oflags), rights, 0, 0, 16)
+
+	return s.u32(16), errno
+}
+
+func TestArgsEnviron(t *testing.T) {
+	s := newSys(t, config.WASIConfig{Args: []string{"prog", "-v"}, Env: []string{"A=1"}})
+
+	if errno := s.call("args_sizes_get", 0, 4); errno != wasi.ESUCCESS || s.u32(0) != 2 || s.u32(4) != 8 {
+		t.Fatalf("got %d, %d, %d", errno, s.u32(0), s.u32(4))
+	}
+	if errno := s.call("args_get", 16, 64); errno != wasi.ESUCCESS {
+		t.Fatal(errno)
+	}
+	if s.u32(16) != 64 || s.u32(20) != 69 || string(s.mem()[64:72]) != "prog\x00-v\x00" {
+		t.Errorf("got %d %d %q", s.u32(16), s.u32(20), s.mem()[64:72])
+	}
+
+	if errno := s.call("environ_sizes_get", 0, 4); errno != wasi.ESUCCESS || s.u32(0) != 1 || s.u32(4) != 4 {
+		t.Fatalf("got %d, %d, %d", errno, s.u32(0), s.u32(4))
+	}
+	if errno := s.call("environ_get", 16, 64); errno != wasi.ESUCCESS || string(s.mem()[64:68]) != "A=1\x00" {
+		t.Fatalf("got %d %q", errno, s.mem()[64:68])
+	}
+
+	if errno := s.call("args_get", config.DefaultMemoryPageSize-2, 64); errno != wasi.EFAULT {
+		t.Errorf("got %d", errno)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "in.txt"), []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	s := newSys(t, config.WASIConfig{
+		Stdin:    strings.NewReader("input"),
+		Stdout:   &stdout,
+		Preopens: []config.Preopen{{GuestPath: "/data", HostPath: dir}},
+	})
+
+	// the preopen
+	if errno := s.call("fd_prestat_get", 3, 0); errno != wasi.ESUCCESS || s.mem()[0] != 0 || s.u32(4) != 5 {
+		t.Fatalf("got %d, %d", errno, s.u32(4))
+	}
+	if errno := s.call("fd_prestat_dir_name", 3, 8, 5); errno != wasi.ESUCCESS || string(s.mem()[8:13]) != "/data" {
+		t.Fatalf("got %d %q", errno, s.mem()[8:13])
+	}
+	if errno := s.call("fd_prestat_get", 4, 0); errno != wasi.EBADF {
+		t.Errorf("got %d", errno)
+	}
+
+	// the stdio, with the iovec at 0 on the buffer at 100
+	binary.LittleEndian.PutUint32(s.mem()[0:], 100)
+	binary.LittleEndian.PutUint32(s.mem()[4:], 3)
+	if errno := s.call("fd_read", 0, 0, 1, 8); errno != wasi.ESUCCESS || s.u32(8) != 3 || string(s.mem()[100:103]) != "inp" {
+		t.Fatalf("got %d %d %q", errno, s.u32(8), s.mem()[100:103])
+	}
+	if errno := s.call("fd_write", 1, 0, 1, 8); errno != wasi.ESUCCESS || s.u32(8) != 3 || stdout.String() != "inp" {
+		t.Fatalf("got %d %d %q", errno, s.u32(8), stdout.String())
+	}
+	if errno := s.call("fd_write", 0, 0, 1, 8); errno != wasi.EBADF {
+		t.Errorf("got %d", errno)
+	}
+	if errno := s.call("fd_seek", 1, 0, 0, 8); errno != wasi.ESPIPE {
+		t.Errorf("got %d", errno)
+	}
+
+	fd, errno := s.open(3, "in.txt", 0, 1<<1)
+	if errno != wasi.ESUCCESS || fd != 4 {
+		t.Fatalf("got %d, %d", fd, errno)
+	}
+	binary.LittleEndian.PutUint32(s.mem()[4:], 16)
+	if errno := s.call("fd_read", uint64(fd), 0, 1, 8); errno != wasi.ESUCCESS || s.u32(8) != 7 || string(s.mem()[100:107]) != "content" {
+		t.Fatalf("got %d %d %q", errno, s.u32(8), s.mem()[100:107])
+	}
+	if errno := s.call("fd_seek", uint64(fd), 3, 0, 24); errno != wasi.ESUCCESS || binary.LittleEndian.Uint64(s.mem()[24:]) != 3 {
+		t.Fatalf("got %d", errno)
+	}
+	if errno := s.call("fd_write", uint64(fd), 0, 1, 8); errno != wasi.EBADF {
+		t.Errorf("got %d", errno)
+	}
+	if errno := s.call("fd_close", uint64(fd)); errno != wasi.ESUCCESS {
+		t.Fatal(errno)
+	}
+	if errno := s.call("fd_close", uint64(fd)); errno != wasi.EBADF {
+		t.Errorf("got %d", errno)
+	}
+
+	// create the file and reuse the closed fd
+	fd, errno = s.open(3, "sub/../out.txt", 1, 1<<6)
+	if errno != wasi.ESUCCESS || fd != 4 {
+		t.Fatalf("got %d, %d", fd, errno)
+	}
+	binary.LittleEndian.PutUint32(s.mem()[4:], 3)
+	if errno := s.call("fd_write", uint64(fd), 0, 1, 8); errno != wasi.ESUCCESS {
+		t.Fatal(errno)
+	}
+	s.call("fd_close", uint64(fd))
+	if b, err := os.ReadFile(filepath.Join(dir, "out.txt")); err != nil || string(b) != "con" {
+		t.Errorf("got %q, %v", b, err)
+	}
+
+	for _, c := range []struct {
+		path   string
+		oflags uint32
+		exp    wasi.Errno
+	}{
+		{path: "../escape", exp: wasi.ENOTCAPABLE},
+		{path: "/etc/passwd", exp: wasi.ENOTCAPABLE},
+		{path: "missing", exp: wasi.ENOENT},
+		{path: "out.txt", oflags: 1 | 4, exp: wasi.EEXIST},
+		{path: "out.txt", oflags: 2, exp: wasi.ENOTDIR},
+	} {
+		if _, errno := s.open(3, c.path, c.oflags, 1<<1); errno != c.exp {
+			t.Errorf("%s: got %d, want %d", c.path, errno, c.exp)
+		}
+	}
+
+	t.Run("preopen", func(t *testing.T) {
+		_, err := wasi.NewModule(config.WASIConfig{Preopens: []config.Preopen{{GuestPath: "/", HostPath: filepath.Join(dir, "in.txt")}}})
+		if err == nil {
+			t.Error("the file is preopened")
+		}
+	})
+}
+
+func TestVirtualPreopens(t *testing.T) {
+	mem := vfs.NewMemFS()
+	if err := mem.Mkdir("sub", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.WriteFile("sub/a.txt", []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := newSys(t, config.WASIConfig{Preopens: []config.Preopen{
+		{GuestPath: "/tmp", FS: mem},
+		{GuestPath: "/ro", FS: mem, ReadOnly: true},
+		{GuestPath: "/embed", FS: vfs.ReadOnly(fstest.MapFS{"b.txt": {Data: []byte("b")}})},
+	}})
+
+	// write through the writable preopen, within the opened subdirectory
+	sub, errno := s.open(3, "sub", 2, 0)
+	if errno != wasi.ESUCCESS || sub != 6 {
+		t.Fatalf("got %d, %d", sub, errno)
+	}
+	fd, errno := s.open(sub, "new.txt", 1, 1<<6)
+	if errno != wasi.ESUCCESS {
+		t.Fatal(errno)
+	}
+	copy(s.mem()[100:], "new")
+	binary.LittleEndian.PutUint32(s.mem()[0:], 100)
+	binary.LittleEndian.PutUint32(s.mem()[4:], 3)
+	if errno := s.call("fd_write", uint64(fd), 0, 1, 8); errno != wasi.ESUCCESS {
+		t.Fatal(errno)
+	}
+	s.call("fd_close", uint64(fd))
+	if b, err := fs.ReadFile(mem, "sub/new.txt"); err != nil || string(b) != "new" {
+		t.Errorf("got %q, %v", b, err)
+	}
+	if _, errno := s.open(sub, "../sub/a.txt", 0, 1<<1); errno != wasi.ENOTCAPABLE {
+		t.Errorf("got %d", errno)
+	}
+
+	// the read-only preopens are readable, also the directory opened in it
+	for _, c := range []struct {
+		dirfd uint32
+		path  string
+	}{{4, "sub/a.txt"}, {5, "b.txt"}} {
+		fd, errno := s.open(c.dirfd, c.path, 0, 1<<1)
+		if errno != wasi.ESUCCESS {
+			t.Fatalf("%s: %d", c.path, errno)
+		}
+		s.call("fd_close", uint64(fd))
+
+		if _, errno := s.open(c.dirfd, c.path, 0, 1<<6); errno != wasi.EROFS {
+			t.Errorf("%s: got %d", c.path, errno)
+		}
+	}
+	sub, _ = s.open(4, "sub", 2, 0)
+	if _, errno := s.open(sub, "c.txt", 1, 1<<1); errno != wasi.EROFS {
+		t.Errorf("got %d", errno)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	// run returns the hash of the memory after running the clockModule
+	run := func(seed int64) ([]byte, [sha256.Size]byte) {
+		ts := tollstation.NewSimpleTollStation(0)
+		l := wasman.NewLinker(config.LinkerConfig{})
+		err := l.DefineWASI(config.WASIConfig{
+			ClockStep:     1000,
+			ClockToll:     ts,
+			ClockEpoch:    1 << 60,
+			RandSeed:      &seed,
+			Deterministic: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mod, err := wasman.NewModule(config.ModuleConfig{TollStation: ts}, bytes.NewReader(clockModule()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ins, err := l.Instantiate(mod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := ins.CallExportedFunc("_start"); err != nil {
+			t.Fatal(err)
+		}
+
+		return ins.Memory.Value, sha256.Sum256(ins.Memory.Value)
+	}
+
+	mem, hash := run(1)
+	if _, again := run(1); again != hash {
+		t.Errorf("got %x, want %x", again, hash)
+	}
+	if _, other := run(2); other == hash {
+		t.Error("the seed is ignored")
+	}
+
+	// the monotonic clock advances by the steps and the toll, and the realtime starts at the epoch
+	first, realtime, last := binary.LittleEndian.Uint64(mem), binary.LittleEndian.Uint64(mem[40:]), binary.LittleEndian.Uint64(mem[48:])
+	if first < 1000 || last < first+2000 || realtime < 1<<60+first {
+		t.Errorf("got %d, %d, %d", first, realtime, last)
+	}
+
+	t.Run("deny", func(t *testing.T) {
+		s := newSys(t, config.WASIConfig{Deterministic: true})
+		for _, c := range []struct {
+			name string
+			args []uint64
+		}{
+			{"clock_time_get", []uint64{1, 1, 0}},
+			{"clock_res_get", []uint64{0, 0}},
+			{"random_get", []uint64{0, 8}},
+			{"poll_oneoff", []uint64{0, 100, 1, 200}},
+		} {
+			if errno := s.call(c.name, c.args...); errno != wasi.ENOSYS {
+				t.Errorf("%s: got %d", c.name, errno)
+			}
+		}
+	})
+
+	t.Run("stdin", func(t *testing.T) {
+		// the one byte reads of the host stream are filled up to the buffer, and the EOF follows the input
+		s := newSys(t, config.WASIConfig{Stdin: iotest.OneByteReader(strings.NewReader("input")), Deterministic: true})
+		binary.LittleEndian.PutUint32(s.mem()[0:], 100)
+		binary.LittleEndian.PutUint32(s.mem()[4:], 3)
+		for _, exp := range []string{"inp", "ut", ""} {
+			if errno := s.call("fd_read", 0, 0, 1, 8); errno != wasi.ESUCCESS || string(s.mem()[100:100+s.u32(8)]) != exp {
+				t.Fatalf("got %d %q, want %q", errno, s.mem()[100:100+s.u32(8)], exp)
+			}
+		}
+
+		s = newSys(t, config.WASIConfig{Deterministic: true})
+		binary.LittleEndian.PutUint32(s.mem()[0:], 100)
+		binary.LittleEndian.PutUint32(s.mem()[4:], 3)
+		if errno := s.call("fd_read", 0, 0, 1, 8); errno != wasi.ESUCCESS || s.u32(8) != 0 {
+			t.Errorf("got %d %d", errno, s.u32(8))
+		}
+		if errno := s.call("sched_yield"); errno != wasi.ESUCCESS {
+			t.Errorf("got %d", errno)
+		}
+	})
+
+	t.Run("sleep", func(t *testing.T) {
+		s := newSys(t, config.WASIConfig{ClockStep: 1, Deterministic: true})
+		binary.LittleEndian.PutUint64(s.mem()[24:], uint64(time.Hour))
+		if errno := s.call("poll_oneoff", 0, 100, 1, 200); errno != wasi.ESUCCESS || s.u32(200) != 1 {
+			t.Fatalf("got %d, %d", errno, s.u32(200))
+		}
+		if errno := s.call("clock_time_get", 1, 1, 300); errno != wasi.ESUCCESS {
+			t.Fatal(errno)
+		}
+		if now := binary.LittleEndian.Uint64(s.mem()[300:]); now < uint64(time.Hour) {
+			t.Errorf("got %d", now)
+		}
+	})
+}
+
+func TestClock(t *testing.T) {
+	s := newSys(t, config.WASIConfig{})
+
+	before := uint64(time.Now().UnixNano())
+	if errno := s.call("clock_time_get", 0, 1, 0); errno != wasi.ESUCCESS || binary.LittleEndian.Uint64(s.mem()) < before {
+		t.Fatalf("got %d", errno)
+	}
+	if errno := s.call("clock_time_get", 9, 1, 0); errno != wasi.EINVAL {
+		t.Errorf("got %d", errno)
+	}
+
+	// two relative clocks of 1ms and 1h, the earlier one fires
+	for i, timeout := range []uint64{uint64(time.Millisecond), uint64(time.Hour)} {
+		sub := s.mem()[i*48:]
+		binary.LittleEndian.PutUint64(sub, uint64(i+7))
+		sub[8] = 0
+		binary.LittleEndian.PutUint32(sub[16:], 1)
+		binary.LittleEndian.PutUint64(sub[24:], timeout)
+	}
+	if errno := s.call("poll_oneoff", 0, 200, 2, 300); errno != wasi.ESUCCESS || s.u32(300) != 1 {
+		t.Fatalf("got %d, %d", errno, s.u32(300))
+	}
+	if userdata := binary.LittleEndian.Uint64(s.mem()[200:]); userdata != 7 {
+		t.Errorf("got %d", userdata)
+	}
+
+	t.Run("random", func(t *testing.T) {
+		if errno := s.call("random_get", 1000, 32); errno != wasi.ESUCCESS || reflect.DeepEqual(s.mem()[1000:1032], make([]byte, 32)) {
+			t.Errorf("got %d", errno)
+		}
+		if errno := s.call("random_get", config.DefaultMemoryPageSize-1, 32); errno != wasi.EFAULT {
+			t.Errorf("got %d", errno)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package wasm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/c0mm4nd/wasman/config"
+	"github.com/c0mm4nd/wasman/expr"
+)
+
+// benchSection encodes the section, whose content is shorter than 128 bytes
+func benchSection(id byte, content ...byte) []byte {
+	return append([]byte{id, byte(len(content))}, content...)
+}
+
+// benchInstance instantiates the module with the conf exporting the funcs below, all of the type (param i32) (result i32)
+//
+//	(func $fib (param $n i32) (result i32)
+//	  (if (result i32) (i32.lt_u (local.get $n) (i32.const 2))
+//	    (then (local.get $n))
+//	    (else (i32.add (call $fib (i32.sub (local.get $n) (i32.const 1)))
+//	                   (call $fib (i32.sub (local.get $n) (i32.const 2)))))))
+//	(func $mem (param $n i32) (result i32) (local $i i32) (local $acc i32)
+//	  (loop
+//	    (i32.store (i32.and (i32.mul (local.get $i) (i32.const 4)) (i32.const 0xfffc)) (local.get $i))
+//	    (local.set $acc (i32.add (local.get $acc)
+//	      (i32.load (i32.and (i32.mul (local.get $i) (i32.const 4)) (i32.const 0xfffc)))))
+//	    (br_if 0 (i32.lt_u (local.tee $i (i32.add (local.get $i) (i32.const 1))) (local.get $n))))
+//	  (local.get $acc))
+func benchInstance(tb testing.TB, conf config.ModuleConfig) *Instance {
+	fib := []byte{
+		0x00, // no locals
+		byte(expr.OpCodeLocalGet), 0x00,
+		byte(expr.OpCodeI32Const), 0x02,
+		byte(expr.OpCodeI32LtU),
+		byte(expr.OpCodeIf), 0x7f,
+		byte(expr.OpCodeLocalGet), 0x00,
+		byte(expr.OpCodeElse),
+		byte(expr.OpCodeLocalGet), 0x00,
+		byte(expr.OpCodeI32Const), 0x01,
+		byte(expr.OpCodeI32Sub),
+		byte(expr.OpCodeCall), 0x00,
+		byte(expr.OpCodeLocalGet), 0x00,
+		byte(expr.OpCodeI32Const), 0x02,
+		byte(expr.OpCodeI32Sub),
+		byte(expr.OpCodeCall), 0x00,
+		byte(expr.OpCodeI32Add),
+		byte(expr.OpCodeEnd),
+		byte(expr.OpCodeEnd),
+	}
+	address := []byte{
+		byte(expr.OpCodeLocalGet), 0x01,
+		byte(expr.OpCodeI32Const), 0x04,
+		byte(expr.OpCodeI32Mul),
+		byte(expr.OpCodeI32Const), 0xfc, 0xff, 0x03,
+		byte(expr.OpCodeI32And),
+	}
+	mem := []byte{0x01, 0x02, 0x7f} // 2 locals of i32
+	mem = append(mem, byte(expr.OpCodeLoop), 0x40)
+	mem = append(mem, address...)
+	mem = append(mem, byte(expr.OpCodeLocalGet), 0x01, byte(expr.OpCodeI32Store), 0x02, 0x00)
+	mem = append(mem, byte(expr.OpCodeLocalGet), 0x02)
+	mem = append(mem, address...)
+	mem = append(mem,
+		byte(expr.OpCodeI32Load), 0x02, 0x00,
+		byte(expr.OpCodeI32Add),
+		byte(expr.OpCodeLocalSet), 0x02,
+		byte(expr.OpCodeLocalGet), 0x01,
+		byte(expr.OpCodeI32Const), 0x01,
+		byte(expr.OpCodeI32Add),
+		byte(expr.OpCodeLocalTee), 0x01,
+		byte(expr.OpCodeLocalGet), 0x00,
+		byte(expr.OpCodeI32LtU),
+		byte(expr.OpCodeBrIf), 0x00,
+		byte(expr.OpCodeEnd),
+		byte(expr.OpCodeLocalGet), 0x02,
+		byte(expr.OpCodeEnd),
+	)
+
+	bin := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	bin = append(bin, benchSection(0x01, 0x01, 0x60, 0x01, 0x7f, 0x01, 0x7f)...)                                     // type
+	bin = append(bin, benchSection(0x03, 0x02, 0x00, 0x00)...)                                                       // function
+	bin = append(bin, benchSection(0x05, 0x01, 0x00, 0x01)...)                                                       // memory
+	bin = append(bin, benchSection(0x07, 0x02, 0x03, 'f', 'i', 'b', 0x00, 0x00, 0x03, 'm', 'e', 'm', 0x00, 0x01)...) // export
+	code := []byte{0x02, byte(len(fib))}
+	code = append(code, fib...)
+	code = append(code, byte(len(mem)))
+	code = append(code, mem...)
+	bin = append(bin, benchSection(0x0a, code...)...)
+
+	m, err := NewModule(conf, bytes.NewReader(bin))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	ins, err := NewInstance(m, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return ins
+}
+
+// benchCall calls the exported func of the benchInstance with the arg on each iteration.
+//
+// Compiling the func bodies into the pre-decoded instructions, instead of decoding the immediates
+// and looking up the blocks on every step, changed the results on an Intel Xeon from
+//
+//	BenchmarkInstance_fib         11.9ms/op  5779240 B/op  109456 allocs/op
+//	BenchmarkInstance_memoryLoop   4.9ms/op   640224 B/op   10005 allocs/op
+//
+// to
+//
+//	BenchmarkInstance_fib          9.4ms/op  5779240 B/op  109456 allocs/op
+//	BenchmarkInstance_memoryLoop   2.3ms/op      288 B/op       6 allocs/op
+//
+// Running the superinstructions lowered by the ir package with ModuleConfig.Optimize on the same machine gives
+//
+//	BenchmarkInstance_memoryLoop           2.2ms/op      288 B/op       6 allocs/op
+//	BenchmarkInstance_memoryLoopOptimized  1.3ms/op      288 B/op       6 allocs/op
+//
+// while the fib stays at the same speed, as its time is taken by the calls.
+// Reusing the frames, the locals and the label stacks by the call depth then takes the fib to
+//
+//	BenchmarkInstance_fib                  3.1ms/op      312 B/op       6 allocs/op
+//	BenchmarkInstance_fibOptimized         2.7ms/op      312 B/op       6 allocs/op
+func benchCall(b *testing.B, conf config.ModuleConfig, name string, arg, exp uint64) {
+	ins := benchInstance(b, conf)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ret, _, err := ins.CallExportedFunc(name, arg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if ret[0] != exp {
+			b.Fatalf("got %d, want %d", ret[0], exp)
+		}
+	}
+}
+
+// TestInstance_callAllocs checks the wasm calls do not allocate, leaving the allocs of CallExportedFunc alone
+func TestInstance_callAllocs(t *testing.T) {
+	for _, conf := range []config.ModuleConfig{{}, {Optimize: true}, {Recover: true}} {
+		ins := benchInstance(t, conf)
+		allocs := func(n uint64) float64 {
+			return testing.AllocsPerRun(10, func() {
+				if _, _, err := ins.CallExportedFunc("fib", n); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+
+		// fib(1) makes no call inside, while fib(20) makes 21890
+		if one, twenty := allocs(1), allocs(20); twenty != one {
+			t.Errorf("%+v: got %v allocs/op, want %v", conf, twenty, one)
+		}
+	}
+}
+
+func BenchmarkInstance_fib(b *testing.B) {
+	benchCall(b, config.ModuleConfig{}, "fib", 20, 6765)
+}
+
+func BenchmarkInstance_memoryLoop(b *testing.B) {
+	// the sum of 0..9999
+	benchCall(b, config.ModuleConfig{}, "mem", 10000, 49995000)
+}
+
+func BenchmarkInstance_fibOptimized(b *testing.B) {
+	benchCall(b, config.ModuleConfig{Optimize: true}, "fib", 20, 6765)
+}
+
+func BenchmarkInstance_memoryLoopOptimized(b *testing.B) {
+	benchCall(b, config.ModuleConfig{Optimize: true}, "mem", 10000, 49995000)
+}
@@ -0,0 +1,298 @@
+package wasm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/leb128decode"
+)
+
+// instr is one instruction of the compiled func body, whose immediates are decoded ahead of the execution
+type instr struct {
+	fn  func(ins *Instance) error
+	op  expr.OpCode // the opcode charged by the toll station, which is the prefix of the prefixed instructions
+	sub uint32      // the sub opcode of the prefixed instructions
+	pos uint64      // the offset of the opcode in the func body
+
+	// imm holds the immediates in the order of the binary format, except that the memarg is (memory index, offset).
+	// The v128.const and the i8x16.shuffle hold the 16 bytes as (Lo, Hi) of the V128,
+	// and the select with the value type holds the type, which is only one in a valid module
+	imm    [3]uint64
+	block  *funcBlock // the block started by the block, loop, if and try_table
+	labels []uint32   // the label indices of the br_table, the default one is the last
+
+	fused []expr.OpCode // the opcodes of the instructions fused into the superinstruction by lower
+}
+
+// current returns the instruction on the PC of the active frame
+func (ins *Instance) current() *instr {
+	return &ins.Active.Func.code[ins.Active.PC]
+}
+
+// unsupportedOpCode creates the instr for the opcode having no implementation, which fails only when executed
+func unsupportedOpCode(op expr.OpCode) func(ins *Instance) error {
+	return func(_ *Instance) error {
+		return &UnsupportedOpCodeError{OpCode: op}
+	}
+}
+
+// compile decodes the func body into the instructions, and resolves the blocks on the indices of the instructions
+func (m *Module) compile(body []byte) ([]instr, error) {
+	r := bytes.NewReader(body)
+	code := make([]instr, 0, len(body)/2)
+	stack := make([]*funcBlock, 0)
+	for r.Len() > 0 {
+		pc := uint64(len(code))
+		in := instr{pos: uint64(len(body) - r.Len())}
+		in.op, _ = r.ReadByte()
+		in.fn = instructions[in.op]
+
+		var err error
+		switch op := in.op; {
+		case op == expr.OpCodeBlock || op == expr.OpCodeLoop || op == expr.OpCodeIf:
+			in.block = &funcBlock{StartAt: pc}
+			in.block.BlockType, _, err = m.readBlockType(r)
+			if err != nil {
+				return nil, fmt.Errorf("read block: %w", err)
+			}
+			stack = append(stack, in.block)
+		case op == expr.OpCodeTryTable:
+			in.block = &funcBlock{StartAt: pc}
+			in.block.BlockType, _, err = m.readBlockType(r)
+			if err != nil {
+				return nil, fmt.Errorf("read block: %w", err)
+			}
+			in.block.Catches, _, err = readCatches(r)
+			if err != nil {
+				return nil, fmt.Errorf("read catch clauses: %w", err)
+			}
+			stack = append(stack, in.block)
+		case op == expr.OpCodeElse:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("ill-nested block exists")
+			}
+			stack[len(stack)-1].ElseAt = pc
+		case op == expr.OpCodeEnd:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("ill-nested block exists")
+			}
+			stack[len(stack)-1].EndAt = pc
+			stack = stack[:len(stack)-1]
+		case 0x28 <= op && op <= 0x3e: // memory load,store
+			err = readMemArg(r, &in)
+		case op == expr.OpCodeI32Const:
+			var v int32
+			v, _, err = leb128decode.DecodeInt32(r)
+			in.imm[0] = uint64(uint32(v))
+		case op == expr.OpCodeI64Const:
+			var v int64
+			v, _, err = leb128decode.DecodeInt64(r)
+			in.imm[0] = uint64(v)
+		case op == expr.OpCodeF32Const:
+			var b [4]byte
+			_, err = io.ReadFull(r, b[:])
+			in.imm[0] = uint64(binary.LittleEndian.Uint32(b[:]))
+		case op == expr.OpCodeF64Const:
+			var b [8]byte
+			_, err = io.ReadFull(r, b[:])
+			in.imm[0] = binary.LittleEndian.Uint64(b[:])
+		case op == expr.OpCodeCallIndirect || op == expr.OpCodeReturnCallIndirect:
+			err = readUint32s(r, in.imm[:2])
+		case (0x3f <= op && op <= 0x40) || // memory grow,size
+			(0x20 <= op && op <= 0x26) || // variable, table get,set instructions
+			(0x0c <= op && op <= 0x0d) || // br,br_if instructions
+			op == expr.OpCodeCall || op == expr.OpCodeReturnCall ||
+			op == expr.OpCodeThrow || op == expr.OpCodeFunc:
+			err = readUint32s(r, in.imm[:1])
+		case op == expr.OpCodeNull: // reftype
+			var rt byte
+			rt, err = r.ReadByte()
+			in.imm[0] = uint64(rt)
+		case op == expr.OpCodeSelectT:
+			var n uint32
+			n, _, err = leb128decode.DecodeUint32(r)
+			if err == nil && uint64(n) > uint64(r.Len()) {
+				err = io.ErrUnexpectedEOF
+			}
+			for i := uint32(0); err == nil && i < n; i++ {
+				var vt byte
+				vt, err = r.ReadByte()
+				in.imm[0] = uint64(vt)
+			}
+		case op == expr.OpCodeBrTable:
+			in.labels, err = readBrTable(r)
+		case op == expr.OpCodeMiscPrefix:
+			err = readMiscInstr(r, &in)
+		case op == expr.OpCodeSIMDPrefix:
+			err = readSIMDInstr(r, &in)
+		case op == expr.OpCodeAtomicPrefix:
+			err = readAtomicInstr(r, &in)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read immediate of %#x at %d: %w", in.op, in.pos, err)
+		}
+
+		if in.fn == nil {
+			in.fn = unsupportedOpCode(in.op)
+		}
+		code = append(code, in)
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("ill-nested block exists")
+	}
+
+	return code, nil
+}
+
+// readUint32s reads the immediates of u32 into the imm
+func readUint32s(r *bytes.Reader, imm []uint64) error {
+	for i := range imm {
+		v, _, err := leb128decode.DecodeUint32(r)
+		if err != nil {
+			return err
+		}
+		imm[i] = uint64(v)
+	}
+
+	return nil
+}
+
+// readMemArg reads the memarg into the imm[0] as the memory index and the imm[1] as the offset
+func readMemArg(r *bytes.Reader, in *instr) error {
+	align, _, err := leb128decode.DecodeUint32(r)
+	if err != nil {
+		return fmt.Errorf("read memory align: %w", err)
+	}
+
+	if align&memArgHasMemoryIndex != 0 {
+		index, _, err := leb128decode.DecodeUint32(r)
+		if err != nil {
+			return fmt.Errorf("read memory index: %w", err)
+		}
+		in.imm[0] = uint64(index)
+	}
+
+	// offset, u64 for the memory64
+	in.imm[1], _, err = leb128decode.DecodeUint64(r)
+	if err != nil {
+		return fmt.Errorf("read memory offset: %w", err)
+	}
+
+	return nil
+}
+
+// readBrTable reads the label indices of the br_table, and appends the default one on the last
+func readBrTable(r *bytes.Reader) ([]uint32, error) {
+	nl, _, err := leb128decode.DecodeUint32(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if uint64(nl) > uint64(r.Len()) {
+		return nil, fmt.Errorf("too many labels: %d", nl)
+	}
+
+	labels := make([]uint32, nl+1)
+	for i := range labels {
+		labels[i], _, err = leb128decode.DecodeUint32(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return labels, nil
+}
+
+// readMiscInstr resolves the instr prefixed by expr.OpCodeMiscPrefix and reads its immediates
+func readMiscInstr(r *bytes.Reader, in *instr) error {
+	op, _, err := leb128decode.DecodeUint32(r)
+	if err != nil {
+		return fmt.Errorf("read misc opcode: %w", err)
+	}
+
+	var immediates int
+	switch op {
+	case expr.OpCodeI32TruncSatF32S, expr.OpCodeI32TruncSatF32U, expr.OpCodeI32TruncSatF64S, expr.OpCodeI32TruncSatF64U,
+		expr.OpCodeI64TruncSatF32S, expr.OpCodeI64TruncSatF32U, expr.OpCodeI64TruncSatF64S, expr.OpCodeI64TruncSatF64U:
+		immediates = 0
+	case expr.OpCodeDataDrop, expr.OpCodeMemoryFill, expr.OpCodeElemDrop,
+		expr.OpCodeTableGrow, expr.OpCodeTableSize, expr.OpCodeTableFill:
+		immediates = 1
+	case expr.OpCodeMemoryInit, expr.OpCodeMemoryCopy, expr.OpCodeTableInit, expr.OpCodeTableCopy:
+		immediates = 2
+	default:
+		return fmt.Errorf("invalid misc opcode: %d", op)
+	}
+
+	in.fn, in.sub = miscInstructions[op], op
+
+	return readUint32s(r, in.imm[:immediates])
+}
+
+// readSIMDInstr resolves the instr prefixed by expr.OpCodeSIMDPrefix and reads its immediates
+func readSIMDInstr(r *bytes.Reader, in *instr) error {
+	op, _, err := leb128decode.DecodeUint32(r)
+	if err != nil {
+		return fmt.Errorf("read simd opcode: %w", err)
+	}
+
+	if op >= uint32(len(simdInstructions)) || simdInstructions[op] == nil {
+		return fmt.Errorf("invalid simd opcode: %d", op)
+	}
+	in.fn, in.sub = simdInstructions[op], op
+
+	hasMemArg := op <= expr.OpCodeV128Store || op == expr.OpCodeV128Load32Zero || op == expr.OpCodeV128Load64Zero
+	hasMemArgAndLane := expr.OpCodeV128Load8Lane <= op && op <= expr.OpCodeV128Store64Lane
+	switch {
+	case op == expr.OpCodeV128Const, op == expr.OpCodeI8x16Shuffle:
+		var b [16]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return err
+		}
+		v := v128FromBytes(b[:])
+		in.imm[0], in.imm[1] = v.Lo, v.Hi
+	case expr.OpCodeI8x16ExtractLaneS <= op && op <= expr.OpCodeF64x2ReplaceLane:
+		lane, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("read lane index: %w", err)
+		}
+		in.imm[0] = uint64(lane)
+	case hasMemArg, hasMemArgAndLane:
+		if err := readMemArg(r, in); err != nil {
+			return err
+		}
+		if hasMemArgAndLane {
+			lane, err := r.ReadByte()
+			if err != nil {
+				return fmt.Errorf("read lane index: %w", err)
+			}
+			in.imm[2] = uint64(lane)
+		}
+	}
+
+	return nil
+}
+
+// readAtomicInstr resolves the instr prefixed by expr.OpCodeAtomicPrefix and reads its immediates
+func readAtomicInstr(r *bytes.Reader, in *instr) error {
+	op, _, err := leb128decode.DecodeUint32(r)
+	if err != nil {
+		return fmt.Errorf("read atomic opcode: %w", err)
+	}
+
+	if op >= uint32(len(atomicInstructions)) || atomicInstructions[op] == nil {
+		return fmt.Errorf("invalid atomic opcode: %d", op)
+	}
+	in.fn, in.sub = atomicInstructions[op], op
+
+	if op == expr.OpCodeAtomicFence {
+		_, err := r.ReadByte() // the reserved byte
+		return err
+	}
+
+	return readMemArg(r, in)
+}
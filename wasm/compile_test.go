@@ -0,0 +1,442 @@
+package wasm
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/types"
+)
+
+// compiled compiles the body of the func, whose blocks may only be typed by the value types
+func compiled(f *wasmFunc) *wasmFunc {
+	code, err := (&Module{}).compile(f.body)
+	if err != nil {
+		panic(err)
+	}
+	f.code = code
+
+	return f
+}
+
+func TestModule_compile(t *testing.T) {
+	m := &Module{TypeSection: []*types.FuncType{{}, {}}}
+	for i, c := range []struct {
+		body []byte
+		exp  map[uint64]*funcBlock
+	}{
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1, 0x0, byte(expr.OpCodeEnd)},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeI32Load), 0x00, 0x0, byte(expr.OpCodeEnd)},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeI64Store32), 0x00, 0x0, byte(expr.OpCodeEnd)},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeMemoryGrow), 0x00, byte(expr.OpCodeEnd)},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeMemorySize), 0x00, byte(expr.OpCodeEnd)},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeI32Const), 0x02, byte(expr.OpCodeEnd)},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeI64Const), 0x02, byte(expr.OpCodeEnd)},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1,
+				byte(expr.OpCodeF32Const), 0x02, 0x02, 0x02, 0x02,
+				byte(expr.OpCodeEnd),
+			},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1,
+				byte(expr.OpCodeF64Const), 0x02, 0x02, 0x02, 0x02, 0x02, 0x02, 0x02, 0x02,
+				byte(expr.OpCodeEnd),
+			},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1,
+				byte(expr.OpCodeMiscPrefix), byte(expr.OpCodeMemoryCopy), 0x00, 0x00,
+				byte(expr.OpCodeMiscPrefix), byte(expr.OpCodeDataDrop), 0x01,
+				byte(expr.OpCodeMiscPrefix), byte(expr.OpCodeI32TruncSatF64S),
+				byte(expr.OpCodeEnd),
+			},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     4,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1,
+				byte(expr.OpCodeCallIndirect), 0x01, 0x02,
+				byte(expr.OpCodeSelectT), 0x01, byte(types.ValueTypeExternRef),
+				byte(expr.OpCodeNull), byte(types.ValueTypeFuncRef),
+				byte(expr.OpCodeFunc), 0x80, 0x01,
+				byte(expr.OpCodeTableGet), 0x01,
+				byte(expr.OpCodeMiscPrefix), byte(expr.OpCodeTableGrow), 0x01,
+				byte(expr.OpCodeEnd),
+			},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     7,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1,
+				byte(expr.OpCodeI32Load), 0x42, 0x01, 0x80, 0x01,
+				byte(expr.OpCodeMemoryGrow), 0x01,
+				byte(expr.OpCodeEnd),
+			},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     3,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1,
+				byte(expr.OpCodeI64Load), 0x03, 0x80, 0x80, 0x80, 0x80, 0x80, 0x20,
+				byte(expr.OpCodeEnd),
+			},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeLocalGet), 0x02, byte(expr.OpCodeEnd)},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeGlobalSet), 0x03, byte(expr.OpCodeEnd)},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeGlobalSet), 0x03, byte(expr.OpCodeEnd)},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeBr), 0x03, byte(expr.OpCodeEnd)},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeBrIf), 0x03, byte(expr.OpCodeEnd)},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeCall), 0x03, byte(expr.OpCodeEnd)},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeCallIndirect), 0x03, 0x00, byte(expr.OpCodeEnd)},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1,
+				byte(expr.OpCodeI32Extend8S), byte(expr.OpCodeI32Extend16S),
+				byte(expr.OpCodeI64Extend8S), byte(expr.OpCodeI64Extend16S), byte(expr.OpCodeI64Extend32S),
+				byte(expr.OpCodeEnd),
+			},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     6,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1,
+				byte(expr.OpCodeSIMDPrefix), byte(expr.OpCodeV128Const), 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x0b, 0x0b, 0, 0, 0, 0,
+				byte(expr.OpCodeSIMDPrefix), byte(expr.OpCodeV128Load16Lane), 0x41, 0x01, 0x80, 0x01, 0x07,
+				byte(expr.OpCodeSIMDPrefix), byte(expr.OpCodeI8x16ExtractLaneU), 0x0b,
+				byte(expr.OpCodeSIMDPrefix), 0xfd, 0x01, // f64x2.convert_low_i32x4_u
+				byte(expr.OpCodeEnd),
+			},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     5,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeBrTable),
+				0x03, 0x01, 0x01, 0x01, 0x01, byte(expr.OpCodeEnd),
+			},
+			exp: map[uint64]*funcBlock{
+				0: {
+					StartAt:   0,
+					EndAt:     2,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeNop),
+				byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeCallIndirect), 0x03, 0x00, byte(expr.OpCodeEnd),
+				byte(expr.OpCodeIf), 0x1, byte(expr.OpCodeLocalGet), 0x02,
+				byte(expr.OpCodeElse), byte(expr.OpCodeLocalGet), 0x02,
+				byte(expr.OpCodeEnd),
+			},
+			exp: map[uint64]*funcBlock{
+				1: {
+					StartAt:   1,
+					EndAt:     3,
+					BlockType: &types.FuncType{},
+				},
+				4: {
+					StartAt:   4,
+					ElseAt:    6,
+					EndAt:     8,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+		{
+			body: []byte{byte(expr.OpCodeNop),
+				byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeCallIndirect), 0x03, 0x00, byte(expr.OpCodeEnd),
+				byte(expr.OpCodeIf), 0x1, byte(expr.OpCodeLocalGet), 0x02,
+				byte(expr.OpCodeElse), byte(expr.OpCodeLocalGet), 0x02,
+				byte(expr.OpCodeIf), 0x01, byte(expr.OpCodeLocalGet), 0x02, byte(expr.OpCodeEnd),
+				byte(expr.OpCodeEnd),
+			},
+			exp: map[uint64]*funcBlock{
+				1: {
+					StartAt:   1,
+					EndAt:     3,
+					BlockType: &types.FuncType{},
+				},
+				4: {
+					StartAt:   4,
+					ElseAt:    6,
+					EndAt:     11,
+					BlockType: &types.FuncType{},
+				},
+				8: {
+					StartAt:   8,
+					EndAt:     10,
+					BlockType: &types.FuncType{},
+				},
+			},
+		},
+	} {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			code, err := m.compile(c.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := map[uint64]*funcBlock{}
+			for pc, in := range code {
+				if in.block != nil {
+					if in.block.StartAt != uint64(pc) {
+						t.Errorf("block of %d starts at %d", pc, in.block.StartAt)
+					}
+					actual[uint64(pc)] = in.block
+				}
+			}
+			if !reflect.DeepEqual(c.exp, actual) {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestModule_compileImmediates(t *testing.T) {
+	m := &Module{}
+	for _, c := range []struct {
+		name   string
+		body   []byte
+		imm    [3]uint64
+		labels []uint32
+	}{
+		{name: "i32.const", body: []byte{byte(expr.OpCodeI32Const), 0x7f}, imm: [3]uint64{math.MaxUint32}},
+		{name: "i64.const", body: []byte{byte(expr.OpCodeI64Const), 0x80, 0x01}, imm: [3]uint64{0x80}},
+		{name: "f32.const", body: []byte{byte(expr.OpCodeF32Const), 0x00, 0x00, 0x80, 0x3f}, imm: [3]uint64{0x3f800000}},
+		{name: "memarg", body: []byte{byte(expr.OpCodeI32Load), 0x02, 0x80, 0x01}, imm: [3]uint64{0, 0x80}},
+		{name: "memarg with memory index", body: []byte{byte(expr.OpCodeI32Load), 0x42, 0x01, 0x03}, imm: [3]uint64{1, 3}},
+		{name: "call_indirect", body: []byte{byte(expr.OpCodeCallIndirect), 0x02, 0x01}, imm: [3]uint64{2, 1}},
+		{name: "br_table", body: []byte{byte(expr.OpCodeBrTable), 0x02, 0x02, 0x01, 0x00}, labels: []uint32{2, 1, 0}},
+		{name: "memory.copy", body: []byte{expr.OpCodeMiscPrefix, byte(expr.OpCodeMemoryCopy), 0x01, 0x02}, imm: [3]uint64{1, 2}},
+		{
+			name: "v128.load8_lane",
+			body: []byte{expr.OpCodeSIMDPrefix, byte(expr.OpCodeV128Load8Lane), 0x00, 0x04, 0x0f},
+			imm:  [3]uint64{0, 4, 15},
+		},
+		{
+			name: "v128.const",
+			body: []byte{expr.OpCodeSIMDPrefix, byte(expr.OpCodeV128Const), 1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0},
+			imm:  [3]uint64{1, 2},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			code, err := m.compile(c.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(code) != 1 || code[0].fn == nil {
+				t.Fatalf("compiled into %d instructions", len(code))
+			}
+			if code[0].imm != c.imm || !reflect.DeepEqual(code[0].labels, c.labels) {
+				t.Errorf("got %v %v", code[0].imm, code[0].labels)
+			}
+		})
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		code, err := m.compile([]byte{byte(expr.OpCodeNop), 0xff})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := code[1].fn(nil); !errors.Is(err, ErrUnsupportedOpCode) {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		for _, body := range [][]byte{
+			{byte(expr.OpCodeBlock), 0x40},
+			{byte(expr.OpCodeEnd)},
+			{byte(expr.OpCodeElse)},
+			{byte(expr.OpCodeI32Load), 0x00},
+			{byte(expr.OpCodeBrTable), 0x05, 0x00},
+			{byte(expr.OpCodeSelectT), 0x02, byte(types.ValueTypeI32)},
+			{expr.OpCodeMiscPrefix, 0x7f},
+			{expr.OpCodeSIMDPrefix, byte(expr.OpCodeV128Const), 0x00},
+			{expr.OpCodeAtomicPrefix, 0x7f},
+		} {
+			if _, err := m.compile(body); err == nil {
+				t.Errorf("no error on %#x", body)
+			}
+		}
+	})
+}
+
+// execCurrent executes the instruction on the PC of the active frame
+func execCurrent(ins *Instance) error {
+	return ins.current().fn(ins)
+}
@@ -0,0 +1,54 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrInterrupted occurs when the context of CallExportedFuncContext is done during the execution
+var ErrInterrupted = errors.New("execution interrupted")
+
+// InterruptedError is the trap of the execution stopped by its context, which wraps the ctx.Err()
+type InterruptedError struct {
+	Err error
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrInterrupted, e.Err)
+}
+
+// Unwrap makes the InterruptedError comparable with context.Canceled and context.DeadlineExceeded by errors.Is
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes the InterruptedError comparable with ErrInterrupted by errors.Is
+func (e *InterruptedError) Is(target error) bool {
+	return target == ErrInterrupted
+}
+
+// Context returns the context of the running CallExportedFuncContext, which the host funcs can follow.
+// It is context.Background() when nothing is running
+func (ins *Instance) Context() context.Context {
+	if ins.ctx == nil {
+		return context.Background()
+	}
+
+	return ins.ctx
+}
+
+// checkContext returns the InterruptedError once the context of the running CallExportedFuncContext is done.
+// It is checked on the calls and the loop iterations, which every endless execution goes through
+func (ins *Instance) checkContext() error {
+	if ins.done == nil {
+		return nil
+	}
+
+	select {
+	case <-ins.done:
+		return &InterruptedError{Err: ins.ctx.Err()}
+	default:
+		return nil
+	}
+}
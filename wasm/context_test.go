@@ -0,0 +1,118 @@
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/c0mm4nd/wasman/config"
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/segments"
+)
+
+// contextInstance instantiates the module with a shared memory exporting the funcs below, all of the type () -> (result i32)
+//
+//	(func $loop (result i32) (loop (br 0)) (i32.const 0))
+//	(func $tail (result i32) (return_call $tail))
+//	(func $wait (result i32) (memory.atomic.wait32 (i32.const 0) (i32.const 0) (i64.const -1)))
+//	(func $one (result i32) (i32.const 1))
+func contextInstance(t *testing.T) *Instance {
+	funcs := [][]byte{
+		{0x00, byte(expr.OpCodeLoop), 0x40, byte(expr.OpCodeBr), 0x00, byte(expr.OpCodeEnd), byte(expr.OpCodeI32Const), 0x00, byte(expr.OpCodeEnd)},
+		{0x00, byte(expr.OpCodeReturnCall), 0x01, byte(expr.OpCodeEnd)},
+		{
+			0x00,
+			byte(expr.OpCodeI32Const), 0x00,
+			byte(expr.OpCodeI32Const), 0x00,
+			byte(expr.OpCodeI64Const), 0x7f,
+			expr.OpCodeAtomicPrefix, byte(expr.OpCodeMemoryAtomicWait32), 0x02, 0x00,
+			byte(expr.OpCodeEnd),
+		},
+		{0x00, byte(expr.OpCodeI32Const), 0x01, byte(expr.OpCodeEnd)},
+	}
+
+	bin := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	bin = append(bin, benchSection(0x01, 0x01, 0x60, 0x00, 0x01, 0x7f)...) // type
+	bin = append(bin, benchSection(0x03, 0x04, 0x00, 0x00, 0x00, 0x00)...) // function
+	bin = append(bin, benchSection(0x05, 0x01, 0x03, 0x01, 0x01)...)       // memory
+	exports := []byte{0x04}
+	for i, name := range []string{"loop", "tail", "wait", "one"} {
+		exports = append(append(append(exports, byte(len(name))), name...), 0x00, byte(i))
+	}
+	bin = append(bin, benchSection(0x07, exports...)...)
+	code := []byte{byte(len(funcs))}
+	for _, f := range funcs {
+		code = append(append(code, byte(len(f))), f...)
+	}
+	bin = append(bin, benchSection(0x0a, code...)...)
+
+	m, err := NewModule(config.ModuleConfig{}, bytes.NewReader(bin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins, err := NewInstance(m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ins
+}
+
+func TestInstance_CallExportedFuncContext(t *testing.T) {
+	ins := contextInstance(t)
+
+	for _, name := range []string{"loop", "tail", "wait"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, _, err := ins.CallExportedFuncContext(ctx, name)
+		cancel()
+		if !errors.Is(err, ErrInterrupted) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("%s: got %v", name, err)
+		}
+
+		// the instance is reusable
+		if ins.OperandStack.Ptr != -1 || ins.FrameStack.Ptr != -1 || ins.Active != nil || ins.ctx != nil {
+			t.Errorf("%s: the stacks are left on %d, %d", name, ins.OperandStack.Ptr, ins.FrameStack.Ptr)
+		}
+		ret, _, err := ins.CallExportedFunc("one")
+		if err != nil || ret[0] != 1 {
+			t.Errorf("%s: got %v, %v", name, ret, err)
+		}
+	}
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, _, err := ins.CallExportedFuncContext(ctx, "one")
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("host", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), ins, "value")
+		hf := &HostFunc{
+			Signature: ins.Functions[3].getType(),
+			function: func([]uint64) []uint64 {
+				if ins.Context() != ctx {
+					t.Error("the host func is not in the context")
+				}
+				return []uint64{2}
+			},
+		}
+		ins.Functions = append(ins.Functions, hf)
+		ins.ExportSection["host"] = &segments.ExportSegment{
+			Name: "host",
+			Desc: &segments.ExportDesc{Kind: segments.KindFunction, Index: uint32(len(ins.Functions) - 1)},
+		}
+
+		ret, _, err := ins.CallExportedFuncContext(ctx, "host")
+		if err != nil || ret[0] != 2 {
+			t.Errorf("got %v, %v", ret, err)
+		}
+		if ins.Context() != context.Background() {
+			t.Error("the context is left")
+		}
+	})
+}
@@ -0,0 +1,278 @@
+package wasm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/segments"
+	"github.com/c0mm4nd/wasman/stacks"
+	"github.com/c0mm4nd/wasman/types"
+)
+
+// errors on exception handling
+var (
+	ErrExportedTagNotFound = errors.New("exported tag is not found")
+	ErrTagIndexOutOfRange  = errors.New("tag index out of range")
+	ErrNullExnRef          = errors.New("null exception reference")
+	ErrUncaughtException   = errors.New("uncaught exception")
+)
+
+// Tag is the runtime instance of an exception tag, the exceptions are caught by the identity of their tags,
+// so a tag imported by another module is the same one
+type Tag struct {
+	Type *types.FuncType // the params are the payload, no results
+}
+
+// NewTag creates a Tag whose exceptions carry the payload of the value types,
+// which can be defined on the linker for the wasm modules to import
+func NewTag(payload ...types.ValueType) *Tag {
+	return &Tag{Type: &types.FuncType{InputTypes: payload}}
+}
+
+// Exception is a wasm exception thrown by the throw instr or a host function.
+// The one not caught by any try_table is returned as the error of the call,
+// which can be caught by errors.As and compared with ErrUncaughtException by errors.Is.
+//
+// The exception caught by catch_ref or catch_all_ref is registered on the instance as an exnref,
+// which stays valid while a value of the instance (on the stack, in a local, a global, a table or the payload
+// of another registered exception) may hold it, then its slot is freed for the later ones.
+// So an exnref in the results or the payload returned to the host is only valid until the next call on the instance
+type Exception struct {
+	Tag         *Tag
+	Payload     []uint64 // the values in the order of the params of the tag type, a v128 keeps its low 64 bits here
+	PayloadHigh []uint64 // the high halves of the v128 values in the Payload on the same indices, nil when the tag has no v128 param
+}
+
+func (e *Exception) Error() string {
+	return fmt.Sprintf("%v: payload %v", ErrUncaughtException, e.Payload)
+}
+
+// Is makes the Exception comparable with ErrUncaughtException by errors.Is
+func (e *Exception) Is(target error) bool {
+	return target == ErrUncaughtException
+}
+
+// Throw throws the exception of the tag with the payload from a host function. It never returns,
+// and the exception unwinds the wasm frames until a try_table catches it.
+// The tag with a v128 param is rejected with the ErrV128Signature, throw it by ThrowV128
+func (ins *Instance) Throw(tag *Tag, payload ...uint64) {
+	if len(payload) != len(tag.Type.InputTypes) {
+		panic(ErrInvalidArgNum)
+	}
+	if hasV128(tag.Type.InputTypes) {
+		panic(ErrV128Signature)
+	}
+
+	panic(&Exception{Tag: tag, Payload: payload})
+}
+
+// ThrowV128 throws the exception like Throw, but takes every value of the payload as a V128,
+// so that the v128 ones keep all their 128 bits. The values of the other types are held in the Lo
+func (ins *Instance) ThrowV128(tag *Tag, payload ...V128) {
+	if len(payload) != len(tag.Type.InputTypes) {
+		panic(ErrInvalidArgNum)
+	}
+
+	exc := &Exception{Tag: tag, Payload: make([]uint64, len(payload))}
+	if hasV128(tag.Type.InputTypes) {
+		exc.PayloadHigh = make([]uint64, len(payload))
+	}
+	for i, v := range payload {
+		exc.Payload[i] = v.Lo
+		if exc.PayloadHigh != nil && tag.Type.InputTypes[i] == types.ValueTypeV128 {
+			exc.PayloadHigh[i] = v.Hi
+		}
+	}
+
+	panic(exc)
+}
+
+// ExportedTag returns the tag exported as the name
+func (ins *Instance) ExportedTag(name string) (*Tag, error) {
+	exp, ok := ins.Module.ExportSection[name]
+	if !ok || exp.Desc.Kind != segments.KindTag {
+		return nil, ErrExportedTagNotFound
+	}
+
+	if exp.Desc.Index >= uint32(len(ins.IndexSpace.Tags)) {
+		return nil, ErrTagIndexOutOfRange
+	}
+
+	return ins.IndexSpace.Tags[exp.Desc.Index], nil
+}
+
+// exnRefsMinCollect is the number of the exnrefs under which newExnRef never collects the unreachable ones
+const exnRefsMinCollect = 1024
+
+// newExnRef registers the caught exception on the instance and returns the exnref standing for it,
+// reusing the slot freed by collectExnRefs if any
+func (ins *Instance) newExnRef(exc *Exception) uint64 {
+	if len(ins.exnRefsFree) == 0 && len(ins.exnRefs) >= exnRefsMinCollect && len(ins.exnRefs) >= ins.exnRefsNextCollect {
+		ins.collectExnRefs()
+	}
+
+	if n := len(ins.exnRefsFree); n > 0 {
+		i := ins.exnRefsFree[n-1]
+		ins.exnRefsFree = ins.exnRefsFree[:n-1]
+		ins.exnRefs[i] = exc
+
+		return uint64(i) + 1
+	}
+
+	ins.exnRefs = append(ins.exnRefs, exc)
+
+	return uint64(len(ins.exnRefs))
+}
+
+// collectExnRefs frees the slots of the exnrefs which no value of the instance can hold.
+// Any value on the OperandStack, in the locals of the running frames, in the globals or in the tables
+// looking like an exnref keeps its exception, and so do the payloads of the kept exceptions,
+// so the exnref in use is never freed while a few unreachable ones may be kept by the other values.
+// The next collection waits until the exnrefs double the kept ones, so the cost is amortized over the catches
+func (ins *Instance) collectExnRefs() {
+	kept := make([]bool, len(ins.exnRefs))
+	var pending []*Exception
+	keepRef := func(v uint64) {
+		if v != refNull && v <= uint64(len(kept)) && !kept[v-1] {
+			kept[v-1] = true
+			pending = append(pending, ins.exnRefs[v-1])
+		}
+	}
+	keep := func(values []uint64) {
+		for _, v := range values {
+			keepRef(v)
+		}
+	}
+
+	keep(ins.OperandStack.Values[:ins.OperandStack.Ptr+1])
+	if ins.FrameStack != nil {
+		for _, frame := range ins.FrameStack.Values[:ins.FrameStack.Ptr+1] {
+			keep(frame.Locals)
+		}
+	}
+	keep(ins.Globals)
+	if ins.IndexSpace != nil {
+		for _, table := range ins.IndexSpace.Tables {
+			for _, index := range table.Value {
+				keepRef(refFromIndex(index))
+			}
+		}
+	}
+	for len(pending) > 0 {
+		exc := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if exc != nil {
+			keep(exc.Payload)
+		}
+	}
+
+	ins.exnRefsFree = ins.exnRefsFree[:0]
+	for i := len(kept) - 1; i >= 0; i-- {
+		if !kept[i] {
+			ins.exnRefs[i] = nil
+			ins.exnRefsFree = append(ins.exnRefsFree, uint32(i))
+		}
+	}
+	ins.exnRefsNextCollect = 2 * (len(kept) - len(ins.exnRefsFree))
+}
+
+// exnRef returns the exception which the exnref stands for, nil for the null one
+func (ins *Instance) exnRef(ref uint64) *Exception {
+	if ref == refNull || ref > uint64(len(ins.exnRefs)) {
+		return nil
+	}
+
+	return ins.exnRefs[ref-1]
+}
+
+func throw(ins *Instance) error {
+	index := uint32(ins.current().imm[0])
+	if index >= uint32(len(ins.IndexSpace.Tags)) {
+		return ErrTagIndexOutOfRange
+	}
+
+	tag := ins.IndexSpace.Tags[index]
+	exc := &Exception{
+		Tag:     tag,
+		Payload: make([]uint64, len(tag.Type.InputTypes)),
+	}
+	if hasV128(tag.Type.InputTypes) {
+		exc.PayloadHigh = make([]uint64, len(exc.Payload))
+		for i := len(exc.Payload) - 1; i >= 0; i-- {
+			exc.Payload[i], exc.PayloadHigh[i] = ins.OperandStack.PopV128()
+		}
+	} else {
+		for i := len(exc.Payload) - 1; i >= 0; i-- {
+			exc.Payload[i] = ins.OperandStack.Pop()
+		}
+	}
+
+	return exc
+}
+
+func throwRef(ins *Instance) error {
+	exc := ins.exnRef(ins.OperandStack.Pop())
+	if exc == nil {
+		return ErrNullExnRef
+	}
+
+	return exc
+}
+
+func tryTable(ins *Instance) error {
+	ctx := ins.Active
+	block := ins.current().block
+	if block == nil {
+		return ErrBlockNotInitialized
+	}
+
+	pushLabel(ctx.LabelStack, stacks.Label{
+		Arity:          len(block.BlockType.ReturnTypes),
+		Height:         ins.OperandStack.Ptr - len(block.BlockType.InputTypes),
+		ContinuationPC: block.EndAt,
+		EndPC:          block.EndAt,
+		Catches:        block.Catches,
+	})
+
+	return nil
+}
+
+// catchException looks for the innermost try_table of the active frame catching the exception,
+// and branches to the label of the matched catch clause with the values it passes.
+// The labels are all popped when no one catches, then the exception goes on to the caller frame
+func (ins *Instance) catchException(exc *Exception) (bool, error) {
+	labels := ins.Active.LabelStack
+	for labels.Ptr > -1 {
+		l := labels.Pop()
+		for _, c := range l.Catches {
+			withPayload := c.Kind == expr.CatchKindCatch || c.Kind == expr.CatchKindCatchRef
+			if withPayload {
+				if c.Tag >= uint32(len(ins.IndexSpace.Tags)) {
+					return false, ErrTagIndexOutOfRange
+				}
+				if ins.IndexSpace.Tags[c.Tag] != exc.Tag {
+					continue
+				}
+			}
+
+			ins.OperandStack.Ptr = l.Height
+			if withPayload {
+				for i, v := range exc.Payload {
+					if exc.PayloadHigh != nil {
+						ins.OperandStack.PushV128(v, exc.PayloadHigh[i])
+					} else {
+						ins.OperandStack.Push(v)
+					}
+				}
+			}
+			if c.Kind == expr.CatchKindCatchRef || c.Kind == expr.CatchKindCatchAllRef {
+				ins.OperandStack.Push(ins.newExnRef(exc))
+			}
+
+			return true, branchAt(ins, c.Label)
+		}
+	}
+
+	return false, nil
+}
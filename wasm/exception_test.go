@@ -0,0 +1,292 @@
+package wasm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/segments"
+	"github.com/c0mm4nd/wasman/stacks"
+	"github.com/c0mm4nd/wasman/types"
+)
+
+func TestInstance_CallExportedFuncException(t *testing.T) {
+	i32 := types.ValueTypeI32
+	payload := &types.FuncType{InputTypes: []types.ValueType{i32}}
+	result := &types.FuncType{ReturnTypes: []types.ValueType{i32}}
+	tag0, tag1 := &Tag{Type: payload}, &Tag{Type: payload}
+
+	exports := map[string]*segments.ExportSegment{}
+	for i, name := range []string{"thrower", "host", "catch", "catch_all", "uncaught", "rethrow"} {
+		exports[name] = &segments.ExportSegment{Name: name, Desc: &segments.ExportDesc{Kind: segments.KindFunction, Index: uint32(i)}}
+	}
+	exports["tag"] = &segments.ExportSegment{Name: "tag", Desc: &segments.ExportDesc{Kind: segments.KindTag, Index: 0}}
+
+	ins := &Instance{
+		Module: &Module{
+			IndexSpace:    &IndexSpace{Tags: []*Tag{tag0, tag1}},
+			ExportSection: exports,
+		},
+		OperandStack: stacks.NewOperandStack(),
+		FrameStack: &stacks.Stack[*Frame]{
+			Ptr:    -1,
+			Values: make([]*Frame, stacks.InitialLabelStackHeight),
+		},
+	}
+
+	host := &HostFunc{
+		Signature: &types.FuncType{},
+		function: func([]uint64) []uint64 {
+			ins.Throw(tag0, 5)
+			return nil
+		},
+	}
+	wasmFn := func(sig *types.FuncType, body []byte) fn {
+		code, err := ins.compile(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &wasmFunc{signature: sig, body: body, code: code}
+	}
+
+	ins.Functions = []fn{
+		// (func $thrower (param i32) (throw $tag0 (local.get 0)))
+		wasmFn(payload, []byte{
+			byte(expr.OpCodeLocalGet), 0x00,
+			byte(expr.OpCodeThrow), 0x00,
+		}),
+		host,
+		// (func $catch (result i32)
+		//   (block (result i32) (try_table (catch $tag0 0) (call $thrower (i32.const 42))) (i32.const 0)))
+		wasmFn(result, []byte{
+			byte(expr.OpCodeBlock), 0x7f,
+			byte(expr.OpCodeTryTable), 0x40, 0x01, expr.CatchKindCatch, 0x00, 0x00,
+			byte(expr.OpCodeI32Const), 42,
+			byte(expr.OpCodeCall), 0x00,
+			byte(expr.OpCodeEnd),
+			byte(expr.OpCodeI32Const), 0x00,
+			byte(expr.OpCodeEnd),
+		}),
+		// (func $catch_all (result i32)
+		//   (block (try_table (catch_all 0) (call $host)) (return (i32.const 1))) (i32.const 2))
+		wasmFn(result, []byte{
+			byte(expr.OpCodeBlock), 0x40,
+			byte(expr.OpCodeTryTable), 0x40, 0x01, expr.CatchKindCatchAll, 0x00,
+			byte(expr.OpCodeCall), 0x01,
+			byte(expr.OpCodeEnd),
+			byte(expr.OpCodeI32Const), 0x01,
+			byte(expr.OpCodeReturn),
+			byte(expr.OpCodeEnd),
+			byte(expr.OpCodeI32Const), 0x02,
+		}),
+		// (func $uncaught (try_table (catch $tag0 0) (throw $tag1 (i32.const 7))))
+		wasmFn(&types.FuncType{}, []byte{
+			byte(expr.OpCodeTryTable), 0x40, 0x01, expr.CatchKindCatch, 0x00, 0x00,
+			byte(expr.OpCodeI32Const), 0x07,
+			byte(expr.OpCodeThrow), 0x01,
+			byte(expr.OpCodeEnd),
+		}),
+		// (func $rethrow
+		//   (throw_ref (block (result exnref) (try_table (catch_all_ref 0) (call $thrower (i32.const 9))) (ref.null exn))))
+		wasmFn(&types.FuncType{}, []byte{
+			byte(expr.OpCodeBlock), 0x69,
+			byte(expr.OpCodeTryTable), 0x40, 0x01, expr.CatchKindCatchAllRef, 0x00,
+			byte(expr.OpCodeI32Const), 0x09,
+			byte(expr.OpCodeCall), 0x00,
+			byte(expr.OpCodeEnd),
+			byte(expr.OpCodeNull), 0x69,
+			byte(expr.OpCodeEnd),
+			byte(expr.OpCodeThrowRef),
+		}),
+	}
+
+	tag, err := ins.ExportedTag("tag")
+	if err != nil || tag != tag0 {
+		t.Fatalf("got %v, %v", tag, err)
+	}
+
+	t.Run("catch", func(t *testing.T) {
+		ret, _, err := ins.CallExportedFunc("catch")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ret[0] != 42 {
+			t.Errorf("got %d, want 42", ret[0])
+		}
+	})
+
+	t.Run("catch_all", func(t *testing.T) {
+		ret, _, err := ins.CallExportedFunc("catch_all")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ret[0] != 2 {
+			t.Errorf("got %d, want 2", ret[0])
+		}
+	})
+
+	for _, c := range []struct {
+		name    string
+		tag     *Tag
+		payload []uint64
+	}{
+		{name: "thrower", tag: tag0, payload: []uint64{3}},
+		{name: "host", tag: tag0, payload: []uint64{5}},
+		{name: "uncaught", tag: tag1, payload: []uint64{7}},
+		{name: "rethrow", tag: tag0, payload: []uint64{9}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var args []uint64
+			if c.name == "thrower" {
+				args = c.payload
+			}
+			ins.OperandStack.Ptr = -1
+			_, _, err := ins.CallExportedFunc(c.name, args...)
+			if !errors.Is(err, ErrUncaughtException) {
+				t.Fatalf("got %v", err)
+			}
+
+			var exc *Exception
+			if !errors.As(err, &exc) {
+				t.Fatal("not an Exception")
+			}
+			if exc.Tag != c.tag || !reflect.DeepEqual(exc.Payload, c.payload) {
+				t.Errorf("got %v", exc)
+			}
+			if ins.FrameStack.Ptr != -1 {
+				t.Errorf("frame stack is not unwound: %d", ins.FrameStack.Ptr)
+			}
+		})
+	}
+
+	t.Run("throw_ref null", func(t *testing.T) {
+		ins.OperandStack.Push(refNull)
+		if err := throwRef(ins); !errors.Is(err, ErrNullExnRef) {
+			t.Errorf("got %v", err)
+		}
+	})
+}
+
+func TestInstance_ThrowV128(t *testing.T) {
+	v128 := types.ValueTypeV128
+	tag := NewTag(types.ValueTypeI32, v128)
+	ins := &Instance{
+		Module: &Module{
+			IndexSpace: &IndexSpace{Tags: []*Tag{tag}},
+			ExportSection: map[string]*segments.ExportSegment{
+				"host":  {Name: "host", Desc: &segments.ExportDesc{Kind: segments.KindFunction, Index: 0}},
+				"catch": {Name: "catch", Desc: &segments.ExportDesc{Kind: segments.KindFunction, Index: 1}},
+			},
+		},
+		OperandStack: stacks.NewOperandStack(),
+		FrameStack: &stacks.Stack[*Frame]{
+			Ptr:    -1,
+			Values: make([]*Frame, stacks.InitialLabelStackHeight),
+		},
+	}
+
+	// (func $catch (result i32 v128)
+	//   (block (result i32 v128) (try_table (catch $tag 0) (call $host)) (unreachable)))
+	body := []byte{
+		byte(expr.OpCodeBlock), 0x00,
+		byte(expr.OpCodeTryTable), 0x40, 0x01, expr.CatchKindCatch, 0x00, 0x00,
+		byte(expr.OpCodeCall), 0x00,
+		byte(expr.OpCodeEnd),
+		byte(expr.OpCodeUnreachable),
+		byte(expr.OpCodeEnd),
+	}
+	ins.TypeSection = []*types.FuncType{{ReturnTypes: []types.ValueType{types.ValueTypeI32, v128}}}
+	code, err := ins.compile(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins.Functions = []fn{
+		&HostFunc{
+			Signature: &types.FuncType{},
+			function: func([]uint64) []uint64 {
+				ins.ThrowV128(tag, V128{Lo: 7}, V128{Lo: 1, Hi: 2})
+				return nil
+			},
+		},
+		&wasmFunc{signature: ins.TypeSection[0], body: body, code: code, hasV128: true},
+	}
+
+	_, _, err = ins.CallExportedFuncV128("host")
+	var exc *Exception
+	if !errors.As(err, &exc) || !reflect.DeepEqual(exc.Payload, []uint64{7, 1}) || !reflect.DeepEqual(exc.PayloadHigh, []uint64{0, 2}) {
+		t.Fatalf("got %v", err)
+	}
+
+	ret, _, err := ins.CallExportedFuncV128("catch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ret, []V128{{Lo: 7}, {Lo: 1, Hi: 2}}) {
+		t.Errorf("got %v", ret)
+	}
+}
+
+func TestModule_compileTryTable(t *testing.T) {
+	m := &Module{}
+	body := []byte{
+		byte(expr.OpCodeTryTable), 0x40, 0x02, expr.CatchKindCatchRef, 0x80, 0x01, 0x00, expr.CatchKindCatchAll, 0x01,
+		byte(expr.OpCodeThrow), 0x80, 0x01,
+		byte(expr.OpCodeEnd),
+	}
+
+	code, err := m.compile(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &funcBlock{
+		StartAt:   0,
+		EndAt:     2,
+		BlockType: &types.FuncType{},
+		Catches: []stacks.Catch{
+			{Kind: expr.CatchKindCatchRef, Tag: 128, Label: 0},
+			{Kind: expr.CatchKindCatchAll, Label: 1},
+		},
+	}
+	if len(code) != 3 || !reflect.DeepEqual(exp, code[0].block) {
+		t.Errorf("got %#v", code[0].block)
+	}
+}
+
+func TestInstance_collectExnRefs(t *testing.T) {
+	ins := &Instance{
+		Module:       &Module{IndexSpace: &IndexSpace{}},
+		OperandStack: stacks.NewOperandStack(),
+		FrameStack: &stacks.Stack[*Frame]{
+			Ptr:    -1,
+			Values: make([]*Frame, stacks.InitialLabelStackHeight),
+		},
+		Globals: make([]uint64, 1),
+	}
+
+	// the refs held on the stack, in a local, in a global, and in the payload of the held one
+	exc := func() *Exception { return &Exception{} }
+	onStack, inLocal, inGlobal, inPayload := ins.newExnRef(exc()), ins.newExnRef(exc()), ins.newExnRef(exc()), ins.newExnRef(exc())
+	ins.exnRef(onStack).Payload = []uint64{inPayload}
+	ins.OperandStack.Push(onStack)
+	ins.FrameStack.Push(&Frame{Locals: []uint64{inLocal}})
+	ins.Globals[0] = inGlobal
+
+	// the refs caught and dropped in a loop
+	for i := 0; i < 100*exnRefsMinCollect; i++ {
+		ref := ins.newExnRef(exc())
+		if ins.exnRef(ref) == nil {
+			t.Fatalf("got null on %d", ref)
+		}
+	}
+
+	if len(ins.exnRefs) > 2*exnRefsMinCollect {
+		t.Errorf("got %d exnrefs", len(ins.exnRefs))
+	}
+	for _, ref := range []uint64{onStack, inLocal, inGlobal, inPayload} {
+		if ins.exnRef(ref) == nil {
+			t.Errorf("freed the held %d", ref)
+		}
+	}
+}
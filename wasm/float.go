@@ -0,0 +1,226 @@
+package wasm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/segments"
+	"github.com/c0mm4nd/wasman/types"
+)
+
+// ErrFloatPointDisabled occurs when the module uses the f32 or f64 with ModuleConfig.DisableFloatPoint
+var ErrFloatPointDisabled = errors.New("float point is disabled")
+
+const (
+	canonicalNaN32 = 0x7fc0_0000
+	canonicalNaN64 = 0x7ff8_0000_0000_0000
+)
+
+// FloatPointError locates the use of the f32 or f64 with ModuleConfig.DisableFloatPoint
+type FloatPointError struct {
+	Where string // the use outside the func bodies, like "type 1" or "global 0", empty for the instructions
+
+	Func      uint32 // the index of the func in the function index space
+	Offset    uint64 // the offset of the instruction in the func body
+	OpCode    expr.OpCode
+	SubOpCode uint32 // only for the prefixed opcodes
+}
+
+func (e *FloatPointError) Error() string {
+	if e.Where != "" {
+		return fmt.Sprintf("%v: used by %s", ErrFloatPointDisabled, e.Where)
+	}
+
+	if e.OpCode == expr.OpCodeMiscPrefix || e.OpCode == expr.OpCodeSIMDPrefix {
+		return fmt.Sprintf("%v: %#x %d in func %d at %#x", ErrFloatPointDisabled, e.OpCode, e.SubOpCode, e.Func, e.Offset)
+	}
+
+	return fmt.Sprintf("%v: %s(%#x) in func %d at %#x", ErrFloatPointDisabled, expr.GetOpCodeName(e.OpCode), e.OpCode, e.Func, e.Offset)
+}
+
+// Is makes the FloatPointError comparable with ErrFloatPointDisabled by errors.Is
+func (e *FloatPointError) Is(target error) bool {
+	return target == ErrFloatPointDisabled
+}
+
+func hasFloat(vts []types.ValueType) bool {
+	for _, vt := range vts {
+		if vt == types.ValueTypeF32 || vt == types.ValueTypeF64 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isFloatInstr returns whether the instruction operates on the f32 or f64, including the blocks and selects typed by them
+func isFloatInstr(in *instr) bool {
+	switch op := in.op; op {
+	case expr.OpCodeF32Load, expr.OpCodeF64Load, expr.OpCodeF32Store, expr.OpCodeF64Store,
+		expr.OpCodeF32Const, expr.OpCodeF64Const:
+		return true
+	case expr.OpCodeSelectT:
+		return hasFloat([]types.ValueType{types.ValueType(in.imm[0])})
+	case expr.OpCodeMiscPrefix:
+		return in.sub <= expr.OpCodeI64TruncSatF64U
+	case expr.OpCodeSIMDPrefix:
+		return isFloatSIMD(in.sub)
+	default:
+		if in.block != nil && in.block.BlockType != nil {
+			return hasFloat(in.block.BlockType.InputTypes) || hasFloat(in.block.BlockType.ReturnTypes)
+		}
+
+		return (expr.OpCodeF32Eq <= op && op <= expr.OpCodeF64Ge) ||
+			(expr.OpCodeF32Abs <= op && op <= expr.OpCodeF64CopySign) ||
+			(expr.OpCodeI32TruncF32S <= op && op <= expr.OpCodeI32truncF64U) ||
+			(expr.OpCodeI64TruncF32S <= op && op <= expr.OpCodeF64ReinterpretI64)
+	}
+}
+
+func isFloatSIMD(op uint32) bool {
+	switch op {
+	case expr.OpCodeF32x4Splat, expr.OpCodeF64x2Splat,
+		expr.OpCodeF32x4DemoteF64x2Zero, expr.OpCodeF64x2PromoteLowF32x4,
+		expr.OpCodeF32x4Ceil, expr.OpCodeF32x4Floor, expr.OpCodeF32x4Trunc, expr.OpCodeF32x4Nearest,
+		expr.OpCodeF64x2Ceil, expr.OpCodeF64x2Floor, expr.OpCodeF64x2Trunc, expr.OpCodeF64x2Nearest:
+		return true
+	}
+
+	return (expr.OpCodeF32x4ExtractLane <= op && op <= expr.OpCodeF64x2ReplaceLane) ||
+		(expr.OpCodeF32x4Eq <= op && op <= expr.OpCodeF64x2Ge) ||
+		(expr.OpCodeF32x4Abs <= op && op <= expr.OpCodeF64x2ConvertLowI32x4U)
+}
+
+// checkFloatPoint returns the FloatPointError on the first use of the f32 or f64 in the module
+func (m *Module) checkFloatPoint() error {
+	for i, t := range m.TypeSection {
+		if hasFloat(t.InputTypes) || hasFloat(t.ReturnTypes) {
+			return &FloatPointError{Where: fmt.Sprintf("type %d", i)}
+		}
+	}
+
+	var imported int
+	for i, imp := range m.ImportSection {
+		switch imp.Desc.Kind {
+		case segments.KindFunction:
+			imported++
+		case segments.KindGlobal:
+			if hasFloat([]types.ValueType{imp.Desc.GlobalTypePtr.ValType}) {
+				return &FloatPointError{Where: fmt.Sprintf("import %d", i)}
+			}
+		}
+	}
+
+	for i, g := range m.GlobalSection {
+		if hasFloat([]types.ValueType{g.Type.ValType}) {
+			return &FloatPointError{Where: fmt.Sprintf("global %d", i)}
+		}
+	}
+
+	for i, c := range m.CodeSection {
+		index := uint32(imported + i)
+		if hasFloat(c.RunTypes()) {
+			return &FloatPointError{Where: fmt.Sprintf("locals of func %d", index)}
+		}
+
+		code, err := m.compile(c.Body)
+		if err != nil {
+			return fmt.Errorf("compile function %d: %w", i, err)
+		}
+		for j := range code {
+			if isFloatInstr(&code[j]) {
+				return floatPointError(&code[j], index)
+			}
+		}
+	}
+
+	return nil
+}
+
+func floatPointError(in *instr, index uint32) *FloatPointError {
+	return &FloatPointError{Func: index, Offset: in.pos, OpCode: in.op, SubOpCode: in.sub}
+}
+
+// applyFloatPoint makes the float instructions of the func at the index trap with ModuleConfig.TrapFloatPoint,
+// or canonicalise their NaN results with ModuleConfig.CanonicalizeNaN
+func (m *Module) applyFloatPoint(code []instr, index uint32) {
+	for i := range code {
+		in := &code[i]
+		switch {
+		case m.DisableFloatPoint && isFloatInstr(in):
+			err := floatPointError(in, index)
+			in.fn = func(_ *Instance) error {
+				return err
+			}
+		case m.CanonicalizeNaN && in.fn != nil:
+			if canonicalize := nanCanonicalizer(in); canonicalize != nil {
+				fn := in.fn
+				in.fn = func(ins *Instance) error {
+					if err := fn(ins); err != nil {
+						return err
+					}
+					canonicalize(ins.OperandStack.Values, ins.OperandStack.High, ins.OperandStack.Ptr)
+
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// nanCanonicalizer returns the func replacing the NaN result on the top of the stack with the canonical NaN,
+// nil if the instruction can not produce a NaN of its own. The abs, neg, copysign, pmin, pmax and reinterpret
+// only move the bits of the operands, so they are deterministic as they are
+func nanCanonicalizer(in *instr) func(values, high []uint64, ptr int) {
+	op := in.op
+	switch {
+	case (expr.OpCodeF32Ceil <= op && op <= expr.OpCodeF32Max) || op == expr.OpCodeF32DemoteF64:
+		return func(values, _ []uint64, ptr int) {
+			values[ptr] = canonicalizeF32(values[ptr])
+		}
+	case (expr.OpCodeF64Ceil <= op && op <= expr.OpCodeF64Max) || op == expr.OpCodeF64PromoteF32:
+		return func(values, _ []uint64, ptr int) {
+			values[ptr] = canonicalizeF64(values[ptr])
+		}
+	case op != expr.OpCodeSIMDPrefix:
+		return nil
+	}
+
+	switch in.sub {
+	case expr.OpCodeF32x4Ceil, expr.OpCodeF32x4Floor, expr.OpCodeF32x4Trunc, expr.OpCodeF32x4Nearest,
+		expr.OpCodeF32x4Sqrt, expr.OpCodeF32x4Add, expr.OpCodeF32x4Sub, expr.OpCodeF32x4Mul, expr.OpCodeF32x4Div,
+		expr.OpCodeF32x4Min, expr.OpCodeF32x4Max, expr.OpCodeF32x4DemoteF64x2Zero:
+		return func(values, high []uint64, ptr int) {
+			values[ptr] = canonicalizeF32(values[ptr]) | canonicalizeF32(values[ptr]>>32)<<32
+			high[ptr] = canonicalizeF32(high[ptr]) | canonicalizeF32(high[ptr]>>32)<<32
+		}
+	case expr.OpCodeF64x2Ceil, expr.OpCodeF64x2Floor, expr.OpCodeF64x2Trunc, expr.OpCodeF64x2Nearest,
+		expr.OpCodeF64x2Sqrt, expr.OpCodeF64x2Add, expr.OpCodeF64x2Sub, expr.OpCodeF64x2Mul, expr.OpCodeF64x2Div,
+		expr.OpCodeF64x2Min, expr.OpCodeF64x2Max, expr.OpCodeF64x2PromoteLowF32x4:
+		return func(values, high []uint64, ptr int) {
+			values[ptr] = canonicalizeF64(values[ptr])
+			high[ptr] = canonicalizeF64(high[ptr])
+		}
+	}
+
+	return nil
+}
+
+// canonicalizeF32 returns the canonical NaN if the low 32 bits are a NaN, or the low 32 bits as they are
+func canonicalizeF32(bits uint64) uint64 {
+	if f := math.Float32frombits(uint32(bits)); f != f {
+		return canonicalNaN32
+	}
+
+	return bits & math.MaxUint32
+}
+
+func canonicalizeF64(bits uint64) uint64 {
+	if math.IsNaN(math.Float64frombits(bits)) {
+		return canonicalNaN64
+	}
+
+	return bits
+}
@@ -0,0 +1,178 @@
+package wasm
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/c0mm4nd/wasman/config"
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/stacks"
+	"github.com/c0mm4nd/wasman/types"
+)
+
+// floatModule reads the module exporting the func "f" of the type () -> (result) with the body
+func floatModule(conf config.ModuleConfig, result types.ValueType, body []byte) (*Module, error) {
+	bin := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	bin = append(bin, benchSection(0x01, 0x01, 0x60, 0x00, 0x01, byte(result))...) // type
+	bin = append(bin, benchSection(0x03, 0x01, 0x00)...)                           // function
+	bin = append(bin, benchSection(0x07, 0x01, 0x01, 'f', 0x00, 0x00)...)          // export
+	bin = append(bin, benchSection(0x0a, append([]byte{0x01, byte(len(body))}, body...)...)...)
+
+	return NewModule(conf, bytes.NewReader(bin))
+}
+
+func TestModule_checkFloatPoint(t *testing.T) {
+	// (func (result i32) (if (result i32) (i32.const 0) (then (i32.trunc_f32_s (f32.const 1))) (else (i32.const 2))))
+	body := []byte{
+		0x00,
+		byte(expr.OpCodeI32Const), 0x00,
+		byte(expr.OpCodeIf), 0x7f,
+		byte(expr.OpCodeF32Const), 0x00, 0x00, 0x80, 0x3f,
+		byte(expr.OpCodeI32TruncF32S),
+		byte(expr.OpCodeElse),
+		byte(expr.OpCodeI32Const), 0x02,
+		byte(expr.OpCodeEnd),
+		byte(expr.OpCodeEnd),
+	}
+
+	t.Run("type", func(t *testing.T) {
+		_, err := floatModule(config.ModuleConfig{DisableFloatPoint: true}, types.ValueTypeF64, []byte{0x00, byte(expr.OpCodeUnreachable), byte(expr.OpCodeEnd)})
+		var fe *FloatPointError
+		if !errors.As(err, &fe) || fe.Where != "type 0" || !errors.Is(err, ErrFloatPointDisabled) {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("code", func(t *testing.T) {
+		_, err := floatModule(config.ModuleConfig{DisableFloatPoint: true}, types.ValueTypeI32, body)
+		exp := &FloatPointError{Func: 0, Offset: 4, OpCode: expr.OpCodeF32Const}
+		var fe *FloatPointError
+		if !errors.As(err, &fe) || !reflect.DeepEqual(fe, exp) {
+			t.Errorf("got %v, want %v", err, exp)
+		}
+
+		if _, err := floatModule(config.ModuleConfig{}, types.ValueTypeI32, body); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("trap", func(t *testing.T) {
+		m, err := floatModule(config.ModuleConfig{DisableFloatPoint: true, TrapFloatPoint: true}, types.ValueTypeI32, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ins, err := NewInstance(m, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the float instructions are not on the way
+		ret, _, err := ins.CallExportedFunc("f")
+		if err != nil || ret[0] != 2 {
+			t.Fatalf("got %v, %v", ret, err)
+		}
+
+		// take the way of the float
+		ins.Functions[0].(*wasmFunc).code[0].imm[0] = 1
+		_, _, err = ins.CallExportedFunc("f")
+		exp := &FloatPointError{Func: 0, Offset: 4, OpCode: expr.OpCodeF32Const}
+		var fe *FloatPointError
+		if !errors.As(err, &fe) || !reflect.DeepEqual(fe, exp) {
+			t.Errorf("got %v, want %v", err, exp)
+		}
+	})
+
+	t.Run("instructions", func(t *testing.T) {
+		for _, c := range []struct {
+			in  instr
+			exp bool
+		}{
+			{in: instr{op: expr.OpCodeI32Add}},
+			{in: instr{op: expr.OpCodeI32WrapI64}},
+			{in: instr{op: expr.OpCodeI64ExtendI32S}},
+			{in: instr{op: expr.OpCodeF64ReinterpretI64}, exp: true},
+			{in: instr{op: expr.OpCodeI32truncF64U}, exp: true},
+			{in: instr{op: expr.OpCodeF32Store}, exp: true},
+			{in: instr{op: expr.OpCodeSelectT, imm: [3]uint64{uint64(types.ValueTypeI64)}}},
+			{in: instr{op: expr.OpCodeSelectT, imm: [3]uint64{uint64(types.ValueTypeF32)}}, exp: true},
+			{in: instr{op: expr.OpCodeBlock, block: &funcBlock{BlockType: &types.FuncType{ReturnTypes: []types.ValueType{types.ValueTypeF64}}}}, exp: true},
+			{in: instr{op: expr.OpCodeMiscPrefix, sub: expr.OpCodeI64TruncSatF64U}, exp: true},
+			{in: instr{op: expr.OpCodeMiscPrefix, sub: expr.OpCodeMemoryInit}},
+			{in: instr{op: expr.OpCodeSIMDPrefix, sub: expr.OpCodeI32x4Add}},
+			{in: instr{op: expr.OpCodeSIMDPrefix, sub: expr.OpCodeF64x2Nearest}, exp: true},
+			{in: instr{op: expr.OpCodeSIMDPrefix, sub: expr.OpCodeF32x4ConvertI32x4U}, exp: true},
+		} {
+			if isFloatInstr(&c.in) != c.exp {
+				t.Errorf("%#x %d: want %v", c.in.op, c.in.sub, c.exp)
+			}
+		}
+	})
+}
+
+func TestModule_applyFloatPointCanonicalizeNaN(t *testing.T) {
+	// the NaN with the payload plus zero keeps the payload on most of the platforms
+	f32 := []byte{
+		0x00,
+		byte(expr.OpCodeI32Const), 0x81, 0x80, 0x80, 0xfd, 0x07, // 0x7fa00001
+		byte(expr.OpCodeF32ReinterpretI32),
+		byte(expr.OpCodeF32Const), 0x00, 0x00, 0x00, 0x00,
+		byte(expr.OpCodeF32Add),
+		byte(expr.OpCodeEnd),
+	}
+	// sqrt(-1)
+	f64 := []byte{
+		0x00,
+		byte(expr.OpCodeF64Const), 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf0, 0xbf,
+		byte(expr.OpCodeF64Sqrt),
+		byte(expr.OpCodeEnd),
+	}
+	for _, c := range []struct {
+		result types.ValueType
+		body   []byte
+		exp    uint64
+	}{
+		{result: types.ValueTypeF32, body: f32, exp: canonicalNaN32},
+		{result: types.ValueTypeF64, body: f64, exp: canonicalNaN64},
+	} {
+		m, err := floatModule(config.ModuleConfig{CanonicalizeNaN: true}, c.result, c.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ins, err := NewInstance(m, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ret, _, err := ins.CallExportedFunc("f")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ret[0] != c.exp {
+			t.Errorf("got %#x, want %#x", ret[0], c.exp)
+		}
+	}
+
+	t.Run("simd", func(t *testing.T) {
+		nan32 := uint64(math.Float32bits(float32(math.NaN())) | 0x1)
+		s := stacks.NewOperandStack()
+		s.PushV128(nan32<<32|0x3f80_0000, nan32)
+		nanCanonicalizer(&instr{op: expr.OpCodeSIMDPrefix, sub: expr.OpCodeF32x4Add})(s.Values, s.High, s.Ptr)
+		if lo, hi := s.PeekV128(); lo != canonicalNaN32<<32|0x3f80_0000 || hi != canonicalNaN32 {
+			t.Errorf("got %#x %#x", lo, hi)
+		}
+
+		s.PushV128(math.Float64bits(math.NaN())|0x1, 0x3ff0_0000_0000_0000)
+		nanCanonicalizer(&instr{op: expr.OpCodeSIMDPrefix, sub: expr.OpCodeF64x2Sqrt})(s.Values, s.High, s.Ptr)
+		if lo, hi := s.PeekV128(); lo != canonicalNaN64 || hi != 0x3ff0_0000_0000_0000 {
+			t.Errorf("got %#x %#x", lo, hi)
+		}
+
+		if nanCanonicalizer(&instr{op: expr.OpCodeSIMDPrefix, sub: expr.OpCodeF32x4Pmin}) != nil ||
+			nanCanonicalizer(&instr{op: expr.OpCodeF64Neg}) != nil {
+			t.Fail()
+		}
+	})
+}
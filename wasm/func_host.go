@@ -27,7 +27,25 @@ func (f *HostFunc) getType() *types.FuncType {
 	return f.Signature
 }
 
-func (f *HostFunc) call(ins *Instance) error {
+func (f *HostFunc) call(ins *Instance) (err error) {
+	if err := ins.checkCallDepth(); err != nil {
+		return err
+	}
+
+	// the exception thrown by Instance.Throw and the error of Instance.Abort go on as an error
+	defer func() {
+		if v := recover(); v != nil {
+			switch v := v.(type) {
+			case *Exception:
+				err = v
+			case *abort:
+				err = v.err
+			default:
+				panic(v)
+			}
+		}
+	}()
+
 	args := make([]uint64, len(f.Signature.InputTypes))
 	for i := len(args) - 1; i >= 0; i-- {
 		args[i] = ins.OperandStack.Pop()
@@ -38,3 +56,14 @@ func (f *HostFunc) call(ins *Instance) error {
 	}
 	return nil
 }
+
+// abort is the panic of Instance.Abort, recovered by the HostFunc as its error
+type abort struct {
+	err error
+}
+
+// Abort stops the execution from a host function with the err, which is returned by the call as the cause of the Trap.
+// It never returns
+func (ins *Instance) Abort(err error) {
+	panic(&abort{err: err})
+}
@@ -3,6 +3,8 @@ package wasm
 import (
 	"errors"
 
+	"github.com/c0mm4nd/wasman/config"
+	"github.com/c0mm4nd/wasman/stacks"
 	"github.com/c0mm4nd/wasman/types"
 )
 
@@ -10,8 +12,50 @@ import (
 var (
 	ErrFuncInvalidInputType  = errors.New("invalid func input type")
 	ErrFuncInvalidReturnType = errors.New("invalid func return type")
+	ErrCallStackExhausted    = errors.New("call stack exhausted")
 )
 
+// checkCallDepth returns ErrCallStackExhausted when one more call goes over the call depth limit
+func (ins *Instance) checkCallDepth() error {
+	limit := ins.callDepthLimit
+	if limit == 0 {
+		limit = config.DefaultCallDepthLimit
+	}
+
+	if ins.FrameStack.Ptr+1 >= limit {
+		return ErrCallStackExhausted
+	}
+
+	return nil
+}
+
+// invoke calls the f from the host side with its args on the OperandStack.
+// When the f traps, the stacks are restored to where they were before the args,
+// and the stacks.ErrStackOverflow panic is recovered as the error even without ModuleConfig.Recover.
+// The error is the Trap, or the Exception not caught by any try_table
+func (ins *Instance) invoke(f fn) (err error) {
+	height := ins.OperandStack.Ptr - len(f.getType().InputTypes)
+	frames, active := ins.FrameStack.Ptr, ins.Active
+	defer func() {
+		if v := recover(); v != nil {
+			if v != stacks.ErrStackOverflow {
+				panic(v)
+			}
+			err = stacks.ErrStackOverflow
+		}
+
+		if err != nil {
+			err = newTrap(err, nil)
+			ins.OperandStack.Ptr = height
+			ins.FrameStack.Ptr = frames
+			ins.Active = active
+			ins.tailCallee = nil
+		}
+	}()
+
+	return f.call(ins)
+}
+
 // fn is an instance of the func value
 type fn interface {
 	getType() *types.FuncType
@@ -1,11 +1,17 @@
 package wasm
 
 import (
+	"bytes"
+	"errors"
+	"reflect"
 	"testing"
 
+	"github.com/c0mm4nd/wasman/config"
 	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/segments"
 	"github.com/c0mm4nd/wasman/stacks"
 	"github.com/c0mm4nd/wasman/types"
+	"github.com/c0mm4nd/wasman/utils"
 )
 
 func TestHostFunction_Call(t *testing.T) {
@@ -22,7 +28,10 @@ func TestHostFunction_Call(t *testing.T) {
 		},
 	}
 
-	vm := &Instance{OperandStack: stacks.NewOperandStack()}
+	vm := &Instance{
+		OperandStack: stacks.NewOperandStack(),
+		FrameStack:   &stacks.Stack[*Frame]{Ptr: -1},
+	}
 	vm.OperandStack.Push(10)
 	err := hf.call(vm)
 	if err != nil {
@@ -55,12 +64,12 @@ func TestHostFunction_Call(t *testing.T) {
 }
 
 func TestNativeFunction_Call(t *testing.T) {
-	n := &wasmFunc{
-		signature: &types.FuncType{},
+	n := compiled(&wasmFunc{
+		signature: &types.FuncType{ReturnTypes: []types.ValueType{types.ValueTypeI64}},
 		body: []byte{
 			byte(expr.OpCodeI64Const), 0x05, byte(expr.OpCodeReturn),
 		},
-	}
+	})
 	vm := &Instance{
 		Module:       new(Module),
 		OperandStack: stacks.NewOperandStack(),
@@ -84,14 +93,14 @@ func TestNativeFunction_Call(t *testing.T) {
 }
 
 func TestVirtualMachine_execNativeFunction(t *testing.T) {
-	n := &wasmFunc{
+	n := compiled(&wasmFunc{
 		signature: &types.FuncType{},
 		body: []byte{
 			byte(expr.OpCodeI64Const), 0x05,
 			byte(expr.OpCodeI64Const), 0x01,
 			byte(expr.OpCodeReturn),
 		},
-	}
+	})
 	vm := &Instance{
 		Module:       new(Module),
 		OperandStack: stacks.NewOperandStack(),
@@ -103,7 +112,7 @@ func TestVirtualMachine_execNativeFunction(t *testing.T) {
 	if vm.execFunc() != nil {
 		t.Fail()
 	}
-	if vm.Active.PC != 4 {
+	if vm.Active.PC != 2 {
 		t.Fail()
 	}
 	if vm.OperandStack.Pop() != 0x01 {
@@ -113,3 +122,320 @@ func TestVirtualMachine_execNativeFunction(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestVirtualMachine_execUnsupportedOpCode(t *testing.T) {
+	n := compiled(&wasmFunc{
+		signature: &types.FuncType{},
+		body:      []byte{byte(expr.OpCodeNop), 0xff},
+	})
+	vm := &Instance{
+		Module:       new(Module),
+		OperandStack: stacks.NewOperandStack(),
+		Active: &Frame{
+			Func: n,
+		},
+	}
+
+	err := vm.execFunc()
+	var opErr *UnsupportedOpCodeError
+	if !errors.As(err, &opErr) || opErr.OpCode != 0xff {
+		t.Log(err)
+		t.Fail()
+	}
+	if !errors.Is(err, ErrUnsupportedOpCode) {
+		t.Fail()
+	}
+}
+
+func TestVirtualMachine_execTruncSat(t *testing.T) {
+	n := compiled(&wasmFunc{
+		signature: &types.FuncType{},
+		body: []byte{
+			byte(expr.OpCodeF64Const), 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf0, 0x7f, // +inf
+			byte(expr.OpCodeMiscPrefix), byte(expr.OpCodeI32TruncSatF64U),
+		},
+	})
+	vm := &Instance{
+		Module:       new(Module),
+		OperandStack: stacks.NewOperandStack(),
+		Active: &Frame{
+			Func: n,
+		},
+	}
+
+	if err := vm.execFunc(); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	if vm.OperandStack.Pop() != 0xffffffff {
+		t.Fail()
+	}
+}
+
+func TestInstance_CallExportedFuncMultiValue(t *testing.T) {
+	i32 := types.ValueTypeI32
+	ins := &Instance{
+		Module: &Module{
+			TypeSection: []*types.FuncType{
+				{InputTypes: []types.ValueType{i32}, ReturnTypes: []types.ValueType{i32}},
+				{ReturnTypes: []types.ValueType{i32, i32}},
+				{InputTypes: []types.ValueType{i32}, ReturnTypes: []types.ValueType{i32, i32}},
+			},
+			ExportSection: map[string]*segments.ExportSegment{},
+		},
+		OperandStack: stacks.NewOperandStack(),
+		FrameStack: &stacks.Stack[*Frame]{
+			Ptr:    -1,
+			Values: make([]*Frame, stacks.InitialLabelStackHeight),
+		},
+	}
+
+	for i, c := range []struct {
+		name string
+		sign uint32
+		body []byte
+	}{
+		{
+			// sums n..1 in a loop which takes the accumulator as param
+			name: "loop", sign: 0, body: []byte{
+				byte(expr.OpCodeI32Const), 0x00,
+				byte(expr.OpCodeLoop), 0x00,
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeI32Add),
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeI32Const), 0x01,
+				byte(expr.OpCodeI32Sub),
+				byte(expr.OpCodeLocalTee), 0x00,
+				byte(expr.OpCodeBrIf), 0x00,
+				byte(expr.OpCodeEnd),
+			},
+		},
+		{
+			// returns (1, 12) on 0, otherwise (1, 2)
+			name: "br_table", sign: 2, body: []byte{
+				byte(expr.OpCodeBlock), 0x01,
+				byte(expr.OpCodeBlock), 0x01,
+				byte(expr.OpCodeI32Const), 0x09,
+				byte(expr.OpCodeI32Const), 0x01,
+				byte(expr.OpCodeI32Const), 0x02,
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeBrTable), 0x01, 0x00, 0x01,
+				byte(expr.OpCodeEnd),
+				byte(expr.OpCodeI32Const), 0x0a,
+				byte(expr.OpCodeI32Add),
+				byte(expr.OpCodeEnd),
+			},
+		},
+		{
+			name: "br", sign: 1, body: []byte{
+				byte(expr.OpCodeI32Const), 0x07,
+				byte(expr.OpCodeI32Const), 0x01,
+				byte(expr.OpCodeI32Const), 0x02,
+				byte(expr.OpCodeBr), 0x00,
+				byte(expr.OpCodeI32Const), 0x03,
+			},
+		},
+	} {
+		code, err := ins.compile(c.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ins.Functions = append(ins.Functions, &wasmFunc{
+			signature: ins.TypeSection[c.sign],
+			body:      c.body,
+			code:      code,
+		})
+		ins.ExportSection[c.name] = &segments.ExportSegment{
+			Name: c.name,
+			Desc: &segments.ExportDesc{Kind: segments.KindFunction, Index: uint32(i)},
+		}
+	}
+
+	for _, c := range []struct {
+		name string
+		args []uint64
+		exp  []uint64
+	}{
+		{name: "loop", args: []uint64{4}, exp: []uint64{10}},
+		{name: "br_table", args: []uint64{0}, exp: []uint64{1, 12}},
+		{name: "br_table", args: []uint64{5}, exp: []uint64{1, 2}},
+		{name: "br", exp: []uint64{1, 2}},
+	} {
+		ret, _, err := ins.CallExportedFunc(c.name, c.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ret, c.exp) {
+			t.Logf("%s%v: got %v, want %v", c.name, c.args, ret, c.exp)
+			t.Fail()
+		}
+		if ins.OperandStack.Ptr != -1 {
+			t.Logf("%s%v: stack is not clean", c.name, c.args)
+			t.Fail()
+		}
+	}
+}
+
+// callTollStation charges 10 on the calls and 1 on the others
+type callTollStation struct {
+	calls, total uint64
+}
+
+func (ts *callTollStation) GetOpPrice(op expr.OpCode) uint64 {
+	if op == expr.OpCodeCall || op == expr.OpCodeCallIndirect {
+		ts.calls++
+		return 10
+	}
+
+	return 1
+}
+
+func (ts *callTollStation) GetToll() uint64 { return ts.total }
+
+func (ts *callTollStation) AddToll(toll uint64) error {
+	ts.total += toll
+	return nil
+}
+
+func TestInstance_CallExportedFuncTailCall(t *testing.T) {
+	i32, i64 := types.ValueTypeI32, types.ValueTypeI64
+	sum := &types.FuncType{InputTypes: []types.ValueType{i32, i64}, ReturnTypes: []types.ValueType{i64}}
+	ts := &callTollStation{}
+	ins := &Instance{
+		Module: &Module{
+			TypeSection: []*types.FuncType{sum},
+			IndexSpace:  &IndexSpace{Tables: []*Table{{Value: []*uint32{utils.Uint32Ptr(2)}}}},
+			ExportSection: map[string]*segments.ExportSegment{
+				"sum": {Name: "sum", Desc: &segments.ExportDesc{Kind: segments.KindFunction, Index: 1}},
+			},
+		},
+		OperandStack: stacks.NewOperandStack(),
+		FrameStack: &stacks.Stack[*Frame]{
+			Ptr:    -1,
+			Values: make([]*Frame, stacks.InitialLabelStackHeight),
+		},
+	}
+	ins.TollStation = ts
+
+	var depth int
+	record := &HostFunc{
+		Signature: &types.FuncType{},
+		function: func([]uint64) []uint64 {
+			depth = ins.FrameStack.Ptr
+			return nil
+		},
+	}
+
+	// (func $sum (param $n i32) (param $acc i64) (result i64)
+	//   (if (i32.eqz (local.get $n)) (then (call $record) (return (local.get $acc))))
+	//   (return_call_indirect (type $sum) (i32.sub (local.get $n) (i32.const 1))
+	//     (i64.add (local.get $acc) (i64.extend_i32_u (local.get $n))) (i32.const 0)))
+	// (func $sum2 ;; the same as $sum but with return_call to $sum, so that they tail call each other
+	sumBody := func(tail []byte) []byte {
+		return append([]byte{
+			byte(expr.OpCodeLocalGet), 0x00,
+			byte(expr.OpCodeI32Eqz),
+			byte(expr.OpCodeIf), 0x40,
+			byte(expr.OpCodeCall), 0x00,
+			byte(expr.OpCodeLocalGet), 0x01,
+			byte(expr.OpCodeReturn),
+			byte(expr.OpCodeEnd),
+			byte(expr.OpCodeLocalGet), 0x00,
+			byte(expr.OpCodeI32Const), 0x01,
+			byte(expr.OpCodeI32Sub),
+			byte(expr.OpCodeLocalGet), 0x01,
+			byte(expr.OpCodeLocalGet), 0x00,
+			byte(expr.OpCodeI64ExtendI32U),
+			byte(expr.OpCodeI64Add),
+		}, tail...)
+	}
+	ins.Functions = []fn{record}
+	for _, body := range [][]byte{
+		sumBody([]byte{byte(expr.OpCodeI32Const), 0x00, byte(expr.OpCodeReturnCallIndirect), 0x00, 0x00}),
+		sumBody([]byte{byte(expr.OpCodeReturnCall), 0x01}),
+	} {
+		code, err := ins.compile(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ins.Functions = append(ins.Functions, &wasmFunc{signature: sum, body: body, code: code})
+	}
+
+	const n = 1000000
+	ret, _, err := ins.CallExportedFunc("sum", n, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret[0] != n*(n+1)/2 {
+		t.Errorf("got %d, want %d", ret[0], uint64(n*(n+1)/2))
+	}
+	if depth != 0 || len(ins.FrameStack.Values) != stacks.InitialLabelStackHeight {
+		t.Errorf("frame stack grows to %d", depth)
+	}
+	if ins.OperandStack.Ptr != -1 {
+		t.Fail()
+	}
+	if ts.calls != n+1 {
+		t.Errorf("tail calls are charged %d times", ts.calls)
+	}
+}
+
+func TestInstance_CallExportedFuncStackLimits(t *testing.T) {
+	// (func $rec (result i32) (i32.add (i32.const 1) (call $rec)))
+	rec := []byte{0x00, byte(expr.OpCodeI32Const), 0x01, byte(expr.OpCodeCall), 0x00, byte(expr.OpCodeI32Add), byte(expr.OpCodeEnd)}
+	// (func $nest (result i32) (block (block (block))) (i32.const 7))
+	nest := []byte{
+		0x00,
+		byte(expr.OpCodeBlock), 0x40, byte(expr.OpCodeBlock), 0x40, byte(expr.OpCodeBlock), 0x40,
+		byte(expr.OpCodeEnd), byte(expr.OpCodeEnd), byte(expr.OpCodeEnd),
+		byte(expr.OpCodeI32Const), 0x07,
+		byte(expr.OpCodeEnd),
+	}
+	bin := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	bin = append(bin, benchSection(0x01, 0x01, 0x60, 0x00, 0x01, 0x7f)...)                                                // type
+	bin = append(bin, benchSection(0x03, 0x02, 0x00, 0x00)...)                                                            // function
+	bin = append(bin, benchSection(0x07, 0x02, 0x03, 'r', 'e', 'c', 0x00, 0x00, 0x04, 'n', 'e', 's', 't', 0x00, 0x01)...) // export
+	code := append([]byte{0x02, byte(len(rec))}, rec...)
+	code = append(append(code, byte(len(nest))), nest...)
+	bin = append(bin, benchSection(0x0a, code...)...)
+
+	limit := func(v uint64) *uint64 { return &v }
+	for _, c := range []struct {
+		name string
+		conf config.ModuleConfig
+		fn   string
+		exp  error
+	}{
+		{name: "default call depth", fn: "rec", exp: ErrCallStackExhausted},
+		{name: "call depth", conf: config.ModuleConfig{CallDepthLimit: limit(100)}, fn: "rec", exp: ErrCallStackExhausted},
+		{name: "operand stack", conf: config.ModuleConfig{OperandStackLimit: limit(50)}, fn: "rec", exp: stacks.ErrStackOverflow},
+		{name: "label stack", conf: config.ModuleConfig{LabelStackLimit: limit(2)}, fn: "nest", exp: stacks.ErrStackOverflow},
+		{name: "label stack enough", conf: config.ModuleConfig{LabelStackLimit: limit(3)}, fn: "nest"},
+	} {
+		for _, withRecover := range []bool{false, true} {
+			c.conf.Recover = withRecover
+			m, err := NewModule(c.conf, bytes.NewReader(bin))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ins, err := NewInstance(m, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the instance is still usable after the trap
+			for i := 0; i < 2; i++ {
+				ret, _, err := ins.CallExportedFunc(c.fn)
+				if !errors.Is(err, c.exp) {
+					t.Fatalf("%s (recover: %v): got %v, want %v", c.name, withRecover, err, c.exp)
+				}
+				if c.exp == nil && ret[0] != 7 {
+					t.Errorf("%s (recover: %v): got %v", c.name, withRecover, ret)
+				}
+				if ins.OperandStack.Ptr != -1 || ins.FrameStack.Ptr != -1 || ins.Active != nil {
+					t.Errorf("%s (recover: %v): the stacks are left on %d, %d", c.name, withRecover, ins.OperandStack.Ptr, ins.FrameStack.Ptr)
+				}
+			}
+		}
+	}
+}
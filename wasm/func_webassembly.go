@@ -1,68 +1,160 @@
 package wasm
 
 import (
-	"fmt"
-
 	"github.com/c0mm4nd/wasman/stacks"
 	"github.com/c0mm4nd/wasman/types"
 )
 
 type wasmFunc struct {
-	signature *types.FuncType       // the shape of func (defined by inputs and outputs)
-	NumLocal  uint32                // index id in local
-	body      []byte                // body
-	Blocks    map[uint64]*funcBlock // instr blocks inside the func
+	signature *types.FuncType // the shape of func (defined by inputs and outputs)
+	NumLocal  uint32          // index id in local
+	body      []byte          // body
+	code      []instr         // the body compiled by Module.compile
+	hasV128   bool            // whether any param or local is a v128
+
+	index uint32 // the index in the function index space of its module
+	name  string // the name for the Trap, empty if unknown
 }
 
+// funcBlock is the block inside the func, located by the indices of the compiled instructions
 type funcBlock struct {
 	StartAt uint64
 	ElseAt  uint64
 	EndAt   uint64
 
-	BlockType      *types.FuncType
-	BlockTypeBytes uint64
+	BlockType *types.FuncType
+
+	Catches []stacks.Catch // the catch clauses of the try_table
 }
 
 func (f *wasmFunc) getType() *types.FuncType {
 	return f.signature
 }
 
-func (f *wasmFunc) call(ins *Instance) (err error) {
+// popLocals pops the args from the OperandStack into the locals of the frame,
+// which reuse the buffers left by the former func on the same depth
+func (f *wasmFunc) popLocals(ins *Instance, frame *Frame) {
 	al := len(f.signature.InputTypes)
-	locals := make([]uint64, f.NumLocal+uint32(al))
-	for i := 0; i < al; i++ {
-		locals[al-1-i] = ins.OperandStack.Pop()
+	frame.Locals = reuseLocals(frame.Locals, int(f.NumLocal)+al)
+	if f.hasV128 {
+		frame.high = reuseLocals(frame.high, len(frame.Locals))
+		frame.LocalsHigh = frame.high
+		for i := 0; i < al; i++ {
+			frame.Locals[al-1-i], frame.LocalsHigh[al-1-i] = ins.OperandStack.PopV128()
+		}
+	} else {
+		frame.LocalsHigh = nil
+		for i := 0; i < al; i++ {
+			frame.Locals[al-1-i] = ins.OperandStack.Pop()
+		}
+	}
+}
+
+// reuseLocals returns the n zero locals on the buf, or on a new one when the buf is too short
+func reuseLocals(buf []uint64, n int) []uint64 {
+	if cap(buf) < n {
+		return make([]uint64, n)
+	}
+
+	buf = buf[:n]
+	for i := range buf {
+		buf[i] = 0
 	}
 
+	return buf
+}
+
+// nextFrame returns the frame on top of the FrameStack for the next call, reusing the one left on the same depth
+// by a former call like pushLabel, so that the calls do not allocate once the FrameStack has been that deep
+func (ins *Instance) nextFrame() *Frame {
+	s := ins.FrameStack
+	if s.Ptr+1 < len(s.Values) && s.Values[s.Ptr+1] != nil {
+		frame := s.Values[s.Ptr+1]
+		frame.PC = 0
+		frame.LabelStack.Ptr = -1
+
+		return frame
+	}
+
+	frame := &Frame{LabelStack: stacks.NewLabelStack()}
+	frame.LabelStack.SetLimit(ins.labelStackLimit)
+
+	return frame
+}
+
+func (f *wasmFunc) call(ins *Instance) (err error) {
+	if err := ins.checkCallDepth(); err != nil {
+		return err
+	}
+	if err := ins.checkContext(); err != nil {
+		return err
+	}
+
+	frame := ins.nextFrame()
+	frame.Func = f
+	f.popLocals(ins, frame)
+
+	height := ins.OperandStack.Ptr
 	prevPtr := ins.FrameStack.Ptr
+	prev := ins.Active
 	if ins.Recover {
 		defer func() {
 			if v := recover(); v != nil {
+				frames := ins.FrameStack.Values[: prevPtr+1 : prevPtr+1]
+				err = recoveredTrap(v, append(frames, frame))
 				ins.FrameStack.Ptr = prevPtr
-				var ok bool
-				err, ok = v.(error)
-				if !ok {
-					err = fmt.Errorf("runtime error: %v", v)
-				}
+				ins.Active = prev
+				ins.tailCallee = nil
 			}
 		}()
 	}
 
-	prev := ins.Active
-	frame := &Frame{
-		Func:       f,
-		Locals:     locals,
-		LabelStack: stacks.NewLabelStack(),
-	}
 	ins.FrameStack.Push(frame)
 	defer ins.FrameStack.Pop()
 	ins.Active = frame
 
-	err = ins.execFunc()
-	if err != nil {
-		return err
+	results := len(f.signature.ReturnTypes)
+	for {
+		err = ins.execFunc()
+		if err != nil {
+			// restore the caller frame, where a try_table may catch the exception
+			ins.Active = prev
+			return err
+		}
+
+		callee := ins.tailCallee
+		if callee == nil {
+			break
+		}
+		ins.tailCallee = nil
+		if err := ins.checkContext(); err != nil {
+			ins.Active = prev
+			return err
+		}
+
+		// drop what the tail call leaves under the args of the callee
+		ins.unwindOperandStack(height, len(callee.getType().InputTypes))
+		results = len(callee.getType().ReturnTypes)
+
+		next, ok := callee.(*wasmFunc)
+		if !ok {
+			err = callee.call(ins)
+			if err != nil {
+				ins.Active = prev
+				return err
+			}
+			break
+		}
+
+		// reuse the frame for the callee
+		frame.Func = next
+		frame.PC = 0
+		next.popLocals(ins, frame)
+		frame.LabelStack.Ptr = -1
 	}
 
+	// drop what a return or branch leaves under the results
+	ins.unwindOperandStack(height, results)
 	ins.Active = prev
 
 	return nil
@@ -1,16 +1,12 @@
 package wasm
 
 import (
-	"bytes"
-	"encoding/binary"
+	"context"
 	"fmt"
 	"math"
 
-	"github.com/c0mm4nd/wasman/config"
-
+	"github.com/c0mm4nd/wasman/segments"
 	"github.com/c0mm4nd/wasman/stacks"
-
-	"github.com/c0mm4nd/wasman/leb128decode"
 )
 
 // Instance is an instantiated module
@@ -21,10 +17,34 @@ type Instance struct {
 	FrameStack *stacks.Stack[*Frame]
 
 	Functions []fn
-	Memory    *Memory
+	Memories  []*Memory // the memory index space
+	Memory    *Memory   // the memory 0, nil when the module has no memory
 	Globals   []uint64
 
-	OperandStack *stacks.Stack[uint64]
+	globalsHigh []uint64 // the high halves of the v128 globals, nil when the module has no v128 global
+
+	OperandStack *stacks.OperandStack
+
+	// the segments available to memory.init and table.init, nil after dropped
+	dataSegments [][]byte
+	elemSegments [][]*uint32
+
+	externRefs     []interface{} // the go values registered by NewExternRef
+	externRefsFree []uint32      // the indices of the slots of the externRefs freed by ReleaseExternRef
+	exnRefs        []*Exception  // the exceptions caught by catch_ref and catch_all_ref, nil on the freed slots
+
+	exnRefsFree        []uint32 // the indices of the freed slots of the exnRefs, the lowest last
+	exnRefsNextCollect int      // the length of the exnRefs on which newExnRef collects the unreachable ones again
+
+	tailCallee fn // the func called by return_call or return_call_indirect, which replaces the active frame
+
+	chunk []byte // the buffer moving the bytes of memory.copy and memory.fill on the Backing, see chunkBuffer
+
+	callDepthLimit  int // the max depth of the nested calls, config.DefaultCallDepthLimit if 0
+	labelStackLimit int // the max height of the label stack in each frame, no limit if 0
+
+	ctx  context.Context // the context of the running CallExportedFuncContext, nil when nothing is running
+	done <-chan struct{} // the ctx.Done(), nil when the ctx is never done
 }
 
 // NewInstance will instantiate the module with extern modules
@@ -38,6 +58,10 @@ func NewInstance(module *Module, externModules map[string]*Module) (*Instance, e
 		},
 	}
 
+	ins.callDepthLimit = stackLimit(module.CallDepthLimit)
+	ins.labelStackLimit = stackLimit(module.LabelStackLimit)
+	ins.OperandStack.SetLimit(stackLimit(module.OperandStackLimit))
+
 	module.log("building index space")
 	if err := ins.buildIndexSpaces(externModules); err != nil {
 		return nil, fmt.Errorf("build index space: %w", err)
@@ -45,11 +69,17 @@ func NewInstance(module *Module, externModules map[string]*Module) (*Instance, e
 
 	// initializing memory
 	module.log("initializing memory")
-	ins.Memory = ins.Module.IndexSpace.Memories[0]
-	diff := uint64(ins.Module.MemorySection[0].Min)*uint64(config.DefaultMemoryPageSize) - uint64(len(ins.Memory.Value))
-	if diff > 0 {
-		// module.log(fmt.Sprintf("3: %v", diff))
-		ins.Memory.Value = append(ins.Memory.Value, make([]byte, diff)...)
+	ins.Memories = ins.Module.IndexSpace.Memories
+	for _, mem := range ins.Memories {
+		if mem.Min > mem.limitPages() {
+			return nil, fmt.Errorf("memory min %d * 64Ki out of limit %d * 64Ki", mem.Min, mem.limitPages())
+		}
+		if size := MemoryPagesToBytesNum(mem.Min); size > mem.Len() {
+			mem.growBytes(size - mem.Len())
+		}
+	}
+	if len(ins.Memories) > 0 {
+		ins.Memory = ins.Memories[0]
 	}
 
 	// initializing functions
@@ -57,8 +87,10 @@ func NewInstance(module *Module, externModules map[string]*Module) (*Instance, e
 	ins.Functions = make([]fn, len(ins.Module.IndexSpace.Functions))
 	for i, f := range ins.Module.IndexSpace.Functions {
 		if wasmFn, ok := f.(*HostFunc); ok {
-			wasmFn.function = wasmFn.Generator(ins)
-			ins.Functions[i] = wasmFn
+			// copy the imported one, which may be generated for other instances at the same time
+			hostFn := *wasmFn
+			hostFn.function = hostFn.Generator(ins)
+			ins.Functions[i] = &hostFn
 		} else {
 			ins.Functions[i] = f
 		}
@@ -77,6 +109,13 @@ func NewInstance(module *Module, externModules map[string]*Module) (*Instance, e
 			ins.Globals[i] = uint64(math.Float32bits(v))
 		case float64:
 			ins.Globals[i] = math.Float64bits(v)
+		case uint64: // reference
+			ins.Globals[i] = v
+		case V128:
+			if ins.globalsHigh == nil {
+				ins.globalsHigh = make([]uint64, len(ins.Globals))
+			}
+			ins.Globals[i], ins.globalsHigh[i] = v.Lo, v.Hi
 		}
 	}
 
@@ -87,7 +126,7 @@ func NewInstance(module *Module, externModules map[string]*Module) (*Instance, e
 			return nil, ErrFuncIndexOutOfRange
 		}
 
-		err := ins.Functions[id].call(ins)
+		err := ins.invoke(ins.Functions[id])
 		if err != nil {
 			return nil, err
 		}
@@ -96,53 +135,43 @@ func NewInstance(module *Module, externModules map[string]*Module) (*Instance, e
 	return ins, nil
 }
 
-func (ins *Instance) fetchInt32() (int32, error) {
-	ret, num, err := leb128decode.DecodeInt32(bytes.NewReader(
-		ins.Active.Func.body[ins.Active.PC:]))
-	if err != nil {
-		return 0, err
+// stackLimit converts the limit in the config into the int, 0 if nil
+func stackLimit(limit *uint64) int {
+	if limit == nil {
+		return 0
 	}
-	ins.Active.PC += num - 1
 
-	return ret, nil
-}
-
-func (ins *Instance) fetchUint32() (uint32, error) {
-	ret, num, err := leb128decode.DecodeUint32(bytes.NewReader(
-		ins.Active.Func.body[ins.Active.PC:]))
-	if err != nil {
-		return 0, err
+	if *limit > math.MaxInt32 {
+		return math.MaxInt32
 	}
 
-	ins.Active.PC += num - 1
-
-	return ret, nil
+	return int(*limit)
 }
 
-func (ins *Instance) fetchInt64() (int64, error) {
-	ret, num, err := leb128decode.DecodeInt64(bytes.NewReader(
-		ins.Active.Func.body[ins.Active.PC:]))
-	if err != nil {
-		return 0, err
+// MemoryByIndex returns the memory on the index of the memory index space, nil when out of range
+func (ins *Instance) MemoryByIndex(index uint32) *Memory {
+	if index == 0 {
+		return ins.Memory
 	}
 
-	ins.Active.PC += num - 1
+	if index >= uint32(len(ins.Memories)) {
+		return nil
+	}
 
-	return ret, nil
+	return ins.Memories[index]
 }
 
-func (ins *Instance) fetchFloat32() (float32, error) {
-	v := math.Float32frombits(binary.LittleEndian.Uint32(
-		ins.Active.Func.body[ins.Active.PC:]))
-	ins.Active.PC += 3
-
-	return v, nil
-}
+// ExportedMemory returns the memory exported as the name
+func (ins *Instance) ExportedMemory(name string) (*Memory, error) {
+	exp, ok := ins.Module.ExportSection[name]
+	if !ok || exp.Desc.Kind != segments.KindMem {
+		return nil, ErrExportedMemoryNotFound
+	}
 
-func (ins *Instance) fetchFloat64() (float64, error) {
-	v := math.Float64frombits(binary.LittleEndian.Uint64(
-		ins.Active.Func.body[ins.Active.PC:]))
-	ins.Active.PC += 7
+	mem := ins.MemoryByIndex(exp.Desc.Index)
+	if mem == nil {
+		return nil, ErrMemoryIndexOutOfRange
+	}
 
-	return v, nil
+	return mem, nil
 }
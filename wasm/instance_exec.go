@@ -2,8 +2,11 @@ package wasm
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 
 	"github.com/c0mm4nd/wasman/expr"
 	"github.com/c0mm4nd/wasman/leb128decode"
@@ -14,68 +17,221 @@ import (
 
 // errors on exec func
 var (
-	ErrExportedFuncNotFound = errors.New("exported func is not found")
-	ErrFuncIndexOutOfRange  = errors.New("function index out of range")
-	ErrInvalidArgNum        = errors.New("invalid number of arguments")
+	ErrExportedFuncNotFound   = errors.New("exported func is not found")
+	ErrExportedMemoryNotFound = errors.New("exported memory is not found")
+	ErrFuncIndexOutOfRange    = errors.New("function index out of range")
+	ErrInvalidArgNum          = errors.New("invalid number of arguments")
+	ErrUnsupportedOpCode      = errors.New("unsupported opcode")
+	ErrV128Signature          = errors.New("v128 value is only passed by CallExportedFuncV128 or ThrowV128")
 )
 
-func (ins *Instance) execExpr(expression *expr.Expression) (v interface{}, err error) {
+// UnsupportedOpCodeError occurs when the function body contains an opcode which has no implementation in the vm
+type UnsupportedOpCodeError struct {
+	OpCode    expr.OpCode
+	SubOpCode uint32 // only for the prefixed opcodes
+}
+
+func (e *UnsupportedOpCodeError) Error() string {
+	if e.OpCode == expr.OpCodeMiscPrefix || e.OpCode == expr.OpCodeSIMDPrefix || e.OpCode == expr.OpCodeAtomicPrefix {
+		return fmt.Sprintf("%v: %#x %d", ErrUnsupportedOpCode, e.OpCode, e.SubOpCode)
+	}
+
+	if name := expr.GetOpCodeName(e.OpCode); name != "" {
+		return fmt.Sprintf("%v: %s(%#x)", ErrUnsupportedOpCode, name, e.OpCode)
+	}
+
+	return fmt.Sprintf("%v: %#x", ErrUnsupportedOpCode, e.OpCode)
+}
+
+// Is makes the UnsupportedOpCodeError comparable with ErrUnsupportedOpCode by errors.Is
+func (e *UnsupportedOpCodeError) Is(target error) bool {
+	return target == ErrUnsupportedOpCode
+}
+
+// constValue is the typed result of a constant expression
+type constValue struct {
+	Type types.ValueType
+	Bits uint64 // the raw bits like on the OperandStack, a v128 keeps its low half here
+	High uint64 // the high half of a v128
+}
+
+// goValue converts the constValue into the go value held by the Global.Val
+func (v constValue) goValue() interface{} {
+	switch v.Type {
+	case types.ValueTypeI32:
+		return int32(v.Bits)
+	case types.ValueTypeI64:
+		return int64(v.Bits)
+	case types.ValueTypeF32:
+		return math.Float32frombits(uint32(v.Bits))
+	case types.ValueTypeF64:
+		return math.Float64frombits(v.Bits)
+	case types.ValueTypeV128:
+		return V128{Lo: v.Bits, Hi: v.High}
+	default: // reference
+		return v.Bits
+	}
+}
+
+// globalConstValue converts the value of the global into the constValue
+func globalConstValue(g *Global) constValue {
+	ret := constValue{Type: g.ValType}
+	switch v := g.Val.(type) {
+	case int32:
+		ret.Bits = uint64(uint32(v))
+	case int64:
+		ret.Bits = uint64(v)
+	case float32:
+		ret.Bits = uint64(math.Float32bits(v))
+	case float64:
+		ret.Bits = math.Float64bits(v)
+	case uint64:
+		ret.Bits = v
+	case V128:
+		ret.Bits, ret.High = v.Lo, v.Hi
+	}
+
+	return ret
+}
+
+// execExpr evaluates the constant expression as a small stack machine, which should leave exactly one value
+func (ins *Instance) execExpr(expression *expr.Expression) (constValue, error) {
 	r := bytes.NewReader(expression.Data)
-	switch expression.OpCode {
-	case expr.OpCodeI32Const:
-		v, _, err = leb128decode.DecodeInt32(r)
-		if err != nil {
-			return nil, fmt.Errorf("read int32: %w", err)
-		}
-	case expr.OpCodeI64Const:
-		v, _, err = leb128decode.DecodeInt64(r)
-		if err != nil {
-			return nil, fmt.Errorf("read int64: %w", err)
-		}
-	case expr.OpCodeF32Const:
-		v, err = utils.ReadFloat32(r)
-		if err != nil {
-			return nil, fmt.Errorf("read f34: %w", err)
-		}
-	case expr.OpCodeF64Const:
-		v, err = utils.ReadFloat64(r)
-		if err != nil {
-			return nil, fmt.Errorf("read f64: %w", err)
-		}
-	case expr.OpCodeGlobalGet:
-		id, _, err := leb128decode.DecodeUint32(r)
-		if err != nil {
-			return nil, fmt.Errorf("read index of global: %w", err)
+	stack := make([]constValue, 0, 1)
+	for op := expression.OpCode; ; {
+		var v constValue
+		switch op {
+		case expr.OpCodeI32Const:
+			i, _, err := leb128decode.DecodeInt32(r)
+			if err != nil {
+				return constValue{}, fmt.Errorf("read int32: %w", err)
+			}
+			v = constValue{Type: types.ValueTypeI32, Bits: uint64(uint32(i))}
+		case expr.OpCodeI64Const:
+			i, _, err := leb128decode.DecodeInt64(r)
+			if err != nil {
+				return constValue{}, fmt.Errorf("read int64: %w", err)
+			}
+			v = constValue{Type: types.ValueTypeI64, Bits: uint64(i)}
+		case expr.OpCodeF32Const:
+			f, err := utils.ReadFloat32(r)
+			if err != nil {
+				return constValue{}, fmt.Errorf("read f34: %w", err)
+			}
+			v = constValue{Type: types.ValueTypeF32, Bits: uint64(math.Float32bits(f))}
+		case expr.OpCodeF64Const:
+			f, err := utils.ReadFloat64(r)
+			if err != nil {
+				return constValue{}, fmt.Errorf("read f64: %w", err)
+			}
+			v = constValue{Type: types.ValueTypeF64, Bits: math.Float64bits(f)}
+		case expr.OpCodeGlobalGet:
+			id, _, err := leb128decode.DecodeUint32(r)
+			if err != nil {
+				return constValue{}, fmt.Errorf("read index of global: %w", err)
+			}
+			if uint32(len(ins.IndexSpace.Globals)) <= id {
+				return constValue{}, fmt.Errorf("global index out of range")
+			}
+			v = globalConstValue(ins.IndexSpace.Globals[id])
+		case expr.OpCodeNull:
+			rt, err := r.ReadByte()
+			if err != nil {
+				return constValue{}, fmt.Errorf("read reference type: %w", err)
+			}
+			v = constValue{Type: types.ValueType(rt), Bits: refNull}
+		case expr.OpCodeFunc:
+			id, _, err := leb128decode.DecodeUint32(r)
+			if err != nil {
+				return constValue{}, fmt.Errorf("read index of function: %w", err)
+			}
+			if uint32(len(ins.IndexSpace.Functions)) <= id {
+				return constValue{}, fmt.Errorf("function index out of range")
+			}
+			v = constValue{Type: types.ValueTypeFuncRef, Bits: refFromIndex(&id)}
+		case expr.OpCodeSIMDPrefix: // v128.const
+			if _, _, err := leb128decode.DecodeUint32(r); err != nil {
+				return constValue{}, fmt.Errorf("read simd opcode: %w", err)
+			}
+			b := make([]byte, 16)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return constValue{}, fmt.Errorf("read v128: %w", err)
+			}
+			v128 := v128FromBytes(b)
+			v = constValue{Type: types.ValueTypeV128, Bits: v128.Lo, High: v128.Hi}
+		case expr.OpCodeI32Add, expr.OpCodeI32Sub, expr.OpCodeI32Mul,
+			expr.OpCodeI64Add, expr.OpCodeI64Sub, expr.OpCodeI64Mul: // extended-const
+			vt := types.ValueTypeI32
+			if op >= expr.OpCodeI64Add {
+				vt = types.ValueTypeI64
+			}
+			n := len(stack)
+			if n < 2 || stack[n-2].Type != vt || stack[n-1].Type != vt {
+				return constValue{}, fmt.Errorf("type mismatch on operands of %#x", op)
+			}
+			a, b := stack[n-2].Bits, stack[n-1].Bits
+			stack = stack[:n-2]
+
+			switch op {
+			case expr.OpCodeI32Add, expr.OpCodeI64Add:
+				v.Bits = a + b
+			case expr.OpCodeI32Sub, expr.OpCodeI64Sub:
+				v.Bits = a - b
+			default:
+				v.Bits = a * b
+			}
+			if vt == types.ValueTypeI32 {
+				v.Bits = uint64(uint32(v.Bits))
+			}
+			v.Type = vt
+		default:
+			return constValue{}, fmt.Errorf("invalid opt code: %#x", op)
 		}
-		if uint32(len(ins.IndexSpace.Globals)) <= id {
-			return nil, fmt.Errorf("global index out of range")
+		stack = append(stack, v)
+
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			break
 		}
-		v = ins.IndexSpace.Globals[id].Val
-	default:
-		return nil, fmt.Errorf("invalid opt code: %#x", expression.OpCode)
+		op = b
+	}
+
+	if len(stack) != 1 {
+		return constValue{}, fmt.Errorf("constant expression leaves %d values", len(stack))
 	}
-	return v, nil
+
+	return stack[0], nil
 }
 
 func (ins *Instance) execFunc() error {
-	for ; int(ins.Active.PC) < len(ins.Active.Func.body); ins.Active.PC++ {
-		opByte := ins.Active.Func.body[ins.Active.PC]
-		op := expr.OpCode(opByte)
-		err := instructions[op](ins)
+	for ; ins.Active.PC < uint64(len(ins.Active.Func.code)); ins.Active.PC++ {
+		in := &ins.Active.Func.code[ins.Active.PC]
+		op := in.op
+		err := in.fn(ins)
 		if err != nil {
-			return err
+			var exc *Exception
+			if !errors.As(err, &exc) {
+				return ins.trap(err)
+			}
+
+			caught, err := ins.catchException(exc)
+			if err != nil {
+				return ins.trap(err)
+			}
+			if !caught {
+				return exc
+			}
 		}
 
 		// Toll
 		if ins.Module.ModuleConfig.TollStation != nil {
-			price := ins.TollStation.GetOpPrice(op)
-			err := ins.TollStation.AddToll(price)
+			err := ins.payToll(in)
 			if err != nil {
-				return err
+				return ins.trap(err)
 			}
 		}
 
-		if op == expr.OpCodeReturn {
+		if op == expr.OpCodeReturn || op == expr.OpCodeReturnCall || op == expr.OpCodeReturnCallIndirect {
 			return nil
 		}
 	}
@@ -83,28 +239,57 @@ func (ins *Instance) execFunc() error {
 	return nil
 }
 
-// CallExportedFunc will call the func `name` with the args
-// TODO: enhance this
-func (ins *Instance) CallExportedFunc(name string, args ...uint64) (returns []uint64, returnTypes []types.ValueType, err error) {
-	exp, ok := ins.Module.ExportSection[name]
-	if !ok || exp.Desc.Kind != segments.KindFunction {
-		return nil, nil, ErrExportedFuncNotFound
+// payToll charges the price of the instr, the superinstruction is charged for each of its fused instructions
+func (ins *Instance) payToll(in *instr) error {
+	if in.fused == nil {
+		return ins.TollStation.AddToll(ins.TollStation.GetOpPrice(tollOpCode(in.op)))
 	}
 
-	if int(exp.Desc.Index) >= len(ins.Functions) {
-		return nil, nil, ErrFuncIndexOutOfRange
+	for _, op := range in.fused {
+		err := ins.TollStation.AddToll(ins.TollStation.GetOpPrice(tollOpCode(op)))
+		if err != nil {
+			return err
+		}
 	}
 
-	f := ins.Functions[exp.Desc.Index]
-	if len(f.getType().InputTypes) != len(args) {
-		return nil, nil, ErrInvalidArgNum
+	return nil
+}
+
+// tollOpCode returns the opcode whose price is charged for the op, the tail calls are charged like the calls
+func tollOpCode(op expr.OpCode) expr.OpCode {
+	switch op {
+	case expr.OpCodeReturnCall:
+		return expr.OpCodeCall
+	case expr.OpCodeReturnCallIndirect:
+		return expr.OpCodeCallIndirect
+	default:
+		return op
 	}
+}
+
+// CallExportedFunc will call the func `name` with the args,
+// following the context of the running CallExportedFuncContext when called by a host func.
+// The func taking or returning a v128 is rejected with the ErrV128Signature, call it by CallExportedFuncV128
+func (ins *Instance) CallExportedFunc(name string, args ...uint64) (returns []uint64, returnTypes []types.ValueType, err error) {
+	return ins.CallExportedFuncContext(ins.Context(), name, args...)
+}
 
-	for i := range args {
-		ins.OperandStack.Push(args[i])
+// CallExportedFuncContext calls the func `name` with the args like CallExportedFunc,
+// and stops the execution with the InterruptedError once the ctx is done
+func (ins *Instance) CallExportedFuncContext(ctx context.Context, name string, args ...uint64) (returns []uint64, returnTypes []types.ValueType, err error) {
+	f, err := ins.exportedFunc(name, len(args))
+	if err != nil {
+		return nil, nil, err
+	}
+	if hasV128(f.getType().InputTypes) || hasV128(f.getType().ReturnTypes) {
+		return nil, nil, ErrV128Signature
 	}
 
-	err = f.call(ins)
+	err = ins.invokeContext(ctx, f, func() {
+		for i := range args {
+			ins.OperandStack.Push(args[i])
+		}
+	})
 	if err != nil {
 		return nil, nil, err
 	}
@@ -116,3 +301,74 @@ func (ins *Instance) CallExportedFunc(name string, args ...uint64) (returns []ui
 
 	return ret, f.getType().ReturnTypes, nil
 }
+
+// CallExportedFuncV128 calls the func `name` like CallExportedFunc, but passes and returns every value as a V128,
+// so that the v128 ones keep all their 128 bits. The values of the other types are held in the Lo
+func (ins *Instance) CallExportedFuncV128(name string, args ...V128) (returns []V128, returnTypes []types.ValueType, err error) {
+	return ins.CallExportedFuncV128Context(ins.Context(), name, args...)
+}
+
+// CallExportedFuncV128Context calls the func `name` with the args like CallExportedFuncV128,
+// and stops the execution with the InterruptedError once the ctx is done
+func (ins *Instance) CallExportedFuncV128Context(ctx context.Context, name string, args ...V128) (returns []V128, returnTypes []types.ValueType, err error) {
+	f, err := ins.exportedFunc(name, len(args))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = ins.invokeContext(ctx, f, func() {
+		for i := range args {
+			ins.pushV128(args[i])
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ret := make([]V128, len(f.getType().ReturnTypes))
+	for i := len(ret) - 1; i >= 0; i-- {
+		if f.getType().ReturnTypes[i] == types.ValueTypeV128 {
+			ret[i] = ins.popV128()
+		} else {
+			ret[i] = V128{Lo: ins.OperandStack.Pop()}
+		}
+	}
+
+	return ret, f.getType().ReturnTypes, nil
+}
+
+// exportedFunc returns the exported func `name` taking the numArgs params
+func (ins *Instance) exportedFunc(name string, numArgs int) (fn, error) {
+	exp, ok := ins.Module.ExportSection[name]
+	if !ok || exp.Desc.Kind != segments.KindFunction {
+		return nil, ErrExportedFuncNotFound
+	}
+
+	if int(exp.Desc.Index) >= len(ins.Functions) {
+		return nil, ErrFuncIndexOutOfRange
+	}
+
+	f := ins.Functions[exp.Desc.Index]
+	if len(f.getType().InputTypes) != numArgs {
+		return nil, ErrInvalidArgNum
+	}
+
+	return f, nil
+}
+
+// invokeContext invokes the f on the args pushed by the push, following the ctx
+func (ins *Instance) invokeContext(ctx context.Context, f fn, push func()) error {
+	if err := ctx.Err(); err != nil {
+		return &InterruptedError{Err: err}
+	}
+
+	prevCtx, prevDone := ins.ctx, ins.done
+	ins.ctx, ins.done = ctx, ctx.Done()
+	defer func() {
+		ins.ctx, ins.done = prevCtx, prevDone
+	}()
+
+	push()
+
+	return ins.invoke(f)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/c0mm4nd/wasman/expr"
 	"github.com/c0mm4nd/wasman/leb128decode"
 	"github.com/c0mm4nd/wasman/segments"
+	"github.com/c0mm4nd/wasman/stacks"
 	"github.com/c0mm4nd/wasman/types"
 )
 
@@ -20,26 +21,48 @@ func (ins *Instance) buildIndexSpaces(externModules map[string]*Module) error {
 		return fmt.Errorf("resolve imports: %w", err)
 	}
 
-	// fill in the gap between the definition and imported ones in index spaces
-	// note: MVP restricts the size of memory index spaces to 1
-	if diff := len(ins.TableSection) - len(ins.IndexSpace.Tables); diff > 0 {
-		for i := 0; i < diff; i++ {
-			ins.IndexSpace.Tables = append(ins.IndexSpace.Tables, &Table{
-				TableType: *ins.TableSection[i+len(ins.IndexSpace.Tables)],
-				Value:     []*uint32{},
-			})
+	// append the defined tags after the imported ones in index spaces
+	for _, tt := range ins.TagSection {
+		tag, err := ins.newTag(tt)
+		if err != nil {
+			return fmt.Errorf("build tag index space: %w", err)
+		}
+		ins.IndexSpace.Tags = append(ins.IndexSpace.Tags, tag)
+	}
+
+	// append the defined tables after the imported ones in index spaces
+	for _, tt := range ins.TableSection {
+		table := &Table{
+			TableType: *tt,
+			limit:     config.DefaultTableLimit,
+		}
+		if ins.TableLimit != nil {
+			table.limit = *ins.TableLimit
+		}
+		if tt.Limits.Min > table.limitSize() {
+			return fmt.Errorf("table min %d out of limit %d", tt.Limits.Min, table.limitSize())
 		}
+		table.Value = make([]*uint32, tt.Limits.Min)
+		ins.IndexSpace.Tables = append(ins.IndexSpace.Tables, table)
 	}
 
-	// fill in the gap between the definition and imported ones in index spaces
-	// note: MVP restricts the size of memory index spaces to 1
-	if diff := len(ins.MemorySection) - len(ins.IndexSpace.Memories); diff > 0 {
-		for i := 0; i < diff; i++ {
-			ins.IndexSpace.Memories = append(ins.IndexSpace.Memories, &Memory{
-				MemoryType: *ins.MemorySection[i+len(ins.IndexSpace.Memories)],
-				Value:      []byte{},
-			})
+	// append the defined memories after the imported ones in index spaces
+	for _, mt := range ins.MemorySection {
+		mem := &Memory{
+			MemoryType: *mt,
+			Value:      []byte{},
+			limit:      config.DefaultMemoryLimitPages,
 		}
+		if ins.MemoryLimitPages != nil {
+			mem.limit = *ins.MemoryLimitPages
+		}
+		if mt.Shared {
+			if mt.Max == nil {
+				return fmt.Errorf("shared memory must have a max")
+			}
+			mem.Backing = NewSharedMemoryBacking(0)
+		}
+		ins.IndexSpace.Memories = append(ins.IndexSpace.Memories, mem)
 	}
 
 	if err := ins.buildGlobalIndexSpace(); err != nil {
@@ -83,13 +106,17 @@ func (ins *Instance) resolveImports(externModules map[string]*Module) error {
 				return fmt.Errorf("applyTableImport failed: %w", err)
 			}
 		case 0x02: // memory
-			if err := ins.applyMemoryImport(em, es); err != nil {
+			if err := ins.applyMemoryImport(is, em, es); err != nil {
 				return fmt.Errorf("applyMemoryImport: %w", err)
 			}
 		case 0x03: // global
 			if err := ins.applyGlobalImport(em, es); err != nil {
 				return fmt.Errorf("applyGlobalImport: %w", err)
 			}
+		case 0x04: // tag
+			if err := ins.applyTagImport(is, em, es); err != nil {
+				return fmt.Errorf("applyTagImport: %w", err)
+			}
 		default:
 			return fmt.Errorf("invalid kind of import: %#x", is.Desc.Kind)
 		}
@@ -127,13 +154,17 @@ func (ins *Instance) applyTableImport(externModule *Module, exportSeg *segments.
 	return nil
 }
 
-func (ins *Instance) applyMemoryImport(externModule *Module, exportSegment *segments.ExportSegment) error {
+func (ins *Instance) applyMemoryImport(importSeg *segments.ImportSegment, externModule *Module, exportSegment *segments.ExportSegment) error {
 	if exportSegment.Desc.Index >= uint32(len(externModule.IndexSpace.Memories)) {
 		return fmt.Errorf("exported index out of range")
 	}
 
-	// note: MVP restricts the size of memory index spaces to 1
-	ins.IndexSpace.Memories = append(ins.IndexSpace.Memories, externModule.IndexSpace.Memories[exportSegment.Desc.Index])
+	mem := externModule.IndexSpace.Memories[exportSegment.Desc.Index]
+	if mt := importSeg.Desc.MemTypePtr; mt != nil && mt.Shared != mem.Shared {
+		return fmt.Errorf("shared flag mismatch: %v != %v", mt.Shared, mem.Shared)
+	}
+
+	ins.IndexSpace.Memories = append(ins.IndexSpace.Memories, mem)
 	return nil
 }
 
@@ -151,21 +182,63 @@ func (ins *Instance) applyGlobalImport(externModule *Module, exportSegment *segm
 	return nil
 }
 
+func (ins *Instance) applyTagImport(importSeg *segments.ImportSegment, externModule *Module, exportSeg *segments.ExportSegment) error {
+	if exportSeg.Desc.Index >= uint32(len(externModule.IndexSpace.Tags)) {
+		return fmt.Errorf("exported index out of range")
+	}
+
+	if importSeg.Desc.TagTypePtr == nil {
+		return fmt.Errorf("is.Desc.TagTypePtr is nill")
+	}
+
+	iTag, err := ins.newTag(importSeg.Desc.TagTypePtr)
+	if err != nil {
+		return err
+	}
+
+	// the imported tag keeps its identity, so that the exceptions are caught across the modules
+	tag := externModule.IndexSpace.Tags[exportSeg.Desc.Index]
+	if !types.HasSameSignature(iTag.Type.InputTypes, tag.Type.InputTypes) {
+		return fmt.Errorf("payload signature mimatch: %#v != %#v", iTag.Type.InputTypes, tag.Type.InputTypes)
+	}
+
+	ins.IndexSpace.Tags = append(ins.IndexSpace.Tags, tag)
+	return nil
+}
+
+// newTag creates a Tag of the tag type, whose function type should have no results
+func (ins *Instance) newTag(tt *types.TagType) (*Tag, error) {
+	if tt.TypeIndex >= uint32(len(ins.TypeSection)) {
+		return nil, fmt.Errorf("tag type index out of range")
+	}
+
+	ft := ins.TypeSection[tt.TypeIndex]
+	if len(ft.ReturnTypes) != 0 {
+		return nil, fmt.Errorf("tag type has results")
+	}
+
+	return &Tag{Type: ft}, nil
+}
+
 func (ins *Instance) buildGlobalIndexSpace() error {
 	for _, gs := range ins.GlobalSection {
 		v, err := ins.execExpr(gs.Init)
 		if err != nil {
 			return fmt.Errorf("execution failed: %w", err)
 		}
+		if v.Type != gs.Type.ValType {
+			return fmt.Errorf("type mismatch on global: %s != %s", v.Type, gs.Type.ValType)
+		}
 		ins.IndexSpace.Globals = append(ins.IndexSpace.Globals, &Global{
 			GlobalType: gs.Type,
-			Val:        v,
+			Val:        v.goValue(),
 		})
 	}
 	return nil
 }
 
 func (ins *Instance) buildFunctionIndexSpace() error {
+	names := ins.funcNames()
 	for codeIndex, typeIndex := range ins.FunctionSection {
 		if typeIndex >= uint32(len(ins.TypeSection)) {
 			return fmt.Errorf("function type index out of range")
@@ -177,14 +250,23 @@ func (ins *Instance) buildFunctionIndexSpace() error {
 			signature: ins.TypeSection[typeIndex],
 			body:      ins.CodeSection[codeIndex].Body,
 			NumLocal:  ins.CodeSection[codeIndex].NumLocals,
+			index:     uint32(len(ins.IndexSpace.Functions)),
 		}
+		f.name = names[f.index]
+		f.hasV128 = hasV128(f.signature.InputTypes) || hasV128(ins.CodeSection[codeIndex].RunTypes())
 
-		brs, err := ins.parseBlocks(f.body)
+		code, err := ins.compile(f.body)
 		if err != nil {
-			return fmt.Errorf("parse blocks: %w", err)
+			return fmt.Errorf("compile function %d: %w", codeIndex, err)
+		}
+		if ins.DisableFloatPoint || ins.CanonicalizeNaN {
+			ins.applyFloatPoint(code, uint32(len(ins.IndexSpace.Functions)))
+		}
+		if ins.ModuleConfig.Optimize {
+			code = lower(code)
 		}
 
-		f.Blocks = brs
+		f.code = code
 		ins.IndexSpace.Functions = append(ins.IndexSpace.Functions, f)
 	}
 
@@ -192,89 +274,123 @@ func (ins *Instance) buildFunctionIndexSpace() error {
 }
 
 func (ins *Instance) buildMemoryIndexSpace() error {
-	for _, d := range ins.Module.DataSection {
-		// note: MVP restricts the size of memory index spaces to 1
+	ins.dataSegments = make([][]byte, len(ins.Module.DataSection))
+	for i, d := range ins.Module.DataSection {
+		if d.Mode == segments.SegmentModePassive {
+			ins.dataSegments[i] = d.Init
+			continue
+		}
+
 		if d.MemoryIndex >= uint32(len(ins.IndexSpace.Memories)) {
 			return fmt.Errorf("index out of range of index space")
-		} else if d.MemoryIndex >= uint32(len(ins.MemorySection)) {
-			return fmt.Errorf("index out of range of memory section")
 		}
 
-		rawOffset, err := ins.execExpr(d.OffsetExpression)
+		memory := ins.IndexSpace.Memories[d.MemoryIndex]
+		v, err := ins.execExpr(d.OffsetExpression)
 		if err != nil {
 			return fmt.Errorf("calculate offset: %w", err)
 		}
 
-		offset, ok := rawOffset.(int32)
-		if !ok {
-			return fmt.Errorf("type assertion failed")
+		addrType := types.ValueTypeI32
+		if memory.Is64 {
+			addrType = types.ValueTypeI64
+		}
+		if v.Type != addrType {
+			return fmt.Errorf("type mismatch on offset: %s != %s", v.Type, addrType)
 		}
 
-		size := int(offset) + len(d.Init)
-		if ins.MemorySection[d.MemoryIndex].Max != nil && uint32(size) > *(ins.MemorySection[d.MemoryIndex].Max)*config.DefaultMemoryPageSize {
-			return fmt.Errorf("memory size out of limit %d * 64Ki", int(*(ins.MemorySection[d.MemoryIndex].Max)))
+		offset := v.Bits
+		size := offset + uint64(len(d.Init))
+		if size < offset || size > MemoryPagesToBytesNum(memory.limitPages()) {
+			return fmt.Errorf("memory size out of limit %d * 64Ki", memory.limitPages())
 		}
 
-		memory := ins.IndexSpace.Memories[d.MemoryIndex]
-		if size > len(memory.Value) {
-			next := make([]byte, size)
-			copy(next, memory.Value)
-			copy(next[offset:], d.Init)
-			ins.IndexSpace.Memories[d.MemoryIndex].Value = next
-		} else {
-			copy(memory.Value[offset:], d.Init)
+		if size > memory.Len() {
+			memory.growBytes(size - memory.Len())
 		}
+
+		memory.write(d.Init, offset)
 	}
 	return nil
 }
 
 func (ins *Instance) buildTableIndexSpace() error {
-	for _, elem := range ins.ElementsSection {
-		// note: MVP restricts the size of memory index spaces to 1
+	ins.elemSegments = make([][]*uint32, len(ins.ElementsSection))
+	for i, elem := range ins.ElementsSection {
+		init, err := ins.evalElemSegment(elem)
+		if err != nil {
+			return fmt.Errorf("evaluate elements: %w", err)
+		}
+
+		switch elem.Mode {
+		case segments.SegmentModePassive:
+			ins.elemSegments[i] = init
+			continue
+		case segments.SegmentModeDeclarative:
+			continue
+		}
+
 		if elem.TableIndex >= uint32(len(ins.IndexSpace.Tables)) {
 			return fmt.Errorf("index out of range of index space")
-		} else if elem.TableIndex >= uint32(len(ins.TableSection)) {
-			// this is just in case since we could assume len(SecTables) == len(indexSpace.Table)
-			return fmt.Errorf("index out of range of table section")
 		}
 
-		rawOffset, err := ins.execExpr(elem.OffsetExpr)
+		v, err := ins.execExpr(elem.OffsetExpr)
 		if err != nil {
 			return fmt.Errorf("calculate offset: %w", err)
 		}
 
-		offset32, ok := rawOffset.(int32)
-		if !ok {
-			return fmt.Errorf("type assertion failed")
+		if v.Type != types.ValueTypeI32 {
+			return fmt.Errorf("type mismatch on offset: %s != %s", v.Type, types.ValueTypeI32)
 		}
 
-		offset := int(offset32)
-		size := offset + len(elem.Init)
-		if ins.TableSection[elem.TableIndex].Limits.Max != nil &&
-			size > int(*(ins.TableSection[elem.TableIndex].Limits.Max)) {
-			return fmt.Errorf("table size out of limit of %d", int(*(ins.TableSection[elem.TableIndex].Limits.Max)))
+		offset := int(uint32(v.Bits))
+		size := offset + len(init)
+		table := ins.IndexSpace.Tables[elem.TableIndex]
+		if uint64(size) > table.limitSize() {
+			return fmt.Errorf("table size out of limit of %d", table.limitSize())
 		}
 
-		table := ins.IndexSpace.Tables[elem.TableIndex]
 		if size > len(table.Value) {
 			next := make([]*uint32, size)
 			copy(next, table.Value)
-			for i := range elem.Init {
-				next[i+offset] = &elem.Init[i]
-			}
+			copy(next[offset:], init)
 			ins.IndexSpace.Tables[elem.TableIndex].Value = next
 		} else {
-			for i := range elem.Init {
-				table.Value[i+offset] = &elem.Init[i]
-			}
+			copy(table.Value[offset:], init)
 		}
 	}
 	return nil
 }
 
+// evalElemSegment resolves the function indices referenced by the element segment, nil means ref.null
+func (ins *Instance) evalElemSegment(elem *segments.ElemSegment) ([]*uint32, error) {
+	if elem.InitExprs == nil {
+		ret := make([]*uint32, len(elem.Init))
+		for i := range elem.Init {
+			ret[i] = &elem.Init[i]
+		}
+		return ret, nil
+	}
+
+	ret := make([]*uint32, len(elem.InitExprs))
+	for i, expression := range elem.InitExprs {
+		v, err := ins.execExpr(expression)
+		if err != nil {
+			return nil, fmt.Errorf("evaluate element: %w", err)
+		}
+
+		if !v.Type.IsRefType() {
+			return nil, fmt.Errorf("element of non-reference type: %s", v.Type)
+		}
+		ret[i] = refToIndex(v.Bits)
+	}
+
+	return ret, nil
+}
+
 type blockType = types.FuncType
 
-func (ins *Instance) readBlockType(r *bytes.Reader) (*blockType, uint64, error) {
+func (m *Module) readBlockType(r *bytes.Reader) (*blockType, uint64, error) {
 	raw, l, err := leb128decode.DecodeInt33AsInt64(r)
 	if err != nil {
 		return nil, 0, fmt.Errorf("decode int33: %w", err)
@@ -292,119 +408,59 @@ func (ins *Instance) readBlockType(r *bytes.Reader) (*blockType, uint64, error)
 		ret = &blockType{ReturnTypes: []types.ValueType{types.ValueTypeF32}}
 	case -4: // 0x7c in original byte = f64
 		ret = &blockType{ReturnTypes: []types.ValueType{types.ValueTypeF64}}
+	case -5: // 0x7b in original byte = v128
+		ret = &blockType{ReturnTypes: []types.ValueType{types.ValueTypeV128}}
+	case -16: // 0x70 in original byte = funcref
+		ret = &blockType{ReturnTypes: []types.ValueType{types.ValueTypeFuncRef}}
+	case -17: // 0x6f in original byte = externref
+		ret = &blockType{ReturnTypes: []types.ValueType{types.ValueTypeExternRef}}
+	case -23: // 0x69 in original byte = exnref
+		ret = &blockType{ReturnTypes: []types.ValueType{types.ValueTypeExnRef}}
 	default:
-		if raw < 0 || (raw >= int64(len(ins.TypeSection))) {
+		if raw < 0 || (raw >= int64(len(m.TypeSection))) {
 			return nil, 0, fmt.Errorf("invalid block type: %d", raw)
 		}
-		ret = ins.TypeSection[raw]
+		ret = m.TypeSection[raw]
 	}
 	return ret, l, nil
 }
 
-func (ins *Instance) parseBlocks(body []byte) (map[uint64]*funcBlock, error) {
-	ret := map[uint64]*funcBlock{}
-	stack := make([]*funcBlock, 0)
-	for pc := uint64(0); pc < uint64(len(body)); pc++ {
-		rawOc := body[pc]
-		if 0x28 <= rawOc && rawOc <= 0x3e { // memory load,store
-			pc++
-			// align
-			_, l, err := leb128decode.DecodeUint32(bytes.NewReader(body[pc:]))
-			if err != nil {
-				return nil, fmt.Errorf("read memory align: %w", err)
-			}
-			pc += l
-			// offset
-			_, l, err = leb128decode.DecodeUint32(bytes.NewReader(body[pc:]))
-			if err != nil {
-				return nil, fmt.Errorf("read memory offset: %w", err)
-			}
-			pc += l - 1
-			continue
-		} else if 0x41 <= rawOc && rawOc <= 0x44 { // const instructions
-			pc++
-			switch expr.OpCode(rawOc) {
-			case expr.OpCodeI32Const:
-				_, l, err := leb128decode.DecodeInt32(bytes.NewReader(body[pc:]))
-				if err != nil {
-					return nil, fmt.Errorf("read immediate: %w", err)
-				}
-				pc += l - 1
-			case expr.OpCodeI64Const:
-				_, l, err := leb128decode.DecodeInt64(bytes.NewReader(body[pc:]))
-				if err != nil {
-					return nil, fmt.Errorf("read immediate: %w", err)
-				}
-				pc += l - 1
-			case expr.OpCodeF32Const:
-				pc += 3
-			case expr.OpCodeF64Const:
-				pc += 7
-			}
-			continue
-		} else if (0x3f <= rawOc && rawOc <= 0x40) || // memory grow,size
-			(0x20 <= rawOc && rawOc <= 0x24) || // variable instructions
-			(0x0c <= rawOc && rawOc <= 0x0d) || // br,br_if instructions
-			(0x10 <= rawOc && rawOc <= 0x11) { // call,call_indirect
-			pc++
-			_, l, err := leb128decode.DecodeUint32(bytes.NewReader(body[pc:]))
-			if err != nil {
-				return nil, fmt.Errorf("read immediate: %w", err)
-			}
-			pc += l - 1
-			if rawOc == 0x11 { // if call_indirect
-				pc++
-			}
-			continue
-		} else if rawOc == 0x0e { // br_table
-			pc++
-			r := bytes.NewReader(body[pc:])
-			nl, num, err := leb128decode.DecodeUint32(r)
-			if err != nil {
-				return nil, fmt.Errorf("read immediate: %w", err)
-			}
-
-			for i := uint32(0); i < nl; i++ {
-				_, n, err := leb128decode.DecodeUint32(r)
-				if err != nil {
-					return nil, fmt.Errorf("read immediate: %w", err)
-				}
-				num += n
-			}
+// readCatches reads the vector of the catch clauses of the try_table, returning the number of bytes read
+func readCatches(r *bytes.Reader) ([]stacks.Catch, uint64, error) {
+	vs, num, err := leb128decode.DecodeUint32(r)
+	if err != nil {
+		return nil, 0, fmt.Errorf("get size of vector: %w", err)
+	}
 
-			_, l, err := leb128decode.DecodeUint32(r)
-			if err != nil {
-				return nil, fmt.Errorf("read immediate: %w", err)
-			}
-			pc += l + num - 1
-			continue
+	ret := make([]stacks.Catch, vs)
+	for i := range ret {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, 0, fmt.Errorf("read catch kind: %w", err)
 		}
+		num++
 
-		switch expr.OpCode(rawOc) {
-		case expr.OpCodeBlock, expr.OpCodeIf, expr.OpCodeLoop:
-			bt, l, err := ins.readBlockType(bytes.NewReader(body[pc+1:]))
+		switch kind {
+		case expr.CatchKindCatch, expr.CatchKindCatchRef:
+			tag, n, err := leb128decode.DecodeUint32(r)
 			if err != nil {
-				return nil, fmt.Errorf("read block: %w", err)
+				return nil, 0, fmt.Errorf("read tag index: %w", err)
 			}
-			stack = append(stack, &funcBlock{
-				StartAt:        pc,
-				BlockType:      bt,
-				BlockTypeBytes: l,
-			})
-			pc += l
-		case expr.OpCodeElse:
-			stack[len(stack)-1].ElseAt = pc
-		case expr.OpCodeEnd:
-			bl := stack[len(stack)-1]
-			stack = stack[:len(stack)-1]
-			bl.EndAt = pc
-			ret[bl.StartAt] = bl
+			ret[i].Tag = tag
+			num += n
+		case expr.CatchKindCatchAll, expr.CatchKindCatchAllRef:
+		default:
+			return nil, 0, fmt.Errorf("invalid catch kind: %#x", kind)
 		}
-	}
 
-	if len(stack) > 0 {
-		return nil, fmt.Errorf("ill-nested block exists")
+		label, n, err := leb128decode.DecodeUint32(r)
+		if err != nil {
+			return nil, 0, fmt.Errorf("read label index: %w", err)
+		}
+		ret[i].Kind = kind
+		ret[i].Label = label
+		num += n
 	}
 
-	return ret, nil
+	return ret, num, nil
 }
@@ -2,12 +2,13 @@ package wasm
 
 import (
 	"bytes"
+	"math"
 	"reflect"
-	"strconv"
 	"testing"
 
 	"github.com/c0mm4nd/wasman/utils"
 
+	"github.com/c0mm4nd/wasman/config"
 	"github.com/c0mm4nd/wasman/expr"
 	"github.com/c0mm4nd/wasman/segments"
 	"github.com/c0mm4nd/wasman/types"
@@ -18,6 +19,10 @@ func TestInstance_executeConstExpression(t *testing.T) {
 		for _, expression := range []*expr.Expression{
 			{OpCode: 0xa},
 			{OpCode: expr.OpCodeGlobalGet, Data: []byte{0x2}},
+			{OpCode: expr.OpCodeFunc, Data: []byte{0x2}},
+			{OpCode: expr.OpCodeI32Const, Data: []byte{0x1, byte(expr.OpCodeI32Const), 0x2}},                          // two values left
+			{OpCode: expr.OpCodeI32Const, Data: []byte{0x1, byte(expr.OpCodeI64Const), 0x2, byte(expr.OpCodeI32Add)}}, // type mismatch
+			{OpCode: expr.OpCodeI32Const, Data: []byte{0x1, byte(expr.OpCodeI32Add)}},                                 // stack underflow
 		} {
 			m := &Module{IndexSpace: new(IndexSpace)}
 			ins := &Instance{Module: m}
@@ -33,35 +38,77 @@ func TestInstance_executeConstExpression(t *testing.T) {
 		for _, c := range []struct {
 			ins  Instance
 			expr *expr.Expression
-			val  interface{}
+			val  constValue
 		}{
 			{
 				expr: &expr.Expression{
 					OpCode: expr.OpCodeI64Const,
 					Data:   []byte{0x5},
 				},
-				val: int64(5),
+				val: constValue{Type: types.ValueTypeI64, Bits: 5},
 			},
 			{
 				expr: &expr.Expression{
 					OpCode: expr.OpCodeI32Const,
 					Data:   []byte{0x5},
 				},
-				val: int32(5),
+				val: constValue{Type: types.ValueTypeI32, Bits: 5},
 			},
 			{
 				expr: &expr.Expression{
 					OpCode: expr.OpCodeF32Const,
 					Data:   []byte{0x40, 0xe1, 0x47, 0x40},
 				},
-				val: float32(3.1231232),
+				val: constValue{Type: types.ValueTypeF32, Bits: uint64(math.Float32bits(3.1231232))},
 			},
 			{
 				expr: &expr.Expression{
 					OpCode: expr.OpCodeF64Const,
 					Data:   []byte{0x5e, 0xc4, 0xd8, 0xf9, 0x27, 0xfc, 0x08, 0x40},
 				},
-				val: 3.1231231231,
+				val: constValue{Type: types.ValueTypeF64, Bits: math.Float64bits(3.1231231231)},
+			},
+			{
+				expr: &expr.Expression{
+					OpCode: expr.OpCodeNull,
+					Data:   []byte{0x70},
+				},
+				val: constValue{Type: types.ValueTypeFuncRef, Bits: 0},
+			},
+			{
+				expr: &expr.Expression{
+					OpCode: expr.OpCodeSIMDPrefix,
+					Data:   []byte{0x0c, 0x01, 0, 0, 0, 0, 0, 0, 0, 0x02, 0, 0, 0, 0, 0, 0, 0},
+				},
+				val: constValue{Type: types.ValueTypeV128, Bits: 1, High: 2},
+			},
+			{
+				ins: Instance{Module: &Module{IndexSpace: &IndexSpace{Functions: []fn{nil, nil}}}},
+				expr: &expr.Expression{
+					OpCode: expr.OpCodeFunc,
+					Data:   []byte{0x1},
+				},
+				val: constValue{Type: types.ValueTypeFuncRef, Bits: 2},
+			},
+			{
+				// (i64.sub (global.get 0) (i64.mul (i64.const 2) (i64.const -3)))
+				ins: Instance{Module: &Module{IndexSpace: &IndexSpace{Globals: []*Global{
+					{GlobalType: &types.GlobalType{ValType: types.ValueTypeI64}, Val: int64(10)},
+				}}}},
+				expr: &expr.Expression{
+					OpCode: expr.OpCodeGlobalGet,
+					Data: []byte{0x00, byte(expr.OpCodeI64Const), 0x02, byte(expr.OpCodeI64Const), 0x7d,
+						byte(expr.OpCodeI64Mul), byte(expr.OpCodeI64Sub)},
+				},
+				val: constValue{Type: types.ValueTypeI64, Bits: 16},
+			},
+			{
+				// (i32.add (i32.const -1) (i32.const 2)) wraps around
+				expr: &expr.Expression{
+					OpCode: expr.OpCodeI32Const,
+					Data:   []byte{0x7f, byte(expr.OpCodeI32Const), 0x02, byte(expr.OpCodeI32Add)},
+				},
+				val: constValue{Type: types.ValueTypeI32, Bits: 1},
 			},
 		} {
 
@@ -265,7 +312,18 @@ func TestModule_applyMemoryImport(t *testing.T) {
 	t.Run("error", func(t *testing.T) {
 		es := &segments.ExportSegment{Desc: &segments.ExportDesc{Index: 10}}
 		em := &Module{IndexSpace: new(IndexSpace)}
-		err := (&Instance{Module: &Module{}}).applyMemoryImport(em, es)
+		is := &segments.ImportSegment{Desc: &segments.ImportDesc{MemTypePtr: &types.MemoryType{}}}
+		err := (&Instance{Module: &Module{}}).applyMemoryImport(is, em, es)
+		if err == nil {
+			t.Fail()
+		}
+	})
+
+	t.Run("shared mismatch", func(t *testing.T) {
+		es := &segments.ExportSegment{Desc: &segments.ExportDesc{}}
+		em := &Module{IndexSpace: &IndexSpace{Memories: []*Memory{{}}}}
+		is := &segments.ImportSegment{Desc: &segments.ImportDesc{MemTypePtr: &types.MemoryType{Shared: true}}}
+		err := (&Instance{Module: &Module{IndexSpace: new(IndexSpace)}}).applyMemoryImport(is, em, es)
 		if err == nil {
 			t.Fail()
 		}
@@ -278,7 +336,8 @@ func TestModule_applyMemoryImport(t *testing.T) {
 		}
 		m := &Module{IndexSpace: new(IndexSpace)}
 		ins := &Instance{Module: m}
-		err := ins.applyMemoryImport(em, es)
+		is := &segments.ImportSegment{Desc: &segments.ImportDesc{MemTypePtr: &types.MemoryType{}}}
+		err := ins.applyMemoryImport(is, em, es)
 		if err != nil {
 			t.Fail()
 		}
@@ -337,7 +396,7 @@ func TestModule_buildGlobalIndexSpace(t *testing.T) {
 	m := &Module{
 		GlobalSection: []*segments.GlobalSegment{
 			{
-				Type: nil,
+				Type: &types.GlobalType{ValType: types.ValueTypeI64},
 				Init: &expr.Expression{
 					OpCode: expr.OpCodeI64Const,
 					Data:   []byte{0x01},
@@ -351,9 +410,14 @@ func TestModule_buildGlobalIndexSpace(t *testing.T) {
 	if err != nil {
 		t.Fail()
 	}
-	if !reflect.DeepEqual(&Global{GlobalType: nil, Val: int64(1)}, m.IndexSpace.Globals[0]) {
+	if !reflect.DeepEqual(&Global{GlobalType: &types.GlobalType{ValType: types.ValueTypeI64}, Val: int64(1)}, m.IndexSpace.Globals[0]) {
 		t.Fail()
 	}
+
+	m.GlobalSection[0].Type.ValType = types.ValueTypeI32
+	if err := ins.buildGlobalIndexSpace(); err == nil {
+		t.Error("type mismatch is not detected")
+	}
 }
 
 func TestModule_buildFunctionIndexSpace(t *testing.T) {
@@ -399,7 +463,7 @@ func TestModule_buildMemoryIndexSpace(t *testing.T) {
 	t.Run("error", func(t *testing.T) {
 		for _, m := range []*Module{
 			{DataSection: []*segments.DataSegment{{MemoryIndex: 1}}, IndexSpace: new(IndexSpace)},
-			{DataSection: []*segments.DataSegment{{MemoryIndex: 0}}, IndexSpace: &IndexSpace{
+			{DataSection: []*segments.DataSegment{{MemoryIndex: 1}}, IndexSpace: &IndexSpace{
 				Memories: []*Memory{
 					{Value: []byte{}},
 				},
@@ -421,9 +485,8 @@ func TestModule_buildMemoryIndexSpace(t *testing.T) {
 						Init: []byte{0x01, 0x02},
 					},
 				},
-				MemorySection: []*types.MemoryType{{Max: utils.Uint32Ptr(0)}},
 				IndexSpace: &IndexSpace{Memories: []*Memory{
-					{Value: []byte{}},
+					{MemoryType: types.MemoryType{Max: utils.Uint64Ptr(0)}, Value: []byte{}},
 				}},
 			},
 		} {
@@ -574,7 +637,7 @@ func TestModule_buildTableIndexSpace(t *testing.T) {
 				IndexSpace:      new(IndexSpace),
 			},
 			{
-				ElementsSection: []*segments.ElemSegment{{TableIndex: 0}},
+				ElementsSection: []*segments.ElemSegment{{TableIndex: 1}},
 				IndexSpace: &IndexSpace{Tables: []*Table{
 					{Value: []*uint32{}},
 				}},
@@ -595,11 +658,11 @@ func TestModule_buildTableIndexSpace(t *testing.T) {
 					},
 					Init: []uint32{0x0, 0x0},
 				}},
-				TableSection: []*types.TableType{{Limits: &types.Limits{
-					Max: utils.Uint32Ptr(1),
-				}}},
 				IndexSpace: &IndexSpace{Tables: []*Table{
-					{Value: []*uint32{}},
+					{
+						TableType: types.TableType{Limits: &types.Limits{Max: utils.Uint64Ptr(1)}},
+						Value:     []*uint32{},
+					},
 				}},
 			},
 		} {
@@ -736,6 +799,9 @@ func TestModule_readBlockType(t *testing.T) {
 		{bytes: []byte{0x7e}, exp: &types.FuncType{ReturnTypes: []types.ValueType{types.ValueTypeI64}}},
 		{bytes: []byte{0x7d}, exp: &types.FuncType{ReturnTypes: []types.ValueType{types.ValueTypeF32}}},
 		{bytes: []byte{0x7c}, exp: &types.FuncType{ReturnTypes: []types.ValueType{types.ValueTypeF64}}},
+		{bytes: []byte{0x7b}, exp: &types.FuncType{ReturnTypes: []types.ValueType{types.ValueTypeV128}}},
+		{bytes: []byte{0x70}, exp: &types.FuncType{ReturnTypes: []types.ValueType{types.ValueTypeFuncRef}}},
+		{bytes: []byte{0x6f}, exp: &types.FuncType{ReturnTypes: []types.ValueType{types.ValueTypeExternRef}}},
 	} {
 		actual, num, err := (&Instance{Module: &Module{}}).readBlockType(bytes.NewReader(c.bytes))
 		if err != nil {
@@ -762,268 +828,149 @@ func TestModule_readBlockType(t *testing.T) {
 	}
 }
 
-func TestModule_parseBlocks(t *testing.T) {
-	m := &Module{TypeSection: []*types.FuncType{{}, {}}}
-	for i, c := range []struct {
-		body []byte
-		exp  map[uint64]*funcBlock
-	}{
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1, 0x0, byte(expr.OpCodeEnd)},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          3,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
-		},
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeI32Load), 0x00, 0x0, byte(expr.OpCodeEnd)},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          5,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
-		},
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeI64Store32), 0x00, 0x0, byte(expr.OpCodeEnd)},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          5,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
-		},
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeMemoryGrow), 0x00, byte(expr.OpCodeEnd)},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          4,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
-		},
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeMemorySize), 0x00, byte(expr.OpCodeEnd)},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          4,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
-		},
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeI32Const), 0x02, byte(expr.OpCodeEnd)},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          4,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
-		},
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeI64Const), 0x02, byte(expr.OpCodeEnd)},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          4,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
-		},
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1,
-				byte(expr.OpCodeF32Const), 0x02, 0x02, 0x02, 0x02,
-				byte(expr.OpCodeEnd),
-			},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          7,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
-		},
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1,
-				byte(expr.OpCodeF64Const), 0x02, 0x02, 0x02, 0x02, 0x02, 0x02, 0x02, 0x02,
-				byte(expr.OpCodeEnd),
-			},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          11,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
-		},
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeLocalGet), 0x02, byte(expr.OpCodeEnd)},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          4,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
-		},
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeGlobalSet), 0x03, byte(expr.OpCodeEnd)},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          4,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
-		},
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeGlobalSet), 0x03, byte(expr.OpCodeEnd)},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          4,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
+func TestInstance_ExportedMemory(t *testing.T) {
+	mem0, mem1 := &Memory{}, &Memory{}
+	ins := &Instance{
+		Module: &Module{
+			ExportSection: map[string]*segments.ExportSegment{
+				"mem1": {Name: "mem1", Desc: &segments.ExportDesc{Kind: segments.KindMem, Index: 1}},
+				"mem2": {Name: "mem2", Desc: &segments.ExportDesc{Kind: segments.KindMem, Index: 2}},
+				"func": {Name: "func", Desc: &segments.ExportDesc{Kind: segments.KindFunction, Index: 1}},
 			},
 		},
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeBr), 0x03, byte(expr.OpCodeEnd)},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          4,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
-		},
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeBrIf), 0x03, byte(expr.OpCodeEnd)},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          4,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
-		},
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeCall), 0x03, byte(expr.OpCodeEnd)},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          4,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
-		},
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeCallIndirect), 0x03, 0x00, byte(expr.OpCodeEnd)},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          5,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
+		Memories: []*Memory{mem0, mem1},
+		Memory:   mem0,
+	}
+
+	if ins.MemoryByIndex(0) != mem0 || ins.MemoryByIndex(1) != mem1 || ins.MemoryByIndex(2) != nil {
+		t.Fail()
+	}
+
+	if mem, err := ins.ExportedMemory("mem1"); err != nil || mem != mem1 {
+		t.Fail()
+	}
+	if _, err := ins.ExportedMemory("mem2"); err != ErrMemoryIndexOutOfRange {
+		t.Fail()
+	}
+	for _, name := range []string{"func", "none"} {
+		if _, err := ins.ExportedMemory(name); err != ErrExportedMemoryNotFound {
+			t.Fail()
+		}
+	}
+}
+
+func TestNewInstance_multiMemory(t *testing.T) {
+	imported := &Memory{Value: []byte{0x01, 0x02}}
+	extern := &Module{
+		ExportSection: map[string]*segments.ExportSegment{
+			"mem": {Name: "mem", Desc: &segments.ExportDesc{Kind: segments.KindMem}},
 		},
-		{
-			body: []byte{byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeBrTable),
-				0x03, 0x01, 0x01, 0x01, 0x01, byte(expr.OpCodeEnd),
-			},
-			exp: map[uint64]*funcBlock{
-				0: {
-					StartAt:        0,
-					EndAt:          8,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
+		IndexSpace: &IndexSpace{Memories: []*Memory{imported}},
+	}
+	m := &Module{
+		ImportSection: []*segments.ImportSegment{
+			{Module: "env", Name: "mem", Desc: &segments.ImportDesc{Kind: segments.KindMem, MemTypePtr: &types.MemoryType{}}},
 		},
-		{
-			body: []byte{byte(expr.OpCodeNop),
-				byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeCallIndirect), 0x03, 0x00, byte(expr.OpCodeEnd),
-				byte(expr.OpCodeIf), 0x1, byte(expr.OpCodeLocalGet), 0x02,
-				byte(expr.OpCodeElse), byte(expr.OpCodeLocalGet), 0x02,
-				byte(expr.OpCodeEnd),
-			},
-			exp: map[uint64]*funcBlock{
-				1: {
-					StartAt:        1,
-					EndAt:          6,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-				7: {
-					StartAt:        7,
-					ElseAt:         11,
-					EndAt:          14,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
+		MemorySection: []*types.MemoryType{{Min: 1}, {Min: 2}},
+		DataSection: []*segments.DataSegment{
+			{
+				MemoryIndex:      2,
+				OffsetExpression: &expr.Expression{OpCode: expr.OpCodeI32Const, Data: []byte{0x01}},
+				Init:             []byte{0xff},
 			},
 		},
-		{
-			body: []byte{byte(expr.OpCodeNop),
-				byte(expr.OpCodeBlock), 0x1, byte(expr.OpCodeCallIndirect), 0x03, 0x00, byte(expr.OpCodeEnd),
-				byte(expr.OpCodeIf), 0x1, byte(expr.OpCodeLocalGet), 0x02,
-				byte(expr.OpCodeElse), byte(expr.OpCodeLocalGet), 0x02,
-				byte(expr.OpCodeIf), 0x01, byte(expr.OpCodeLocalGet), 0x02, byte(expr.OpCodeEnd),
-				byte(expr.OpCodeEnd),
-			},
-			exp: map[uint64]*funcBlock{
-				1: {
-					StartAt:        1,
-					EndAt:          6,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-				7: {
-					StartAt:        7,
-					ElseAt:         11,
-					EndAt:          19,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-				14: {
-					StartAt:        14,
-					EndAt:          18,
-					BlockType:      &types.FuncType{},
-					BlockTypeBytes: 1,
-				},
-			},
+		ExportSection: map[string]*segments.ExportSegment{
+			"mem2": {Name: "mem2", Desc: &segments.ExportDesc{Kind: segments.KindMem, Index: 2}},
 		},
+	}
+
+	ins, err := NewInstance(m, map[string]*Module{"env": extern})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ins.Memories) != 3 || ins.Memory != imported {
+		t.Fail()
+	}
+	if ins.Memories[1].PageSize() != 1 || ins.Memories[2].PageSize() != 2 {
+		t.Fail()
+	}
+	mem, err := ins.ExportedMemory("mem2")
+	if err != nil || mem.Value[1] != 0xff {
+		t.Fail()
+	}
+}
+
+// TestNewModule_extendedConstOffsets decodes and instantiates the segments on the offsets like the PIC,
+// which add the constant to the base from the global
+//
+//	(table 4 funcref)
+//	(memory 1)
+//	(global $memory_base i32 (i32.const 16))
+//	(global $table_base i32 (i32.const 1))
+//	(elem (offset (i32.add (global.get $table_base) (i32.const 2))) $f)
+//	(func $f)
+//	(data (offset (i32.add (global.get $memory_base) (i32.const 16))) "hi")
+func TestNewModule_extendedConstOffsets(t *testing.T) {
+	bin := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	bin = append(bin, benchSection(0x01, 0x01, 0x60, 0x00, 0x00)...)                                           // type
+	bin = append(bin, benchSection(0x03, 0x01, 0x00)...)                                                       // function
+	bin = append(bin, benchSection(0x04, 0x01, 0x70, 0x00, 0x04)...)                                           // table
+	bin = append(bin, benchSection(0x05, 0x01, 0x00, 0x01)...)                                                 // memory
+	bin = append(bin, benchSection(0x06, 0x02, 0x7f, 0x00, 0x41, 0x10, 0x0b, 0x7f, 0x00, 0x41, 0x01, 0x0b)...) // global
+	bin = append(bin, benchSection(0x09, 0x01, 0x00, 0x23, 0x01, 0x41, 0x02, 0x6a, 0x0b, 0x01, 0x00)...)       // elem
+	bin = append(bin, benchSection(0x0a, 0x01, 0x02, 0x00, 0x0b)...)                                           // code
+	bin = append(bin, benchSection(0x0b, 0x01, 0x00, 0x23, 0x00, 0x41, 0x10, 0x6a, 0x0b, 0x02, 'h', 'i')...)   // data
+
+	m, err := NewModule(config.ModuleConfig{}, bytes.NewReader(bin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins, err := NewInstance(m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ins.Memory.Value[32:34]; string(got) != "hi" {
+		t.Errorf("got data %q", got)
+	}
+	if got := ins.IndexSpace.Tables[0].Value; got[3] == nil || *got[3] != 0 || got[0] != nil {
+		t.Errorf("got elem %v", got)
+	}
+
+	t.Run("mistyped", func(t *testing.T) {
+		// the offset of the i64 on the memory of i32
+		m.DataSection[0].OffsetExpression = &expr.Expression{OpCode: expr.OpCodeI64Const, Data: []byte{0x00}}
+		if _, err := NewInstance(m, nil); err == nil {
+			t.Error("no error")
+		}
+	})
+}
+
+func TestNewInstance_tableLimit(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		min   []byte
+		limit *uint64
+		ok    bool
+	}{
+		{name: "over the limit", min: []byte{0x03}, limit: utils.Uint64Ptr(2)},
+		{name: "within the limit", min: []byte{0x03}, limit: utils.Uint64Ptr(3), ok: true},
+		{name: "over the default", min: []byte{0x81, 0xad, 0xe2, 0x04}}, // 10000001
 	} {
-		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			actual, err := (&Instance{Module: m}).parseBlocks(c.body)
+		t.Run(c.name, func(t *testing.T) {
+			bin := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+			bin = append(bin, benchSection(0x04, append([]byte{0x01, 0x70, 0x00}, c.min...)...)...)
+			m, err := NewModule(config.ModuleConfig{TableLimit: c.limit}, bytes.NewReader(bin))
 			if err != nil {
-				t.Fail()
+				t.Fatal(err)
 			}
-			if !reflect.DeepEqual(c.exp, actual) {
-				t.Fail()
+
+			ins, err := NewInstance(m, nil)
+			if (err == nil) != c.ok {
+				t.Fatalf("got %v", err)
+			}
+			if c.ok && len(ins.IndexSpace.Tables[0].Value) != 3 {
+				t.Errorf("got %d elements", len(ins.IndexSpace.Tables[0].Value))
 			}
 		})
 	}
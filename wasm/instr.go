@@ -7,184 +7,539 @@ import (
 
 // Frame is the context data of one instance
 type Frame struct {
-	PC         uint64
+	PC         uint64 // the index of the active instruction in the compiled code of the func
 	Func       *wasmFunc
 	Locals     []uint64
+	LocalsHigh []uint64 // the high halves of the v128 locals, nil when the func has no v128 local
 	LabelStack *stacks.Stack[*stacks.Label]
+
+	high []uint64 // the buffer of the LocalsHigh, kept for the next func on the same depth
 }
 
 // instructions are basic wasm instructions
 var instructions = [256]func(ins *Instance) error{
-	expr.OpCodeUnreachable:       unreachable,
-	expr.OpCodeNop:               nop,
-	expr.OpCodeBlock:             block,
-	expr.OpCodeLoop:              loop,
-	expr.OpCodeIf:                ifOp,
-	expr.OpCodeElse:              elseOp,
-	expr.OpCodeEnd:               end,
-	expr.OpCodeBr:                br,
-	expr.OpCodeBrIf:              brIf,
-	expr.OpCodeBrTable:           brTable,
-	expr.OpCodeReturn:            nop,
-	expr.OpCodeCall:              call,
-	expr.OpCodeCallIndirect:      callIndirect,
-	expr.OpCodeDrop:              drop,
-	expr.OpCodeSelect:            selectOp,
-	expr.OpCodeLocalGet:          getLocal,
-	expr.OpCodeLocalSet:          setLocal,
-	expr.OpCodeLocalTee:          teeLocal,
-	expr.OpCodeGlobalGet:         getGlobal,
-	expr.OpCodeGlobalSet:         setGlobal,
-	expr.OpCodeI32Load:           i32Load,
-	expr.OpCodeI64Load:           i64Load,
-	expr.OpCodeF32Load:           f32Load,
-	expr.OpCodeF64Load:           f64Load,
-	expr.OpCodeI32Load8s:         i32Load8s,
-	expr.OpCodeI32Load8u:         i32Load8u,
-	expr.OpCodeI32Load16s:        i32Load16s,
-	expr.OpCodeI32Load16u:        i32Load16u,
-	expr.OpCodeI64Load8s:         i64Load8s,
-	expr.OpCodeI64Load8u:         i64Load8u,
-	expr.OpCodeI64Load16s:        i64Load16s,
-	expr.OpCodeI64Load16u:        i64Load16u,
-	expr.OpCodeI64Load32s:        i64Load32s,
-	expr.OpCodeI64Load32u:        i64Load32u,
-	expr.OpCodeI32Store:          i32Store,
-	expr.OpCodeI64Store:          i64Store,
-	expr.OpCodeF32Store:          f32Store,
-	expr.OpCodeF64Store:          f64Store,
-	expr.OpCodeI32Store8:         i32Store8,
-	expr.OpCodeI32Store16:        i32Store16,
-	expr.OpCodeI64Store8:         i64Store8,
-	expr.OpCodeI64Store16:        i64Store16,
-	expr.OpCodeI64Store32:        i64Store32,
-	expr.OpCodeMemorySize:        memorySize,
-	expr.OpCodeMemoryGrow:        memoryGrow,
-	expr.OpCodeI32Const:          i32Const,
-	expr.OpCodeI64Const:          i64Const,
-	expr.OpCodeF32Const:          f32Const,
-	expr.OpCodeF64Const:          f64Const,
-	expr.OpCodeI32Eqz:            i32eqz,
-	expr.OpCodeI32Eq:             i32eq,
-	expr.OpCodeI32Ne:             i32ne,
-	expr.OpCodeI32LtS:            i32lts,
-	expr.OpCodeI32LtU:            i32ltu,
-	expr.OpCodeI32GtS:            i32gts,
-	expr.OpCodeI32GtU:            i32gtu,
-	expr.OpCodeI32LeS:            i32les,
-	expr.OpCodeI32LeU:            i32leu,
-	expr.OpCodeI32GeS:            i32ges,
-	expr.OpCodeI32GeU:            i32geu,
-	expr.OpCodeI64Eqz:            i64eqz,
-	expr.OpCodeI64Eq:             i64eq,
-	expr.OpCodeI64Ne:             i64ne,
-	expr.OpCodeI64LtS:            i64lts,
-	expr.OpCodeI64LtU:            i64ltu,
-	expr.OpCodeI64GtS:            i64gts,
-	expr.OpCodeI64GtU:            i64gtu,
-	expr.OpCodeI64LeS:            i64les,
-	expr.OpCodeI64LeU:            i64leu,
-	expr.OpCodeI64GeS:            i64ges,
-	expr.OpCodeI64GeU:            i64geu,
-	expr.OpCodeF32Eq:             f32eq,
-	expr.OpCodeF32Ne:             f32ne,
-	expr.OpCodeF32Lt:             f32lt,
-	expr.OpCodeF32Gt:             f32gt,
-	expr.OpCodeF32Le:             f32le,
-	expr.OpCodeF32Ge:             f32ge,
-	expr.OpCodeF64Eq:             f64eq,
-	expr.OpCodeF64Ne:             f64ne,
-	expr.OpCodeF64Lt:             f64lt,
-	expr.OpCodeF64Gt:             f64gt,
-	expr.OpCodeF64Le:             f64le,
-	expr.OpCodeF64Ge:             f64ge,
-	expr.OpCodeI32Clz:            i32clz,
-	expr.OpCodeI32Ctz:            i32ctz,
-	expr.OpCodeI32PopCnt:         i32popcnt,
-	expr.OpCodeI32Add:            i32add,
-	expr.OpCodeI32Sub:            i32sub,
-	expr.OpCodeI32Mul:            i32mul,
-	expr.OpCodeI32DivS:           i32divs,
-	expr.OpCodeI32DivU:           i32divu,
-	expr.OpCodeI32RemS:           i32rems,
-	expr.OpCodeI32RemU:           i32remu,
-	expr.OpCodeI32And:            i32and,
-	expr.OpCodeI32Or:             i32or,
-	expr.OpCodeI32Xor:            i32xor,
-	expr.OpCodeI32Shl:            i32shl,
-	expr.OpCodeI32ShrS:           i32shrs,
-	expr.OpCodeI32ShrU:           i32shru,
-	expr.OpCodeI32RotL:           i32rotl,
-	expr.OpCodeI32RotR:           i32rotr,
-	expr.OpCodeI64Clz:            i64clz,
-	expr.OpCodeI64Ctz:            i64ctz,
-	expr.OpCodeI64PopCnt:         i64popcnt,
-	expr.OpCodeI64Add:            i64add,
-	expr.OpCodeI64Sub:            i64sub,
-	expr.OpCodeI64Mul:            i64mul,
-	expr.OpCodeI64DivS:           i64divs,
-	expr.OpCodeI64DivU:           i64divu,
-	expr.OpCodeI64RemS:           i64rems,
-	expr.OpCodeI64RemU:           i64remu,
-	expr.OpCodeI64And:            i64and,
-	expr.OpCodeI64Or:             i64or,
-	expr.OpCodeI64Xor:            i64xor,
-	expr.OpCodeI64Shl:            i64shl,
-	expr.OpCodeI64ShrS:           i64shrs,
-	expr.OpCodeI64ShrU:           i64shru,
-	expr.OpCodeI64RotL:           i64rotl,
-	expr.OpCodeI64RotR:           i64rotr,
-	expr.OpCodeF32Abs:            f32abs,
-	expr.OpCodeF32Neg:            f32neg,
-	expr.OpCodeF32Ceil:           f32ceil,
-	expr.OpCodeF32Floor:          f32floor,
-	expr.OpCodeF32Trunc:          f32trunc,
-	expr.OpCodeF32Nearest:        f32nearest,
-	expr.OpCodeF32Sqrt:           f32sqrt,
-	expr.OpCodeF32Add:            f32add,
-	expr.OpCodeF32Sub:            f32sub,
-	expr.OpCodeF32Mul:            f32mul,
-	expr.OpCodeF32Div:            f32div,
-	expr.OpCodeF32Min:            f32min,
-	expr.OpCodeF32Max:            f32max,
-	expr.OpCodeF32CopySign:       f32copysign,
-	expr.OpCodeF64Abs:            f64abs,
-	expr.OpCodeF64Neg:            f64neg,
-	expr.OpCodeF64Ceil:           f64ceil,
-	expr.OpCodeF64Floor:          f64floor,
-	expr.OpCodeF64Trunc:          f64trunc,
-	expr.OpCodeF64Nearest:        f64nearest,
-	expr.OpCodeF64Sqrt:           f64sqrt,
-	expr.OpCodeF64Add:            f64add,
-	expr.OpCodeF64Sub:            f64sub,
-	expr.OpCodeF64Mul:            f64mul,
-	expr.OpCodeF64Div:            f64div,
-	expr.OpCodeF64Min:            f64min,
-	expr.OpCodeF64Max:            f64max,
-	expr.OpCodeF64CopySign:       f64copysign,
-	expr.OpCodeI32WrapI64:        i32wrapi64,
-	expr.OpCodeI32TruncF32S:      i32truncf32s,
-	expr.OpCodeI32TruncF32U:      i32truncf32u,
-	expr.OpCodeI32truncF64S:      i32truncf64s,
-	expr.OpCodeI32truncF64U:      i32truncf64u,
-	expr.OpCodeI64ExtendI32S:     i64extendi32s,
-	expr.OpCodeI64ExtendI32U:     i64extendi32u,
-	expr.OpCodeI64TruncF32S:      i64truncf32s,
-	expr.OpCodeI64TruncF32U:      i64truncf32u,
-	expr.OpCodeI64TruncF64S:      i64truncf64s,
-	expr.OpCodeI64TruncF64U:      i64truncf64u,
-	expr.OpCodeF32ConvertI32S:    f32converti32s,
-	expr.OpCodeF32ConvertI32U:    f32converti32u,
-	expr.OpCodeF32ConvertI64S:    f32converti64s,
-	expr.OpCodeF32ConvertI64U:    f32converti64u,
-	expr.OpCodeF32DemoteF64:      f32demotef64,
-	expr.OpCodeF64ConvertI32S:    f64converti32s,
-	expr.OpCodeF64ConvertI32U:    f64converti32u,
-	expr.OpCodeF64ConvertI64S:    f64converti64s,
-	expr.OpCodeF64ConvertI64U:    f64converti64u,
-	expr.OpCodeF64PromoteF32:     f64promotef32,
-	expr.OpCodeI32ReinterpretF32: nop,
-	expr.OpCodeI64ReinterpretF64: nop,
-	expr.OpCodeF32ReinterpretI32: nop,
-	expr.OpCodeF64ReinterpretI64: nop,
+	expr.OpCodeUnreachable:        unreachable,
+	expr.OpCodeNop:                nop,
+	expr.OpCodeBlock:              block,
+	expr.OpCodeLoop:               loop,
+	expr.OpCodeIf:                 ifOp,
+	expr.OpCodeElse:               elseOp,
+	expr.OpCodeEnd:                end,
+	expr.OpCodeBr:                 br,
+	expr.OpCodeBrIf:               brIf,
+	expr.OpCodeBrTable:            brTable,
+	expr.OpCodeReturn:             nop,
+	expr.OpCodeCall:               call,
+	expr.OpCodeCallIndirect:       callIndirect,
+	expr.OpCodeReturnCall:         returnCall,
+	expr.OpCodeReturnCallIndirect: returnCallIndirect,
+	expr.OpCodeThrow:              throw,
+	expr.OpCodeThrowRef:           throwRef,
+	expr.OpCodeTryTable:           tryTable,
+	expr.OpCodeDrop:               drop,
+	expr.OpCodeSelect:             selectOp,
+	expr.OpCodeLocalGet:           getLocal,
+	expr.OpCodeLocalSet:           setLocal,
+	expr.OpCodeLocalTee:           teeLocal,
+	expr.OpCodeGlobalGet:          getGlobal,
+	expr.OpCodeGlobalSet:          setGlobal,
+	expr.OpCodeI32Load:            i32Load,
+	expr.OpCodeI64Load:            i64Load,
+	expr.OpCodeF32Load:            f32Load,
+	expr.OpCodeF64Load:            f64Load,
+	expr.OpCodeI32Load8s:          i32Load8s,
+	expr.OpCodeI32Load8u:          i32Load8u,
+	expr.OpCodeI32Load16s:         i32Load16s,
+	expr.OpCodeI32Load16u:         i32Load16u,
+	expr.OpCodeI64Load8s:          i64Load8s,
+	expr.OpCodeI64Load8u:          i64Load8u,
+	expr.OpCodeI64Load16s:         i64Load16s,
+	expr.OpCodeI64Load16u:         i64Load16u,
+	expr.OpCodeI64Load32s:         i64Load32s,
+	expr.OpCodeI64Load32u:         i64Load32u,
+	expr.OpCodeI32Store:           i32Store,
+	expr.OpCodeI64Store:           i64Store,
+	expr.OpCodeF32Store:           f32Store,
+	expr.OpCodeF64Store:           f64Store,
+	expr.OpCodeI32Store8:          i32Store8,
+	expr.OpCodeI32Store16:         i32Store16,
+	expr.OpCodeI64Store8:          i64Store8,
+	expr.OpCodeI64Store16:         i64Store16,
+	expr.OpCodeI64Store32:         i64Store32,
+	expr.OpCodeMemorySize:         memorySize,
+	expr.OpCodeMemoryGrow:         memoryGrow,
+	expr.OpCodeI32Const:           i32Const,
+	expr.OpCodeI64Const:           i64Const,
+	expr.OpCodeF32Const:           f32Const,
+	expr.OpCodeF64Const:           f64Const,
+	expr.OpCodeI32Eqz:             i32eqz,
+	expr.OpCodeI32Eq:              i32eq,
+	expr.OpCodeI32Ne:              i32ne,
+	expr.OpCodeI32LtS:             i32lts,
+	expr.OpCodeI32LtU:             i32ltu,
+	expr.OpCodeI32GtS:             i32gts,
+	expr.OpCodeI32GtU:             i32gtu,
+	expr.OpCodeI32LeS:             i32les,
+	expr.OpCodeI32LeU:             i32leu,
+	expr.OpCodeI32GeS:             i32ges,
+	expr.OpCodeI32GeU:             i32geu,
+	expr.OpCodeI64Eqz:             i64eqz,
+	expr.OpCodeI64Eq:              i64eq,
+	expr.OpCodeI64Ne:              i64ne,
+	expr.OpCodeI64LtS:             i64lts,
+	expr.OpCodeI64LtU:             i64ltu,
+	expr.OpCodeI64GtS:             i64gts,
+	expr.OpCodeI64GtU:             i64gtu,
+	expr.OpCodeI64LeS:             i64les,
+	expr.OpCodeI64LeU:             i64leu,
+	expr.OpCodeI64GeS:             i64ges,
+	expr.OpCodeI64GeU:             i64geu,
+	expr.OpCodeF32Eq:              f32eq,
+	expr.OpCodeF32Ne:              f32ne,
+	expr.OpCodeF32Lt:              f32lt,
+	expr.OpCodeF32Gt:              f32gt,
+	expr.OpCodeF32Le:              f32le,
+	expr.OpCodeF32Ge:              f32ge,
+	expr.OpCodeF64Eq:              f64eq,
+	expr.OpCodeF64Ne:              f64ne,
+	expr.OpCodeF64Lt:              f64lt,
+	expr.OpCodeF64Gt:              f64gt,
+	expr.OpCodeF64Le:              f64le,
+	expr.OpCodeF64Ge:              f64ge,
+	expr.OpCodeI32Clz:             i32clz,
+	expr.OpCodeI32Ctz:             i32ctz,
+	expr.OpCodeI32PopCnt:          i32popcnt,
+	expr.OpCodeI32Add:             i32add,
+	expr.OpCodeI32Sub:             i32sub,
+	expr.OpCodeI32Mul:             i32mul,
+	expr.OpCodeI32DivS:            i32divs,
+	expr.OpCodeI32DivU:            i32divu,
+	expr.OpCodeI32RemS:            i32rems,
+	expr.OpCodeI32RemU:            i32remu,
+	expr.OpCodeI32And:             i32and,
+	expr.OpCodeI32Or:              i32or,
+	expr.OpCodeI32Xor:             i32xor,
+	expr.OpCodeI32Shl:             i32shl,
+	expr.OpCodeI32ShrS:            i32shrs,
+	expr.OpCodeI32ShrU:            i32shru,
+	expr.OpCodeI32RotL:            i32rotl,
+	expr.OpCodeI32RotR:            i32rotr,
+	expr.OpCodeI64Clz:             i64clz,
+	expr.OpCodeI64Ctz:             i64ctz,
+	expr.OpCodeI64PopCnt:          i64popcnt,
+	expr.OpCodeI64Add:             i64add,
+	expr.OpCodeI64Sub:             i64sub,
+	expr.OpCodeI64Mul:             i64mul,
+	expr.OpCodeI64DivS:            i64divs,
+	expr.OpCodeI64DivU:            i64divu,
+	expr.OpCodeI64RemS:            i64rems,
+	expr.OpCodeI64RemU:            i64remu,
+	expr.OpCodeI64And:             i64and,
+	expr.OpCodeI64Or:              i64or,
+	expr.OpCodeI64Xor:             i64xor,
+	expr.OpCodeI64Shl:             i64shl,
+	expr.OpCodeI64ShrS:            i64shrs,
+	expr.OpCodeI64ShrU:            i64shru,
+	expr.OpCodeI64RotL:            i64rotl,
+	expr.OpCodeI64RotR:            i64rotr,
+	expr.OpCodeF32Abs:             f32abs,
+	expr.OpCodeF32Neg:             f32neg,
+	expr.OpCodeF32Ceil:            f32ceil,
+	expr.OpCodeF32Floor:           f32floor,
+	expr.OpCodeF32Trunc:           f32trunc,
+	expr.OpCodeF32Nearest:         f32nearest,
+	expr.OpCodeF32Sqrt:            f32sqrt,
+	expr.OpCodeF32Add:             f32add,
+	expr.OpCodeF32Sub:             f32sub,
+	expr.OpCodeF32Mul:             f32mul,
+	expr.OpCodeF32Div:             f32div,
+	expr.OpCodeF32Min:             f32min,
+	expr.OpCodeF32Max:             f32max,
+	expr.OpCodeF32CopySign:        f32copysign,
+	expr.OpCodeF64Abs:             f64abs,
+	expr.OpCodeF64Neg:             f64neg,
+	expr.OpCodeF64Ceil:            f64ceil,
+	expr.OpCodeF64Floor:           f64floor,
+	expr.OpCodeF64Trunc:           f64trunc,
+	expr.OpCodeF64Nearest:         f64nearest,
+	expr.OpCodeF64Sqrt:            f64sqrt,
+	expr.OpCodeF64Add:             f64add,
+	expr.OpCodeF64Sub:             f64sub,
+	expr.OpCodeF64Mul:             f64mul,
+	expr.OpCodeF64Div:             f64div,
+	expr.OpCodeF64Min:             f64min,
+	expr.OpCodeF64Max:             f64max,
+	expr.OpCodeF64CopySign:        f64copysign,
+	expr.OpCodeI32WrapI64:         i32wrapi64,
+	expr.OpCodeI32TruncF32S:       i32truncf32s,
+	expr.OpCodeI32TruncF32U:       i32truncf32u,
+	expr.OpCodeI32truncF64S:       i32truncf64s,
+	expr.OpCodeI32truncF64U:       i32truncf64u,
+	expr.OpCodeI64ExtendI32S:      i64extendi32s,
+	expr.OpCodeI64ExtendI32U:      i64extendi32u,
+	expr.OpCodeI64TruncF32S:       i64truncf32s,
+	expr.OpCodeI64TruncF32U:       i64truncf32u,
+	expr.OpCodeI64TruncF64S:       i64truncf64s,
+	expr.OpCodeI64TruncF64U:       i64truncf64u,
+	expr.OpCodeF32ConvertI32S:     f32converti32s,
+	expr.OpCodeF32ConvertI32U:     f32converti32u,
+	expr.OpCodeF32ConvertI64S:     f32converti64s,
+	expr.OpCodeF32ConvertI64U:     f32converti64u,
+	expr.OpCodeF32DemoteF64:       f32demotef64,
+	expr.OpCodeF64ConvertI32S:     f64converti32s,
+	expr.OpCodeF64ConvertI32U:     f64converti32u,
+	expr.OpCodeF64ConvertI64S:     f64converti64s,
+	expr.OpCodeF64ConvertI64U:     f64converti64u,
+	expr.OpCodeF64PromoteF32:      f64promotef32,
+	expr.OpCodeI32ReinterpretF32:  nop,
+	expr.OpCodeI64ReinterpretF64:  nop,
+	expr.OpCodeF32ReinterpretI32:  nop,
+	expr.OpCodeF64ReinterpretI64:  nop,
+	expr.OpCodeI32Extend8S:        i32extend8s,
+	expr.OpCodeI32Extend16S:       i32extend16s,
+	expr.OpCodeI64Extend8S:        i64extend8s,
+	expr.OpCodeI64Extend16S:       i64extend16s,
+	expr.OpCodeI64Extend32S:       i64extend32s,
+	expr.OpCodeSelectT:            selectOp,
+	expr.OpCodeTableGet:           tableGet,
+	expr.OpCodeTableSet:           tableSet,
+	expr.OpCodeNull:               refNullOp,
+	expr.OpCodeIsNull:             refIsNull,
+	expr.OpCodeFunc:               refFunc,
+}
+
+// miscInstructions are the instructions prefixed by expr.OpCodeMiscPrefix, resolved by the sub opcode on compiling
+var miscInstructions = [...]func(ins *Instance) error{
+	expr.OpCodeI32TruncSatF32S: i32truncsatf32s,
+	expr.OpCodeI32TruncSatF32U: i32truncsatf32u,
+	expr.OpCodeI32TruncSatF64S: i32truncsatf64s,
+	expr.OpCodeI32TruncSatF64U: i32truncsatf64u,
+	expr.OpCodeI64TruncSatF32S: i64truncsatf32s,
+	expr.OpCodeI64TruncSatF32U: i64truncsatf32u,
+	expr.OpCodeI64TruncSatF64S: i64truncsatf64s,
+	expr.OpCodeI64TruncSatF64U: i64truncsatf64u,
+	expr.OpCodeMemoryInit:      memoryInit,
+	expr.OpCodeDataDrop:        dataDrop,
+	expr.OpCodeMemoryCopy:      memoryCopy,
+	expr.OpCodeMemoryFill:      memoryFill,
+	expr.OpCodeTableInit:       tableInit,
+	expr.OpCodeElemDrop:        elemDrop,
+	expr.OpCodeTableCopy:       tableCopy,
+	expr.OpCodeTableGrow:       tableGrow,
+	expr.OpCodeTableSize:       tableSize,
+	expr.OpCodeTableFill:       tableFill,
+}
+
+// simdInstructions are the instructions prefixed by expr.OpCodeSIMDPrefix, resolved by the sub opcode on compiling
+var simdInstructions = [...]func(ins *Instance) error{
+	expr.OpCodeV128Load:                  v128Load,
+	expr.OpCodeV128Load8x8S:              v128LoadExtend[int8, int16],
+	expr.OpCodeV128Load8x8U:              v128LoadExtend[uint8, uint16],
+	expr.OpCodeV128Load16x4S:             v128LoadExtend[int16, int32],
+	expr.OpCodeV128Load16x4U:             v128LoadExtend[uint16, uint32],
+	expr.OpCodeV128Load32x2S:             v128LoadExtend[int32, int64],
+	expr.OpCodeV128Load32x2U:             v128LoadExtend[uint32, uint64],
+	expr.OpCodeV128Load8Splat:            v128LoadSplat[uint8],
+	expr.OpCodeV128Load16Splat:           v128LoadSplat[uint16],
+	expr.OpCodeV128Load32Splat:           v128LoadSplat[uint32],
+	expr.OpCodeV128Load64Splat:           v128LoadSplat[uint64],
+	expr.OpCodeV128Store:                 v128Store,
+	expr.OpCodeV128Const:                 v128Const,
+	expr.OpCodeI8x16Shuffle:              i8x16Shuffle,
+	expr.OpCodeI8x16Swizzle:              i8x16Swizzle,
+	expr.OpCodeI8x16Splat:                splat(i32ToLane[int8]),
+	expr.OpCodeI16x8Splat:                splat(i32ToLane[int16]),
+	expr.OpCodeI32x4Splat:                splat(i32ToLane[int32]),
+	expr.OpCodeI64x2Splat:                splat(i64ToLane),
+	expr.OpCodeF32x4Splat:                splat(f32ToLane),
+	expr.OpCodeF64x2Splat:                splat(f64ToLane),
+	expr.OpCodeI8x16ExtractLaneS:         extractLane(laneToI32[int8]),
+	expr.OpCodeI8x16ExtractLaneU:         extractLane(laneToI32[uint8]),
+	expr.OpCodeI8x16ReplaceLane:          replaceLane(i32ToLane[int8]),
+	expr.OpCodeI16x8ExtractLaneS:         extractLane(laneToI32[int16]),
+	expr.OpCodeI16x8ExtractLaneU:         extractLane(laneToI32[uint16]),
+	expr.OpCodeI16x8ReplaceLane:          replaceLane(i32ToLane[int16]),
+	expr.OpCodeI32x4ExtractLane:          extractLane(laneToI32[int32]),
+	expr.OpCodeI32x4ReplaceLane:          replaceLane(i32ToLane[int32]),
+	expr.OpCodeI64x2ExtractLane:          extractLane(laneToI64),
+	expr.OpCodeI64x2ReplaceLane:          replaceLane(i64ToLane),
+	expr.OpCodeF32x4ExtractLane:          extractLane(laneToF32),
+	expr.OpCodeF32x4ReplaceLane:          replaceLane(f32ToLane),
+	expr.OpCodeF64x2ExtractLane:          extractLane(laneToF64),
+	expr.OpCodeF64x2ReplaceLane:          replaceLane(f64ToLane),
+	expr.OpCodeI8x16Eq:                   compareLanes[int8, uint8](laneEq[int8]),
+	expr.OpCodeI8x16Ne:                   compareLanes[int8, uint8](laneNe[int8]),
+	expr.OpCodeI8x16LtS:                  compareLanes[int8, uint8](laneLt[int8]),
+	expr.OpCodeI8x16LtU:                  compareLanes[uint8, uint8](laneLt[uint8]),
+	expr.OpCodeI8x16GtS:                  compareLanes[int8, uint8](laneGt[int8]),
+	expr.OpCodeI8x16GtU:                  compareLanes[uint8, uint8](laneGt[uint8]),
+	expr.OpCodeI8x16LeS:                  compareLanes[int8, uint8](laneLe[int8]),
+	expr.OpCodeI8x16LeU:                  compareLanes[uint8, uint8](laneLe[uint8]),
+	expr.OpCodeI8x16GeS:                  compareLanes[int8, uint8](laneGe[int8]),
+	expr.OpCodeI8x16GeU:                  compareLanes[uint8, uint8](laneGe[uint8]),
+	expr.OpCodeI16x8Eq:                   compareLanes[int16, uint16](laneEq[int16]),
+	expr.OpCodeI16x8Ne:                   compareLanes[int16, uint16](laneNe[int16]),
+	expr.OpCodeI16x8LtS:                  compareLanes[int16, uint16](laneLt[int16]),
+	expr.OpCodeI16x8LtU:                  compareLanes[uint16, uint16](laneLt[uint16]),
+	expr.OpCodeI16x8GtS:                  compareLanes[int16, uint16](laneGt[int16]),
+	expr.OpCodeI16x8GtU:                  compareLanes[uint16, uint16](laneGt[uint16]),
+	expr.OpCodeI16x8LeS:                  compareLanes[int16, uint16](laneLe[int16]),
+	expr.OpCodeI16x8LeU:                  compareLanes[uint16, uint16](laneLe[uint16]),
+	expr.OpCodeI16x8GeS:                  compareLanes[int16, uint16](laneGe[int16]),
+	expr.OpCodeI16x8GeU:                  compareLanes[uint16, uint16](laneGe[uint16]),
+	expr.OpCodeI32x4Eq:                   compareLanes[int32, uint32](laneEq[int32]),
+	expr.OpCodeI32x4Ne:                   compareLanes[int32, uint32](laneNe[int32]),
+	expr.OpCodeI32x4LtS:                  compareLanes[int32, uint32](laneLt[int32]),
+	expr.OpCodeI32x4LtU:                  compareLanes[uint32, uint32](laneLt[uint32]),
+	expr.OpCodeI32x4GtS:                  compareLanes[int32, uint32](laneGt[int32]),
+	expr.OpCodeI32x4GtU:                  compareLanes[uint32, uint32](laneGt[uint32]),
+	expr.OpCodeI32x4LeS:                  compareLanes[int32, uint32](laneLe[int32]),
+	expr.OpCodeI32x4LeU:                  compareLanes[uint32, uint32](laneLe[uint32]),
+	expr.OpCodeI32x4GeS:                  compareLanes[int32, uint32](laneGe[int32]),
+	expr.OpCodeI32x4GeU:                  compareLanes[uint32, uint32](laneGe[uint32]),
+	expr.OpCodeF32x4Eq:                   compareLanes[float32, uint32](laneEq[float32]),
+	expr.OpCodeF32x4Ne:                   compareLanes[float32, uint32](laneNe[float32]),
+	expr.OpCodeF32x4Lt:                   compareLanes[float32, uint32](laneLt[float32]),
+	expr.OpCodeF32x4Gt:                   compareLanes[float32, uint32](laneGt[float32]),
+	expr.OpCodeF32x4Le:                   compareLanes[float32, uint32](laneLe[float32]),
+	expr.OpCodeF32x4Ge:                   compareLanes[float32, uint32](laneGe[float32]),
+	expr.OpCodeF64x2Eq:                   compareLanes[float64, uint64](laneEq[float64]),
+	expr.OpCodeF64x2Ne:                   compareLanes[float64, uint64](laneNe[float64]),
+	expr.OpCodeF64x2Lt:                   compareLanes[float64, uint64](laneLt[float64]),
+	expr.OpCodeF64x2Gt:                   compareLanes[float64, uint64](laneGt[float64]),
+	expr.OpCodeF64x2Le:                   compareLanes[float64, uint64](laneLe[float64]),
+	expr.OpCodeF64x2Ge:                   compareLanes[float64, uint64](laneGe[float64]),
+	expr.OpCodeV128Not:                   v128Not,
+	expr.OpCodeV128And:                   v128And,
+	expr.OpCodeV128Andnot:                v128AndNot,
+	expr.OpCodeV128Or:                    v128Or,
+	expr.OpCodeV128Xor:                   v128Xor,
+	expr.OpCodeV128Bitselect:             v128BitSelect,
+	expr.OpCodeV128AnyTrue:               v128AnyTrue,
+	expr.OpCodeV128Load8Lane:             v128LoadLane[uint8],
+	expr.OpCodeV128Load16Lane:            v128LoadLane[uint16],
+	expr.OpCodeV128Load32Lane:            v128LoadLane[uint32],
+	expr.OpCodeV128Load64Lane:            v128LoadLane[uint64],
+	expr.OpCodeV128Store8Lane:            v128StoreLane[uint8],
+	expr.OpCodeV128Store16Lane:           v128StoreLane[uint16],
+	expr.OpCodeV128Store32Lane:           v128StoreLane[uint32],
+	expr.OpCodeV128Store64Lane:           v128StoreLane[uint64],
+	expr.OpCodeV128Load32Zero:            v128LoadZero[uint32],
+	expr.OpCodeV128Load64Zero:            v128LoadZero[uint64],
+	expr.OpCodeF32x4DemoteF64x2Zero:      f32x4DemoteF64x2Zero,
+	expr.OpCodeF64x2PromoteLowF32x4:      f64x2PromoteLowF32x4,
+	expr.OpCodeI8x16Abs:                  lanewiseUnary(laneAbs[int8]),
+	expr.OpCodeI8x16Neg:                  lanewiseUnary(laneNeg[int8]),
+	expr.OpCodeI8x16Popcnt:               lanewiseUnary(lanePopcnt),
+	expr.OpCodeI8x16AllTrue:              allTrue[uint8],
+	expr.OpCodeI8x16Bitmask:              bitmask[int8],
+	expr.OpCodeI8x16NarrowI16x8S:         narrow[int16, int8],
+	expr.OpCodeI8x16NarrowI16x8U:         narrow[int16, uint8],
+	expr.OpCodeF32x4Ceil:                 lanewiseUnary(laneCeil[float32]),
+	expr.OpCodeF32x4Floor:                lanewiseUnary(laneFloor[float32]),
+	expr.OpCodeF32x4Trunc:                lanewiseUnary(laneTrunc[float32]),
+	expr.OpCodeF32x4Nearest:              lanewiseUnary(laneNearest[float32]),
+	expr.OpCodeI8x16Shl:                  shiftLanes(laneShl[uint8]),
+	expr.OpCodeI8x16ShrS:                 shiftLanes(laneShr[int8]),
+	expr.OpCodeI8x16ShrU:                 shiftLanes(laneShr[uint8]),
+	expr.OpCodeI8x16Add:                  lanewiseBinary(laneAdd[uint8]),
+	expr.OpCodeI8x16AddSatS:              lanewiseBinary(laneAddSat[int8]),
+	expr.OpCodeI8x16AddSatU:              lanewiseBinary(laneAddSat[uint8]),
+	expr.OpCodeI8x16Sub:                  lanewiseBinary(laneSub[uint8]),
+	expr.OpCodeI8x16SubSatS:              lanewiseBinary(laneSubSat[int8]),
+	expr.OpCodeI8x16SubSatU:              lanewiseBinary(laneSubSat[uint8]),
+	expr.OpCodeF64x2Ceil:                 lanewiseUnary(laneCeil[float64]),
+	expr.OpCodeF64x2Floor:                lanewiseUnary(laneFloor[float64]),
+	expr.OpCodeI8x16MinS:                 lanewiseBinary(laneMin[int8]),
+	expr.OpCodeI8x16MinU:                 lanewiseBinary(laneMin[uint8]),
+	expr.OpCodeI8x16MaxS:                 lanewiseBinary(laneMax[int8]),
+	expr.OpCodeI8x16MaxU:                 lanewiseBinary(laneMax[uint8]),
+	expr.OpCodeF64x2Trunc:                lanewiseUnary(laneTrunc[float64]),
+	expr.OpCodeI8x16AvgrU:                lanewiseBinary(laneAvgr[uint8]),
+	expr.OpCodeI16x8ExtaddPairwiseI8x16S: extAddPairwise[int8, int16],
+	expr.OpCodeI16x8ExtaddPairwiseI8x16U: extAddPairwise[uint8, uint16],
+	expr.OpCodeI32x4ExtaddPairwiseI16x8S: extAddPairwise[int16, int32],
+	expr.OpCodeI32x4ExtaddPairwiseI16x8U: extAddPairwise[uint16, uint32],
+	expr.OpCodeI16x8Abs:                  lanewiseUnary(laneAbs[int16]),
+	expr.OpCodeI16x8Neg:                  lanewiseUnary(laneNeg[int16]),
+	expr.OpCodeI16x8Q15mulrSatS:          lanewiseBinary(laneQ15MulrSat),
+	expr.OpCodeI16x8AllTrue:              allTrue[uint16],
+	expr.OpCodeI16x8Bitmask:              bitmask[int16],
+	expr.OpCodeI16x8NarrowI32x4S:         narrow[int32, int16],
+	expr.OpCodeI16x8NarrowI32x4U:         narrow[int32, uint16],
+	expr.OpCodeI16x8ExtendLowI8x16S:      extend[int8, int16](false),
+	expr.OpCodeI16x8ExtendHighI8x16S:     extend[int8, int16](true),
+	expr.OpCodeI16x8ExtendLowI8x16U:      extend[uint8, uint16](false),
+	expr.OpCodeI16x8ExtendHighI8x16U:     extend[uint8, uint16](true),
+	expr.OpCodeI16x8Shl:                  shiftLanes(laneShl[uint16]),
+	expr.OpCodeI16x8ShrS:                 shiftLanes(laneShr[int16]),
+	expr.OpCodeI16x8ShrU:                 shiftLanes(laneShr[uint16]),
+	expr.OpCodeI16x8Add:                  lanewiseBinary(laneAdd[uint16]),
+	expr.OpCodeI16x8AddSatS:              lanewiseBinary(laneAddSat[int16]),
+	expr.OpCodeI16x8AddSatU:              lanewiseBinary(laneAddSat[uint16]),
+	expr.OpCodeI16x8Sub:                  lanewiseBinary(laneSub[uint16]),
+	expr.OpCodeI16x8SubSatS:              lanewiseBinary(laneSubSat[int16]),
+	expr.OpCodeI16x8SubSatU:              lanewiseBinary(laneSubSat[uint16]),
+	expr.OpCodeF64x2Nearest:              lanewiseUnary(laneNearest[float64]),
+	expr.OpCodeI16x8Mul:                  lanewiseBinary(laneMul[uint16]),
+	expr.OpCodeI16x8MinS:                 lanewiseBinary(laneMin[int16]),
+	expr.OpCodeI16x8MinU:                 lanewiseBinary(laneMin[uint16]),
+	expr.OpCodeI16x8MaxS:                 lanewiseBinary(laneMax[int16]),
+	expr.OpCodeI16x8MaxU:                 lanewiseBinary(laneMax[uint16]),
+	expr.OpCodeI16x8AvgrU:                lanewiseBinary(laneAvgr[uint16]),
+	expr.OpCodeI16x8ExtmulLowI8x16S:      extMul[int8, int16](false),
+	expr.OpCodeI16x8ExtmulHighI8x16S:     extMul[int8, int16](true),
+	expr.OpCodeI16x8ExtmulLowI8x16U:      extMul[uint8, uint16](false),
+	expr.OpCodeI16x8ExtmulHighI8x16U:     extMul[uint8, uint16](true),
+	expr.OpCodeI32x4Abs:                  lanewiseUnary(laneAbs[int32]),
+	expr.OpCodeI32x4Neg:                  lanewiseUnary(laneNeg[int32]),
+	expr.OpCodeI32x4AllTrue:              allTrue[uint32],
+	expr.OpCodeI32x4Bitmask:              bitmask[int32],
+	expr.OpCodeI32x4ExtendLowI16x8S:      extend[int16, int32](false),
+	expr.OpCodeI32x4ExtendHighI16x8S:     extend[int16, int32](true),
+	expr.OpCodeI32x4ExtendLowI16x8U:      extend[uint16, uint32](false),
+	expr.OpCodeI32x4ExtendHighI16x8U:     extend[uint16, uint32](true),
+	expr.OpCodeI32x4Shl:                  shiftLanes(laneShl[uint32]),
+	expr.OpCodeI32x4ShrS:                 shiftLanes(laneShr[int32]),
+	expr.OpCodeI32x4ShrU:                 shiftLanes(laneShr[uint32]),
+	expr.OpCodeI32x4Add:                  lanewiseBinary(laneAdd[uint32]),
+	expr.OpCodeI32x4Sub:                  lanewiseBinary(laneSub[uint32]),
+	expr.OpCodeI32x4Mul:                  lanewiseBinary(laneMul[uint32]),
+	expr.OpCodeI32x4MinS:                 lanewiseBinary(laneMin[int32]),
+	expr.OpCodeI32x4MinU:                 lanewiseBinary(laneMin[uint32]),
+	expr.OpCodeI32x4MaxS:                 lanewiseBinary(laneMax[int32]),
+	expr.OpCodeI32x4MaxU:                 lanewiseBinary(laneMax[uint32]),
+	expr.OpCodeI32x4DotI16x8S:            i32x4DotI16x8S,
+	expr.OpCodeI32x4ExtmulLowI16x8S:      extMul[int16, int32](false),
+	expr.OpCodeI32x4ExtmulHighI16x8S:     extMul[int16, int32](true),
+	expr.OpCodeI32x4ExtmulLowI16x8U:      extMul[uint16, uint32](false),
+	expr.OpCodeI32x4ExtmulHighI16x8U:     extMul[uint16, uint32](true),
+	expr.OpCodeI64x2Abs:                  lanewiseUnary(laneAbs[int64]),
+	expr.OpCodeI64x2Neg:                  lanewiseUnary(laneNeg[int64]),
+	expr.OpCodeI64x2AllTrue:              allTrue[uint64],
+	expr.OpCodeI64x2Bitmask:              bitmask[int64],
+	expr.OpCodeI64x2ExtendLowI32x4S:      extend[int32, int64](false),
+	expr.OpCodeI64x2ExtendHighI32x4S:     extend[int32, int64](true),
+	expr.OpCodeI64x2ExtendLowI32x4U:      extend[uint32, uint64](false),
+	expr.OpCodeI64x2ExtendHighI32x4U:     extend[uint32, uint64](true),
+	expr.OpCodeI64x2Shl:                  shiftLanes(laneShl[uint64]),
+	expr.OpCodeI64x2ShrS:                 shiftLanes(laneShr[int64]),
+	expr.OpCodeI64x2ShrU:                 shiftLanes(laneShr[uint64]),
+	expr.OpCodeI64x2Add:                  lanewiseBinary(laneAdd[uint64]),
+	expr.OpCodeI64x2Sub:                  lanewiseBinary(laneSub[uint64]),
+	expr.OpCodeI64x2Mul:                  lanewiseBinary(laneMul[uint64]),
+	expr.OpCodeI64x2Eq:                   compareLanes[int64, uint64](laneEq[int64]),
+	expr.OpCodeI64x2Ne:                   compareLanes[int64, uint64](laneNe[int64]),
+	expr.OpCodeI64x2LtS:                  compareLanes[int64, uint64](laneLt[int64]),
+	expr.OpCodeI64x2GtS:                  compareLanes[int64, uint64](laneGt[int64]),
+	expr.OpCodeI64x2LeS:                  compareLanes[int64, uint64](laneLe[int64]),
+	expr.OpCodeI64x2GeS:                  compareLanes[int64, uint64](laneGe[int64]),
+	expr.OpCodeI64x2ExtmulLowI32x4S:      extMul[int32, int64](false),
+	expr.OpCodeI64x2ExtmulHighI32x4S:     extMul[int32, int64](true),
+	expr.OpCodeI64x2ExtmulLowI32x4U:      extMul[uint32, uint64](false),
+	expr.OpCodeI64x2ExtmulHighI32x4U:     extMul[uint32, uint64](true),
+	expr.OpCodeF32x4Abs:                  lanewiseUnary(laneFAbs[uint32]),
+	expr.OpCodeF32x4Neg:                  lanewiseUnary(laneFNeg[uint32]),
+	expr.OpCodeF32x4Sqrt:                 lanewiseUnary(laneSqrt[float32]),
+	expr.OpCodeF32x4Add:                  lanewiseBinary(laneAdd[float32]),
+	expr.OpCodeF32x4Sub:                  lanewiseBinary(laneSub[float32]),
+	expr.OpCodeF32x4Mul:                  lanewiseBinary(laneMul[float32]),
+	expr.OpCodeF32x4Div:                  lanewiseBinary(laneDiv[float32]),
+	expr.OpCodeF32x4Min:                  lanewiseBinary(laneFMin[float32]),
+	expr.OpCodeF32x4Max:                  lanewiseBinary(laneFMax[float32]),
+	expr.OpCodeF32x4Pmin:                 lanewiseBinary(lanePMin[float32]),
+	expr.OpCodeF32x4Pmax:                 lanewiseBinary(lanePMax[float32]),
+	expr.OpCodeF64x2Abs:                  lanewiseUnary(laneFAbs[uint64]),
+	expr.OpCodeF64x2Neg:                  lanewiseUnary(laneFNeg[uint64]),
+	expr.OpCodeF64x2Sqrt:                 lanewiseUnary(laneSqrt[float64]),
+	expr.OpCodeF64x2Add:                  lanewiseBinary(laneAdd[float64]),
+	expr.OpCodeF64x2Sub:                  lanewiseBinary(laneSub[float64]),
+	expr.OpCodeF64x2Mul:                  lanewiseBinary(laneMul[float64]),
+	expr.OpCodeF64x2Div:                  lanewiseBinary(laneDiv[float64]),
+	expr.OpCodeF64x2Min:                  lanewiseBinary(laneFMin[float64]),
+	expr.OpCodeF64x2Max:                  lanewiseBinary(laneFMax[float64]),
+	expr.OpCodeF64x2Pmin:                 lanewiseBinary(lanePMin[float64]),
+	expr.OpCodeF64x2Pmax:                 lanewiseBinary(lanePMax[float64]),
+	expr.OpCodeI32x4TruncSatF32x4S:       truncSatLanes[float32](true),
+	expr.OpCodeI32x4TruncSatF32x4U:       truncSatLanes[float32](false),
+	expr.OpCodeF32x4ConvertI32x4S:        convertLanes[int32, float32],
+	expr.OpCodeF32x4ConvertI32x4U:        convertLanes[uint32, float32],
+	expr.OpCodeI32x4TruncSatF64x2SZero:   truncSatLanes[float64](true),
+	expr.OpCodeI32x4TruncSatF64x2UZero:   truncSatLanes[float64](false),
+	expr.OpCodeF64x2ConvertLowI32x4S:     convertLanes[int32, float64],
+	expr.OpCodeF64x2ConvertLowI32x4U:     convertLanes[uint32, float64],
+}
+
+// atomicInstructions are the instructions prefixed by expr.OpCodeAtomicPrefix, resolved by the sub opcode on compiling
+var atomicInstructions = [...]func(ins *Instance) error{
+	expr.OpCodeMemoryAtomicNotify: memoryAtomicNotify,
+	expr.OpCodeMemoryAtomicWait32: memoryAtomicWait(4),
+	expr.OpCodeMemoryAtomicWait64: memoryAtomicWait(8),
+	expr.OpCodeAtomicFence:        atomicFence,
+
+	expr.OpCodeI32AtomicLoad:    atomicLoad(4),
+	expr.OpCodeI64AtomicLoad:    atomicLoad(8),
+	expr.OpCodeI32AtomicLoad8U:  atomicLoad(1),
+	expr.OpCodeI32AtomicLoad16U: atomicLoad(2),
+	expr.OpCodeI64AtomicLoad8U:  atomicLoad(1),
+	expr.OpCodeI64AtomicLoad16U: atomicLoad(2),
+	expr.OpCodeI64AtomicLoad32U: atomicLoad(4),
+
+	expr.OpCodeI32AtomicStore:   atomicStore(4),
+	expr.OpCodeI64AtomicStore:   atomicStore(8),
+	expr.OpCodeI32AtomicStore8:  atomicStore(1),
+	expr.OpCodeI32AtomicStore16: atomicStore(2),
+	expr.OpCodeI64AtomicStore8:  atomicStore(1),
+	expr.OpCodeI64AtomicStore16: atomicStore(2),
+	expr.OpCodeI64AtomicStore32: atomicStore(4),
+
+	expr.OpCodeI32AtomicRmwAdd:        atomicRMW(4, rmwAdd),
+	expr.OpCodeI64AtomicRmwAdd:        atomicRMW(8, rmwAdd),
+	expr.OpCodeI32AtomicRmw8AddU:      atomicRMW(1, rmwAdd),
+	expr.OpCodeI32AtomicRmw16AddU:     atomicRMW(2, rmwAdd),
+	expr.OpCodeI64AtomicRmw8AddU:      atomicRMW(1, rmwAdd),
+	expr.OpCodeI64AtomicRmw16AddU:     atomicRMW(2, rmwAdd),
+	expr.OpCodeI64AtomicRmw32AddU:     atomicRMW(4, rmwAdd),
+	expr.OpCodeI32AtomicRmwSub:        atomicRMW(4, rmwSub),
+	expr.OpCodeI64AtomicRmwSub:        atomicRMW(8, rmwSub),
+	expr.OpCodeI32AtomicRmw8SubU:      atomicRMW(1, rmwSub),
+	expr.OpCodeI32AtomicRmw16SubU:     atomicRMW(2, rmwSub),
+	expr.OpCodeI64AtomicRmw8SubU:      atomicRMW(1, rmwSub),
+	expr.OpCodeI64AtomicRmw16SubU:     atomicRMW(2, rmwSub),
+	expr.OpCodeI64AtomicRmw32SubU:     atomicRMW(4, rmwSub),
+	expr.OpCodeI32AtomicRmwAnd:        atomicRMW(4, rmwAnd),
+	expr.OpCodeI64AtomicRmwAnd:        atomicRMW(8, rmwAnd),
+	expr.OpCodeI32AtomicRmw8AndU:      atomicRMW(1, rmwAnd),
+	expr.OpCodeI32AtomicRmw16AndU:     atomicRMW(2, rmwAnd),
+	expr.OpCodeI64AtomicRmw8AndU:      atomicRMW(1, rmwAnd),
+	expr.OpCodeI64AtomicRmw16AndU:     atomicRMW(2, rmwAnd),
+	expr.OpCodeI64AtomicRmw32AndU:     atomicRMW(4, rmwAnd),
+	expr.OpCodeI32AtomicRmwOr:         atomicRMW(4, rmwOr),
+	expr.OpCodeI64AtomicRmwOr:         atomicRMW(8, rmwOr),
+	expr.OpCodeI32AtomicRmw8OrU:       atomicRMW(1, rmwOr),
+	expr.OpCodeI32AtomicRmw16OrU:      atomicRMW(2, rmwOr),
+	expr.OpCodeI64AtomicRmw8OrU:       atomicRMW(1, rmwOr),
+	expr.OpCodeI64AtomicRmw16OrU:      atomicRMW(2, rmwOr),
+	expr.OpCodeI64AtomicRmw32OrU:      atomicRMW(4, rmwOr),
+	expr.OpCodeI32AtomicRmwXor:        atomicRMW(4, rmwXor),
+	expr.OpCodeI64AtomicRmwXor:        atomicRMW(8, rmwXor),
+	expr.OpCodeI32AtomicRmw8XorU:      atomicRMW(1, rmwXor),
+	expr.OpCodeI32AtomicRmw16XorU:     atomicRMW(2, rmwXor),
+	expr.OpCodeI64AtomicRmw8XorU:      atomicRMW(1, rmwXor),
+	expr.OpCodeI64AtomicRmw16XorU:     atomicRMW(2, rmwXor),
+	expr.OpCodeI64AtomicRmw32XorU:     atomicRMW(4, rmwXor),
+	expr.OpCodeI32AtomicRmwXchg:       atomicRMW(4, rmwXchg),
+	expr.OpCodeI64AtomicRmwXchg:       atomicRMW(8, rmwXchg),
+	expr.OpCodeI32AtomicRmw8XchgU:     atomicRMW(1, rmwXchg),
+	expr.OpCodeI32AtomicRmw16XchgU:    atomicRMW(2, rmwXchg),
+	expr.OpCodeI64AtomicRmw8XchgU:     atomicRMW(1, rmwXchg),
+	expr.OpCodeI64AtomicRmw16XchgU:    atomicRMW(2, rmwXchg),
+	expr.OpCodeI64AtomicRmw32XchgU:    atomicRMW(4, rmwXchg),
+	expr.OpCodeI32AtomicRmwCmpxchg:    atomicCmpxchg(4),
+	expr.OpCodeI64AtomicRmwCmpxchg:    atomicCmpxchg(8),
+	expr.OpCodeI32AtomicRmw8CmpxchgU:  atomicCmpxchg(1),
+	expr.OpCodeI32AtomicRmw16CmpxchgU: atomicCmpxchg(2),
+	expr.OpCodeI64AtomicRmw8CmpxchgU:  atomicCmpxchg(1),
+	expr.OpCodeI64AtomicRmw16CmpxchgU: atomicCmpxchg(2),
+	expr.OpCodeI64AtomicRmw32CmpxchgU: atomicCmpxchg(4),
 }
@@ -7,11 +7,11 @@ func drop(ins *Instance) error {
 }
 
 func selectOp(ins *Instance) error {
-	c := ins.OperandStack.Pop()
-	v2 := ins.OperandStack.Pop()
+	s := ins.OperandStack
+	c := uint32(s.Pop())
+	s.Drop()
 	if c == 0 {
-		_ = ins.OperandStack.Pop()
-		ins.OperandStack.Push(v2)
+		s.Move(s.Ptr, s.Ptr+1)
 	}
 
 	return nil
@@ -1 +1,28 @@
 package wasm
+
+import (
+	"testing"
+
+	"github.com/c0mm4nd/wasman/stacks"
+)
+
+func Test_selectOp(t *testing.T) {
+	for _, c := range []struct {
+		cond, exp uint64
+	}{
+		{cond: 1, exp: 10},
+		{cond: 0, exp: 20},
+		{cond: 1 << 32, exp: 20}, // false, the bits over the i32 are ignored
+	} {
+		vm := &Instance{OperandStack: stacks.NewOperandStack()}
+		vm.OperandStack.Push(10)
+		vm.OperandStack.Push(20)
+		vm.OperandStack.Push(c.cond)
+		if err := selectOp(vm); err != nil {
+			t.Fatal(err)
+		}
+		if got := vm.OperandStack.Pop(); got != c.exp || vm.OperandStack.Ptr != -1 {
+			t.Errorf("cond %#x: got %d", c.cond, got)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package wasm
+
+import (
+	"errors"
+)
+
+// errors on atomic instr
+var (
+	// ErrUnalignedAtomic will be throw when the address of the atomic instr is not aligned to its size
+	ErrUnalignedAtomic = errors.New("unaligned atomic")
+	// ErrWaitOnUnsharedMemory will be throw when memory.atomic.wait is executed on the memory not shared
+	ErrWaitOnUnsharedMemory = errors.New("expected shared memory")
+)
+
+// atomicMemoryBase reads the memarg immediates like memoryBase, and ensures the address is aligned to the size
+func atomicMemoryBase(ins *Instance, size uint64) (*Memory, uint64, error) {
+	mem, base, err := memoryBase(ins, size)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if base%size != 0 {
+		return nil, 0, ErrUnalignedAtomic
+	}
+
+	return mem, base, nil
+}
+
+// atomicLoad reads the size bytes on the offset, atomically when the memory is shared
+func (mem *Memory) atomicLoad(offset, size uint64) uint64 {
+	if s, ok := mem.Backing.(*SharedMemoryBacking); ok {
+		return s.load(offset, size)
+	}
+
+	switch size {
+	case 1:
+		return uint64(mem.loadUint8(offset))
+	case 2:
+		return uint64(mem.loadUint16(offset))
+	case 4:
+		return uint64(mem.loadUint32(offset))
+	default:
+		return mem.loadUint64(offset)
+	}
+}
+
+// atomicRMW replaces the size bytes on the offset with f(old) and returns the old ones,
+// atomically when the memory is shared
+func (mem *Memory) atomicRMW(offset, size uint64, f func(old uint64) uint64) uint64 {
+	if s, ok := mem.Backing.(*SharedMemoryBacking); ok {
+		return s.rmw(offset, size, f)
+	}
+
+	old := mem.atomicLoad(offset, size)
+	switch v := f(old); size {
+	case 1:
+		mem.storeUint8(offset, uint8(v))
+	case 2:
+		mem.storeUint16(offset, uint16(v))
+	case 4:
+		mem.storeUint32(offset, uint32(v))
+	default:
+		mem.storeUint64(offset, v)
+	}
+
+	return old
+}
+
+// atomicLoad creates the instr loading the size bytes, zero extended
+func atomicLoad(size uint64) func(ins *Instance) error {
+	return func(ins *Instance) error {
+		mem, base, err := atomicMemoryBase(ins, size)
+		if err != nil {
+			return err
+		}
+
+		ins.OperandStack.Push(mem.atomicLoad(base, size))
+
+		return nil
+	}
+}
+
+// atomicStore creates the instr storing the lowest size bytes of the value
+func atomicStore(size uint64) func(ins *Instance) error {
+	return func(ins *Instance) error {
+		v := ins.OperandStack.Pop()
+		mem, base, err := atomicMemoryBase(ins, size)
+		if err != nil {
+			return err
+		}
+
+		mem.atomicRMW(base, size, func(uint64) uint64 { return v })
+
+		return nil
+	}
+}
+
+// atomicRMW creates the instr replacing the size bytes with op(old, v), and pushes the old ones zero extended
+func atomicRMW(size uint64, op func(old, v uint64) uint64) func(ins *Instance) error {
+	return func(ins *Instance) error {
+		v := ins.OperandStack.Pop()
+		mem, base, err := atomicMemoryBase(ins, size)
+		if err != nil {
+			return err
+		}
+
+		old := mem.atomicRMW(base, size, func(old uint64) uint64 { return op(old, v) })
+		ins.OperandStack.Push(old)
+
+		return nil
+	}
+}
+
+// atomicCmpxchg creates the instr replacing the size bytes when they equal to the expected wrapped to the size,
+// and pushes the old ones zero extended
+func atomicCmpxchg(size uint64) func(ins *Instance) error {
+	return func(ins *Instance) error {
+		replacement := ins.OperandStack.Pop()
+		expected := ins.OperandStack.Pop() & sizeMask(size)
+		mem, base, err := atomicMemoryBase(ins, size)
+		if err != nil {
+			return err
+		}
+
+		old := mem.atomicRMW(base, size, func(old uint64) uint64 {
+			if old == expected {
+				return replacement
+			}
+			return old
+		})
+		ins.OperandStack.Push(old)
+
+		return nil
+	}
+}
+
+func rmwAdd(old, v uint64) uint64 { return old + v }
+func rmwSub(old, v uint64) uint64 { return old - v }
+func rmwAnd(old, v uint64) uint64 { return old & v }
+func rmwOr(old, v uint64) uint64  { return old | v }
+func rmwXor(old, v uint64) uint64 { return old ^ v }
+func rmwXchg(_, v uint64) uint64  { return v }
+
+// memoryAtomicWait creates the memory.atomic.wait32 or memory.atomic.wait64 on the size bytes
+func memoryAtomicWait(size uint64) func(ins *Instance) error {
+	return func(ins *Instance) error {
+		timeout := int64(ins.OperandStack.Pop())
+		expected := ins.OperandStack.Pop() & sizeMask(size)
+		mem, base, err := atomicMemoryBase(ins, size)
+		if err != nil {
+			return err
+		}
+
+		s, ok := mem.Backing.(*SharedMemoryBacking)
+		if !ok {
+			return ErrWaitOnUnsharedMemory
+		}
+
+		result, interrupted := s.wait(base, size, expected, timeout, ins.done)
+		if interrupted {
+			return ins.checkContext()
+		}
+		ins.OperandStack.Push(result)
+
+		return nil
+	}
+}
+
+func memoryAtomicNotify(ins *Instance) error {
+	count := uint32(ins.OperandStack.Pop())
+	mem, base, err := atomicMemoryBase(ins, 4)
+	if err != nil {
+		return err
+	}
+
+	// no one can wait on the memory not shared
+	var woken uint32
+	if s, ok := mem.Backing.(*SharedMemoryBacking); ok {
+		woken = s.notify(base, count)
+	}
+	ins.OperandStack.Push(uint64(woken))
+
+	return nil
+}
+
+func atomicFence(_ *Instance) error {
+	return nil
+}
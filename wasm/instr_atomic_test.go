@@ -0,0 +1,211 @@
+package wasm
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/segments"
+	"github.com/c0mm4nd/wasman/stacks"
+	"github.com/c0mm4nd/wasman/types"
+	"github.com/c0mm4nd/wasman/utils"
+)
+
+// atomicInstr encodes the atomic instruction with the memarg of the align and offset
+func atomicInstr(op expr.AtomicOpCode, align, offset byte) []byte {
+	return []byte{expr.OpCodeAtomicPrefix, byte(op), align, offset}
+}
+
+func atomicVM(mem *Memory, body []byte) *Instance {
+	return &Instance{
+		Module:       new(Module),
+		Active:       &Frame{Func: compiled(&wasmFunc{body: body})},
+		Memory:       mem,
+		OperandStack: stacks.NewOperandStack(),
+	}
+}
+
+func Test_atomicOp(t *testing.T) {
+	for _, shared := range []bool{false, true} {
+		newMemory := func() *Memory {
+			if shared {
+				mem := NewSharedMemory(1, 1)
+				mem.write([]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, 0)
+				return mem
+			}
+			mem := &Memory{Value: make([]byte, MemoryPagesToBytesNum(1))}
+			mem.write([]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, 0)
+			return mem
+		}
+
+		for _, c := range []struct {
+			name   string
+			op     expr.AtomicOpCode
+			offset byte
+			args   []uint64
+			exp    uint64
+			mem    uint64 // the i64 on the address 0 afterwards
+		}{
+			{name: "i32.atomic.load", op: expr.OpCodeI32AtomicLoad, args: []uint64{4}, exp: 0x08070605, mem: 0x0807060504030201},
+			{name: "i64.atomic.load", op: expr.OpCodeI64AtomicLoad, args: []uint64{0}, exp: 0x0807060504030201, mem: 0x0807060504030201},
+			{name: "i32.atomic.load16_u", op: expr.OpCodeI32AtomicLoad16U, offset: 2, args: []uint64{0}, exp: 0x0403, mem: 0x0807060504030201},
+			{name: "i64.atomic.store8", op: expr.OpCodeI64AtomicStore8, args: []uint64{3, 0xff}, exp: 0, mem: 0x08070605ff030201},
+			{name: "i32.atomic.rmw.add", op: expr.OpCodeI32AtomicRmwAdd, args: []uint64{0, 0x01010101}, exp: 0x04030201, mem: 0x0807060505040302},
+			{name: "i32.atomic.rmw8.add_u", op: expr.OpCodeI32AtomicRmw8AddU, args: []uint64{1, 0xff}, exp: 0x02, mem: 0x0807060504030101},
+			{name: "i64.atomic.rmw16.sub_u", op: expr.OpCodeI64AtomicRmw16SubU, args: []uint64{6, 0x0808}, exp: 0x0807, mem: 0xffff060504030201},
+			{name: "i64.atomic.rmw.and", op: expr.OpCodeI64AtomicRmwAnd, args: []uint64{0, 0xff}, exp: 0x0807060504030201, mem: 0x01},
+			{name: "i32.atomic.rmw.or", op: expr.OpCodeI32AtomicRmwOr, args: []uint64{4, 0xf0}, exp: 0x08070605, mem: 0x080706f504030201},
+			{name: "i64.atomic.rmw32.xor_u", op: expr.OpCodeI64AtomicRmw32XorU, args: []uint64{0, 0xff}, exp: 0x04030201, mem: 0x08070605040302fe},
+			{name: "i32.atomic.rmw.xchg", op: expr.OpCodeI32AtomicRmwXchg, args: []uint64{0, 0xaa}, exp: 0x04030201, mem: 0x08070605000000aa},
+			{name: "i32.atomic.rmw.cmpxchg", op: expr.OpCodeI32AtomicRmwCmpxchg, args: []uint64{0, 0x04030201, 0xaa}, exp: 0x04030201, mem: 0x08070605000000aa},
+			{name: "i32.atomic.rmw.cmpxchg mismatch", op: expr.OpCodeI32AtomicRmwCmpxchg, args: []uint64{0, 0, 0xaa}, exp: 0x04030201, mem: 0x0807060504030201},
+			// the expected is wrapped to the size
+			{name: "i64.atomic.rmw8.cmpxchg_u", op: expr.OpCodeI64AtomicRmw8CmpxchgU, args: []uint64{2, 0x103, 0xaa}, exp: 0x03, mem: 0x0807060504aa0201},
+			{name: "memory.atomic.notify", op: expr.OpCodeMemoryAtomicNotify, args: []uint64{0, 1}, exp: 0, mem: 0x0807060504030201},
+		} {
+			t.Run(c.name, func(t *testing.T) {
+				vm := atomicVM(newMemory(), atomicInstr(c.op, 0x02, c.offset))
+				for _, arg := range c.args {
+					vm.OperandStack.Push(arg)
+				}
+				if err := execCurrent(vm); err != nil {
+					t.Fatal(err)
+				}
+				if vm.OperandStack.Ptr == 0 && vm.OperandStack.Pop() != c.exp {
+					t.Error("unexpected result")
+				}
+				if vm.OperandStack.Ptr != -1 {
+					t.Error("unexpected operand stack")
+				}
+				if actual := vm.Memory.atomicLoad(0, 8); actual != c.mem {
+					t.Errorf("memory: got %#x, want %#x", actual, c.mem)
+				}
+			})
+		}
+	}
+
+	t.Run("unaligned", func(t *testing.T) {
+		vm := atomicVM(NewSharedMemory(1, 1), atomicInstr(expr.OpCodeI32AtomicLoad, 0x02, 0x00))
+		vm.OperandStack.Push(2)
+		if err := execCurrent(vm); !errors.Is(err, ErrUnalignedAtomic) {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("out of bounds", func(t *testing.T) {
+		vm := atomicVM(NewSharedMemory(1, 1), atomicInstr(expr.OpCodeI64AtomicLoad, 0x03, 0x00))
+		vm.OperandStack.Push(MemoryPagesToBytesNum(1) - 4)
+		if err := execCurrent(vm); !errors.Is(err, ErrPtrOutOfBounds) {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		vm := atomicVM(NewSharedMemory(1, 1), atomicInstr(expr.OpCodeMemoryAtomicWait64, 0x03, 0x00))
+		vm.OperandStack.Push(0)
+		vm.OperandStack.Push(0)
+		vm.OperandStack.Push(1000)
+		if err := execCurrent(vm); err != nil {
+			t.Fatal(err)
+		}
+		if vm.OperandStack.Pop() != 2 { // timed out
+			t.Fail()
+		}
+
+		vm = atomicVM(&Memory{Value: make([]byte, 8)}, atomicInstr(expr.OpCodeMemoryAtomicWait32, 0x02, 0x00))
+		vm.OperandStack.Push(0)
+		vm.OperandStack.Push(0)
+		vm.OperandStack.Push(1000)
+		if err := execCurrent(vm); !errors.Is(err, ErrWaitOnUnsharedMemory) {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("fence", func(t *testing.T) {
+		vm := atomicVM(nil, []byte{expr.OpCodeAtomicPrefix, byte(expr.OpCodeAtomicFence), 0x00})
+		if err := execCurrent(vm); err != nil || len(vm.Active.Func.code) != 1 {
+			t.Fail()
+		}
+	})
+}
+
+func TestInstance_sharedMemoryConcurrently(t *testing.T) {
+	const goroutines, iterations = 8, 1000
+
+	mem := NewSharedMemory(1, 1)
+	env := &Module{
+		IndexSpace: &IndexSpace{Memories: []*Memory{mem}},
+		ExportSection: map[string]*segments.ExportSegment{
+			"memory": {Name: "memory", Desc: &segments.ExportDesc{Kind: segments.KindMem}},
+		},
+	}
+
+	// (func (export "count") (param $n i32)
+	//   (loop
+	//     (drop (i32.atomic.rmw.add (i32.const 0) (i32.const 1)))
+	//     (drop (i32.atomic.rmw8.add_u offset=5 (i32.const 0) (i32.const 1)))
+	//     (br_if 0 (local.tee $n (i32.sub (local.get $n) (i32.const 1))))))
+	body := []byte{
+		byte(expr.OpCodeLoop), 0x40,
+		byte(expr.OpCodeI32Const), 0x00,
+		byte(expr.OpCodeI32Const), 0x01,
+		expr.OpCodeAtomicPrefix, byte(expr.OpCodeI32AtomicRmwAdd), 0x02, 0x00,
+		byte(expr.OpCodeDrop),
+		byte(expr.OpCodeI32Const), 0x00,
+		byte(expr.OpCodeI32Const), 0x01,
+		expr.OpCodeAtomicPrefix, byte(expr.OpCodeI32AtomicRmw8AddU), 0x00, 0x05,
+		byte(expr.OpCodeDrop),
+		byte(expr.OpCodeLocalGet), 0x00,
+		byte(expr.OpCodeI32Const), 0x01,
+		byte(expr.OpCodeI32Sub),
+		byte(expr.OpCodeLocalTee), 0x00,
+		byte(expr.OpCodeBrIf), 0x00,
+		byte(expr.OpCodeEnd),
+	}
+
+	instances := make([]*Instance, goroutines)
+	for i := range instances {
+		// every instance is instantiated from its own module
+		module := &Module{
+			TypeSection: []*types.FuncType{{InputTypes: []types.ValueType{types.ValueTypeI32}}},
+			ImportSection: []*segments.ImportSegment{{
+				Module: "env", Name: "memory",
+				Desc: &segments.ImportDesc{
+					Kind:       segments.KindMem,
+					MemTypePtr: &types.MemoryType{Min: 1, Max: utils.Uint64Ptr(1), Shared: true},
+				},
+			}},
+			FunctionSection: []uint32{0},
+			CodeSection:     []*segments.CodeSegment{{Body: body}},
+			ExportSection: map[string]*segments.ExportSegment{
+				"count": {Name: "count", Desc: &segments.ExportDesc{Kind: segments.KindFunction}},
+			},
+		}
+
+		ins, err := NewInstance(module, map[string]*Module{"env": env})
+		if err != nil {
+			t.Fatal(err)
+		}
+		instances[i] = ins
+	}
+
+	var wg sync.WaitGroup
+	for _, ins := range instances {
+		wg.Add(1)
+		go func(ins *Instance) {
+			defer wg.Done()
+			if _, _, err := ins.CallExportedFunc("count", iterations); err != nil {
+				t.Error(err)
+			}
+		}(ins)
+	}
+	wg.Wait()
+
+	if v := mem.atomicLoad(0, 4); v != goroutines*iterations {
+		t.Errorf("got %d, want %d", v, goroutines*iterations)
+	}
+	if v := mem.atomicLoad(4, 4); v != (goroutines*iterations%256)<<8 {
+		t.Errorf("got %#x, want %#x", v, (goroutines*iterations%256)<<8)
+	}
+}
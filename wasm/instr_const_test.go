@@ -10,13 +10,13 @@ import (
 
 func Test_i32Const(t *testing.T) {
 	ctx := &Frame{
-		Func: &wasmFunc{
+		Func: compiled(&wasmFunc{
 			body: []byte{byte(expr.OpCodeI32Const), 0x05},
-		},
+		}),
 	}
 
 	vm := &Instance{
-		Active:      ctx,
+		Active:       ctx,
 		OperandStack: stacks.NewOperandStack(),
 	}
 	err := i32Const(vm)
@@ -33,13 +33,13 @@ func Test_i32Const(t *testing.T) {
 
 func Test_i64Const(t *testing.T) {
 	ctx := &Frame{
-		Func: &wasmFunc{
+		Func: compiled(&wasmFunc{
 			body: []byte{byte(expr.OpCodeI64Const), 0x05},
-		},
+		}),
 	}
 
 	vm := &Instance{
-		Active:      ctx,
+		Active:       ctx,
 		OperandStack: stacks.NewOperandStack(),
 	}
 	err := i64Const(vm)
@@ -57,13 +57,13 @@ func Test_i64Const(t *testing.T) {
 func Test_f32Const(t *testing.T) {
 
 	ctx := &Frame{
-		Func: &wasmFunc{
+		Func: compiled(&wasmFunc{
 			body: []byte{byte(expr.OpCodeF32Const), 0x00, 0x00, 0x80, 0x3f},
-		},
+		}),
 	}
 
 	vm := &Instance{
-		Active:      ctx,
+		Active:       ctx,
 		OperandStack: stacks.NewOperandStack(),
 	}
 	err := f32Const(vm)
@@ -80,13 +80,13 @@ func Test_f32Const(t *testing.T) {
 
 func Test_f64Const(t *testing.T) {
 	ctx := &Frame{
-		Func: &wasmFunc{
+		Func: compiled(&wasmFunc{
 			body: []byte{byte(expr.OpCodeF64Const), 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf0, 0x3f},
-		},
+		}),
 	}
 
 	vm := &Instance{
-		Active:      ctx,
+		Active:       ctx,
 		OperandStack: stacks.NewOperandStack(),
 	}
 	err := f64Const(vm)
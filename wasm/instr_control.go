@@ -1,10 +1,8 @@
 package wasm
 
 import (
-	"bytes"
 	"errors"
 
-	"github.com/c0mm4nd/wasman/leb128decode"
 	"github.com/c0mm4nd/wasman/stacks"
 	"github.com/c0mm4nd/wasman/types"
 )
@@ -28,16 +26,30 @@ func nop(_ *Instance) error {
 	return nil
 }
 
+// pushLabel pushes the label of the block entered, and reuses the label left on the slot by an earlier pop,
+// so that entering the blocks inside a loop does not allocate
+func pushLabel(labels *stacks.Stack[*stacks.Label], l stacks.Label) {
+	if labels.Ptr+1 < len(labels.Values) && labels.Values[labels.Ptr+1] != nil {
+		*labels.Values[labels.Ptr+1] = l
+		labels.Ptr++
+		return
+	}
+
+	pushed := new(stacks.Label)
+	*pushed = l
+	labels.Push(pushed)
+}
+
 func block(ins *Instance) error {
 	ctx := ins.Active
-	block, ok := ctx.Func.Blocks[ctx.PC]
-	if !ok {
+	block := ins.current().block
+	if block == nil {
 		return ErrBlockNotInitialized
 	}
 
-	ctx.PC += block.BlockTypeBytes
-	ctx.LabelStack.Push(&stacks.Label{
+	pushLabel(ctx.LabelStack, stacks.Label{
 		Arity:          len(block.BlockType.ReturnTypes),
+		Height:         ins.OperandStack.Ptr - len(block.BlockType.InputTypes),
 		ContinuationPC: block.EndAt,
 		EndPC:          block.EndAt,
 	})
@@ -46,14 +58,21 @@ func block(ins *Instance) error {
 }
 
 func loop(ins *Instance) error {
+	// every branch back to the loop executes it again
+	if err := ins.checkContext(); err != nil {
+		return err
+	}
+
 	ctx := ins.Active
-	block, ok := ctx.Func.Blocks[ctx.PC]
-	if !ok {
+	block := ins.current().block
+	if block == nil {
 		return ErrBlockNotFound
 	}
-	ctx.PC += block.BlockTypeBytes
-	ctx.LabelStack.Push(&stacks.Label{
-		Arity:          len(block.BlockType.ReturnTypes),
+
+	// a branch to the loop restarts it, so it carries the params rather than the results
+	pushLabel(ctx.LabelStack, stacks.Label{
+		Arity:          len(block.BlockType.InputTypes),
+		Height:         ins.OperandStack.Ptr - len(block.BlockType.InputTypes),
 		ContinuationPC: block.StartAt - 1,
 		EndPC:          block.EndAt,
 	})
@@ -63,20 +82,24 @@ func loop(ins *Instance) error {
 
 func ifOp(ins *Instance) error {
 	ctx := ins.Active
-	block, ok := ctx.Func.Blocks[ins.Active.PC]
-	if !ok {
+	block := ins.current().block
+	if block == nil {
 		return ErrBlockNotInitialized
 	}
-	ctx.PC += block.BlockTypeBytes
 
-	if ins.OperandStack.Pop() == 0 && // means false, turn to else codes
-		block.ElseAt > block.StartAt {
-		// enter else
-		ins.Active.PC = block.ElseAt
+	if uint32(ins.OperandStack.Pop()) == 0 { // means false, turn to else codes
+		if block.ElseAt > block.StartAt {
+			// enter else
+			ins.Active.PC = block.ElseAt
+		} else {
+			// no else, so let the end pop the label
+			ins.Active.PC = block.EndAt - 1
+		}
 	}
 
-	ctx.LabelStack.Push(&stacks.Label{
+	pushLabel(ctx.LabelStack, stacks.Label{
 		Arity:          len(block.BlockType.ReturnTypes),
+		Height:         ins.OperandStack.Ptr - len(block.BlockType.InputTypes),
 		ContinuationPC: block.EndAt,
 		EndPC:          block.EndAt,
 	})
@@ -100,86 +123,87 @@ func end(ins *Instance) error {
 }
 
 func br(ins *Instance) error {
-	ins.Active.PC++
-	index, err := ins.fetchUint32()
-	if err != nil {
-		return err
-	}
-
-	return branchAt(ins, index)
+	return branchAt(ins, uint32(ins.current().imm[0]))
 }
 
 func branchAt(ins *Instance, index uint32) error {
-	var l *stacks.Label
+	labels := ins.Active.LabelStack
+	if int(index) > labels.Ptr+1 {
+		return ErrLabelNotFound
+	}
+
+	if int(index) == labels.Ptr+1 {
+		// the outermost label is the func body, branching to it equals to return
+		labels.Ptr = -1
+		ins.Active.PC = uint64(len(ins.Active.Func.code))
 
+		return nil
+	}
+
+	var l *stacks.Label
 	for i := uint32(0); i < index+1; i++ {
-		l = ins.Active.LabelStack.Pop()
+		l = labels.Pop()
 	}
 
 	if l == nil {
 		return ErrLabelNotFound
 	}
 
+	ins.unwindOperandStack(l.Height, l.Arity)
 	ins.Active.PC = l.ContinuationPC
 
 	return nil
 }
 
-func brIf(ins *Instance) error {
-	ins.Active.PC++
-	index, err := ins.fetchUint32()
-	if err != nil {
-		return err
+// unwindOperandStack drops the values above the height except the top arity ones
+func (ins *Instance) unwindOperandStack(height, arity int) {
+	s := ins.OperandStack
+	if s.Ptr <= height+arity {
+		return
 	}
 
-	c := ins.OperandStack.Pop()
+	for i := 0; i < arity; i++ {
+		s.Move(height+1+i, s.Ptr+1-arity+i)
+	}
+	s.Ptr = height + arity
+}
+
+func brIf(ins *Instance) error {
+	c := uint32(ins.OperandStack.Pop())
 	if c != 0 {
-		return branchAt(ins, index)
+		return branchAt(ins, uint32(ins.current().imm[0]))
 	}
 
 	return nil
 }
 
 func brTable(ins *Instance) error {
-	ins.Active.PC++
-	r := bytes.NewReader(ins.Active.Func.body[ins.Active.PC:])
-	nl, num, err := leb128decode.DecodeUint32(r)
-	if err != nil {
-		return err
+	labels := ins.current().labels
+	i := ins.OperandStack.Pop()
+	if uint32(i) < uint32(len(labels)-1) {
+		return branchAt(ins, labels[uint32(i)])
 	}
 
-	lis := make([]uint32, nl)
-	for i := range lis {
-		li, n, err := leb128decode.DecodeUint32(r)
-		if err != nil {
-			return err
-		}
-		num += n
-		lis[i] = li
-	}
+	return branchAt(ins, labels[len(labels)-1])
+}
 
-	ln, n, err := leb128decode.DecodeUint32(r)
+func call(ins *Instance) error {
+	index := uint32(ins.current().imm[0])
+	err := ins.Functions[index].call(ins)
 	if err != nil {
 		return err
 	}
-	ins.Active.PC += n + num
-
-	i := ins.OperandStack.Pop()
-	if uint32(i) < nl {
-		return branchAt(ins, lis[i])
-	}
 
-	return branchAt(ins, ln)
+	return nil
 }
 
-func call(ins *Instance) error {
-	ins.Active.PC++
-	index, err := ins.fetchUint32()
+func callIndirect(ins *Instance) error {
+	f, err := fetchIndirectFunc(ins)
 	if err != nil {
 		return err
 	}
 
-	err = ins.Functions[index].call(ins)
+	err = f.call(ins)
 	if err != nil {
 		return err
 	}
@@ -187,39 +211,55 @@ func call(ins *Instance) error {
 	return nil
 }
 
-func callIndirect(ins *Instance) error {
-	ins.Active.PC++
-	index, err := ins.fetchUint32()
+// fetchIndirectFunc reads the type and table immediates, and returns the func on the table entry popped from the OperandStack
+func fetchIndirectFunc(ins *Instance) (fn, error) {
+	table, err := ins.fetchTable(1)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	expType := ins.Module.TypeSection[index]
+	expType := ins.Module.TypeSection[ins.current().imm[0]]
 
-	tableIndex := ins.OperandStack.Pop()
-	// note: mvp limits the size of table index space to 1
-	if tableIndex >= uint64(len(ins.Module.IndexSpace.Tables[0].Value)) {
-		return ErrTableIndexOutOfRange
+	elemIndex := uint64(uint32(ins.OperandStack.Pop()))
+	if elemIndex >= uint64(len(table.Value)) {
+		return nil, ErrTableIndexOutOfRange
 	}
 
-	te := ins.Module.IndexSpace.Tables[0].Value[tableIndex]
+	te := table.Value[elemIndex]
 	if te == nil {
-		return ErrTableInstanceNotInitialized
+		return nil, ErrTableInstanceNotInitialized
 	}
 
 	f := ins.Functions[*te]
 	ft := f.getType()
 	if !types.HasSameSignature(ft.InputTypes, expType.InputTypes) ||
 		!types.HasSameSignature(ft.ReturnTypes, expType.ReturnTypes) {
-		return ErrFuncSignMismatch
+		return nil, ErrFuncSignMismatch
 	}
 
-	err = f.call(ins)
+	return f, nil
+}
+
+// returnCall leaves the current func and lets the caller frame call the func in place of it,
+// so that the FrameStack does not grow on the tail calls
+func returnCall(ins *Instance) error {
+	index := uint32(ins.current().imm[0])
+	if index >= uint32(len(ins.Functions)) {
+		return ErrFuncIndexOutOfRange
+	}
+
+	ins.tailCallee = ins.Functions[index]
+
+	return nil
+}
+
+func returnCallIndirect(ins *Instance) error {
+	f, err := fetchIndirectFunc(ins)
 	if err != nil {
 		return err
 	}
 
-	ins.Active.PC++ // skip 0x00
+	ins.tailCallee = f
 
 	return nil
 }
@@ -15,28 +15,28 @@ func Test_block(t *testing.T) {
 	ctx := &Frame{
 		PC: 1,
 		Func: &wasmFunc{
-			Blocks: map[uint64]*funcBlock{
-				1: {
-					StartAt:        1,
-					EndAt:          100,
-					BlockTypeBytes: 3,
-					BlockType:      &types.FuncType{ReturnTypes: []types.ValueType{types.ValueTypeI32}},
-				},
+			code: []instr{
+				1: {block: &funcBlock{
+					StartAt:   1,
+					EndAt:     100,
+					BlockType: &types.FuncType{ReturnTypes: []types.ValueType{types.ValueTypeI32}},
+				}},
 			},
 		},
 		LabelStack: stacks.NewLabelStack(),
 	}
-	if block(&Instance{Active: ctx}) != nil {
+	if block(&Instance{Active: ctx, OperandStack: stacks.NewOperandStack()}) != nil {
 		t.Fail()
 	}
 	if !reflect.DeepEqual(&stacks.Label{
 		Arity:          1,
+		Height:         -1,
 		ContinuationPC: 100,
 		EndPC:          100,
 	}, ctx.LabelStack.Values[ctx.LabelStack.Ptr]) {
 		t.Fail()
 	}
-	if ctx.PC != 4 {
+	if ctx.PC != 1 {
 		t.Fail()
 	}
 }
@@ -45,28 +45,35 @@ func Test_loop(t *testing.T) {
 	ctx := &Frame{
 		PC: 1,
 		Func: &wasmFunc{
-			Blocks: map[uint64]*funcBlock{
-				1: {
-					StartAt:        1,
-					EndAt:          100,
-					BlockTypeBytes: 3,
-					BlockType:      &types.FuncType{ReturnTypes: []types.ValueType{types.ValueTypeI32}},
+			code: []instr{
+				1: {block: &funcBlock{
+					StartAt: 1,
+					EndAt:   100,
+					BlockType: &types.FuncType{
+						InputTypes:  []types.ValueType{types.ValueTypeI32, types.ValueTypeI64},
+						ReturnTypes: []types.ValueType{types.ValueTypeI32},
+					}},
 				},
 			},
 		},
 		LabelStack: stacks.NewLabelStack(),
 	}
-	if loop(&Instance{Active: ctx}) != nil {
+	vm := &Instance{Active: ctx, OperandStack: stacks.NewOperandStack()}
+	vm.OperandStack.Push(1)
+	vm.OperandStack.Push(2)
+	vm.OperandStack.Push(3)
+	if loop(vm) != nil {
 		t.Fail()
 	}
 	if !reflect.DeepEqual(&stacks.Label{
-		Arity:          1,
+		Arity:          2,
+		Height:         0,
 		ContinuationPC: 0,
 		EndPC:          100,
 	}, ctx.LabelStack.Values[ctx.LabelStack.Ptr]) {
 		t.Fail()
 	}
-	if ctx.PC != 4 {
+	if ctx.PC != 1 {
 		t.Fail()
 	}
 }
@@ -76,13 +83,12 @@ func Test_ifOp(t *testing.T) {
 		ctx := &Frame{
 			PC: 1,
 			Func: &wasmFunc{
-				Blocks: map[uint64]*funcBlock{
-					1: {
-						StartAt:        1,
-						EndAt:          100,
-						BlockTypeBytes: 3,
-						BlockType:      &types.FuncType{ReturnTypes: []types.ValueType{types.ValueTypeI32}},
-					},
+				code: []instr{
+					1: {block: &funcBlock{
+						StartAt:   1,
+						EndAt:     100,
+						BlockType: &types.FuncType{ReturnTypes: []types.ValueType{types.ValueTypeI32}},
+					}},
 				},
 			},
 			LabelStack: stacks.NewLabelStack(),
@@ -94,12 +100,13 @@ func Test_ifOp(t *testing.T) {
 		}
 		if !reflect.DeepEqual(&stacks.Label{
 			Arity:          1,
+			Height:         -1,
 			ContinuationPC: 100,
 			EndPC:          100,
 		}, ctx.LabelStack.Values[ctx.LabelStack.Ptr]) {
 			t.Fail()
 		}
-		if ctx.PC != 4 {
+		if ctx.PC != 1 {
 			t.Fail()
 		}
 	})
@@ -107,14 +114,13 @@ func Test_ifOp(t *testing.T) {
 		ctx := &Frame{
 			PC: 1,
 			Func: &wasmFunc{
-				Blocks: map[uint64]*funcBlock{
-					1: {
-						StartAt:        1,
-						ElseAt:         50,
-						EndAt:          100,
-						BlockTypeBytes: 3,
-						BlockType:      &types.FuncType{ReturnTypes: []types.ValueType{types.ValueTypeI32}},
-					},
+				code: []instr{
+					1: {block: &funcBlock{
+						StartAt:   1,
+						ElseAt:    50,
+						EndAt:     100,
+						BlockType: &types.FuncType{ReturnTypes: []types.ValueType{types.ValueTypeI32}},
+					}},
 				},
 			},
 			LabelStack: stacks.NewLabelStack(),
@@ -126,6 +132,7 @@ func Test_ifOp(t *testing.T) {
 		}
 		if !reflect.DeepEqual(&stacks.Label{
 			Arity:          1,
+			Height:         -1,
 			ContinuationPC: 100,
 			EndPC:          100,
 		}, ctx.LabelStack.Values[ctx.LabelStack.Ptr]) {
@@ -137,6 +144,31 @@ func Test_ifOp(t *testing.T) {
 	})
 }
 
+func Test_ifOpWithoutElse(t *testing.T) {
+	ctx := &Frame{
+		PC: 1,
+		Func: &wasmFunc{
+			code: []instr{
+				1: {block: &funcBlock{
+					StartAt:   1,
+					EndAt:     100,
+					BlockType: &types.FuncType{},
+				}},
+			},
+		},
+		LabelStack: stacks.NewLabelStack(),
+	}
+	vm := &Instance{Active: ctx, OperandStack: stacks.NewOperandStack()}
+	vm.OperandStack.Push(1 << 32) // false, the bits over the i32 are ignored
+	if ifOp(vm) != nil {
+		t.Fail()
+	}
+	// the end at 100 is the next to execute
+	if ctx.PC != 99 || ctx.LabelStack.Ptr != 0 {
+		t.Fail()
+	}
+}
+
 func Test_elseOp(t *testing.T) {
 	ctx := &Frame{
 		LabelStack: stacks.NewLabelStack(),
@@ -165,7 +197,7 @@ func Test_end(t *testing.T) {
 func Test_br(t *testing.T) {
 	ctx := &Frame{
 		LabelStack: stacks.NewLabelStack(),
-		Func:       &wasmFunc{body: []byte{0x00, 0x01}},
+		Func:       compiled(&wasmFunc{body: []byte{byte(expr.OpCodeBr), 0x01}}),
 	}
 	vm := &Instance{
 		Active:       ctx,
@@ -184,7 +216,7 @@ func Test_brIf(t *testing.T) {
 	t.Run("true", func(t *testing.T) {
 		ctx := &Frame{
 			LabelStack: stacks.NewLabelStack(),
-			Func:       &wasmFunc{body: []byte{0x00, 0x01}},
+			Func:       compiled(&wasmFunc{body: []byte{byte(expr.OpCodeBrIf), 0x01}}),
 		}
 
 		vm := &Instance{Active: ctx, OperandStack: stacks.NewOperandStack()}
@@ -202,26 +234,98 @@ func Test_brIf(t *testing.T) {
 	t.Run("false", func(t *testing.T) {
 		ctx := &Frame{
 			LabelStack: stacks.NewLabelStack(),
-			Func:       &wasmFunc{body: []byte{0x00, 0x01}},
+			Func:       compiled(&wasmFunc{body: []byte{byte(expr.OpCodeBrIf), 0x01}}),
 		}
 
 		vm := &Instance{Active: ctx, OperandStack: stacks.NewOperandStack()}
-		vm.OperandStack.Push(0)
+		vm.OperandStack.Push(1 << 32) // false, the bits over the i32 are ignored
 		if brIf(vm) != nil {
 			t.Fail()
 		}
-		if ctx.PC != 1 {
+		if ctx.PC != 0 {
 			t.Fail()
 		}
 	})
 }
 
 func Test_brAt(t *testing.T) {
-	// fixme:
+	t.Run("unwind", func(t *testing.T) {
+		ctx := &Frame{
+			LabelStack: stacks.NewLabelStack(),
+			Func:       compiled(&wasmFunc{body: []byte{0x00, 0x01}}),
+		}
+		vm := &Instance{Active: ctx, OperandStack: stacks.NewOperandStack()}
+		for _, v := range []uint64{5, 9, 9, 1, 2} {
+			vm.OperandStack.Push(v)
+		}
+		ctx.LabelStack.Push(&stacks.Label{Arity: 2, Height: 0, ContinuationPC: 7})
+		ctx.LabelStack.Push(&stacks.Label{Arity: 1, Height: 1})
+		if branchAt(vm, 1) != nil {
+			t.Fail()
+		}
+		if ctx.PC != 7 || ctx.LabelStack.Ptr != -1 {
+			t.Fail()
+		}
+		if !reflect.DeepEqual(vm.OperandStack.Values[:vm.OperandStack.Ptr+1], []uint64{5, 1, 2}) {
+			t.Fail()
+		}
+	})
+
+	t.Run("func body", func(t *testing.T) {
+		ctx := &Frame{
+			LabelStack: stacks.NewLabelStack(),
+			Func:       compiled(&wasmFunc{body: []byte{0x00, 0x01}}),
+		}
+		vm := &Instance{Active: ctx, OperandStack: stacks.NewOperandStack()}
+		ctx.LabelStack.Push(&stacks.Label{})
+		if branchAt(vm, 1) != nil {
+			t.Fail()
+		}
+		if ctx.PC != 2 || ctx.LabelStack.Ptr != -1 {
+			t.Fail()
+		}
+		if branchAt(vm, 1) != ErrLabelNotFound {
+			t.Fail()
+		}
+	})
 }
 
 func Test_brTable(t *testing.T) {
-	// fixme:
+	for _, c := range []struct {
+		index uint64
+		expPC uint64
+		exp   []uint64
+	}{
+		{index: 0, expPC: 10, exp: []uint64{3}},
+		{index: 1, expPC: 20, exp: []uint64{2, 3}},
+		{index: 2, expPC: 30, exp: []uint64{3}},
+		{index: 100, expPC: 30, exp: []uint64{3}},
+	} {
+		ctx := &Frame{
+			LabelStack: stacks.NewLabelStack(),
+			Func: compiled(&wasmFunc{body: []byte{
+				byte(expr.OpCodeBrTable), 0x02, 0x02, 0x01, 0x00,
+			}}),
+		}
+		vm := &Instance{Active: ctx, OperandStack: stacks.NewOperandStack()}
+		for _, v := range []uint64{1, 2, 3, c.index} {
+			vm.OperandStack.Push(v)
+		}
+		ctx.LabelStack.Push(&stacks.Label{Arity: 1, Height: -1, ContinuationPC: 10})
+		ctx.LabelStack.Push(&stacks.Label{Arity: 2, Height: -1, ContinuationPC: 20})
+		ctx.LabelStack.Push(&stacks.Label{Arity: 1, Height: -1, ContinuationPC: 30})
+		if brTable(vm) != nil {
+			t.Fail()
+		}
+		if ctx.PC != c.expPC {
+			t.Logf("index %d: PC %d", c.index, ctx.PC)
+			t.Fail()
+		}
+		if !reflect.DeepEqual(vm.OperandStack.Values[:vm.OperandStack.Ptr+1], c.exp) {
+			t.Logf("index %d: stack %v", c.index, vm.OperandStack.Values[:vm.OperandStack.Ptr+1])
+			t.Fail()
+		}
+	}
 }
 
 type dummyFunc struct {
@@ -239,9 +343,9 @@ func Test_call(t *testing.T) {
 	df := &dummyFunc{}
 	ins := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeCall), 0x01},
-			},
+			}),
 		},
 		Functions: []fn{nil, df},
 	}
@@ -258,9 +362,9 @@ func Test_callIndirect(t *testing.T) {
 	df := &dummyFunc{}
 	ins := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
-				body: []byte{byte(expr.OpCodeCall), 0x01, 0x00},
-			},
+			Func: compiled(&wasmFunc{
+				body: []byte{byte(expr.OpCodeCallIndirect), 0x01, 0x00},
+			}),
 		},
 		Functions: []fn{nil, df},
 		Module: &Module{
@@ -282,3 +386,44 @@ func Test_callIndirect(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func Test_callIndirectTableIndex(t *testing.T) {
+	df := &dummyFunc{}
+	ins := &Instance{
+		Active: &Frame{
+			Func: compiled(&wasmFunc{
+				body: []byte{byte(expr.OpCodeCallIndirect), 0x01, 0x01},
+			}),
+		},
+		Functions: []fn{nil, df},
+		Module: &Module{
+			TypeSection: []*types.FuncType{nil, {}},
+			IndexSpace: &IndexSpace{
+				Tables: []*Table{
+					{Value: []*uint32{}},
+					{Value: []*uint32{nil, utils.Uint32Ptr(1)}},
+				},
+			},
+		},
+		OperandStack: stacks.NewOperandStack(),
+	}
+
+	ins.OperandStack.Push(1)
+	if callIndirect(ins) != nil {
+		t.Fail()
+	}
+	if df.cnt != 1 || ins.Active.PC != 0 {
+		t.Fail()
+	}
+
+	ins.OperandStack.Push(0)
+	if callIndirect(ins) != ErrTableInstanceNotInitialized {
+		t.Fail()
+	}
+
+	ins.Active.Func = compiled(&wasmFunc{body: []byte{byte(expr.OpCodeCallIndirect), 0x01, 0x02}})
+	ins.OperandStack.Push(1)
+	if callIndirect(ins) != ErrTableIndexOutOfRange {
+		t.Fail()
+	}
+}
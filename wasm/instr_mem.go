@@ -1,53 +1,82 @@
 package wasm
 
 import (
-	"encoding/binary"
 	"errors"
+)
 
-	"github.com/c0mm4nd/wasman/config"
+// errors on memory instr
+var (
+	// ErrPtrOutOfBounds will be throw when the pointer visiting a pos out of the range of memory
+	ErrPtrOutOfBounds = errors.New("pointer is out of bounds")
+	// ErrDataSegmentNotFound will be throw when the data index is out of the range of data segments
+	ErrDataSegmentNotFound = errors.New("data segment not found")
+	// ErrMemoryIndexOutOfRange will be throw when the memory index is out of the range of memory index space
+	ErrMemoryIndexOutOfRange = errors.New("memory index out of range")
 )
 
-// ErrPtrOutOfBounds will be throw when the pointer visiting a pos out of the range of memory
-var ErrPtrOutOfBounds = errors.New("pointer is out of bounds")
+// memArgHasMemoryIndex is the bit of the alignment in memarg which means a memory index follows it
+const memArgHasMemoryIndex = 1 << 6
+
+// memoryBase reads the memarg immediates and returns the memory and the effective address,
+// ensuring the width bytes on the address are inside the memory.
+// The effective address of the memory32 takes 33 bits, which never wraps in the uint64 but may go over the memory
+func memoryBase(ins *Instance, width uint64) (*Memory, uint64, error) {
+	imm := &ins.current().imm
+	offset := imm[1] // u64 for the memory64
+	mem := ins.MemoryByIndex(uint32(imm[0]))
+	if mem == nil {
+		return nil, 0, ErrMemoryIndexOutOfRange
+	}
 
-func memoryBase(ins *Instance) (uint64, error) {
-	ins.Active.PC++
-	_, err := ins.fetchUint32() // ignore align
-	if err != nil {
-		return 0, err
+	base := offset + mem.address(ins.OperandStack.Pop())
+	if base < offset || !mem.inBounds(base, width) {
+		return nil, 0, ErrPtrOutOfBounds
 	}
-	ins.Active.PC++
-	v, err := ins.fetchUint32()
-	if err != nil {
-		return 0, err
+
+	return mem, base, nil
+}
+
+// fetchMemory returns the memory on the index immediate at i
+func (ins *Instance) fetchMemory(i int) (*Memory, error) {
+	mem := ins.MemoryByIndex(uint32(ins.current().imm[i]))
+	if mem == nil {
+		return nil, ErrMemoryIndexOutOfRange
 	}
 
-	base := uint64(v) + ins.OperandStack.Pop()
-	if !(base < uint64(len(ins.Memory.Value))) {
-		return 0, ErrPtrOutOfBounds
+	return mem, nil
+}
+
+// chunkBuffer returns the buffer of memory.copy and memory.fill on the Backing, at most a page long whatever the n,
+// which is allocated once for the instance
+func (ins *Instance) chunkBuffer(n uint64) []byte {
+	if ins.chunk == nil {
+		ins.chunk = make([]byte, memoryChunkSize)
+	}
+	if n < memoryChunkSize {
+		return ins.chunk[:n]
 	}
 
-	return base, nil
+	return ins.chunk
 }
 
 func i32Load(ins *Instance) error {
-	base, err := memoryBase(ins)
+	mem, base, err := memoryBase(ins, 4)
 	if err != nil {
 		return err
 	}
 
-	ins.OperandStack.Push(uint64(binary.LittleEndian.Uint32(ins.Memory.Value[base:])))
+	ins.OperandStack.Push(uint64(mem.loadUint32(base)))
 
 	return nil
 }
 
 func i64Load(ins *Instance) error {
-	base, err := memoryBase(ins)
+	mem, base, err := memoryBase(ins, 8)
 	if err != nil {
 		return err
 	}
 
-	ins.OperandStack.Push(binary.LittleEndian.Uint64(ins.Memory.Value[base:]))
+	ins.OperandStack.Push(mem.loadUint64(base))
 
 	return nil
 }
@@ -61,209 +90,338 @@ func f64Load(ins *Instance) error {
 }
 
 func i32Load8s(ins *Instance) error {
-	base, err := memoryBase(ins)
+	mem, base, err := memoryBase(ins, 1)
 	if err != nil {
 		return err
 	}
 
-	ins.OperandStack.Push(uint64(ins.Memory.Value[base]))
+	ins.OperandStack.Push(uint64(uint32(int32(int8(mem.loadUint8(base))))))
 
 	return nil
 }
 
 func i32Load8u(ins *Instance) error {
-	return i32Load8s(ins)
+	mem, base, err := memoryBase(ins, 1)
+	if err != nil {
+		return err
+	}
+
+	ins.OperandStack.Push(uint64(mem.loadUint8(base)))
+
+	return nil
 }
 
 func i32Load16s(ins *Instance) error {
-	base, err := memoryBase(ins)
+	mem, base, err := memoryBase(ins, 2)
 	if err != nil {
 		return err
 	}
 
-	ins.OperandStack.Push(uint64(binary.LittleEndian.Uint16(ins.Memory.Value[base:])))
+	ins.OperandStack.Push(uint64(uint32(int32(int16(mem.loadUint16(base))))))
 
 	return nil
 }
 
 func i32Load16u(ins *Instance) error {
-	return i32Load16s(ins)
+	mem, base, err := memoryBase(ins, 2)
+	if err != nil {
+		return err
+	}
+
+	ins.OperandStack.Push(uint64(mem.loadUint16(base)))
+
+	return nil
 }
 
 func i64Load8s(ins *Instance) error {
-	base, err := memoryBase(ins)
+	mem, base, err := memoryBase(ins, 1)
 	if err != nil {
 		return err
 	}
 
-	ins.OperandStack.Push(uint64(ins.Memory.Value[base]))
+	ins.OperandStack.Push(uint64(int64(int8(mem.loadUint8(base)))))
 
 	return nil
 }
 
 func i64Load8u(ins *Instance) error {
-	return i64Load8s(ins)
+	mem, base, err := memoryBase(ins, 1)
+	if err != nil {
+		return err
+	}
+
+	ins.OperandStack.Push(uint64(mem.loadUint8(base)))
+
+	return nil
 }
 
 func i64Load16s(ins *Instance) error {
-	base, err := memoryBase(ins)
+	mem, base, err := memoryBase(ins, 2)
 	if err != nil {
 		return err
 	}
 
-	ins.OperandStack.Push(uint64(binary.LittleEndian.Uint16(ins.Memory.Value[base:])))
+	ins.OperandStack.Push(uint64(int64(int16(mem.loadUint16(base)))))
 
 	return nil
 }
 
 func i64Load16u(ins *Instance) error {
-	return i64Load16s(ins)
+	mem, base, err := memoryBase(ins, 2)
+	if err != nil {
+		return err
+	}
+
+	ins.OperandStack.Push(uint64(mem.loadUint16(base)))
+
+	return nil
 }
 
 func i64Load32s(ins *Instance) error {
-	base, err := memoryBase(ins)
+	mem, base, err := memoryBase(ins, 4)
 	if err != nil {
 		return err
 	}
 
-	ins.OperandStack.Push(uint64(binary.LittleEndian.Uint32(ins.Memory.Value[base:])))
+	ins.OperandStack.Push(uint64(int64(int32(mem.loadUint32(base)))))
 
 	return nil
 }
 
 func i64Load32u(ins *Instance) error {
-	return i64Load32s(ins)
+	mem, base, err := memoryBase(ins, 4)
+	if err != nil {
+		return err
+	}
+
+	ins.OperandStack.Push(uint64(mem.loadUint32(base)))
+
+	return nil
 }
 
 func i32Store(ins *Instance) error {
 	val := ins.OperandStack.Pop()
-	base, err := memoryBase(ins)
+	mem, base, err := memoryBase(ins, 4)
 	if err != nil {
 		return err
 	}
 
-	binary.LittleEndian.PutUint32(ins.Memory.Value[base:], uint32(val))
+	mem.storeUint32(base, uint32(val))
 
 	return nil
 }
 
 func i64Store(ins *Instance) error {
 	val := ins.OperandStack.Pop()
-	base, err := memoryBase(ins)
+	mem, base, err := memoryBase(ins, 8)
 	if err != nil {
 		return err
 	}
 
-	binary.LittleEndian.PutUint64(ins.Memory.Value[base:], val)
+	mem.storeUint64(base, val)
 
 	return nil
 }
 
 func f32Store(ins *Instance) error {
 	val := ins.OperandStack.Pop()
-	base, err := memoryBase(ins)
+	mem, base, err := memoryBase(ins, 4)
 	if err != nil {
 		return err
 	}
 
-	binary.LittleEndian.PutUint32(ins.Memory.Value[base:], uint32(val))
+	mem.storeUint32(base, uint32(val))
 
 	return nil
 }
 
 func f64Store(ins *Instance) error {
 	v := ins.OperandStack.Pop()
-	base, err := memoryBase(ins)
+	mem, base, err := memoryBase(ins, 8)
 	if err != nil {
 		return err
 	}
 
-	binary.LittleEndian.PutUint64(ins.Memory.Value[base:], v)
+	mem.storeUint64(base, v)
 
 	return nil
 }
 
 func i32Store8(ins *Instance) error {
 	v := byte(ins.OperandStack.Pop())
-	base, err := memoryBase(ins)
+	mem, base, err := memoryBase(ins, 1)
 	if err != nil {
 		return err
 	}
 
-	ins.Memory.Value[base] = v
+	mem.storeUint8(base, v)
 
 	return nil
 }
 
 func i32Store16(ins *Instance) error {
 	v := uint16(ins.OperandStack.Pop())
-	base, err := memoryBase(ins)
+	mem, base, err := memoryBase(ins, 2)
 	if err != nil {
 		return err
 	}
 
-	binary.LittleEndian.PutUint16(ins.Memory.Value[base:], v)
+	mem.storeUint16(base, v)
 
 	return nil
 }
 
 func i64Store8(ins *Instance) error {
 	v := byte(ins.OperandStack.Pop())
-	base, err := memoryBase(ins)
+	mem, base, err := memoryBase(ins, 1)
 	if err != nil {
 		return err
 	}
 
-	ins.Memory.Value[base] = v
+	mem.storeUint8(base, v)
 
 	return nil
 }
 
 func i64Store16(ins *Instance) error {
 	v := uint16(ins.OperandStack.Pop())
-	base, err := memoryBase(ins)
+	mem, base, err := memoryBase(ins, 2)
 	if err != nil {
 		return err
 	}
 
-	binary.LittleEndian.PutUint16(ins.Memory.Value[base:], v)
+	mem.storeUint16(base, v)
 
 	return nil
 }
 
 func i64Store32(ins *Instance) error {
 	v := uint32(ins.OperandStack.Pop())
-	base, err := memoryBase(ins)
+	mem, base, err := memoryBase(ins, 4)
 	if err != nil {
 		return err
 	}
 
-	binary.LittleEndian.PutUint32(ins.Memory.Value[base:], v)
+	mem.storeUint32(base, v)
 
 	return nil
 }
 
 func memorySize(ins *Instance) error {
-	ins.Active.PC++
-	ins.OperandStack.Push(uint64(int32(len(ins.Memory.Value) / config.DefaultMemoryPageSize)))
+	mem, err := ins.fetchMemory(0)
+	if err != nil {
+		return err
+	}
+
+	ins.OperandStack.Push(mem.PageSize())
 
 	return nil
 }
 
 func memoryGrow(ins *Instance) error {
-	ins.Active.PC++
-	n := uint32(ins.OperandStack.Pop())
+	mem, err := ins.fetchMemory(0)
+	if err != nil {
+		return err
+	}
+
+	n := mem.address(ins.OperandStack.Pop())
+	ins.OperandStack.Push(mem.address(mem.Grow(n))) // -1 in the address type when failed
 
-	if ins.Module.MemorySection[0].Max != nil &&
-		uint64(n+uint32(len(ins.Memory.Value)/config.DefaultMemoryPageSize)) > uint64(*(ins.Module.MemorySection[0].Max)) {
-		v := int32(-1)
-		ins.OperandStack.Push(uint64(v))
+	return nil
+}
+
+func memoryInit(ins *Instance) error {
+	dataIndex := uint32(ins.current().imm[0])
+	mem, err := ins.fetchMemory(1)
+	if err != nil {
+		return err
+	}
+
+	n := uint64(uint32(ins.OperandStack.Pop()))
+	src := uint64(uint32(ins.OperandStack.Pop()))
+	dst := mem.address(ins.OperandStack.Pop())
+
+	if dataIndex >= uint32(len(ins.dataSegments)) {
+		return ErrDataSegmentNotFound
+	}
+
+	data := ins.dataSegments[dataIndex]
+	if src+n > uint64(len(data)) || !mem.inBounds(dst, n) {
+		return ErrPtrOutOfBounds
+	}
+
+	mem.write(data[src:src+n], dst)
+
+	return nil
+}
+
+func dataDrop(ins *Instance) error {
+	dataIndex := uint32(ins.current().imm[0])
+	if dataIndex >= uint32(len(ins.dataSegments)) {
+		return ErrDataSegmentNotFound
+	}
+
+	ins.dataSegments[dataIndex] = nil
+
+	return nil
+}
+
+func memoryCopy(ins *Instance) error {
+	dstMem, err := ins.fetchMemory(0)
+	if err != nil {
+		return err
+	}
+
+	srcMem, err := ins.fetchMemory(1)
+	if err != nil {
+		return err
+	}
+
+	// n is an i64 only when both memories are memory64
+	n := ins.OperandStack.Pop()
+	if !dstMem.Is64 || !srcMem.Is64 {
+		n = uint64(uint32(n))
+	}
+	src := srcMem.address(ins.OperandStack.Pop())
+	dst := dstMem.address(ins.OperandStack.Pop())
+
+	if !srcMem.inBounds(src, n) || !dstMem.inBounds(dst, n) {
+		return ErrPtrOutOfBounds
+	}
+
+	if srcMem.Backing == nil && dstMem.Backing == nil {
+		copy(dstMem.Value[dst:dst+n], srcMem.Value[src:src+n])
+		return nil
+	}
 
+	dstMem.copyFrom(srcMem, dst, src, n, ins.chunkBuffer(n))
+
+	return nil
+}
+
+func memoryFill(ins *Instance) error {
+	mem, err := ins.fetchMemory(0)
+	if err != nil {
+		return err
+	}
+
+	n := mem.address(ins.OperandStack.Pop())
+	val := byte(ins.OperandStack.Pop())
+	dst := mem.address(ins.OperandStack.Pop())
+
+	if !mem.inBounds(dst, n) {
+		return ErrPtrOutOfBounds
+	}
+
+	if mem.Backing != nil {
+		mem.fill(dst, n, val, ins.chunkBuffer(n))
 		return nil
 	}
 
-	ins.OperandStack.Push(uint64(len(ins.Memory.Value)) / config.DefaultMemoryPageSize)
-	ins.Memory.Value = append(ins.Memory.Value, make([]byte, n*config.DefaultMemoryPageSize)...)
+	region := mem.Value[dst : dst+n]
+	for i := range region {
+		region[i] = val
+	}
 
 	return nil
 }
@@ -16,9 +16,9 @@ import (
 func Test_i32Load(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Load), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0x01, 0x00, 0x00, 0x00},
@@ -38,9 +38,9 @@ func Test_i32Load(t *testing.T) {
 func Test_i64Load(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI64Load), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
@@ -60,9 +60,9 @@ func Test_i64Load(t *testing.T) {
 func Test_f32Load(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeF32Load), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			MemoryType: types.MemoryType{},
@@ -83,9 +83,9 @@ func Test_f32Load(t *testing.T) {
 func Test_f64Load(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeF64Load), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
@@ -105,9 +105,9 @@ func Test_f64Load(t *testing.T) {
 func Test_i32Load8s(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Load), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0xff},
@@ -127,9 +127,9 @@ func Test_i32Load8s(t *testing.T) {
 func Test_i32Load8u(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Load), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0xff},
@@ -149,9 +149,9 @@ func Test_i32Load8u(t *testing.T) {
 func Test_i32Load16s(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Load), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0xff, 0x01},
@@ -171,9 +171,9 @@ func Test_i32Load16s(t *testing.T) {
 func Test_i32Load16u(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Load), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0x00, 0xff},
@@ -193,9 +193,9 @@ func Test_i32Load16u(t *testing.T) {
 func Test_i64Load8s(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Load), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0xff},
@@ -215,9 +215,9 @@ func Test_i64Load8s(t *testing.T) {
 func Test_i64Load8u(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Load), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0xff},
@@ -237,9 +237,9 @@ func Test_i64Load8u(t *testing.T) {
 func Test_i64Load16s(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Load), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0xff, 0x01},
@@ -259,9 +259,9 @@ func Test_i64Load16s(t *testing.T) {
 func Test_i64Load16u(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Load), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0x00, 0xff},
@@ -281,9 +281,9 @@ func Test_i64Load16u(t *testing.T) {
 func Test_i64Load32s(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Load), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0xff, 0x01, 0x00, 0x01},
@@ -303,9 +303,9 @@ func Test_i64Load32s(t *testing.T) {
 func Test_i64Load32u(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Load), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0x00, 0xff, 0x00, 0xff},
@@ -325,9 +325,9 @@ func Test_i64Load32u(t *testing.T) {
 func Test_i32Store(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Store), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
@@ -348,9 +348,9 @@ func Test_i32Store(t *testing.T) {
 func Test_i64Store(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Store), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
@@ -376,9 +376,9 @@ func Test_i64Store(t *testing.T) {
 func Test_f32Store(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Store), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
@@ -399,9 +399,9 @@ func Test_f32Store(t *testing.T) {
 func Test_f64Store(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Store), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
@@ -422,9 +422,9 @@ func Test_f64Store(t *testing.T) {
 func Test_i32store8(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Store), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0x00, 0x00},
@@ -445,9 +445,9 @@ func Test_i32store8(t *testing.T) {
 func Test_i32store16(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Store), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0x00, 0x00, 0x00},
@@ -468,9 +468,9 @@ func Test_i32store16(t *testing.T) {
 func Test_i64store8(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Store), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0x00, 0x00},
@@ -491,9 +491,9 @@ func Test_i64store8(t *testing.T) {
 func Test_i64store16(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Store), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0x00, 0x00, 0x00},
@@ -514,9 +514,9 @@ func Test_i64store16(t *testing.T) {
 func Test_i64store32(t *testing.T) {
 	vm := &Instance{
 		Active: &Frame{
-			Func: &wasmFunc{
+			Func: compiled(&wasmFunc{
 				body: []byte{byte(expr.OpCodeI32Store), 0x00, 0x01},
-			},
+			}),
 		},
 		Memory: &Memory{
 			Value: []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
@@ -536,7 +536,9 @@ func Test_i64store32(t *testing.T) {
 
 func Test_memorySize(t *testing.T) {
 	vm := &Instance{
-		Active: &Frame{},
+		Active: &Frame{
+			Func: compiled(&wasmFunc{body: []byte{expr.OpCodeMemorySize, 0x00}}),
+		},
 		Memory: &Memory{
 			Value: make([]byte, config.DefaultMemoryPageSize*2),
 		},
@@ -554,14 +556,13 @@ func Test_memorySize(t *testing.T) {
 func Test_memoryGrow(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
 		vm := &Instance{
-			Active: &Frame{},
+			Active: &Frame{
+				Func: compiled(&wasmFunc{body: []byte{expr.OpCodeMemoryGrow, 0x00}}),
+			},
 			Memory: &Memory{
 				Value: make([]byte, config.DefaultMemoryPageSize*2),
 			},
 			OperandStack: stacks.NewOperandStack(),
-			Module: &Module{
-				MemorySection: []*types.MemoryType{{}},
-			},
 		}
 
 		vm.OperandStack.Push(5)
@@ -578,25 +579,576 @@ func Test_memoryGrow(t *testing.T) {
 
 	t.Run("oom", func(t *testing.T) {
 		vm := &Instance{
-			Active: &Frame{},
+			Active: &Frame{
+				Func: compiled(&wasmFunc{body: []byte{expr.OpCodeMemoryGrow, 0x00}}),
+			},
 			Memory: &Memory{
-				Value: make([]byte, config.DefaultMemoryPageSize*2),
+				MemoryType: types.MemoryType{Max: utils.Uint64Ptr(0)},
+				Value:      make([]byte, config.DefaultMemoryPageSize*2),
 			},
 			OperandStack: stacks.NewOperandStack(),
-			Module: &Module{
-				MemorySection: []*types.MemoryType{{Max: utils.Uint32Ptr(0)}},
-			},
 		}
 
-		exp := int32(-1)
 		vm.OperandStack.Push(5)
 		err := memoryGrow(vm)
 		if err != nil {
 			t.Fail()
 		}
-		if vm.OperandStack.Pop() != uint64(exp) {
+		if got := vm.OperandStack.Pop(); got != uint64(uint32(0xffffffff)) { // -1 in i32
+			t.Errorf("got %#x", got)
+		}
+	})
+
+}
+
+func Test_memoryInit(t *testing.T) {
+	vm := &Instance{
+		Active: &Frame{
+			Func: compiled(&wasmFunc{
+				body: []byte{expr.OpCodeMiscPrefix, byte(expr.OpCodeMemoryInit), 0x01, 0x00},
+			}),
+		},
+		Memory: &Memory{
+			Value: make([]byte, 8),
+		},
+		OperandStack: stacks.NewOperandStack(),
+		dataSegments: [][]byte{nil, {0x01, 0x02, 0x03, 0x04}},
+	}
+
+	vm.OperandStack.Push(2) // dst
+	vm.OperandStack.Push(1) // src
+	vm.OperandStack.Push(3) // n
+	if execCurrent(vm) != nil {
+		t.Fail()
+	}
+	if !bytes.Equal(vm.Memory.Value, []byte{0x00, 0x00, 0x02, 0x03, 0x04, 0x00, 0x00, 0x00}) {
+		t.Fail()
+	}
+
+	for _, args := range [][3]uint64{
+		{6, 0, 4}, // out of memory
+		{0, 2, 3}, // out of data
+	} {
+		vm.OperandStack.Push(args[0])
+		vm.OperandStack.Push(args[1])
+		vm.OperandStack.Push(args[2])
+		if execCurrent(vm) != ErrPtrOutOfBounds {
 			t.Fail()
 		}
+	}
+}
+
+func Test_dataDrop(t *testing.T) {
+	vm := &Instance{
+		Active: &Frame{
+			Func: compiled(&wasmFunc{
+				body: []byte{
+					expr.OpCodeMiscPrefix, byte(expr.OpCodeDataDrop), 0x00,
+					expr.OpCodeMiscPrefix, byte(expr.OpCodeMemoryInit), 0x00, 0x00,
+				},
+			}),
+		},
+		Memory: &Memory{
+			Value: make([]byte, 8),
+		},
+		OperandStack: stacks.NewOperandStack(),
+		dataSegments: [][]byte{{0x01, 0x02}},
+	}
+
+	if execCurrent(vm) != nil {
+		t.Fail()
+	}
+	if vm.dataSegments[0] != nil {
+		t.Fail()
+	}
+
+	// a dropped segment has the length of zero
+	vm.Active.PC = 1
+	vm.OperandStack.Push(0)
+	vm.OperandStack.Push(0)
+	vm.OperandStack.Push(0)
+	if execCurrent(vm) != nil {
+		t.Fail()
+	}
+
+	vm.Active.PC = 1
+	vm.OperandStack.Push(0)
+	vm.OperandStack.Push(0)
+	vm.OperandStack.Push(1)
+	if execCurrent(vm) != ErrPtrOutOfBounds {
+		t.Fail()
+	}
+}
+
+func Test_memoryCopy(t *testing.T) {
+	for _, c := range []struct {
+		dst, src, n uint64
+		exp         []byte
+		err         error
+	}{
+		{dst: 0, src: 4, n: 4, exp: []byte{5, 6, 7, 8, 5, 6, 7, 8}},
+		{dst: 1, src: 0, n: 4, exp: []byte{1, 1, 2, 3, 4, 6, 7, 8}},
+		{dst: 0, src: 1, n: 4, exp: []byte{2, 3, 4, 5, 5, 6, 7, 8}},
+		{dst: 8, src: 0, n: 0, exp: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{dst: 5, src: 0, n: 4, err: ErrPtrOutOfBounds},
+		{dst: 0, src: 9, n: 0, err: ErrPtrOutOfBounds},
+	} {
+		vm := &Instance{
+			Active: &Frame{
+				Func: compiled(&wasmFunc{
+					body: []byte{expr.OpCodeMiscPrefix, byte(expr.OpCodeMemoryCopy), 0x00, 0x00},
+				}),
+			},
+			Memory: &Memory{
+				Value: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+			},
+			OperandStack: stacks.NewOperandStack(),
+		}
+
+		vm.OperandStack.Push(c.dst)
+		vm.OperandStack.Push(c.src)
+		vm.OperandStack.Push(c.n)
+		if err := execCurrent(vm); err != c.err {
+			t.Log(err)
+			t.Fail()
+		}
+		if c.err == nil && !bytes.Equal(vm.Memory.Value, c.exp) {
+			t.Logf("%v", vm.Memory.Value)
+			t.Fail()
+		}
+	}
+}
+
+func Test_memoryFill(t *testing.T) {
+	vm := &Instance{
+		Active: &Frame{
+			Func: compiled(&wasmFunc{
+				body: []byte{expr.OpCodeMiscPrefix, byte(expr.OpCodeMemoryFill), 0x00},
+			}),
+		},
+		Memory: &Memory{
+			Value: make([]byte, 6),
+		},
+		OperandStack: stacks.NewOperandStack(),
+	}
+
+	vm.OperandStack.Push(1)
+	vm.OperandStack.Push(0xaa)
+	vm.OperandStack.Push(4)
+	if execCurrent(vm) != nil {
+		t.Fail()
+	}
+	if !bytes.Equal(vm.Memory.Value, []byte{0x00, 0xaa, 0xaa, 0xaa, 0xaa, 0x00}) {
+		t.Fail()
+	}
+
+	vm.OperandStack.Push(3)
+	vm.OperandStack.Push(0xbb)
+	vm.OperandStack.Push(4)
+	if execCurrent(vm) != ErrPtrOutOfBounds {
+		t.Fail()
+	}
+}
+
+func Test_multiMemory(t *testing.T) {
+	mem0 := &Memory{Value: make([]byte, config.DefaultMemoryPageSize)}
+	mem1 := &Memory{Value: make([]byte, config.DefaultMemoryPageSize)}
+	vm := &Instance{
+		Active: &Frame{
+			Func: compiled(&wasmFunc{
+				body: []byte{
+					expr.OpCodeI32Store, 0x42, 0x01, 0x04, // align 2 | memory index, memory 1, offset 4
+					expr.OpCodeI32Load, 0x42, 0x01, 0x00,
+					expr.OpCodeMemoryGrow, 0x01,
+					expr.OpCodeMemorySize, 0x01,
+					expr.OpCodeMiscPrefix, byte(expr.OpCodeMemoryCopy), 0x00, 0x01,
+					expr.OpCodeI32Load, 0x42, 0x02, 0x00,
+				},
+			}),
+		},
+		Memories:     []*Memory{mem0, mem1},
+		Memory:       mem0,
+		OperandStack: stacks.NewOperandStack(),
+	}
+
+	// i32.store on memory 1
+	vm.OperandStack.Push(0)
+	vm.OperandStack.Push(0xdeadbeef)
+	if i32Store(vm) != nil {
+		t.Fail()
+	}
+	if !bytes.Equal(mem1.Value[4:8], []byte{0xef, 0xbe, 0xad, 0xde}) || !bytes.Equal(mem0.Value[4:8], make([]byte, 4)) {
+		t.Fail()
+	}
+
+	// i32.load on memory 1
+	vm.Active.PC = 1
+	vm.OperandStack.Push(4)
+	if i32Load(vm) != nil {
+		t.Fail()
+	}
+	if vm.OperandStack.Pop() != 0xdeadbeef {
+		t.Fail()
+	}
+
+	// memory.grow and memory.size on memory 1
+	vm.Active.PC = 2
+	vm.OperandStack.Push(2)
+	if memoryGrow(vm) != nil {
+		t.Fail()
+	}
+	if vm.OperandStack.Pop() != 1 || mem0.PageSize() != 1 {
+		t.Fail()
+	}
+	vm.Active.PC = 3
+	if memorySize(vm) != nil {
+		t.Fail()
+	}
+	if vm.OperandStack.Pop() != 3 {
+		t.Fail()
+	}
+
+	// memory.copy from memory 1 to memory 0
+	vm.Active.PC = 4
+	vm.OperandStack.Push(0)
+	vm.OperandStack.Push(4)
+	vm.OperandStack.Push(4)
+	if execCurrent(vm) != nil {
+		t.Fail()
+	}
+	if !bytes.Equal(mem0.Value[0:4], []byte{0xef, 0xbe, 0xad, 0xde}) {
+		t.Fail()
+	}
+
+	// memory 2 does not exist
+	vm.Active.PC = 5
+	vm.OperandStack.Push(0)
+	if i32Load(vm) != ErrMemoryIndexOutOfRange {
+		t.Fail()
+	}
+}
+
+func Test_memory64(t *testing.T) {
+	mem := &Memory{
+		MemoryType: types.MemoryType{Min: 1 << 18, Is64: true},
+		Backing:    NewSparseMemoryBacking(MemoryPagesToBytesNum(1 << 18)), // 16GiB
+	}
+	vm := &Instance{
+		Active: &Frame{
+			Func: compiled(&wasmFunc{
+				body: []byte{
+					expr.OpCodeI64Store, 0x03, 0x80, 0x80, 0x80, 0x80, 0x10, // offset 1 << 32
+					expr.OpCodeI64Load, 0x03, 0x80, 0x80, 0x80, 0x80, 0x10,
+					expr.OpCodeMemorySize, 0x00,
+					expr.OpCodeMemoryGrow, 0x00,
+					expr.OpCodeI32Load8u, 0x00, 0x00,
+				},
+			}),
+		},
+		Memories:     []*Memory{mem},
+		Memory:       mem,
+		OperandStack: stacks.NewOperandStack(),
+	}
+
+	// i64.store and i64.load over 4GiB
+	vm.OperandStack.Push(1<<32 + 8)
+	vm.OperandStack.Push(0x0102030405060708)
+	if i64Store(vm) != nil {
+		t.Fail()
+	}
+	buf := make([]byte, 8)
+	mem.Backing.ReadAt(buf, 1<<33+8)
+	if !bytes.Equal(buf, []byte{8, 7, 6, 5, 4, 3, 2, 1}) {
+		t.Fail()
+	}
+
+	vm.Active.PC = 1
+	vm.OperandStack.Push(1<<32 + 8)
+	if i64Load(vm) != nil {
+		t.Fail()
+	}
+	if vm.OperandStack.Pop() != 0x0102030405060708 {
+		t.Fail()
+	}
+
+	// memory.size and memory.grow with i64 pages
+	vm.Active.PC = 2
+	if memorySize(vm) != nil {
+		t.Fail()
+	}
+	if vm.OperandStack.Pop() != 1<<18 {
+		t.Fail()
+	}
+
+	vm.Active.PC = 3
+	vm.OperandStack.Push(1 << 40)
+	if memoryGrow(vm) != nil {
+		t.Fail()
+	}
+	if vm.OperandStack.Pop() != 1<<18 || mem.PageSize() != 1<<18+1<<40 {
+		t.Fail()
+	}
+
+	vm.Active.PC = 3
+	vm.OperandStack.Push(1 << 48)
+	if memoryGrow(vm) != nil {
+		t.Fail()
+	}
+	if vm.OperandStack.Pop() != MemoryGrowFailed {
+		t.Fail()
+	}
+
+	// the address is not truncated into 32 bits, and unwritten bytes read as zero
+	vm.Active.PC = 4
+	vm.OperandStack.Push(1<<40 + 1)
+	if i32Load8u(vm) != nil {
+		t.Fail()
+	}
+	if vm.OperandStack.Pop() != 0 {
+		t.Fail()
+	}
+
+	// out of bounds
+	vm.Active.PC = 4
+	vm.OperandStack.Push(mem.Len())
+	if i32Load8u(vm) != ErrPtrOutOfBounds {
+		t.Fail()
+	}
+}
+
+func Test_memory32AddressTruncation(t *testing.T) {
+	mem := &Memory{Value: make([]byte, config.DefaultMemoryPageSize)}
+	mem.Value[4] = 0xff
+	vm := &Instance{
+		Active: &Frame{
+			Func: compiled(&wasmFunc{
+				body: []byte{expr.OpCodeI32Load8u, 0x00, 0x00},
+			}),
+		},
+		Memories:     []*Memory{mem},
+		Memory:       mem,
+		OperandStack: stacks.NewOperandStack(),
+	}
+
+	vm.OperandStack.Push(1<<32 + 4)
+	if i32Load8u(vm) != nil {
+		t.Fail()
+	}
+	if vm.OperandStack.Pop() != 0xff {
+		t.Fail()
+	}
+}
+
+// Test_memoryBounds runs every load and store on the edges of the memory, which trap
+// once the effective address plus the width goes over the memory, like the address.wast of the spec
+func Test_memoryBounds(t *testing.T) {
+	const size = 32
+	uleb := func(v uint64) []byte {
+		var b []byte
+		for {
+			c := byte(v & 0x7f)
+			v >>= 7
+			if v == 0 {
+				return append(b, c)
+			}
+			b = append(b, c|0x80)
+		}
+	}
+
+	type op struct {
+		code   expr.OpCode
+		width  uint64
+		signed bool
+		i64    bool // the i64 result, or else the i32 one kept in 32 bits
+		store  bool
+	}
+	ops := []op{
+		{code: expr.OpCodeI32Load, width: 4},
+		{code: expr.OpCodeI64Load, width: 8, i64: true},
+		{code: expr.OpCodeF32Load, width: 4},
+		{code: expr.OpCodeF64Load, width: 8, i64: true},
+		{code: expr.OpCodeI32Load8s, width: 1, signed: true},
+		{code: expr.OpCodeI32Load8u, width: 1},
+		{code: expr.OpCodeI32Load16s, width: 2, signed: true},
+		{code: expr.OpCodeI32Load16u, width: 2},
+		{code: expr.OpCodeI64Load8s, width: 1, signed: true, i64: true},
+		{code: expr.OpCodeI64Load8u, width: 1, i64: true},
+		{code: expr.OpCodeI64Load16s, width: 2, signed: true, i64: true},
+		{code: expr.OpCodeI64Load16u, width: 2, i64: true},
+		{code: expr.OpCodeI64Load32s, width: 4, signed: true, i64: true},
+		{code: expr.OpCodeI64Load32u, width: 4, i64: true},
+		{code: expr.OpCodeI32Store, width: 4, store: true},
+		{code: expr.OpCodeI64Store, width: 8, store: true},
+		{code: expr.OpCodeF32Store, width: 4, store: true},
+		{code: expr.OpCodeF64Store, width: 8, store: true},
+		{code: expr.OpCodeI32Store8, width: 1, store: true},
+		{code: expr.OpCodeI32Store16, width: 2, store: true},
+		{code: expr.OpCodeI64Store8, width: 1, store: true},
+		{code: expr.OpCodeI64Store16, width: 2, store: true},
+		{code: expr.OpCodeI64Store32, width: 4, store: true},
+	}
+
+	for _, o := range ops {
+		edges := []uint64{0, 1, size - o.width - 1, size - o.width, size - o.width + 1, size - 1, size, math.MaxUint32}
+		for _, offset := range edges {
+			for _, addr := range edges {
+				mem := &Memory{Value: make([]byte, size)}
+				for i := range mem.Value {
+					mem.Value[i] = 0x80 | byte(i)
+				}
+				vm := &Instance{
+					Active: &Frame{
+						Func: compiled(&wasmFunc{body: append([]byte{o.code, 0x00}, uleb(offset)...)}),
+					},
+					Memory:       mem,
+					OperandStack: stacks.NewOperandStack(),
+				}
+
+				val := uint64(0x0102_0304_0506_0708)
+				vm.OperandStack.Push(addr)
+				if o.store {
+					vm.OperandStack.Push(val)
+				}
+				err := vm.Active.Func.code[0].fn(vm)
+
+				ea := offset + addr // 33 bits
+				if ea+o.width > size {
+					if err != ErrPtrOutOfBounds {
+						t.Errorf("%#x at %d+%d: got %v", o.code, offset, addr, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("%#x at %d+%d: got %v", o.code, offset, addr, err)
+					continue
+				}
+
+				if o.store {
+					for i, b := range mem.Value {
+						exp := 0x80 | byte(i)
+						if uint64(i) >= ea && uint64(i) < ea+o.width {
+							exp = byte(val >> (8 * (uint64(i) - ea)))
+						}
+						if b != exp {
+							t.Errorf("%#x at %d+%d: got %#x at %d, want %#x", o.code, offset, addr, b, i, exp)
+						}
+					}
+					continue
+				}
+
+				var exp uint64
+				for i := o.width; i > 0; i-- {
+					exp = exp<<8 | uint64(mem.Value[ea+i-1])
+				}
+				if o.signed {
+					shift := 64 - 8*o.width
+					exp = uint64(int64(exp<<shift) >> shift)
+				}
+				if !o.i64 {
+					exp = uint64(uint32(exp))
+				}
+				if got := vm.OperandStack.Pop(); got != exp || vm.OperandStack.Ptr != -1 {
+					t.Errorf("%#x at %d+%d: got %#x, want %#x", o.code, offset, addr, got, exp)
+				}
+			}
+		}
+	}
+
+	t.Run("memory64", func(t *testing.T) {
+		// the offset plus the address wraps in 64 bits
+		mem := &Memory{MemoryType: types.MemoryType{Is64: true}, Value: make([]byte, size)}
+		vm := &Instance{
+			Active: &Frame{
+				Func: compiled(&wasmFunc{body: append([]byte{expr.OpCodeI64Load, 0x00}, uleb(math.MaxUint64-3)...)}),
+			},
+			Memory:       mem,
+			OperandStack: stacks.NewOperandStack(),
+		}
+		vm.OperandStack.Push(8)
+		if err := i64Load(vm); err != ErrPtrOutOfBounds {
+			t.Errorf("got %v", err)
+		}
 	})
+}
 
+func Test_memoryCopyFill_backing(t *testing.T) {
+	const size = 3 * config.DefaultMemoryPageSize
+	for _, c := range []struct {
+		name        string
+		dst, src, n uint64
+	}{
+		{name: "forward", dst: 10, src: 100, n: 2*config.DefaultMemoryPageSize + 7},
+		{name: "backward", dst: 100, src: 10, n: 2*config.DefaultMemoryPageSize + 7},
+		{name: "disjoint", dst: 2 * config.DefaultMemoryPageSize, src: 0, n: 1000},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			exp := make([]byte, size)
+			for i := range exp {
+				exp[i] = byte(i * 7)
+			}
+			mem := &Memory{Backing: NewSparseMemoryBacking(size)}
+			mem.Backing.WriteAt(exp, 0)
+			vm := &Instance{
+				Active: &Frame{
+					Func: compiled(&wasmFunc{
+						body: []byte{expr.OpCodeMiscPrefix, byte(expr.OpCodeMemoryCopy), 0x00, 0x00},
+					}),
+				},
+				Memory:       mem,
+				OperandStack: stacks.NewOperandStack(),
+			}
+
+			vm.OperandStack.Push(c.dst)
+			vm.OperandStack.Push(c.src)
+			vm.OperandStack.Push(c.n)
+			if err := execCurrent(vm); err != nil {
+				t.Fatal(err)
+			}
+			copy(exp[c.dst:c.dst+c.n], exp[c.src:c.src+c.n])
+			got := make([]byte, size)
+			mem.Backing.ReadAt(got, 0)
+			if !bytes.Equal(got, exp) {
+				t.Error("not copied like the copy builtin")
+			}
+		})
+	}
+
+	t.Run("fill", func(t *testing.T) {
+		s := NewSparseMemoryBacking(MemoryPagesToBytesNum(1 << 18)) // 16GiB
+		s.WriteAt([]byte{1}, MemoryPagesToBytesNum(2))
+		mem := &Memory{MemoryType: types.MemoryType{Is64: true}, Backing: s}
+		vm := &Instance{
+			Active: &Frame{
+				Func: compiled(&wasmFunc{
+					body: []byte{expr.OpCodeMiscPrefix, byte(expr.OpCodeMemoryFill), 0x00},
+				}),
+			},
+			Memory:       mem,
+			OperandStack: stacks.NewOperandStack(),
+		}
+
+		// the zero leaves the pages never written alone
+		vm.OperandStack.Push(1)
+		vm.OperandStack.Push(0)
+		vm.OperandStack.Push(mem.Len() - 1)
+		if err := execCurrent(vm); err != nil {
+			t.Fatal(err)
+		}
+		if len(s.pages) != 1 || s.pages[2][0] != 0 {
+			t.Errorf("got %d pages", len(s.pages))
+		}
+
+		vm.Active.PC = 0
+		vm.OperandStack.Push(config.DefaultMemoryPageSize - 1)
+		vm.OperandStack.Push(0xaa)
+		vm.OperandStack.Push(2)
+		if err := execCurrent(vm); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, 4)
+		s.ReadAt(got, config.DefaultMemoryPageSize-2)
+		if !bytes.Equal(got, []byte{0, 0xaa, 0xaa, 0}) || len(s.pages) != 3 {
+			t.Errorf("got %v on %d pages", got, len(s.pages))
+		}
+	})
 }
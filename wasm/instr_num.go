@@ -9,8 +9,11 @@ import (
 // ErrUndefined is a panic error
 var ErrUndefined = errors.New("undefined")
 
+// the i32 values are zero-extended in the 64 bits of the slots, so every instr producing an i32
+// pushes uint64(uint32(result)), while the ones consuming it only read its low 32 bits
+
 func i32eqz(ins *Instance) error {
-	if ins.OperandStack.Pop() == 0 {
+	if uint32(ins.OperandStack.Pop()) == 0 {
 		ins.OperandStack.Push(1)
 	} else {
 		ins.OperandStack.Push(0)
@@ -20,8 +23,8 @@ func i32eqz(ins *Instance) error {
 }
 
 func i32eq(ins *Instance) error {
-	v1 := ins.OperandStack.Pop()
-	v2 := ins.OperandStack.Pop()
+	v1 := uint32(ins.OperandStack.Pop())
+	v2 := uint32(ins.OperandStack.Pop())
 	if v1 == v2 {
 		ins.OperandStack.Push(1)
 	} else {
@@ -32,8 +35,8 @@ func i32eq(ins *Instance) error {
 }
 
 func i32ne(ins *Instance) error {
-	v1 := ins.OperandStack.Pop()
-	v2 := ins.OperandStack.Pop()
+	v1 := uint32(ins.OperandStack.Pop())
+	v2 := uint32(ins.OperandStack.Pop())
 	if v1 != v2 {
 		ins.OperandStack.Push(1)
 	} else {
@@ -432,7 +435,7 @@ func i32popcnt(ins *Instance) error {
 }
 
 func i32add(ins *Instance) error {
-	ins.OperandStack.Push(uint64(int32(ins.OperandStack.Pop()) + int32(ins.OperandStack.Pop())))
+	ins.OperandStack.Push(uint64(uint32(ins.OperandStack.Pop()) + uint32(ins.OperandStack.Pop())))
 
 	return nil
 }
@@ -440,13 +443,13 @@ func i32add(ins *Instance) error {
 func i32sub(ins *Instance) error {
 	v2 := ins.OperandStack.Pop()
 	v1 := ins.OperandStack.Pop()
-	ins.OperandStack.Push(uint64(int32(v1) - int32(v2)))
+	ins.OperandStack.Push(uint64(uint32(v1) - uint32(v2)))
 
 	return nil
 }
 
 func i32mul(ins *Instance) error {
-	ins.OperandStack.Push(uint64(int32(ins.OperandStack.Pop()) * int32(ins.OperandStack.Pop())))
+	ins.OperandStack.Push(uint64(uint32(ins.OperandStack.Pop()) * uint32(ins.OperandStack.Pop())))
 
 	return nil
 }
@@ -457,7 +460,7 @@ func i32divs(ins *Instance) error {
 	if v2 == 0 || (v1 == math.MinInt32 && v2 == -1) {
 		return ErrUndefined
 	}
-	ins.OperandStack.Push(uint64(v1 / v2))
+	ins.OperandStack.Push(uint64(uint32(v1 / v2)))
 
 	return nil
 }
@@ -473,7 +476,7 @@ func i32divu(ins *Instance) error {
 func i32rems(ins *Instance) error {
 	v2 := int32(ins.OperandStack.Pop())
 	v1 := int32(ins.OperandStack.Pop())
-	ins.OperandStack.Push(uint64(v1 % v2))
+	ins.OperandStack.Push(uint64(uint32(v1 % v2)))
 
 	return nil
 }
@@ -529,7 +532,7 @@ func i32shru(ins *Instance) error {
 func i32shrs(ins *Instance) error {
 	v2 := uint32(ins.OperandStack.Pop())
 	v1 := int32(ins.OperandStack.Pop())
-	ins.OperandStack.Push(uint64(v1 >> (v2 % 32)))
+	ins.OperandStack.Push(uint64(uint32(v1 >> (v2 % 32))))
 
 	return nil
 }
@@ -906,7 +909,7 @@ func i32wrapi64(ins *Instance) error {
 
 func i32truncf32s(ins *Instance) error {
 	v := math.Float32frombits(uint32(ins.OperandStack.Pop()))
-	ins.OperandStack.Push(uint64(int32(math.Trunc(float64(v)))))
+	ins.OperandStack.Push(uint64(uint32(int32(math.Trunc(float64(v))))))
 
 	return nil
 }
@@ -920,7 +923,7 @@ func i32truncf32u(ins *Instance) error {
 
 func i32truncf64s(ins *Instance) error {
 	v := math.Float64frombits(ins.OperandStack.Pop())
-	ins.OperandStack.Push(uint64(int32(math.Trunc(v))))
+	ins.OperandStack.Push(uint64(uint32(int32(math.Trunc(v)))))
 
 	return nil
 }
@@ -1043,3 +1046,120 @@ func f64promotef32(ins *Instance) error {
 
 	return nil
 }
+
+func i32extend8s(ins *Instance) error {
+	v := int32(int8(ins.OperandStack.Pop()))
+	ins.OperandStack.Push(uint64(uint32(v)))
+
+	return nil
+}
+
+func i32extend16s(ins *Instance) error {
+	v := int32(int16(ins.OperandStack.Pop()))
+	ins.OperandStack.Push(uint64(uint32(v)))
+
+	return nil
+}
+
+func i64extend8s(ins *Instance) error {
+	v := int64(int8(ins.OperandStack.Pop()))
+	ins.OperandStack.Push(uint64(v))
+
+	return nil
+}
+
+func i64extend16s(ins *Instance) error {
+	v := int64(int16(ins.OperandStack.Pop()))
+	ins.OperandStack.Push(uint64(v))
+
+	return nil
+}
+
+func i64extend32s(ins *Instance) error {
+	v := int64(int32(ins.OperandStack.Pop()))
+	ins.OperandStack.Push(uint64(v))
+
+	return nil
+}
+
+// truncSatS truncates v to a signed integer within [min, max], NaN becomes 0
+func truncSatS(v float64, min, max int64) int64 {
+	switch {
+	case math.IsNaN(v):
+		return 0
+	case v <= float64(min):
+		return min
+	case v >= float64(max):
+		return max
+	default:
+		return int64(math.Trunc(v))
+	}
+}
+
+// truncSatU truncates v to an unsigned integer within [0, max], NaN becomes 0
+func truncSatU(v float64, max uint64) uint64 {
+	switch {
+	case math.IsNaN(v), v <= 0:
+		return 0
+	case v >= float64(max):
+		return max
+	default:
+		return uint64(math.Trunc(v))
+	}
+}
+
+func i32truncsatf32s(ins *Instance) error {
+	v := float64(math.Float32frombits(uint32(ins.OperandStack.Pop())))
+	ins.OperandStack.Push(uint64(uint32(truncSatS(v, math.MinInt32, math.MaxInt32))))
+
+	return nil
+}
+
+func i32truncsatf32u(ins *Instance) error {
+	v := float64(math.Float32frombits(uint32(ins.OperandStack.Pop())))
+	ins.OperandStack.Push(truncSatU(v, math.MaxUint32))
+
+	return nil
+}
+
+func i32truncsatf64s(ins *Instance) error {
+	v := math.Float64frombits(ins.OperandStack.Pop())
+	ins.OperandStack.Push(uint64(uint32(truncSatS(v, math.MinInt32, math.MaxInt32))))
+
+	return nil
+}
+
+func i32truncsatf64u(ins *Instance) error {
+	v := math.Float64frombits(ins.OperandStack.Pop())
+	ins.OperandStack.Push(truncSatU(v, math.MaxUint32))
+
+	return nil
+}
+
+func i64truncsatf32s(ins *Instance) error {
+	v := float64(math.Float32frombits(uint32(ins.OperandStack.Pop())))
+	ins.OperandStack.Push(uint64(truncSatS(v, math.MinInt64, math.MaxInt64)))
+
+	return nil
+}
+
+func i64truncsatf32u(ins *Instance) error {
+	v := float64(math.Float32frombits(uint32(ins.OperandStack.Pop())))
+	ins.OperandStack.Push(truncSatU(v, math.MaxUint64))
+
+	return nil
+}
+
+func i64truncsatf64s(ins *Instance) error {
+	v := math.Float64frombits(ins.OperandStack.Pop())
+	ins.OperandStack.Push(uint64(truncSatS(v, math.MinInt64, math.MaxInt64)))
+
+	return nil
+}
+
+func i64truncsatf64u(ins *Instance) error {
+	v := math.Float64frombits(ins.OperandStack.Pop())
+	ins.OperandStack.Push(truncSatU(v, math.MaxUint64))
+
+	return nil
+}
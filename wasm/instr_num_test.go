@@ -1,6 +1,7 @@
 package wasm
 
 import (
+	"math"
 	"testing"
 
 	"github.com/c0mm4nd/wasman/stacks"
@@ -23,6 +24,7 @@ func (s *NumTestSet) Test_i32eqz(t *testing.T) {
 	}{
 		{input: 0, want: 1},
 		{input: 1, want: 0},
+		{input: 1 << 32, want: 1}, // the bits over the i32
 	}
 	for _, tt := range testTable {
 		s.vm.OperandStack.Push(uint64(tt.input))
@@ -55,6 +57,40 @@ func (s *NumTestSet) Test_i32ne(t *testing.T) {
 	}
 }
 
+// Test_i32eq checks i32.eq and i32.ne compare the low 32 bits only, ignoring the high bits
+// which the i32 values from the host or the sign extension may carry
+func (s *NumTestSet) Test_i32eq(t *testing.T) {
+	var testTable = []struct {
+		input [2]uint64
+		eq    uint64
+	}{
+		{input: [2]uint64{3, 3}, eq: 1},
+		{input: [2]uint64{3, 4}, eq: 0},
+		{input: [2]uint64{0xffffffff, math.MaxUint64}, eq: 1},
+		{input: [2]uint64{1 << 32, 0}, eq: 1},
+		{input: [2]uint64{1<<32 | 1, 0}, eq: 0},
+	}
+	for _, tt := range testTable {
+		s.vm.OperandStack.Push(tt.input[0])
+		s.vm.OperandStack.Push(tt.input[1])
+		if i32eq(s.vm) != nil {
+			t.Fail()
+		}
+		if got := s.vm.OperandStack.Pop(); got != tt.eq {
+			t.Errorf("i32.eq %#x: got %d", tt.input, got)
+		}
+
+		s.vm.OperandStack.Push(tt.input[0])
+		s.vm.OperandStack.Push(tt.input[1])
+		if i32ne(s.vm) != nil {
+			t.Fail()
+		}
+		if got := s.vm.OperandStack.Pop(); got != 1-tt.eq {
+			t.Errorf("i32.ne %#x: got %d", tt.input, got)
+		}
+	}
+}
+
 func (s *NumTestSet) Test_i32lts(t *testing.T) {
 	var testTable = []struct {
 		input [2]int
@@ -115,12 +151,87 @@ func (s *NumTestSet) Test_i32gts(t *testing.T) {
 	}
 }
 
+func (s *NumTestSet) Test_signExtension(t *testing.T) {
+	var testTable = []struct {
+		name  string
+		instr func(ins *Instance) error
+		input uint64
+		want  uint64
+	}{
+		{name: "i32.extend8_s", instr: i32extend8s, input: 0x7f, want: 0x7f},
+		{name: "i32.extend8_s", instr: i32extend8s, input: 0x80, want: 0xffffff80},
+		{name: "i32.extend8_s", instr: i32extend8s, input: 0x12345680, want: 0xffffff80},
+		{name: "i32.extend16_s", instr: i32extend16s, input: 0x7fff, want: 0x7fff},
+		{name: "i32.extend16_s", instr: i32extend16s, input: 0x8000, want: 0xffff8000},
+		{name: "i32.extend16_s", instr: i32extend16s, input: 0x12348000, want: 0xffff8000},
+		{name: "i64.extend8_s", instr: i64extend8s, input: 0x7f, want: 0x7f},
+		{name: "i64.extend8_s", instr: i64extend8s, input: 0x80, want: 0xffffffffffffff80},
+		{name: "i64.extend8_s", instr: i64extend8s, input: 0x0123456789abcd01, want: 0x01},
+		{name: "i64.extend16_s", instr: i64extend16s, input: 0x8000, want: 0xffffffffffff8000},
+		{name: "i64.extend16_s", instr: i64extend16s, input: 0x0123456789ab7fff, want: 0x7fff},
+		{name: "i64.extend32_s", instr: i64extend32s, input: 0x80000000, want: 0xffffffff80000000},
+		{name: "i64.extend32_s", instr: i64extend32s, input: 0x012345677fffffff, want: 0x7fffffff},
+	}
+	for _, tt := range testTable {
+		s.vm.OperandStack.Push(tt.input)
+		if tt.instr(s.vm) != nil {
+			t.Fail()
+		}
+		if actual := s.vm.OperandStack.Pop(); actual != tt.want {
+			t.Logf("%s(%#x): got %#x, want %#x", tt.name, tt.input, actual, tt.want)
+			t.Fail()
+		}
+	}
+}
+
+func (s *NumTestSet) Test_truncSat(t *testing.T) {
+	f32 := func(v float32) uint64 { return uint64(math.Float32bits(v)) }
+	f64 := math.Float64bits
+	var testTable = []struct {
+		name  string
+		instr func(ins *Instance) error
+		input uint64
+		want  uint64
+	}{
+		{name: "i32.trunc_sat_f32_s", instr: i32truncsatf32s, input: f32(-1.5), want: 0xffffffff},
+		{name: "i32.trunc_sat_f32_s", instr: i32truncsatf32s, input: f32(float32(math.NaN())), want: 0},
+		{name: "i32.trunc_sat_f32_s", instr: i32truncsatf32s, input: f32(3e9), want: math.MaxInt32},
+		{name: "i32.trunc_sat_f32_s", instr: i32truncsatf32s, input: f32(-3e9), want: 0x80000000},
+		{name: "i32.trunc_sat_f32_u", instr: i32truncsatf32u, input: f32(-1.5), want: 0},
+		{name: "i32.trunc_sat_f32_u", instr: i32truncsatf32u, input: f32(5e9), want: math.MaxUint32},
+		{name: "i32.trunc_sat_f64_s", instr: i32truncsatf64s, input: f64(2147483647.9), want: math.MaxInt32},
+		{name: "i32.trunc_sat_f64_s", instr: i32truncsatf64s, input: f64(math.Inf(-1)), want: 0x80000000},
+		{name: "i32.trunc_sat_f64_u", instr: i32truncsatf64u, input: f64(4294967295.5), want: math.MaxUint32},
+		{name: "i32.trunc_sat_f64_u", instr: i32truncsatf64u, input: f64(math.NaN()), want: 0},
+		{name: "i64.trunc_sat_f32_s", instr: i64truncsatf32s, input: f32(-2.5), want: 0xfffffffffffffffe},
+		{name: "i64.trunc_sat_f32_s", instr: i64truncsatf32s, input: f32(float32(math.Inf(1))), want: math.MaxInt64},
+		{name: "i64.trunc_sat_f32_u", instr: i64truncsatf32u, input: f32(1e20), want: math.MaxUint64},
+		{name: "i64.trunc_sat_f64_s", instr: i64truncsatf64s, input: f64(-1e19), want: 0x8000000000000000},
+		{name: "i64.trunc_sat_f64_s", instr: i64truncsatf64s, input: f64(123.9), want: 123},
+		{name: "i64.trunc_sat_f64_u", instr: i64truncsatf64u, input: f64(-0.9), want: 0},
+		{name: "i64.trunc_sat_f64_u", instr: i64truncsatf64u, input: f64(1e19), want: 10000000000000000000},
+	}
+	for _, tt := range testTable {
+		s.vm.OperandStack.Push(tt.input)
+		if tt.instr(s.vm) != nil {
+			t.Fail()
+		}
+		if actual := s.vm.OperandStack.Pop(); actual != tt.want {
+			t.Logf("%s(%#x): got %#x, want %#x", tt.name, tt.input, actual, tt.want)
+			t.Fail()
+		}
+	}
+}
+
 func TestRunSuite(t *testing.T) {
 	set := new(NumTestSet)
 	set.SetupTest()
 	set.Test_i32eqz(t)
 	set.Test_i32ne(t)
+	set.Test_i32eq(t)
 	set.Test_i32lts(t)
 	set.Test_i32ltu(t)
 	set.Test_i32gts(t)
+	set.Test_signExtension(t)
+	set.Test_truncSat(t)
 }
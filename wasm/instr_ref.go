@@ -0,0 +1,28 @@
+package wasm
+
+func refNullOp(ins *Instance) error {
+	ins.OperandStack.Push(refNull)
+
+	return nil
+}
+
+func refIsNull(ins *Instance) error {
+	if ins.OperandStack.Pop() == refNull {
+		ins.OperandStack.Push(1)
+	} else {
+		ins.OperandStack.Push(0)
+	}
+
+	return nil
+}
+
+func refFunc(ins *Instance) error {
+	index := uint32(ins.current().imm[0])
+	if index >= uint32(len(ins.Functions)) {
+		return ErrFuncIndexOutOfRange
+	}
+
+	ins.OperandStack.Push(refFromIndex(&index))
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package wasm
+
+import (
+	"testing"
+
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/stacks"
+	"github.com/c0mm4nd/wasman/types"
+)
+
+func Test_refNull(t *testing.T) {
+	vm := &Instance{
+		Active: &Frame{
+			Func: compiled(&wasmFunc{body: []byte{expr.OpCodeNull, byte(types.ValueTypeExternRef)}}),
+		},
+		OperandStack: stacks.NewOperandStack(),
+	}
+	if refNullOp(vm) != nil {
+		t.Fail()
+	}
+	if vm.OperandStack.Pop() != refNull {
+		t.Fail()
+	}
+}
+
+func Test_refIsNull(t *testing.T) {
+	vm := &Instance{OperandStack: stacks.NewOperandStack()}
+	for _, c := range []struct {
+		ref uint64
+		exp uint64
+	}{
+		{ref: refNull, exp: 1},
+		{ref: 1, exp: 0},
+		{ref: 100, exp: 0},
+	} {
+		vm.OperandStack.Push(c.ref)
+		if refIsNull(vm) != nil {
+			t.Fail()
+		}
+		if vm.OperandStack.Pop() != c.exp {
+			t.Fail()
+		}
+	}
+}
+
+func Test_refFunc(t *testing.T) {
+	vm := &Instance{
+		Active: &Frame{
+			Func: compiled(&wasmFunc{body: []byte{expr.OpCodeFunc, 0x01}}),
+		},
+		Functions:    []fn{&dummyFunc{}, &dummyFunc{}},
+		OperandStack: stacks.NewOperandStack(),
+	}
+	if refFunc(vm) != nil {
+		t.Fail()
+	}
+	if ref := vm.OperandStack.Pop(); ref != 2 || *refToIndex(ref) != 1 {
+		t.Fail()
+	}
+
+	vm.Active.Func = compiled(&wasmFunc{body: []byte{expr.OpCodeFunc, 0x02}})
+	if refFunc(vm) != ErrFuncIndexOutOfRange {
+		t.Fail()
+	}
+}
+
+func TestInstance_ExternRef(t *testing.T) {
+	vm := &Instance{}
+	type object struct{ name string }
+	a, b := &object{name: "a"}, &object{name: "b"}
+
+	refA, refB := vm.NewExternRef(a), vm.NewExternRef(b)
+	if refA == refNull || refB == refNull || refA == refB {
+		t.Fail()
+	}
+	if vm.ExternRef(refA) != a || vm.ExternRef(refB) != b {
+		t.Fail()
+	}
+	if vm.ExternRef(refNull) != nil || vm.ExternRef(100) != nil {
+		t.Fail()
+	}
+
+	vm.ReleaseExternRef(refA)
+	vm.ReleaseExternRef(refA)
+	if vm.ExternRef(refA) != nil || vm.ExternRef(refB) != b {
+		t.Fail()
+	}
+	c := &object{name: "c"}
+	if refC := vm.NewExternRef(c); refC != refA || vm.ExternRef(refC) != c || vm.NewExternRef(a) == refA {
+		t.Errorf("the released slot is not reused once")
+	}
+}
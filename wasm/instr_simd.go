@@ -0,0 +1,649 @@
+package wasm
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"unsafe"
+)
+
+// errors on simd instr
+var (
+	// ErrLaneIndexOutOfRange will be throw when the lane index immediate exceeds the lanes of the shape
+	ErrLaneIndexOutOfRange = errors.New("lane index out of range")
+)
+
+// fetchLaneIndex reads the lane index immediate at i for the shape of T
+func fetchLaneIndex[T lane](ins *Instance, i int) (int, error) {
+	index := int(ins.current().imm[i])
+	if index >= laneNum[T]() {
+		return 0, ErrLaneIndexOutOfRange
+	}
+
+	return index, nil
+}
+
+func v128Load(ins *Instance) error {
+	mem, base, err := memoryBase(ins, 16)
+	if err != nil {
+		return err
+	}
+
+	var buf [16]byte
+	mem.read(buf[:], base)
+	ins.pushV128(v128FromBytes(buf[:]))
+
+	return nil
+}
+
+// v128LoadExtend loads 8 bytes as the lanes of F and extends each of them into the lane of T
+func v128LoadExtend[F, T intLane](ins *Instance) error {
+	mem, base, err := memoryBase(ins, 8)
+	if err != nil {
+		return err
+	}
+
+	src := V128{Lo: mem.loadUint64(base)}
+	var v V128
+	for i := 0; i < laneNum[T](); i++ {
+		setLane(&v, i, T(getLane[F](src, i)))
+	}
+	ins.pushV128(v)
+
+	return nil
+}
+
+// loadLane reads one lane of T on the address
+func loadLane[T intLane](mem *Memory, base uint64) T {
+	var buf [16]byte
+	mem.read(buf[:unsafe.Sizeof(T(0))], base)
+
+	return getLane[T](v128FromBytes(buf[:]), 0)
+}
+
+// v128LoadSplat loads one lane of T and copies it into all lanes
+func v128LoadSplat[T intLane](ins *Instance) error {
+	mem, base, err := memoryBase(ins, uint64(unsafe.Sizeof(T(0))))
+	if err != nil {
+		return err
+	}
+
+	ins.pushV128(splatLane(loadLane[T](mem, base)))
+
+	return nil
+}
+
+// v128LoadZero loads one lane of T into the lane 0 and zeros the others
+func v128LoadZero[T intLane](ins *Instance) error {
+	mem, base, err := memoryBase(ins, uint64(unsafe.Sizeof(T(0))))
+	if err != nil {
+		return err
+	}
+
+	var v V128
+	setLane(&v, 0, loadLane[T](mem, base))
+	ins.pushV128(v)
+
+	return nil
+}
+
+// v128LoadLane loads one lane of T into the lane on the index immediate
+func v128LoadLane[T intLane](ins *Instance) error {
+	v := ins.popV128()
+	mem, base, err := memoryBase(ins, uint64(unsafe.Sizeof(T(0))))
+	if err != nil {
+		return err
+	}
+
+	index, err := fetchLaneIndex[T](ins, 2)
+	if err != nil {
+		return err
+	}
+
+	setLane(&v, index, loadLane[T](mem, base))
+	ins.pushV128(v)
+
+	return nil
+}
+
+func v128Store(ins *Instance) error {
+	v := ins.popV128()
+	mem, base, err := memoryBase(ins, 16)
+	if err != nil {
+		return err
+	}
+
+	buf := v.Bytes()
+	mem.write(buf[:], base)
+
+	return nil
+}
+
+// v128StoreLane stores the lane of T on the index immediate
+func v128StoreLane[T intLane](ins *Instance) error {
+	v := ins.popV128()
+	size := unsafe.Sizeof(T(0))
+	mem, base, err := memoryBase(ins, uint64(size))
+	if err != nil {
+		return err
+	}
+
+	index, err := fetchLaneIndex[T](ins, 2)
+	if err != nil {
+		return err
+	}
+
+	var tmp V128
+	setLane(&tmp, 0, getLane[T](v, index))
+	buf := tmp.Bytes()
+	mem.write(buf[:size], base)
+
+	return nil
+}
+
+func v128Const(ins *Instance) error {
+	imm := &ins.current().imm
+	ins.pushV128(V128{Lo: imm[0], Hi: imm[1]})
+
+	return nil
+}
+
+func i8x16Shuffle(ins *Instance) error {
+	imm := &ins.current().imm
+	lanes := V128{Lo: imm[0], Hi: imm[1]}.Bytes()
+
+	b := ins.popV128()
+	a := ins.popV128()
+	var v V128
+	for i, l := range lanes {
+		switch {
+		case l < 16:
+			setLane(&v, i, getLane[uint8](a, int(l)))
+		case l < 32:
+			setLane(&v, i, getLane[uint8](b, int(l)-16))
+		default:
+			return ErrLaneIndexOutOfRange
+		}
+	}
+	ins.pushV128(v)
+
+	return nil
+}
+
+func i8x16Swizzle(ins *Instance) error {
+	s := ins.popV128()
+	a := ins.popV128()
+	var v V128
+	for i := 0; i < 16; i++ {
+		if l := getLane[uint8](s, i); l < 16 {
+			setLane(&v, i, getLane[uint8](a, int(l)))
+		}
+	}
+	ins.pushV128(v)
+
+	return nil
+}
+
+// splat creates the instr which copies the operand into all lanes of T
+func splat[T lane](fromOperand func(uint64) T) func(ins *Instance) error {
+	return func(ins *Instance) error {
+		ins.pushV128(splatLane(fromOperand(ins.OperandStack.Pop())))
+
+		return nil
+	}
+}
+
+// extractLane creates the instr which pushes the lane of T on the index immediate as an operand
+func extractLane[T lane](toOperand func(T) uint64) func(ins *Instance) error {
+	return func(ins *Instance) error {
+		index, err := fetchLaneIndex[T](ins, 0)
+		if err != nil {
+			return err
+		}
+
+		ins.OperandStack.Push(toOperand(getLane[T](ins.popV128(), index)))
+
+		return nil
+	}
+}
+
+// replaceLane creates the instr which replaces the lane of T on the index immediate with the operand
+func replaceLane[T lane](fromOperand func(uint64) T) func(ins *Instance) error {
+	return func(ins *Instance) error {
+		index, err := fetchLaneIndex[T](ins, 0)
+		if err != nil {
+			return err
+		}
+
+		x := fromOperand(ins.OperandStack.Pop())
+		v := ins.popV128()
+		setLane(&v, index, x)
+		ins.pushV128(v)
+
+		return nil
+	}
+}
+
+// lanewiseUnary creates the instr which applies f on every lane of T
+func lanewiseUnary[T lane](f func(a T) T) func(ins *Instance) error {
+	return func(ins *Instance) error {
+		a := ins.popV128()
+		var v V128
+		for i := 0; i < laneNum[T](); i++ {
+			setLane(&v, i, f(getLane[T](a, i)))
+		}
+		ins.pushV128(v)
+
+		return nil
+	}
+}
+
+// lanewiseBinary creates the instr which applies f on every pair of the lanes of T
+func lanewiseBinary[T lane](f func(a, b T) T) func(ins *Instance) error {
+	return func(ins *Instance) error {
+		b := ins.popV128()
+		a := ins.popV128()
+		var v V128
+		for i := 0; i < laneNum[T](); i++ {
+			setLane(&v, i, f(getLane[T](a, i), getLane[T](b, i)))
+		}
+		ins.pushV128(v)
+
+		return nil
+	}
+}
+
+// compareLanes creates the instr which compares every pair of the lanes of T,
+// the lane of the same width M becomes all ones when f holds and zero otherwise
+func compareLanes[T lane, M intLane](f func(a, b T) bool) func(ins *Instance) error {
+	return func(ins *Instance) error {
+		b := ins.popV128()
+		a := ins.popV128()
+		var v V128
+		for i := 0; i < laneNum[T](); i++ {
+			if f(getLane[T](a, i), getLane[T](b, i)) {
+				setLane(&v, i, ^M(0))
+			}
+		}
+		ins.pushV128(v)
+
+		return nil
+	}
+}
+
+// shiftLanes creates the instr which shifts every lane of T by the i32 operand modulo the lane width
+func shiftLanes[T intLane](f func(a T, s uint) T) func(ins *Instance) error {
+	return func(ins *Instance) error {
+		s := uint(ins.OperandStack.Pop()) % (uint(unsafe.Sizeof(T(0))) * 8)
+		a := ins.popV128()
+		var v V128
+		for i := 0; i < laneNum[T](); i++ {
+			setLane(&v, i, f(getLane[T](a, i), s))
+		}
+		ins.pushV128(v)
+
+		return nil
+	}
+}
+
+// allTrue creates the instr which tests whether all lanes of T are non-zero
+func allTrue[T intLane](ins *Instance) error {
+	a := ins.popV128()
+	for i := 0; i < laneNum[T](); i++ {
+		if getLane[T](a, i) == 0 {
+			ins.OperandStack.Push(0)
+			return nil
+		}
+	}
+	ins.OperandStack.Push(1)
+
+	return nil
+}
+
+// bitmask collects the sign bits of the lanes of the signed T into an i32
+func bitmask[T intLane](ins *Instance) error {
+	a := ins.popV128()
+	var ret uint64
+	for i := 0; i < laneNum[T](); i++ {
+		if getLane[T](a, i) < 0 {
+			ret |= 1 << i
+		}
+	}
+	ins.OperandStack.Push(ret)
+
+	return nil
+}
+
+// narrow packs the lanes of the two operands in F into the lanes of T with saturation
+func narrow[F, T intLane](ins *Instance) error {
+	b := ins.popV128()
+	a := ins.popV128()
+	n := laneNum[F]()
+	var v V128
+	for i := 0; i < n; i++ {
+		setLane(&v, i, saturate[T](int64(getLane[F](a, i))))
+		setLane(&v, n+i, saturate[T](int64(getLane[F](b, i))))
+	}
+	ins.pushV128(v)
+
+	return nil
+}
+
+// extend creates the instr which extends the low or high half lanes of F into the lanes of T
+func extend[F, T intLane](high bool) func(ins *Instance) error {
+	return func(ins *Instance) error {
+		a := ins.popV128()
+		n := laneNum[T]()
+		offset := 0
+		if high {
+			offset = n
+		}
+
+		var v V128
+		for i := 0; i < n; i++ {
+			setLane(&v, i, T(getLane[F](a, offset+i)))
+		}
+		ins.pushV128(v)
+
+		return nil
+	}
+}
+
+// extMul creates the instr which multiplies the low or high half lanes of F into the lanes of T
+func extMul[F, T intLane](high bool) func(ins *Instance) error {
+	return func(ins *Instance) error {
+		b := ins.popV128()
+		a := ins.popV128()
+		n := laneNum[T]()
+		offset := 0
+		if high {
+			offset = n
+		}
+
+		var v V128
+		for i := 0; i < n; i++ {
+			setLane(&v, i, T(getLane[F](a, offset+i))*T(getLane[F](b, offset+i)))
+		}
+		ins.pushV128(v)
+
+		return nil
+	}
+}
+
+// extAddPairwise adds the adjacent pairs of the lanes of F into the lanes of T
+func extAddPairwise[F, T intLane](ins *Instance) error {
+	a := ins.popV128()
+	var v V128
+	for i := 0; i < laneNum[T](); i++ {
+		setLane(&v, i, T(getLane[F](a, 2*i))+T(getLane[F](a, 2*i+1)))
+	}
+	ins.pushV128(v)
+
+	return nil
+}
+
+func i32x4DotI16x8S(ins *Instance) error {
+	b := ins.popV128()
+	a := ins.popV128()
+	var v V128
+	for i := 0; i < 4; i++ {
+		lo := int32(getLane[int16](a, 2*i)) * int32(getLane[int16](b, 2*i))
+		hi := int32(getLane[int16](a, 2*i+1)) * int32(getLane[int16](b, 2*i+1))
+		setLane(&v, i, lo+hi)
+	}
+	ins.pushV128(v)
+
+	return nil
+}
+
+func v128Not(ins *Instance) error {
+	a := ins.popV128()
+	ins.pushV128(V128{Lo: ^a.Lo, Hi: ^a.Hi})
+
+	return nil
+}
+
+func v128And(ins *Instance) error {
+	b := ins.popV128()
+	a := ins.popV128()
+	ins.pushV128(V128{Lo: a.Lo & b.Lo, Hi: a.Hi & b.Hi})
+
+	return nil
+}
+
+func v128AndNot(ins *Instance) error {
+	b := ins.popV128()
+	a := ins.popV128()
+	ins.pushV128(V128{Lo: a.Lo &^ b.Lo, Hi: a.Hi &^ b.Hi})
+
+	return nil
+}
+
+func v128Or(ins *Instance) error {
+	b := ins.popV128()
+	a := ins.popV128()
+	ins.pushV128(V128{Lo: a.Lo | b.Lo, Hi: a.Hi | b.Hi})
+
+	return nil
+}
+
+func v128Xor(ins *Instance) error {
+	b := ins.popV128()
+	a := ins.popV128()
+	ins.pushV128(V128{Lo: a.Lo ^ b.Lo, Hi: a.Hi ^ b.Hi})
+
+	return nil
+}
+
+func v128BitSelect(ins *Instance) error {
+	c := ins.popV128()
+	b := ins.popV128()
+	a := ins.popV128()
+	ins.pushV128(V128{Lo: a.Lo&c.Lo | b.Lo&^c.Lo, Hi: a.Hi&c.Hi | b.Hi&^c.Hi})
+
+	return nil
+}
+
+func v128AnyTrue(ins *Instance) error {
+	a := ins.popV128()
+	if a.Lo != 0 || a.Hi != 0 {
+		ins.OperandStack.Push(1)
+	} else {
+		ins.OperandStack.Push(0)
+	}
+
+	return nil
+}
+
+func f32x4DemoteF64x2Zero(ins *Instance) error {
+	a := ins.popV128()
+	var v V128
+	setLane(&v, 0, float32(getLane[float64](a, 0)))
+	setLane(&v, 1, float32(getLane[float64](a, 1)))
+	ins.pushV128(v)
+
+	return nil
+}
+
+func f64x2PromoteLowF32x4(ins *Instance) error {
+	a := ins.popV128()
+	var v V128
+	setLane(&v, 0, float64(getLane[float32](a, 0)))
+	setLane(&v, 1, float64(getLane[float32](a, 1)))
+	ins.pushV128(v)
+
+	return nil
+}
+
+// truncSatLanes creates the instr which truncates the lanes of F into the i32 lanes with saturation,
+// the lanes beyond the ones of F are zeroed
+func truncSatLanes[F floatLane](signed bool) func(ins *Instance) error {
+	return func(ins *Instance) error {
+		a := ins.popV128()
+		var v V128
+		for i := 0; i < laneNum[F](); i++ {
+			f := float64(getLane[F](a, i))
+			if signed {
+				setLane(&v, i, int32(truncSatS(f, math.MinInt32, math.MaxInt32)))
+			} else {
+				setLane(&v, i, uint32(truncSatU(f, math.MaxUint32)))
+			}
+		}
+		ins.pushV128(v)
+
+		return nil
+	}
+}
+
+// convertLanes creates the instr which converts the low lanes of the i32 F into the lanes of T
+func convertLanes[F int32 | uint32, T floatLane](ins *Instance) error {
+	a := ins.popV128()
+	var v V128
+	for i := 0; i < laneNum[T](); i++ {
+		setLane(&v, i, T(getLane[F](a, i)))
+	}
+	ins.pushV128(v)
+
+	return nil
+}
+
+// saturate clamps x into the range of T, which is not wider than 32 bits
+func saturate[T intLane](x int64) T {
+	size := unsafe.Sizeof(T(0)) * 8
+	min, max := int64(0), int64(1)<<size-1
+	if ^T(0) < 0 { // signed
+		min, max = -1<<(size-1), 1<<(size-1)-1
+	}
+
+	switch {
+	case x < min:
+		return T(min)
+	case x > max:
+		return T(max)
+	default:
+		return T(x)
+	}
+}
+
+func laneAdd[T lane](a, b T) T      { return a + b }
+func laneSub[T lane](a, b T) T      { return a - b }
+func laneMul[T lane](a, b T) T      { return a * b }
+func laneDiv[T floatLane](a, b T) T { return a / b }
+func laneNeg[T intLane](a T) T      { return -a }
+
+func laneAbs[T intLane](a T) T {
+	if a < 0 {
+		return -a
+	}
+
+	return a
+}
+
+func laneMin[T intLane](a, b T) T {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func laneMax[T intLane](a, b T) T {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+func laneAddSat[T intLane](a, b T) T      { return saturate[T](int64(a) + int64(b)) }
+func laneSubSat[T intLane](a, b T) T      { return saturate[T](int64(a) - int64(b)) }
+func laneAvgr[T uint8 | uint16](a, b T) T { return T((uint32(a) + uint32(b) + 1) / 2) }
+
+func laneQ15MulrSat(a, b int16) int16 {
+	return saturate[int16]((int64(a)*int64(b) + 0x4000) >> 15)
+}
+
+func lanePopcnt(a uint8) uint8 { return uint8(bits.OnesCount8(a)) }
+
+func laneShl[T intLane](a T, s uint) T { return a << s }
+func laneShr[T intLane](a T, s uint) T { return a >> s } // arithmetic on the signed T, logical on the unsigned
+
+func laneEq[T lane](a, b T) bool { return a == b }
+func laneNe[T lane](a, b T) bool { return a != b }
+func laneLt[T lane](a, b T) bool { return a < b }
+func laneGt[T lane](a, b T) bool { return a > b }
+func laneLe[T lane](a, b T) bool { return a <= b }
+func laneGe[T lane](a, b T) bool { return a >= b }
+
+// the abs and neg on the floats only touch the sign bit, so they work on the unsigned lanes of the same width
+func laneFAbs[T uint32 | uint64](a T) T { return a &^ (1 << (unsafe.Sizeof(a)*8 - 1)) }
+func laneFNeg[T uint32 | uint64](a T) T { return a ^ (1 << (unsafe.Sizeof(a)*8 - 1)) }
+
+func laneSqrt[T floatLane](a T) T    { return T(math.Sqrt(float64(a))) }
+func laneCeil[T floatLane](a T) T    { return T(math.Ceil(float64(a))) }
+func laneFloor[T floatLane](a T) T   { return T(math.Floor(float64(a))) }
+func laneTrunc[T floatLane](a T) T   { return T(math.Trunc(float64(a))) }
+func laneNearest[T floatLane](a T) T { return T(math.RoundToEven(float64(a))) }
+
+// laneFMin follows the wasm fmin, NaN wins and -0 is less than +0
+func laneFMin[T floatLane](a, b T) T {
+	switch {
+	case a != a || b != b:
+		return T(math.NaN())
+	case a == 0 && b == 0:
+		if math.Signbit(float64(a)) {
+			return a
+		}
+		return b
+	case a < b:
+		return a
+	default:
+		return b
+	}
+}
+
+// laneFMax follows the wasm fmax, NaN wins and +0 is greater than -0
+func laneFMax[T floatLane](a, b T) T {
+	switch {
+	case a != a || b != b:
+		return T(math.NaN())
+	case a == 0 && b == 0:
+		if math.Signbit(float64(a)) {
+			return b
+		}
+		return a
+	case a > b:
+		return a
+	default:
+		return b
+	}
+}
+
+func lanePMin[T floatLane](a, b T) T {
+	if b < a {
+		return b
+	}
+
+	return a
+}
+
+func lanePMax[T floatLane](a, b T) T {
+	if a < b {
+		return b
+	}
+
+	return a
+}
+
+// the conversions between the scalar operands and the lanes
+
+func i32ToLane[T int8 | int16 | int32](v uint64) T { return T(v) }
+func i64ToLane(v uint64) int64                     { return int64(v) }
+func f32ToLane(v uint64) float32                   { return math.Float32frombits(uint32(v)) }
+func f64ToLane(v uint64) float64                   { return math.Float64frombits(v) }
+func laneToI32[T int8 | uint8 | int16 | uint16 | int32](x T) uint64 {
+	return uint64(uint32(int32(x)))
+}
+func laneToI64(x int64) uint64   { return uint64(x) }
+func laneToF32(x float32) uint64 { return uint64(math.Float32bits(x)) }
+func laneToF64(x float64) uint64 { return math.Float64bits(x) }
@@ -0,0 +1,543 @@
+package wasm
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/segments"
+	"github.com/c0mm4nd/wasman/stacks"
+	"github.com/c0mm4nd/wasman/types"
+)
+
+func Test_lane(t *testing.T) {
+	v := V128{Lo: 0x0706050403020100, Hi: 0x0f0e0d0c0b0a0908}
+	if getLane[uint8](v, 9) != 0x09 || getLane[uint16](v, 3) != 0x0706 ||
+		getLane[uint32](v, 2) != 0x0b0a0908 || getLane[uint64](v, 1) != 0x0f0e0d0c0b0a0908 {
+		t.Fail()
+	}
+
+	setLane(&v, 15, int8(-1))
+	setLane(&v, 1, int16(-2))
+	if v.Hi != 0xff0e0d0c0b0a0908 || v.Lo != 0x07060504fffe0100 {
+		t.Fail()
+	}
+
+	setLane(&v, 1, float32(1.5))
+	if getLane[float32](v, 1) != 1.5 || getLane[uint32](v, 0) != 0xfffe0100 {
+		t.Fail()
+	}
+
+	if splatLane(uint16(0xabcd)) != (V128{Lo: 0xabcdabcdabcdabcd, Hi: 0xabcdabcdabcdabcd}) {
+		t.Fail()
+	}
+}
+
+// simdInstr encodes the simd instr with the immediates, the sub opcode is in leb128
+func simdInstr(op expr.SIMDOpCode, immediates ...byte) []byte {
+	ret := []byte{byte(expr.OpCodeSIMDPrefix)}
+	if op < 0x80 {
+		ret = append(ret, byte(op))
+	} else {
+		ret = append(ret, byte(op)|0x80, byte(op>>7))
+	}
+
+	return append(ret, immediates...)
+}
+
+// simdVM creates an instance whose active func body is the simd instr with the immediates
+func simdVM(op expr.SIMDOpCode, immediates ...byte) *Instance {
+	return &Instance{
+		Module: new(Module),
+		Active: &Frame{
+			Func: compiled(&wasmFunc{body: simdInstr(op, immediates...)}),
+		},
+		OperandStack: stacks.NewOperandStack(),
+	}
+}
+
+func Test_simdLanewise(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		op   expr.SIMDOpCode
+		a, b V128
+		exp  V128
+	}{
+		{
+			name: "i8x16.add", op: expr.OpCodeI8x16Add,
+			a: V128{Lo: 0xff01, Hi: 1}, b: V128{Lo: 0x0101, Hi: 2}, exp: V128{Lo: 0x0002, Hi: 3},
+		},
+		{
+			name: "i8x16.add_sat_s", op: expr.OpCodeI8x16AddSatS,
+			a: V128{Lo: 0x807f}, b: V128{Lo: 0xff01}, exp: V128{Lo: 0x807f},
+		},
+		{
+			name: "i8x16.sub_sat_u", op: expr.OpCodeI8x16SubSatU,
+			a: V128{Lo: 0x0105}, b: V128{Lo: 0x0203}, exp: V128{Lo: 0x0002},
+		},
+		{
+			name: "i16x8.mul", op: expr.OpCodeI16x8Mul,
+			a: V128{Lo: 0x0003_8000}, b: V128{Lo: 0x0004_0002}, exp: V128{Lo: 0x000c_0000},
+		},
+		{
+			name: "i32x4.min_s", op: expr.OpCodeI32x4MinS,
+			a: V128{Lo: 0xffffffff_00000001}, b: V128{Lo: 0x00000001_00000002}, exp: V128{Lo: 0xffffffff_00000001},
+		},
+		{
+			name: "i32x4.min_u", op: expr.OpCodeI32x4MinU,
+			a: V128{Lo: 0xffffffff_00000001}, b: V128{Lo: 0x00000001_00000002}, exp: V128{Lo: 0x00000001_00000001},
+		},
+		{
+			name: "i8x16.avgr_u", op: expr.OpCodeI8x16AvgrU,
+			a: V128{Lo: 0xff03}, b: V128{Lo: 0xff04}, exp: V128{Lo: 0xff04},
+		},
+		{
+			name: "i16x8.q15mulr_sat_s", op: expr.OpCodeI16x8Q15mulrSatS,
+			a: V128{Lo: 0x8000_4000}, b: V128{Lo: 0x8000_4000}, exp: V128{Lo: 0x7fff_2000},
+		},
+		{
+			name: "i8x16.eq", op: expr.OpCodeI8x16Eq,
+			a: V128{Lo: 0x0102, Hi: 5}, b: V128{Lo: 0x0202, Hi: 5}, exp: V128{Lo: 0xffffffffffff00ff, Hi: 0xffffffffffffffff},
+		},
+		{
+			name: "i16x8.lt_s", op: expr.OpCodeI16x8LtS,
+			a: V128{Lo: 0xffff_0001}, b: V128{Lo: 0x0000_0001}, exp: V128{Lo: 0xffff_0000},
+		},
+		{
+			name: "i64x2.gt_s", op: expr.OpCodeI64x2GtS,
+			a: V128{Lo: 1, Hi: math.MaxUint64}, b: V128{Lo: 0, Hi: 0}, exp: V128{Lo: math.MaxUint64},
+		},
+		{
+			name: "f32x4.lt", op: expr.OpCodeF32x4Lt,
+			a:   V128{Lo: uint64(math.Float32bits(1)) | uint64(math.Float32bits(float32(math.NaN())))<<32},
+			b:   V128{Lo: uint64(math.Float32bits(2)) | uint64(math.Float32bits(2))<<32},
+			exp: V128{Lo: 0xffffffff},
+		},
+		{
+			name: "f64x2.add", op: expr.OpCodeF64x2Add,
+			a: V128{Lo: math.Float64bits(1.5), Hi: math.Float64bits(-1)}, b: V128{Lo: math.Float64bits(2), Hi: math.Float64bits(3)},
+			exp: V128{Lo: math.Float64bits(3.5), Hi: math.Float64bits(2)},
+		},
+		{
+			name: "f64x2.min", op: expr.OpCodeF64x2Min,
+			a: V128{Lo: math.Float64bits(0), Hi: math.Float64bits(1)}, b: V128{Lo: math.Float64bits(math.Copysign(0, -1)), Hi: math.Float64bits(math.NaN())},
+			exp: V128{Lo: math.Float64bits(math.Copysign(0, -1)), Hi: math.Float64bits(math.NaN())},
+		},
+		{
+			name: "f32x4.pmax", op: expr.OpCodeF32x4Pmax,
+			a: V128{Lo: uint64(math.Float32bits(1))}, b: V128{Lo: uint64(math.Float32bits(2))},
+			exp: V128{Lo: uint64(math.Float32bits(2))},
+		},
+		{
+			name: "v128.andnot", op: expr.OpCodeV128Andnot,
+			a: V128{Lo: 0xff, Hi: 0xf0}, b: V128{Lo: 0x0f, Hi: 0xff}, exp: V128{Lo: 0xf0},
+		},
+		{
+			name: "i8x16.swizzle", op: expr.OpCodeI8x16Swizzle,
+			a: V128{Lo: 0x0706050403020100, Hi: 0x0f0e0d0c0b0a0908}, b: V128{Lo: 0xff0f_0001},
+			exp: V128{Lo: 0x000f_0001},
+		},
+		{
+			name: "i8x16.narrow_i16x8_s", op: expr.OpCodeI8x16NarrowI16x8S,
+			a: V128{Lo: 0x0100_ff00_0005}, b: V128{Lo: 0xfffe}, exp: V128{Lo: 0x7f80_05, Hi: 0xfe},
+		},
+		{
+			name: "i16x8.extmul_high_i8x16_u", op: expr.OpCodeI16x8ExtmulHighI8x16U,
+			a: V128{Hi: 0xff}, b: V128{Hi: 0xff}, exp: V128{Lo: 0xfe01},
+		},
+		{
+			name: "i32x4.dot_i16x8_s", op: expr.OpCodeI32x4DotI16x8S,
+			a: V128{Lo: 0x0003_ffff}, b: V128{Lo: 0x0004_0002}, exp: V128{Lo: 10},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			vm := simdVM(c.op)
+			vm.pushV128(c.a)
+			vm.pushV128(c.b)
+			if err := vm.execFunc(); err != nil {
+				t.Fatal(err)
+			}
+			if actual := vm.popV128(); actual != c.exp {
+				t.Errorf("got %#x, want %#x", actual, c.exp)
+			}
+		})
+	}
+}
+
+func Test_simdUnary(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		op   expr.SIMDOpCode
+		a    V128
+		exp  V128
+	}{
+		{name: "v128.not", op: expr.OpCodeV128Not, a: V128{Lo: 0xff}, exp: V128{Lo: ^uint64(0xff), Hi: math.MaxUint64}},
+		{name: "i8x16.abs", op: expr.OpCodeI8x16Abs, a: V128{Lo: 0x80ff01}, exp: V128{Lo: 0x800101}},
+		{name: "i8x16.popcnt", op: expr.OpCodeI8x16Popcnt, a: V128{Lo: 0xff03, Hi: 0x80}, exp: V128{Lo: 0x0802, Hi: 0x01}},
+		{name: "i16x8.neg", op: expr.OpCodeI16x8Neg, a: V128{Lo: 0x0001}, exp: V128{Lo: 0xffff}},
+		{
+			name: "i32x4.extend_high_i16x8_s", op: expr.OpCodeI32x4ExtendHighI16x8S,
+			a: V128{Hi: 0xffff_0002}, exp: V128{Lo: 0xffffffff_00000002},
+		},
+		{
+			name: "i64x2.extend_low_i32x4_u", op: expr.OpCodeI64x2ExtendLowI32x4U,
+			a: V128{Lo: 0xffffffff_00000002}, exp: V128{Lo: 2, Hi: 0xffffffff},
+		},
+		{
+			name: "i16x8.extadd_pairwise_i8x16_s", op: expr.OpCodeI16x8ExtaddPairwiseI8x16S,
+			a: V128{Lo: 0x02ff}, exp: V128{Lo: 0x0001},
+		},
+		{
+			name: "f32x4.neg", op: expr.OpCodeF32x4Neg,
+			a: V128{Lo: uint64(math.Float32bits(1))}, exp: V128{Lo: uint64(math.Float32bits(-1)) | 0x80000000<<32, Hi: 0x80000000_80000000},
+		},
+		{
+			name: "f64x2.nearest", op: expr.OpCodeF64x2Nearest,
+			a: V128{Lo: math.Float64bits(2.5), Hi: math.Float64bits(-3.5)}, exp: V128{Lo: math.Float64bits(2), Hi: math.Float64bits(-4)},
+		},
+		{
+			name: "i32x4.trunc_sat_f64x2_s_zero", op: expr.OpCodeI32x4TruncSatF64x2SZero,
+			a: V128{Lo: math.Float64bits(-1e10), Hi: math.Float64bits(math.NaN())}, exp: V128{Lo: 0x80000000},
+		},
+		{
+			name: "f32x4.convert_i32x4_u", op: expr.OpCodeF32x4ConvertI32x4U,
+			a: V128{Lo: 0xffffffff}, exp: V128{Lo: uint64(math.Float32bits(4294967295))},
+		},
+		{
+			name: "f64x2.promote_low_f32x4", op: expr.OpCodeF64x2PromoteLowF32x4,
+			a: V128{Lo: uint64(math.Float32bits(0.5))}, exp: V128{Lo: math.Float64bits(0.5)},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			vm := simdVM(c.op)
+			vm.pushV128(c.a)
+			if err := vm.execFunc(); err != nil {
+				t.Fatal(err)
+			}
+			if actual := vm.popV128(); actual != c.exp {
+				t.Errorf("got %#x, want %#x", actual, c.exp)
+			}
+		})
+	}
+}
+
+func Test_simdScalar(t *testing.T) {
+	t.Run("i16x8.splat", func(t *testing.T) {
+		vm := simdVM(expr.OpCodeI16x8Splat)
+		vm.OperandStack.Push(0x12345)
+		if err := vm.execFunc(); err != nil {
+			t.Fatal(err)
+		}
+		if vm.popV128() != (V128{Lo: 0x2345234523452345, Hi: 0x2345234523452345}) {
+			t.Fail()
+		}
+	})
+
+	t.Run("i8x16.extract_lane_s", func(t *testing.T) {
+		vm := simdVM(expr.OpCodeI8x16ExtractLaneS, 9)
+		vm.pushV128(V128{Hi: 0x8000})
+		if err := vm.execFunc(); err != nil {
+			t.Fatal(err)
+		}
+		if vm.OperandStack.Pop() != 0xffffff80 {
+			t.Fail()
+		}
+	})
+
+	t.Run("f64x2.replace_lane", func(t *testing.T) {
+		vm := simdVM(expr.OpCodeF64x2ReplaceLane, 1)
+		vm.pushV128(V128{Lo: 1, Hi: 2})
+		vm.OperandStack.Push(math.Float64bits(1.5))
+		if err := vm.execFunc(); err != nil {
+			t.Fatal(err)
+		}
+		if vm.popV128() != (V128{Lo: 1, Hi: math.Float64bits(1.5)}) {
+			t.Fail()
+		}
+	})
+
+	t.Run("lane out of range", func(t *testing.T) {
+		vm := simdVM(expr.OpCodeI32x4ExtractLane, 4)
+		vm.pushV128(V128{})
+		if !errors.Is(vm.execFunc(), ErrLaneIndexOutOfRange) {
+			t.Fail()
+		}
+	})
+
+	t.Run("i32x4.shl", func(t *testing.T) {
+		vm := simdVM(expr.OpCodeI32x4Shl)
+		vm.pushV128(V128{Lo: 1, Hi: 0x80000000})
+		vm.OperandStack.Push(33)
+		if err := vm.execFunc(); err != nil {
+			t.Fatal(err)
+		}
+		if vm.popV128() != (V128{Lo: 2}) {
+			t.Fail()
+		}
+	})
+
+	t.Run("i16x8.shr_s", func(t *testing.T) {
+		vm := simdVM(expr.OpCodeI16x8ShrS)
+		vm.pushV128(V128{Lo: 0x8000_0010})
+		vm.OperandStack.Push(4)
+		if err := vm.execFunc(); err != nil {
+			t.Fatal(err)
+		}
+		if vm.popV128() != (V128{Lo: 0xf800_0001}) {
+			t.Fail()
+		}
+	})
+
+	for _, c := range []struct {
+		name string
+		op   expr.SIMDOpCode
+		a    V128
+		exp  uint64
+	}{
+		{name: "v128.any_true", op: expr.OpCodeV128AnyTrue, a: V128{Hi: 1}, exp: 1},
+		{name: "i8x16.all_true", op: expr.OpCodeI8x16AllTrue, a: V128{Lo: math.MaxUint64, Hi: 0xff}, exp: 0},
+		{name: "i64x2.all_true", op: expr.OpCodeI64x2AllTrue, a: V128{Lo: 1, Hi: 1 << 63}, exp: 1},
+		{name: "i8x16.bitmask", op: expr.OpCodeI8x16Bitmask, a: V128{Lo: 0x80, Hi: 0x8000000000000000}, exp: 0x8001},
+		{name: "i32x4.bitmask", op: expr.OpCodeI32x4Bitmask, a: V128{Lo: 0x80000000_00000000, Hi: 0x80000000}, exp: 0b0110},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			vm := simdVM(c.op)
+			vm.pushV128(c.a)
+			if err := vm.execFunc(); err != nil {
+				t.Fatal(err)
+			}
+			if actual := vm.OperandStack.Pop(); actual != c.exp {
+				t.Errorf("got %#x, want %#x", actual, c.exp)
+			}
+		})
+	}
+}
+
+func Test_simdImmediates(t *testing.T) {
+	t.Run("v128.const", func(t *testing.T) {
+		vm := simdVM(expr.OpCodeV128Const, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15)
+		if err := vm.execFunc(); err != nil {
+			t.Fatal(err)
+		}
+		if vm.Active.PC != 1 {
+			t.Fail()
+		}
+		if vm.popV128() != (V128{Lo: 0x0706050403020100, Hi: 0x0f0e0d0c0b0a0908}) {
+			t.Fail()
+		}
+	})
+
+	t.Run("i8x16.shuffle", func(t *testing.T) {
+		vm := simdVM(expr.OpCodeI8x16Shuffle, 0, 16, 1, 17, 2, 18, 3, 19, 4, 20, 5, 21, 6, 22, 31, 15)
+		vm.pushV128(V128{Lo: 0x0706050403020100, Hi: 0x0f0e0d0c0b0a0908})
+		vm.pushV128(V128{Lo: 0x1716151413121110, Hi: 0x1f1e1d1c1b1a1918})
+		if err := vm.execFunc(); err != nil {
+			t.Fatal(err)
+		}
+		if vm.popV128() != (V128{Lo: 0x1303120211011000, Hi: 0x0f1f160615051404}) {
+			t.Fail()
+		}
+	})
+}
+
+func Test_simdMemory(t *testing.T) {
+	newVM := func(op expr.SIMDOpCode, immediates ...byte) *Instance {
+		vm := simdVM(op, immediates...)
+		vm.Memory = &Memory{Value: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 0xff, 0xfe}}
+
+		return vm
+	}
+
+	t.Run("v128.load", func(t *testing.T) {
+		vm := newVM(expr.OpCodeV128Load, 0x00, 0x01)
+		vm.OperandStack.Push(1)
+		if err := vm.execFunc(); err != nil {
+			t.Fatal(err)
+		}
+		if vm.popV128() != (V128{Lo: 0x0908070605040302, Hi: 0xfeff0f0e0d0c0b0a}) {
+			t.Fail()
+		}
+
+		vm = newVM(expr.OpCodeV128Load, 0x00, 0x00)
+		vm.OperandStack.Push(3)
+		if !errors.Is(vm.execFunc(), ErrPtrOutOfBounds) {
+			t.Fail()
+		}
+	})
+
+	t.Run("v128.load8x8_s", func(t *testing.T) {
+		vm := newVM(expr.OpCodeV128Load8x8S, 0x00, 0x00)
+		vm.OperandStack.Push(10)
+		if err := vm.execFunc(); err != nil {
+			t.Fatal(err)
+		}
+		if vm.popV128() != (V128{Lo: 0x000d000c000b000a, Hi: 0xfffeffff000f000e}) {
+			t.Fail()
+		}
+	})
+
+	t.Run("v128.load16_splat", func(t *testing.T) {
+		vm := newVM(expr.OpCodeV128Load16Splat, 0x00, 0x00)
+		vm.OperandStack.Push(16)
+		if err := vm.execFunc(); err != nil {
+			t.Fatal(err)
+		}
+		if vm.popV128() != (V128{Lo: 0xfefffefffefffeff, Hi: 0xfefffefffefffeff}) {
+			t.Fail()
+		}
+	})
+
+	t.Run("v128.load32_zero", func(t *testing.T) {
+		vm := newVM(expr.OpCodeV128Load32Zero, 0x00, 0x00)
+		vm.OperandStack.Push(0)
+		if err := vm.execFunc(); err != nil {
+			t.Fatal(err)
+		}
+		if vm.popV128() != (V128{Lo: 0x03020100}) {
+			t.Fail()
+		}
+	})
+
+	t.Run("v128.load16_lane", func(t *testing.T) {
+		vm := newVM(expr.OpCodeV128Load16Lane, 0x00, 0x00, 7)
+		vm.OperandStack.Push(0)
+		vm.pushV128(V128{Lo: 1})
+		if err := vm.execFunc(); err != nil {
+			t.Fatal(err)
+		}
+		if vm.popV128() != (V128{Lo: 1, Hi: 0x0100 << 48}) {
+			t.Fail()
+		}
+	})
+
+	t.Run("v128.store", func(t *testing.T) {
+		vm := newVM(expr.OpCodeV128Store, 0x00, 0x02)
+		vm.OperandStack.Push(0)
+		vm.pushV128(V128{Lo: 0xaa, Hi: 0xbb << 56})
+		if err := vm.execFunc(); err != nil {
+			t.Fatal(err)
+		}
+		if vm.Memory.Value[2] != 0xaa || vm.Memory.Value[17] != 0xbb || vm.Memory.Value[3] != 0 {
+			t.Fail()
+		}
+	})
+
+	t.Run("v128.store32_lane", func(t *testing.T) {
+		vm := newVM(expr.OpCodeV128Store32Lane, 0x00, 0x00, 3)
+		vm.OperandStack.Push(14)
+		vm.pushV128(V128{Hi: 0x11223344 << 32})
+		if err := vm.execFunc(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(vm.Memory.Value[14:], []byte{0x44, 0x33, 0x22, 0x11}) {
+			t.Fail()
+		}
+	})
+}
+
+func TestInstance_CallExportedFuncV128(t *testing.T) {
+	v128 := types.ValueTypeV128
+	i32 := types.ValueTypeI32
+	ins := &Instance{
+		Module:       &Module{},
+		OperandStack: stacks.NewOperandStack(),
+		FrameStack: &stacks.Stack[*Frame]{
+			Ptr:    -1,
+			Values: make([]*Frame, stacks.InitialLabelStackHeight),
+		},
+	}
+
+	// (func $inner (param v128 v128 i32) (result v128)
+	//   (select (local.get 0) (local.get 1) (local.get 2)))
+	inner := compiled(&wasmFunc{
+		signature: &types.FuncType{InputTypes: []types.ValueType{v128, v128, i32}, ReturnTypes: []types.ValueType{v128}},
+		body: []byte{
+			byte(expr.OpCodeLocalGet), 0x00,
+			byte(expr.OpCodeLocalGet), 0x01,
+			byte(expr.OpCodeLocalGet), 0x02,
+			byte(expr.OpCodeSelect),
+		},
+		hasV128: true,
+	})
+
+	// (func (param i32) (result i32) (local v128)
+	//   (local.set 1 (block (result v128) (i64x2.splat (i64.const 1)) (i64x2.splat (i64.const 2)) (br 0)))
+	//   (call $inner (local.get 1) (i8x16.splat (i32.const 3)) (local.get 0))
+	//   (i8x16.extract_lane_u 8))
+	body := []byte{
+		byte(expr.OpCodeBlock), 0x7b,
+		byte(expr.OpCodeI64Const), 0x01,
+		byte(expr.OpCodeSIMDPrefix), byte(expr.OpCodeI64x2Splat),
+		byte(expr.OpCodeI64Const), 0x02,
+		byte(expr.OpCodeSIMDPrefix), byte(expr.OpCodeI64x2Splat),
+		byte(expr.OpCodeBr), 0x00,
+		byte(expr.OpCodeEnd),
+		byte(expr.OpCodeLocalSet), 0x01,
+		byte(expr.OpCodeLocalGet), 0x01,
+		byte(expr.OpCodeI32Const), 0x03,
+		byte(expr.OpCodeSIMDPrefix), byte(expr.OpCodeI8x16Splat),
+		byte(expr.OpCodeLocalGet), 0x00,
+		byte(expr.OpCodeCall), 0x00,
+		byte(expr.OpCodeSIMDPrefix), byte(expr.OpCodeI8x16ExtractLaneU), 0x08,
+	}
+	code, err := ins.compile(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ins.Functions = []fn{inner, &wasmFunc{
+		signature: &types.FuncType{InputTypes: []types.ValueType{i32}, ReturnTypes: []types.ValueType{i32}},
+		NumLocal:  1,
+		body:      body,
+		code:      code,
+		hasV128:   true,
+	}}
+	ins.ExportSection = map[string]*segments.ExportSegment{
+		"main":  {Name: "main", Desc: &segments.ExportDesc{Kind: segments.KindFunction, Index: 1}},
+		"inner": {Name: "inner", Desc: &segments.ExportDesc{Kind: segments.KindFunction, Index: 0}},
+	}
+
+	for _, c := range []struct {
+		cond uint64
+		exp  uint64
+	}{
+		{cond: 1, exp: 2},
+		{cond: 0, exp: 3},
+	} {
+		ret, _, err := ins.CallExportedFunc("main", c.cond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ret[0] != c.exp {
+			t.Errorf("got %d, want %d", ret[0], c.exp)
+		}
+		if ins.OperandStack.Ptr != -1 {
+			t.Fail()
+		}
+	}
+
+	// the v128 params and result keep all their bits
+	for _, c := range []struct {
+		cond uint64
+		exp  V128
+	}{
+		{cond: 1, exp: V128{Lo: 1, Hi: 2}},
+		{cond: 1 << 32, exp: V128{Lo: 3, Hi: 4}},
+	} {
+		ret, vts, err := ins.CallExportedFuncV128("inner", V128{Lo: 1, Hi: 2}, V128{Lo: 3, Hi: 4}, V128{Lo: c.cond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ret) != 1 || ret[0] != c.exp || vts[0] != v128 {
+			t.Errorf("got %v, want %v", ret, c.exp)
+		}
+		if ins.OperandStack.Ptr != -1 {
+			t.Fail()
+		}
+	}
+	if _, _, err := ins.CallExportedFunc("inner", 1, 3, 1); err != ErrV128Signature {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package wasm
+
+import (
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/ir"
+)
+
+// superInstructions are the instr of the superinstructions in the ir package
+var superInstructions = map[ir.Op]func(ins *Instance) error{
+	ir.OpLocalGet2:           localGet2,
+	ir.OpLocalGet2I32Add:     localGet2I32Add,
+	ir.OpLocalGet2I32Sub:     localGet2I32Sub,
+	ir.OpLocalGetI32AddConst: localGetI32AddConst,
+	ir.OpI32AddConst:         i32AddConst,
+	ir.OpI32MulConst:         i32MulConst,
+	ir.OpI32AndConst:         i32AndConst,
+	ir.OpI32OrConst:          i32OrConst,
+	ir.OpI32XorConst:         i32XorConst,
+	ir.OpI32ShlConst:         i32ShlConst,
+	ir.OpI32ShrSConst:        i32ShrSConst,
+	ir.OpI32ShrUConst:        i32ShrUConst,
+	ir.OpI32EqzBrIf:          i32EqzBrIf,
+	ir.OpI32EqBrIf:           i32CmpBrIf(func(v1, v2 uint32) bool { return v1 == v2 }),
+	ir.OpI32NeBrIf:           i32CmpBrIf(func(v1, v2 uint32) bool { return v1 != v2 }),
+	ir.OpI32LtSBrIf:          i32CmpBrIf(func(v1, v2 uint32) bool { return int32(v1) < int32(v2) }),
+	ir.OpI32LtUBrIf:          i32CmpBrIf(func(v1, v2 uint32) bool { return v1 < v2 }),
+	ir.OpI32GtSBrIf:          i32CmpBrIf(func(v1, v2 uint32) bool { return int32(v1) > int32(v2) }),
+	ir.OpI32GtUBrIf:          i32CmpBrIf(func(v1, v2 uint32) bool { return v1 > v2 }),
+	ir.OpI32LeSBrIf:          i32CmpBrIf(func(v1, v2 uint32) bool { return int32(v1) <= int32(v2) }),
+	ir.OpI32LeUBrIf:          i32CmpBrIf(func(v1, v2 uint32) bool { return v1 <= v2 }),
+	ir.OpI32GeSBrIf:          i32CmpBrIf(func(v1, v2 uint32) bool { return int32(v1) >= int32(v2) }),
+	ir.OpI32GeUBrIf:          i32CmpBrIf(func(v1, v2 uint32) bool { return v1 >= v2 }),
+}
+
+// lower fuses the compiled code into the superinstructions by the ir package, and relocates the blocks on the fused code.
+// The opcodes of the fused instructions are kept for the toll station
+func lower(code []instr) []instr {
+	src := make([]ir.Instr, len(code))
+	for i, in := range code {
+		src[i] = ir.Instr{Op: ir.Op(in.op), Imm: [2]uint64{in.imm[0], in.imm[1]}}
+	}
+
+	lowered, index := ir.Lower(src)
+	out := make([]instr, 0, len(lowered))
+	for i := 0; i < len(code); {
+		l := lowered[index[i]]
+		in := code[i]
+		if l.Op.IsSuper() {
+			in = instr{fn: superInstructions[l.Op], op: code[i].op, pos: code[i].pos, imm: [3]uint64{l.Imm[0], l.Imm[1]}}
+			in.fused = make([]expr.OpCode, l.Len)
+			for j := range in.fused {
+				in.fused[j] = code[i+j].op
+			}
+		}
+
+		if in.block != nil {
+			b := *in.block
+			b.StartAt, b.ElseAt, b.EndAt = uint64(index[b.StartAt]), uint64(index[b.ElseAt]), uint64(index[b.EndAt])
+			in.block = &b
+		}
+
+		out = append(out, in)
+		i += l.Len
+	}
+
+	return out
+}
+
+func localGet2(ins *Instance) error {
+	in := ins.current()
+	if ins.Active.LocalsHigh != nil {
+		ins.OperandStack.PushV128(ins.Active.Locals[in.imm[0]], ins.Active.LocalsHigh[in.imm[0]])
+		ins.OperandStack.PushV128(ins.Active.Locals[in.imm[1]], ins.Active.LocalsHigh[in.imm[1]])
+		return nil
+	}
+
+	ins.OperandStack.Push(ins.Active.Locals[in.imm[0]])
+	ins.OperandStack.Push(ins.Active.Locals[in.imm[1]])
+
+	return nil
+}
+
+func localGet2I32Add(ins *Instance) error {
+	in := ins.current()
+	ins.OperandStack.Push(uint64(uint32(ins.Active.Locals[in.imm[0]]) + uint32(ins.Active.Locals[in.imm[1]])))
+
+	return nil
+}
+
+func localGet2I32Sub(ins *Instance) error {
+	in := ins.current()
+	ins.OperandStack.Push(uint64(uint32(ins.Active.Locals[in.imm[0]]) - uint32(ins.Active.Locals[in.imm[1]])))
+
+	return nil
+}
+
+func localGetI32AddConst(ins *Instance) error {
+	in := ins.current()
+	ins.OperandStack.Push(uint64(uint32(ins.Active.Locals[in.imm[0]]) + uint32(in.imm[1])))
+
+	return nil
+}
+
+func i32AddConst(ins *Instance) error {
+	s := ins.OperandStack
+	s.Values[s.Ptr] = uint64(uint32(s.Values[s.Ptr]) + uint32(ins.current().imm[0]))
+
+	return nil
+}
+
+// the i32 binary instructions on the constant zero-extend their results like the ones in instr_num.go
+
+func i32MulConst(ins *Instance) error {
+	s := ins.OperandStack
+	s.Values[s.Ptr] = uint64(uint32(s.Values[s.Ptr]) * uint32(ins.current().imm[0]))
+
+	return nil
+}
+
+func i32AndConst(ins *Instance) error {
+	s := ins.OperandStack
+	s.Values[s.Ptr] = uint64(uint32(s.Values[s.Ptr]) & uint32(ins.current().imm[0]))
+
+	return nil
+}
+
+func i32OrConst(ins *Instance) error {
+	s := ins.OperandStack
+	s.Values[s.Ptr] = uint64(uint32(s.Values[s.Ptr]) | uint32(ins.current().imm[0]))
+
+	return nil
+}
+
+func i32XorConst(ins *Instance) error {
+	s := ins.OperandStack
+	s.Values[s.Ptr] = uint64(uint32(s.Values[s.Ptr]) ^ uint32(ins.current().imm[0]))
+
+	return nil
+}
+
+func i32ShlConst(ins *Instance) error {
+	s := ins.OperandStack
+	s.Values[s.Ptr] = uint64(uint32(s.Values[s.Ptr]) << (uint32(ins.current().imm[0]) % 32))
+
+	return nil
+}
+
+func i32ShrSConst(ins *Instance) error {
+	s := ins.OperandStack
+	s.Values[s.Ptr] = uint64(uint32(int32(s.Values[s.Ptr]) >> (uint32(ins.current().imm[0]) % 32)))
+
+	return nil
+}
+
+func i32ShrUConst(ins *Instance) error {
+	s := ins.OperandStack
+	s.Values[s.Ptr] = uint64(uint32(s.Values[s.Ptr]) >> (uint32(ins.current().imm[0]) % 32))
+
+	return nil
+}
+
+func i32EqzBrIf(ins *Instance) error {
+	if uint32(ins.OperandStack.Pop()) == 0 {
+		return branchAt(ins, uint32(ins.current().imm[0]))
+	}
+
+	return nil
+}
+
+// i32CmpBrIf creates the instr popping two i32 and branching to the label if the cmp holds
+func i32CmpBrIf(cmp func(v1, v2 uint32) bool) func(ins *Instance) error {
+	return func(ins *Instance) error {
+		v2 := uint32(ins.OperandStack.Pop())
+		v1 := uint32(ins.OperandStack.Pop())
+		if cmp(v1, v2) {
+			return branchAt(ins, uint32(ins.current().imm[0]))
+		}
+
+		return nil
+	}
+}
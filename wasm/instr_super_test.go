@@ -0,0 +1,258 @@
+package wasm
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/c0mm4nd/wasman/config"
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/ir"
+	"github.com/c0mm4nd/wasman/tollstation"
+)
+
+// superInstance instantiates the module exporting the func "f" of the type (param i32 i32) (result i32) with the body
+func superInstance(t *testing.T, conf config.ModuleConfig, body []byte) *Instance {
+	bin := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	bin = append(bin, benchSection(0x01, 0x01, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f)...) // type
+	bin = append(bin, benchSection(0x03, 0x01, 0x00)...)                               // function
+	bin = append(bin, benchSection(0x07, 0x01, 0x01, 'f', 0x00, 0x00)...)              // export
+	bin = append(bin, benchSection(0x0a, append([]byte{0x01, byte(len(body))}, body...)...)...)
+
+	m, err := NewModule(conf, bytes.NewReader(bin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins, err := NewInstance(m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ins
+}
+
+func TestLower(t *testing.T) {
+	code, err := (&Module{}).compile([]byte{
+		byte(expr.OpCodeLoop), 0x40,
+		byte(expr.OpCodeLocalGet), 0x00,
+		byte(expr.OpCodeI32Const), 0x01,
+		byte(expr.OpCodeI32Sub),
+		byte(expr.OpCodeLocalTee), 0x00,
+		byte(expr.OpCodeI32Eqz),
+		byte(expr.OpCodeBrIf), 0x01,
+		byte(expr.OpCodeBr), 0x00,
+		byte(expr.OpCodeEnd),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code = lower(code)
+	if len(code) != 6 {
+		t.Fatalf("lowered into %d instructions", len(code))
+	}
+	if b := code[0].block; b.StartAt != 0 || b.EndAt != 5 {
+		t.Errorf("got %+v", b)
+	}
+	if code[1].imm[1] != 0xffff_ffff || code[1].pos != 2 {
+		t.Errorf("got %+v", code[1])
+	}
+	if exp := []expr.OpCode{expr.OpCodeI32Eqz, expr.OpCodeBrIf}; !reflect.DeepEqual(code[3].fused, exp) {
+		t.Errorf("got %v, want %v", code[3].fused, exp)
+	}
+	if code[2].fused != nil || code[2].op != expr.OpCodeLocalTee {
+		t.Errorf("got %+v", code[2])
+	}
+	for op := ir.OpLocalGet2; op < ir.OpEnd; op++ {
+		if superInstructions[op] == nil {
+			t.Errorf("no instr for %#x", op)
+		}
+	}
+}
+
+// TestInstance_Optimize runs the funcs on both the reference interpreter and the lowered superinstructions,
+// which should return the same results at the same toll
+func TestInstance_Optimize(t *testing.T) {
+	type call struct {
+		name string
+		args []uint64
+	}
+	run := func(t *testing.T, ins func(conf config.ModuleConfig) *Instance, calls []call) {
+		var exp [][]uint64
+		var expToll uint64
+		for i, optimize := range []bool{false, true} {
+			ts := tollstation.NewSimpleTollStation(0)
+			in := ins(config.ModuleConfig{TollStation: ts, Optimize: optimize})
+			var got [][]uint64
+			for _, c := range calls {
+				ret, _, err := in.CallExportedFunc(c.name, c.args...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// all the funcs return i32, which both paths keep zero-extended
+				for _, v := range ret {
+					if v>>32 != 0 {
+						t.Errorf("%s%v: got %#x, not zero-extended", c.name, c.args, v)
+					}
+				}
+				got = append(got, ret)
+			}
+
+			if i == 0 {
+				exp, expToll = got, ts.GetToll()
+				continue
+			}
+			if !reflect.DeepEqual(got, exp) {
+				t.Errorf("got %v, want %v", got, exp)
+			}
+			if ts.GetToll() != expToll {
+				t.Errorf("got toll %d, want %d", ts.GetToll(), expToll)
+			}
+		}
+	}
+
+	t.Run("bench", func(t *testing.T) {
+		run(t, func(conf config.ModuleConfig) *Instance {
+			return benchInstance(t, conf)
+		}, []call{{"fib", []uint64{0}}, {"fib", []uint64{15}}, {"mem", []uint64{1}}, {"mem", []uint64{300}}})
+	})
+
+	for _, c := range []struct {
+		name string
+		body []byte
+	}{
+		{
+			// the i32.and gives 0x80000000 which should equal to the i32.const of the same bits
+			name: "eq",
+			body: []byte{
+				0x00,
+				byte(expr.OpCodeBlock), 0x7f,
+				byte(expr.OpCodeI32Const), 0x01,
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeI32Const), 0x80, 0x80, 0x80, 0x80, 0x78,
+				byte(expr.OpCodeI32And),
+				byte(expr.OpCodeI32Const), 0x80, 0x80, 0x80, 0x80, 0x78,
+				byte(expr.OpCodeI32Eq),
+				byte(expr.OpCodeBrIf), 0x00,
+				byte(expr.OpCodeDrop),
+				byte(expr.OpCodeLocalGet), 0x01,
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeI32Eq),
+				byte(expr.OpCodeEnd),
+				byte(expr.OpCodeEnd),
+			},
+		},
+		{
+			// every i32 producing a negative result on the fused or the plain instr, summed by i32.xor
+			name: "signed",
+			body: []byte{
+				0x00,
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeLocalGet), 0x01,
+				byte(expr.OpCodeI32Sub),
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeI32Const), 0x7b, // -5
+				byte(expr.OpCodeI32Add),
+				byte(expr.OpCodeI32Xor),
+				byte(expr.OpCodeLocalGet), 0x01,
+				byte(expr.OpCodeI32Const), 0x7d, // -3
+				byte(expr.OpCodeI32Mul),
+				byte(expr.OpCodeI32Xor),
+				byte(expr.OpCodeI32Const), 0x01,
+				byte(expr.OpCodeI32ShrS),
+				byte(expr.OpCodeI32Const), 0x7f, // -1
+				byte(expr.OpCodeI32Const), 0x02,
+				byte(expr.OpCodeI32DivS),
+				byte(expr.OpCodeI32Add),
+				byte(expr.OpCodeEnd),
+			},
+		},
+		{
+			name: "loop",
+			body: []byte{
+				0x01, 0x01, 0x7f, // the local $acc
+				byte(expr.OpCodeLoop), 0x40,
+				byte(expr.OpCodeLocalGet), 0x02,
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeI32Xor),
+				byte(expr.OpCodeI32Const), 0x03,
+				byte(expr.OpCodeI32Shl),
+				byte(expr.OpCodeI32Const), 0x05,
+				byte(expr.OpCodeI32ShrS),
+				byte(expr.OpCodeLocalGet), 0x01,
+				byte(expr.OpCodeI32Add),
+				byte(expr.OpCodeLocalSet), 0x02,
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeI32Const), 0x01,
+				byte(expr.OpCodeI32Sub),
+				byte(expr.OpCodeLocalTee), 0x00,
+				byte(expr.OpCodeI32Const), 0x00,
+				byte(expr.OpCodeI32GtS),
+				byte(expr.OpCodeBrIf), 0x00,
+				byte(expr.OpCodeEnd),
+				byte(expr.OpCodeLocalGet), 0x02,
+				byte(expr.OpCodeLocalGet), 0x01,
+				byte(expr.OpCodeI32Sub),
+				byte(expr.OpCodeEnd),
+			},
+		},
+		{
+			// the conditions of the select and the if on the param
+			name: "conditions",
+			body: []byte{
+				0x00,
+				byte(expr.OpCodeLocalGet), 0x01,
+				byte(expr.OpCodeI32Const), 0x07,
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeSelect),
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeIf), 0x7f,
+				byte(expr.OpCodeI32Const), 0x01,
+				byte(expr.OpCodeElse),
+				byte(expr.OpCodeI32Const), 0x02,
+				byte(expr.OpCodeEnd),
+				byte(expr.OpCodeI32Add),
+				byte(expr.OpCodeEnd),
+			},
+		},
+		{
+			name: "branches",
+			body: []byte{
+				0x00,
+				byte(expr.OpCodeBlock), 0x40,
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeI32Eqz),
+				byte(expr.OpCodeBrIf), 0x00,
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeLocalGet), 0x01,
+				byte(expr.OpCodeI32LeU),
+				byte(expr.OpCodeBrIf), 0x00,
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeLocalGet), 0x01,
+				byte(expr.OpCodeI32Mul),
+				byte(expr.OpCodeReturn),
+				byte(expr.OpCodeEnd),
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeI32Const), 0x7f, // -1
+				byte(expr.OpCodeI32Sub),
+				byte(expr.OpCodeLocalGet), 0x01,
+				byte(expr.OpCodeI32Sub),
+				byte(expr.OpCodeEnd),
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var calls []call
+			// the last args carry the high bits over the i32, which all the i32 consumers should ignore
+			for _, args := range [][]uint64{
+				{0, 0}, {1, 2}, {2, 1}, {100, 7}, {0xfffffff0, 0x80000000}, {0xffffffff, 3},
+				{0xffffffff_00000000, 1<<32 | 3}, {0x1_00000002, 0xffffffff_00000000},
+			} {
+				calls = append(calls, call{"f", args})
+			}
+			run(t, func(conf config.ModuleConfig) *Instance {
+				return superInstance(t, conf, c.body)
+			}, calls)
+		})
+	}
+}
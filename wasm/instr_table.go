@@ -0,0 +1,160 @@
+package wasm
+
+import "errors"
+
+// ErrElemSegmentNotFound will be throw when the element index is out of the range of element segments
+var ErrElemSegmentNotFound = errors.New("element segment not found")
+
+func tableInit(ins *Instance) error {
+	imm := &ins.current().imm
+	elemIndex, tableIndex := uint32(imm[0]), uint32(imm[1])
+	n := uint64(uint32(ins.OperandStack.Pop()))
+	src := uint64(uint32(ins.OperandStack.Pop()))
+	dst := uint64(uint32(ins.OperandStack.Pop()))
+
+	if elemIndex >= uint32(len(ins.elemSegments)) {
+		return ErrElemSegmentNotFound
+	}
+
+	if tableIndex >= uint32(len(ins.Module.IndexSpace.Tables)) {
+		return ErrTableIndexOutOfRange
+	}
+
+	elems := ins.elemSegments[elemIndex]
+	table := ins.Module.IndexSpace.Tables[tableIndex]
+	if src+n > uint64(len(elems)) || dst+n > uint64(len(table.Value)) {
+		return ErrTableIndexOutOfRange
+	}
+
+	copy(table.Value[dst:dst+n], elems[src:src+n])
+
+	return nil
+}
+
+func elemDrop(ins *Instance) error {
+	elemIndex := uint32(ins.current().imm[0])
+	if elemIndex >= uint32(len(ins.elemSegments)) {
+		return ErrElemSegmentNotFound
+	}
+
+	ins.elemSegments[elemIndex] = nil
+
+	return nil
+}
+
+func tableCopy(ins *Instance) error {
+	imm := &ins.current().imm
+	dstIndex, srcIndex := uint32(imm[0]), uint32(imm[1])
+	n := uint64(uint32(ins.OperandStack.Pop()))
+	src := uint64(uint32(ins.OperandStack.Pop()))
+	dst := uint64(uint32(ins.OperandStack.Pop()))
+
+	tables := ins.Module.IndexSpace.Tables
+	if dstIndex >= uint32(len(tables)) || srcIndex >= uint32(len(tables)) {
+		return ErrTableIndexOutOfRange
+	}
+
+	dstTable, srcTable := tables[dstIndex], tables[srcIndex]
+	if src+n > uint64(len(srcTable.Value)) || dst+n > uint64(len(dstTable.Value)) {
+		return ErrTableIndexOutOfRange
+	}
+
+	copy(dstTable.Value[dst:dst+n], srcTable.Value[src:src+n])
+
+	return nil
+}
+
+// fetchTable returns the table on the index immediate at i
+func (ins *Instance) fetchTable(i int) (*Table, error) {
+	index := uint32(ins.current().imm[i])
+	if index >= uint32(len(ins.Module.IndexSpace.Tables)) {
+		return nil, ErrTableIndexOutOfRange
+	}
+
+	return ins.Module.IndexSpace.Tables[index], nil
+}
+
+func tableGet(ins *Instance) error {
+	table, err := ins.fetchTable(0)
+	if err != nil {
+		return err
+	}
+
+	i := uint64(uint32(ins.OperandStack.Pop()))
+	if i >= uint64(len(table.Value)) {
+		return ErrTableIndexOutOfRange
+	}
+
+	ins.OperandStack.Push(refFromIndex(table.Value[i]))
+
+	return nil
+}
+
+func tableSet(ins *Instance) error {
+	table, err := ins.fetchTable(0)
+	if err != nil {
+		return err
+	}
+
+	ref := ins.OperandStack.Pop()
+	i := uint64(uint32(ins.OperandStack.Pop()))
+	if i >= uint64(len(table.Value)) {
+		return ErrTableIndexOutOfRange
+	}
+
+	table.Value[i] = refToIndex(ref)
+
+	return nil
+}
+
+func tableGrow(ins *Instance) error {
+	table, err := ins.fetchTable(0)
+	if err != nil {
+		return err
+	}
+
+	n := uint64(uint32(ins.OperandStack.Pop()))
+	ref := ins.OperandStack.Pop()
+
+	size := uint64(len(table.Value))
+	if size+n > table.limitSize() {
+		ins.OperandStack.Push(uint64(uint32(0xffffffff))) // -1 in i32
+		return nil
+	}
+
+	table.grow(n, refToIndex(ref))
+	ins.OperandStack.Push(size)
+
+	return nil
+}
+
+func tableSize(ins *Instance) error {
+	table, err := ins.fetchTable(0)
+	if err != nil {
+		return err
+	}
+
+	ins.OperandStack.Push(uint64(len(table.Value)))
+
+	return nil
+}
+
+func tableFill(ins *Instance) error {
+	table, err := ins.fetchTable(0)
+	if err != nil {
+		return err
+	}
+
+	n := uint64(uint32(ins.OperandStack.Pop()))
+	ref := ins.OperandStack.Pop()
+	i := uint64(uint32(ins.OperandStack.Pop()))
+	if i+n > uint64(len(table.Value)) {
+		return ErrTableIndexOutOfRange
+	}
+
+	for j := i; j < i+n; j++ {
+		table.Value[j] = refToIndex(ref)
+	}
+
+	return nil
+}
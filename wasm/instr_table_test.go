@@ -0,0 +1,267 @@
+package wasm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/stacks"
+	"github.com/c0mm4nd/wasman/types"
+	"github.com/c0mm4nd/wasman/utils"
+)
+
+func Test_tableInit(t *testing.T) {
+	vm := &Instance{
+		Active: &Frame{
+			Func: compiled(&wasmFunc{
+				body: []byte{expr.OpCodeMiscPrefix, byte(expr.OpCodeTableInit), 0x00, 0x01},
+			}),
+		},
+		Module: &Module{
+			IndexSpace: &IndexSpace{
+				Tables: []*Table{
+					{Value: []*uint32{nil}},
+					{Value: []*uint32{nil, nil, nil}},
+				},
+			},
+		},
+		OperandStack: stacks.NewOperandStack(),
+		elemSegments: [][]*uint32{{utils.Uint32Ptr(3), utils.Uint32Ptr(4)}},
+	}
+
+	vm.OperandStack.Push(1) // dst
+	vm.OperandStack.Push(0) // src
+	vm.OperandStack.Push(2) // n
+	if execCurrent(vm) != nil {
+		t.Fail()
+	}
+	if !reflect.DeepEqual(vm.IndexSpace.Tables[1].Value, []*uint32{nil, utils.Uint32Ptr(3), utils.Uint32Ptr(4)}) {
+		t.Fail()
+	}
+
+	vm.OperandStack.Push(2)
+	vm.OperandStack.Push(0)
+	vm.OperandStack.Push(2)
+	if execCurrent(vm) != ErrTableIndexOutOfRange {
+		t.Fail()
+	}
+}
+
+func Test_elemDrop(t *testing.T) {
+	vm := &Instance{
+		Active: &Frame{
+			Func: compiled(&wasmFunc{
+				body: []byte{expr.OpCodeMiscPrefix, byte(expr.OpCodeElemDrop), 0x00},
+			}),
+		},
+		OperandStack: stacks.NewOperandStack(),
+		elemSegments: [][]*uint32{{utils.Uint32Ptr(3)}},
+	}
+
+	if execCurrent(vm) != nil {
+		t.Fail()
+	}
+	if vm.elemSegments[0] != nil {
+		t.Fail()
+	}
+
+	vm.Active.Func = compiled(&wasmFunc{body: []byte{expr.OpCodeMiscPrefix, byte(expr.OpCodeElemDrop), 0x01}})
+	if execCurrent(vm) != ErrElemSegmentNotFound {
+		t.Fail()
+	}
+}
+
+func Test_tableCopy(t *testing.T) {
+	vm := &Instance{
+		Active: &Frame{
+			Func: compiled(&wasmFunc{
+				body: []byte{expr.OpCodeMiscPrefix, byte(expr.OpCodeTableCopy), 0x00, 0x01},
+			}),
+		},
+		Module: &Module{
+			IndexSpace: &IndexSpace{
+				Tables: []*Table{
+					{Value: []*uint32{nil, nil, nil}},
+					{Value: []*uint32{utils.Uint32Ptr(1), utils.Uint32Ptr(2)}},
+				},
+			},
+		},
+		OperandStack: stacks.NewOperandStack(),
+	}
+
+	vm.OperandStack.Push(1) // dst
+	vm.OperandStack.Push(0) // src
+	vm.OperandStack.Push(2) // n
+	if execCurrent(vm) != nil {
+		t.Fail()
+	}
+	if !reflect.DeepEqual(vm.IndexSpace.Tables[0].Value, []*uint32{nil, utils.Uint32Ptr(1), utils.Uint32Ptr(2)}) {
+		t.Fail()
+	}
+
+	vm.OperandStack.Push(0)
+	vm.OperandStack.Push(1)
+	vm.OperandStack.Push(2)
+	if execCurrent(vm) != ErrTableIndexOutOfRange {
+		t.Fail()
+	}
+}
+
+func Test_tableGetSet(t *testing.T) {
+	vm := &Instance{
+		Active: &Frame{
+			Func: compiled(&wasmFunc{
+				body: []byte{expr.OpCodeTableSet, 0x01, expr.OpCodeTableGet, 0x01},
+			}),
+		},
+		Module: &Module{
+			IndexSpace: &IndexSpace{
+				Tables: []*Table{
+					{Value: []*uint32{}},
+					{Value: []*uint32{nil, nil}},
+				},
+			},
+		},
+		OperandStack: stacks.NewOperandStack(),
+	}
+	ref := vm.NewExternRef("foo")
+
+	vm.OperandStack.Push(1)
+	vm.OperandStack.Push(ref)
+	if tableSet(vm) != nil {
+		t.Fail()
+	}
+	vm.Active.PC = 1
+	vm.OperandStack.Push(1)
+	if tableGet(vm) != nil {
+		t.Fail()
+	}
+	if got := vm.OperandStack.Pop(); got != ref || vm.ExternRef(got) != "foo" {
+		t.Fail()
+	}
+
+	vm.Active.PC = 1
+	vm.OperandStack.Push(2)
+	if tableGet(vm) != ErrTableIndexOutOfRange {
+		t.Fail()
+	}
+
+	vm.Active.Func = compiled(&wasmFunc{body: []byte{expr.OpCodeTableGet, 0x02}})
+	vm.Active.PC = 0
+	vm.OperandStack.Push(0)
+	if tableGet(vm) != ErrTableIndexOutOfRange {
+		t.Fail()
+	}
+}
+
+func Test_tableGrowSizeFill(t *testing.T) {
+	table := &Table{
+		TableType: types.TableType{
+			Elem:   types.ValueTypeFuncRef,
+			Limits: &types.Limits{Min: 1, Max: utils.Uint64Ptr(4)},
+		},
+		Value: []*uint32{nil},
+	}
+	vm := &Instance{
+		Active: &Frame{
+			Func: compiled(&wasmFunc{
+				body: []byte{
+					expr.OpCodeMiscPrefix, byte(expr.OpCodeTableGrow), 0x00,
+					expr.OpCodeMiscPrefix, byte(expr.OpCodeTableSize), 0x00,
+					expr.OpCodeMiscPrefix, byte(expr.OpCodeTableFill), 0x00,
+				},
+			}),
+		},
+		Module:       &Module{IndexSpace: &IndexSpace{Tables: []*Table{table}}},
+		OperandStack: stacks.NewOperandStack(),
+	}
+
+	// table.grow
+	vm.OperandStack.Push(refFromIndex(utils.Uint32Ptr(5)))
+	vm.OperandStack.Push(2)
+	if execCurrent(vm) != nil {
+		t.Fail()
+	}
+	if vm.OperandStack.Pop() != 1 {
+		t.Fail()
+	}
+	if !reflect.DeepEqual(table.Value, []*uint32{nil, utils.Uint32Ptr(5), utils.Uint32Ptr(5)}) {
+		t.Fail()
+	}
+
+	vm.Active.PC = 0
+	vm.OperandStack.Push(refNull)
+	vm.OperandStack.Push(2)
+	if execCurrent(vm) != nil {
+		t.Fail()
+	}
+	if vm.OperandStack.Pop() != 0xffffffff || len(table.Value) != 3 {
+		t.Fail()
+	}
+
+	// table.size
+	vm.Active.PC = 1
+	if execCurrent(vm) != nil {
+		t.Fail()
+	}
+	if vm.OperandStack.Pop() != 3 {
+		t.Fail()
+	}
+
+	// table.fill
+	vm.Active.PC = 2
+	vm.OperandStack.Push(1)
+	vm.OperandStack.Push(refNull)
+	vm.OperandStack.Push(2)
+	if execCurrent(vm) != nil {
+		t.Fail()
+	}
+	if !reflect.DeepEqual(table.Value, []*uint32{nil, nil, nil}) {
+		t.Fail()
+	}
+
+	vm.Active.PC = 2
+	vm.OperandStack.Push(2)
+	vm.OperandStack.Push(refNull)
+	vm.OperandStack.Push(2)
+	if execCurrent(vm) != ErrTableIndexOutOfRange {
+		t.Fail()
+	}
+}
+
+func Test_tableGrow_limit(t *testing.T) {
+	table := &Table{
+		TableType: types.TableType{
+			Elem:   types.ValueTypeFuncRef,
+			Limits: &types.Limits{Min: 1},
+		},
+		Value: []*uint32{nil},
+		limit: 2,
+	}
+	vm := &Instance{
+		Active: &Frame{
+			Func: compiled(&wasmFunc{
+				body: []byte{expr.OpCodeMiscPrefix, byte(expr.OpCodeTableGrow), 0x00},
+			}),
+		},
+		Module:       &Module{IndexSpace: &IndexSpace{Tables: []*Table{table}}},
+		OperandStack: stacks.NewOperandStack(),
+	}
+
+	for _, c := range []struct {
+		n, exp uint64
+	}{{n: 2, exp: 0xffffffff}, {n: 1, exp: 1}, {n: 1, exp: 0xffffffff}} {
+		vm.Active.PC = 0
+		vm.OperandStack.Push(refNull)
+		vm.OperandStack.Push(c.n)
+		if err := execCurrent(vm); err != nil {
+			t.Fatal(err)
+		}
+		if got := vm.OperandStack.Pop(); got != c.exp {
+			t.Errorf("grow %d: got %#x, want %#x", c.n, got, c.exp)
+		}
+	}
+	if len(table.Value) != 2 {
+		t.Errorf("got %d elements", len(table.Value))
+	}
+}
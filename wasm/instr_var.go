@@ -1,10 +1,10 @@
 package wasm
 
 func getLocal(ins *Instance) error {
-	ins.Active.PC++
-	id, err := ins.fetchUint32()
-	if err != nil {
-		return err
+	id := ins.current().imm[0]
+	if ins.Active.LocalsHigh != nil {
+		ins.OperandStack.PushV128(ins.Active.Locals[id], ins.Active.LocalsHigh[id])
+		return nil
 	}
 
 	ins.OperandStack.Push(ins.Active.Locals[id])
@@ -13,10 +13,10 @@ func getLocal(ins *Instance) error {
 }
 
 func setLocal(ins *Instance) error {
-	ins.Active.PC++
-	id, err := ins.fetchUint32()
-	if err != nil {
-		return err
+	id := ins.current().imm[0]
+	if ins.Active.LocalsHigh != nil {
+		ins.Active.Locals[id], ins.Active.LocalsHigh[id] = ins.OperandStack.PopV128()
+		return nil
 	}
 
 	v := ins.OperandStack.Pop()
@@ -26,10 +26,10 @@ func setLocal(ins *Instance) error {
 }
 
 func teeLocal(ins *Instance) error {
-	ins.Active.PC++
-	id, err := ins.fetchUint32()
-	if err != nil {
-		return err
+	id := ins.current().imm[0]
+	if ins.Active.LocalsHigh != nil {
+		ins.Active.Locals[id], ins.Active.LocalsHigh[id] = ins.OperandStack.PeekV128()
+		return nil
 	}
 
 	v := ins.OperandStack.Peek()
@@ -39,10 +39,10 @@ func teeLocal(ins *Instance) error {
 }
 
 func getGlobal(ins *Instance) error {
-	ins.Active.PC++
-	id, err := ins.fetchUint32()
-	if err != nil {
-		return err
+	id := ins.current().imm[0]
+	if ins.globalsHigh != nil {
+		ins.OperandStack.PushV128(ins.Globals[id], ins.globalsHigh[id])
+		return nil
 	}
 
 	ins.OperandStack.Push(ins.Globals[id])
@@ -51,10 +51,10 @@ func getGlobal(ins *Instance) error {
 }
 
 func setGlobal(ins *Instance) error {
-	ins.Active.PC++
-	id, err := ins.fetchUint32()
-	if err != nil {
-		return err
+	id := ins.current().imm[0]
+	if ins.globalsHigh != nil {
+		ins.Globals[id], ins.globalsHigh[id] = ins.OperandStack.PopV128()
+		return nil
 	}
 
 	ins.Globals[id] = ins.OperandStack.Pop()
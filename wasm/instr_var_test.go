@@ -10,9 +10,9 @@ import (
 func Test_getLocal(t *testing.T) {
 	exp := uint64(100)
 	ctx := &Frame{
-		Func: &wasmFunc{
+		Func: compiled(&wasmFunc{
 			body: []byte{byte(expr.OpCodeLocalGet), 0x05},
-		},
+		}),
 		Locals: []uint64{0, 0, 0, 0, 0, exp},
 	}
 
@@ -31,9 +31,9 @@ func Test_getLocal(t *testing.T) {
 
 func Test_setLocal(t *testing.T) {
 	ctx := &Frame{
-		Func: &wasmFunc{
+		Func: compiled(&wasmFunc{
 			body: []byte{byte(expr.OpCodeLocalSet), 0x05},
-		},
+		}),
 		Locals: make([]uint64, 100),
 	}
 
@@ -56,9 +56,9 @@ func Test_setLocal(t *testing.T) {
 
 func Test_teeLocal(t *testing.T) {
 	ctx := &Frame{
-		Func: &wasmFunc{
+		Func: compiled(&wasmFunc{
 			body: []byte{byte(expr.OpCodeLocalTee), 0x05},
-		},
+		}),
 		Locals: make([]uint64, 100),
 	}
 
@@ -81,16 +81,16 @@ func Test_teeLocal(t *testing.T) {
 
 func Test_getGlobal(t *testing.T) {
 	ctx := &Frame{
-		Func: &wasmFunc{
+		Func: compiled(&wasmFunc{
 			body: []byte{byte(expr.OpCodeGlobalGet), 0x05},
-		},
+		}),
 	}
 
 	exp := uint64(1)
 	globals := []uint64{0, 0, 0, 0, 0, exp}
 
 	vm := &Instance{
-		Active:      ctx,
+		Active:       ctx,
 		OperandStack: stacks.NewOperandStack(),
 		Globals:      globals,
 	}
@@ -108,9 +108,9 @@ func Test_getGlobal(t *testing.T) {
 
 func Test_setGlobal(t *testing.T) {
 	ctx := &Frame{
-		Func: &wasmFunc{
+		Func: compiled(&wasmFunc{
 			body: []byte{byte(expr.OpCodeGlobalSet), 0x05},
-		},
+		}),
 	}
 
 	exp := uint64(100)
@@ -1,40 +1,320 @@
 package wasm
 
 import (
+	"encoding/binary"
+	"math"
+
 	"github.com/c0mm4nd/wasman/config"
 	"github.com/c0mm4nd/wasman/types"
 )
 
+const (
+	// memory64MaxPages is the implicit maximum of pages on the memory64 (2^48)
+	memory64MaxPages = 1 << 48
+	// memoryBytesMaxPages is the max of pages whose size in bytes fits in uint64, less than memory64MaxPages
+	memoryBytesMaxPages = math.MaxUint64 >> config.DefaultMemoryPageSizeInBits
+
+	// MemoryGrowFailed is the result of Memory.Grow when it failed to grow, i.e. -1 in i32 and i64
+	MemoryGrowFailed = math.MaxUint64
+)
+
 // Memory is an instance of the memory value
 type Memory struct {
 	types.MemoryType
 	Value []byte
+
+	// Backing replaces the Value as the storage when it is not nil,
+	// e.g. a SparseMemoryBacking for the huge memory64 or a SharedMemoryBacking for the shared memory
+	Backing MemoryBacking
+
+	// limit is the max pages allowed by the host, set by ModuleConfig.MemoryLimitPages on instantiation.
+	// When it is 0, the memory without the Backing is limited by config.DefaultMemoryLimitPages
+	limit uint64
+}
+
+// MemoryBacking is the storage of a Memory not held in one contiguous []byte
+type MemoryBacking interface {
+	// Len returns the current length in bytes
+	Len() uint64
+	// Grow extends the storage by n zero bytes
+	Grow(n uint64)
+	// ReadAt fills p with the bytes starting at the offset
+	ReadAt(p []byte, offset uint64)
+	// WriteAt copies p to the bytes starting at the offset
+	WriteAt(p []byte, offset uint64)
 }
 
 // memoryBytesNumToPages converts the given number of bytes into the number of pages.
-func memoryBytesNumToPages(bytesNum uint64) (pages uint32) {
-	return uint32(bytesNum >> config.DefaultMemoryPageSizeInBits)
+func memoryBytesNumToPages(bytesNum uint64) (pages uint64) {
+	return bytesNum >> config.DefaultMemoryPageSizeInBits
 }
 
 // MemoryPagesToBytesNum converts the given pages into the number of bytes contained in these pages.
-func MemoryPagesToBytesNum(pages uint32) (bytesNum uint64) {
-	return uint64(pages) << config.DefaultMemoryPageSizeInBits
+func MemoryPagesToBytesNum(pages uint64) (bytesNum uint64) {
+	return pages << config.DefaultMemoryPageSizeInBits
+}
+
+// Len returns the current memory size in bytes.
+func (mem *Memory) Len() uint64 {
+	if mem.Backing != nil {
+		return mem.Backing.Len()
+	}
+
+	return uint64(len(mem.Value))
 }
 
 // PageSize returns the current memory buffer size in pages.
-func (m *Memory) PageSize() uint32 {
-	return memoryBytesNumToPages(uint64(len(m.Value)))
+func (mem *Memory) PageSize() uint64 {
+	return memoryBytesNumToPages(mem.Len())
+}
+
+// maxPages returns the max of pages, implicit one when no max is defined
+func (mem *Memory) maxPages() uint64 {
+	if mem.Max != nil {
+		return *mem.Max
+	}
+
+	if mem.Is64 {
+		return memory64MaxPages
+	}
+
+	return config.DefaultMemoryMaxPages
 }
 
-func (mem *Memory) Grow(newPages uint32) (result uint32) {
-	currentPages := memoryBytesNumToPages(uint64(len(mem.Value)))
+// limitPages returns the max of pages it can grow to, within the max, the limit of the host and the uint64 bytes
+func (mem *Memory) limitPages() uint64 {
+	max := mem.maxPages()
 
-	if mem.Max != nil &&
-		newPages+currentPages > *(mem.Max) {
-		return 0xffffffff // failed to grow
+	limit := mem.limit
+	if limit == 0 && mem.Backing == nil {
+		limit = config.DefaultMemoryLimitPages // the Value is allocated at once
+	}
+	if limit != 0 && limit < max {
+		max = limit
 	}
 
-	mem.Value = append(mem.Value, make([]byte, MemoryPagesToBytesNum(newPages))...)
+	if max > memoryBytesMaxPages {
+		max = memoryBytesMaxPages
+	}
+
+	return max
+}
+
+// Grow extends the memory by newPages and returns the previous size in pages,
+// or MemoryGrowFailed when the max or the limit of the host is exceeded
+func (mem *Memory) Grow(newPages uint64) (result uint64) {
+	maxPages := mem.limitPages()
+	if s, ok := mem.Backing.(*SharedMemoryBacking); ok {
+		// check and grow at once, the others may be growing it at the same time
+		return s.growPages(newPages, maxPages)
+	}
+
+	currentPages := mem.PageSize()
+
+	if currentPages > maxPages || newPages > maxPages-currentPages {
+		return MemoryGrowFailed // failed to grow
+	}
+
+	mem.growBytes(MemoryPagesToBytesNum(newPages))
 
 	return currentPages
 }
+
+func (mem *Memory) growBytes(n uint64) {
+	if mem.Backing != nil {
+		mem.Backing.Grow(n)
+		return
+	}
+
+	mem.Value = append(mem.Value, make([]byte, n)...)
+}
+
+// address converts the operand into an address on the memory
+func (mem *Memory) address(v uint64) uint64 {
+	if mem.Is64 {
+		return v
+	}
+
+	return uint64(uint32(v))
+}
+
+// inBounds checks whether the range [offset, offset+n) is inside the memory
+func (mem *Memory) inBounds(offset, n uint64) bool {
+	end := offset + n
+
+	return end >= offset && end <= mem.Len()
+}
+
+func (mem *Memory) read(p []byte, offset uint64) {
+	if mem.Backing != nil {
+		mem.Backing.ReadAt(p, offset)
+		return
+	}
+
+	copy(p, mem.Value[offset:])
+}
+
+func (mem *Memory) write(p []byte, offset uint64) {
+	if mem.Backing != nil {
+		mem.Backing.WriteAt(p, offset)
+		return
+	}
+
+	copy(mem.Value[offset:], p)
+}
+
+// memoryChunkSize is the max bytes moved at once by memory.copy and memory.fill on the Backing
+const memoryChunkSize = config.DefaultMemoryPageSize
+
+// copyFrom copies the n bytes at the src of the srcMem to the dst through the buf, a chunk at a time.
+// On the same memory, it copies backward when the dst is inside the src range, like the copy builtin
+func (mem *Memory) copyFrom(srcMem *Memory, dst, src, n uint64, buf []byte) {
+	if mem == srcMem && dst > src && dst < src+n {
+		for n > 0 {
+			size := uint64(len(buf))
+			if n < size {
+				size = n
+			}
+			n -= size
+			srcMem.read(buf[:size], src+n)
+			mem.write(buf[:size], dst+n)
+		}
+		return
+	}
+
+	for n > 0 {
+		size := uint64(len(buf))
+		if n < size {
+			size = n
+		}
+		srcMem.read(buf[:size], src)
+		mem.write(buf[:size], dst)
+		src, dst, n = src+size, dst+size, n-size
+	}
+}
+
+// fill sets the n bytes starting at the offset to the val through the buf, a chunk at a time
+func (mem *Memory) fill(offset, n uint64, val byte, buf []byte) {
+	if s, ok := mem.Backing.(*SparseMemoryBacking); ok {
+		s.fill(offset, n, val)
+		return
+	}
+
+	for i := range buf {
+		buf[i] = val
+	}
+	for n > 0 {
+		size := uint64(len(buf))
+		if n < size {
+			size = n
+		}
+		mem.write(buf[:size], offset)
+		offset, n = offset+size, n-size
+	}
+}
+
+func (mem *Memory) loadUint8(offset uint64) uint8 {
+	if mem.Backing == nil {
+		return mem.Value[offset]
+	}
+
+	var buf [1]byte
+	mem.Backing.ReadAt(buf[:], offset)
+	return buf[0]
+}
+
+func (mem *Memory) loadUint16(offset uint64) uint16 {
+	if mem.Backing == nil {
+		return binary.LittleEndian.Uint16(mem.Value[offset:])
+	}
+
+	var buf [2]byte
+	mem.Backing.ReadAt(buf[:], offset)
+	return binary.LittleEndian.Uint16(buf[:])
+}
+
+func (mem *Memory) loadUint32(offset uint64) uint32 {
+	if mem.Backing == nil {
+		return binary.LittleEndian.Uint32(mem.Value[offset:])
+	}
+
+	var buf [4]byte
+	mem.Backing.ReadAt(buf[:], offset)
+	return binary.LittleEndian.Uint32(buf[:])
+}
+
+func (mem *Memory) loadUint64(offset uint64) uint64 {
+	if mem.Backing == nil {
+		return binary.LittleEndian.Uint64(mem.Value[offset:])
+	}
+
+	var buf [8]byte
+	mem.Backing.ReadAt(buf[:], offset)
+	return binary.LittleEndian.Uint64(buf[:])
+}
+
+func (mem *Memory) storeUint8(offset uint64, v uint8) {
+	if mem.Backing == nil {
+		mem.Value[offset] = v
+		return
+	}
+
+	mem.Backing.WriteAt([]byte{v}, offset)
+}
+
+func (mem *Memory) storeUint16(offset uint64, v uint16) {
+	if mem.Backing == nil {
+		binary.LittleEndian.PutUint16(mem.Value[offset:], v)
+		return
+	}
+
+	var buf [2]byte
+	binary.LittleEndian.PutUint16(buf[:], v)
+	mem.Backing.WriteAt(buf[:], offset)
+}
+
+func (mem *Memory) storeUint32(offset uint64, v uint32) {
+	if mem.Backing == nil {
+		binary.LittleEndian.PutUint32(mem.Value[offset:], v)
+		return
+	}
+
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	mem.Backing.WriteAt(buf[:], offset)
+}
+
+func (mem *Memory) storeUint64(offset uint64, v uint64) {
+	if mem.Backing == nil {
+		binary.LittleEndian.PutUint64(mem.Value[offset:], v)
+		return
+	}
+
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	mem.Backing.WriteAt(buf[:], offset)
+}
+
+// ReadBytes returns a copy of the n bytes on the offset, for the host funcs reading the guest memory.
+// It returns ErrPtrOutOfBounds instead of panicking when the bytes are outside the memory
+func (mem *Memory) ReadBytes(offset, n uint64) ([]byte, error) {
+	if !mem.inBounds(offset, n) {
+		return nil, ErrPtrOutOfBounds
+	}
+
+	p := make([]byte, n)
+	mem.read(p, offset)
+
+	return p, nil
+}
+
+// WriteBytes copies the p onto the offset like ReadBytes
+func (mem *Memory) WriteBytes(offset uint64, p []byte) error {
+	if !mem.inBounds(offset, uint64(len(p))) {
+		return ErrPtrOutOfBounds
+	}
+
+	mem.write(p, offset)
+
+	return nil
+}
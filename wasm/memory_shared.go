@@ -0,0 +1,277 @@
+package wasm
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/c0mm4nd/wasman/config"
+	"github.com/c0mm4nd/wasman/types"
+)
+
+// sharedPage is one page of the SharedMemoryBacking, which never moves once allocated
+type sharedPage = [config.DefaultMemoryPageSize]byte
+
+// hostLittleEndian tells whether the words accessed by the sync/atomic are in the byte order of the wasm memory
+var hostLittleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// SharedMemoryBacking is a MemoryBacking which can be accessed by the instances running on different goroutines.
+// Its pages are allocated one by one and never moved, so growing the memory does not invalidate the pages in use.
+// The atomic instr are atomic on it, while the other accesses are not synchronized as in the threads proposal
+type SharedMemoryBacking struct {
+	size  uint64       // accessed atomically
+	pages atomic.Value // []*sharedPage, replaced with a longer copy on grow
+
+	mu      sync.Mutex // serializes the grows and guards the waiters
+	waiters map[uint64][]chan struct{}
+}
+
+// NewSharedMemoryBacking creates a SharedMemoryBacking with the initial size in bytes
+func NewSharedMemoryBacking(size uint64) *SharedMemoryBacking {
+	s := &SharedMemoryBacking{
+		waiters: make(map[uint64][]chan struct{}),
+	}
+	s.pages.Store([]*sharedPage{})
+	s.Grow(size)
+
+	return s
+}
+
+// NewSharedMemory creates a shared memory of the min pages, which cannot grow over the max pages.
+// Define it on the linker, then the instances importing it share the memory,
+// each of them should be instantiated from its own Module and run on its own goroutine
+func NewSharedMemory(min, max uint64) *Memory {
+	return &Memory{
+		MemoryType: types.MemoryType{Min: min, Max: &max, Shared: true},
+		Backing:    NewSharedMemoryBacking(MemoryPagesToBytesNum(min)),
+	}
+}
+
+// Len returns the current length in bytes
+func (s *SharedMemoryBacking) Len() uint64 {
+	return atomic.LoadUint64(&s.size)
+}
+
+// Grow extends the storage by n zero bytes
+func (s *SharedMemoryBacking) Grow(n uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.grow(n)
+}
+
+// growPages extends the storage by n pages unless it exceeds the max pages,
+// and returns the previous size in pages or MemoryGrowFailed
+func (s *SharedMemoryBacking) growPages(n, max uint64) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := memoryBytesNumToPages(s.Len())
+	if current > max || n > max-current {
+		return MemoryGrowFailed
+	}
+
+	s.grow(MemoryPagesToBytesNum(n))
+
+	return current
+}
+
+func (s *SharedMemoryBacking) grow(n uint64) {
+	size := s.Len() + n
+	pages := s.loadPages()
+	if num := (size + config.DefaultMemoryPageSize - 1) >> config.DefaultMemoryPageSizeInBits; num > uint64(len(pages)) {
+		next := make([]*sharedPage, num)
+		copy(next, pages)
+		for i := len(pages); i < len(next); i++ {
+			next[i] = new(sharedPage)
+		}
+		s.pages.Store(next)
+	}
+
+	// store the size after the pages, so that the readers seeing the size see the pages
+	atomic.StoreUint64(&s.size, size)
+}
+
+func (s *SharedMemoryBacking) loadPages() []*sharedPage {
+	return s.pages.Load().([]*sharedPage)
+}
+
+// ReadAt fills p with the bytes starting at the offset
+func (s *SharedMemoryBacking) ReadAt(p []byte, offset uint64) {
+	pages := s.loadPages()
+	for len(p) > 0 {
+		index, pos := offset>>config.DefaultMemoryPageSizeInBits, offset%config.DefaultMemoryPageSize
+		n := copy(p, pages[index][pos:])
+		p = p[n:]
+		offset += uint64(n)
+	}
+}
+
+// WriteAt copies p to the bytes starting at the offset
+func (s *SharedMemoryBacking) WriteAt(p []byte, offset uint64) {
+	pages := s.loadPages()
+	for len(p) > 0 {
+		index, pos := offset>>config.DefaultMemoryPageSizeInBits, offset%config.DefaultMemoryPageSize
+		n := copy(pages[index][pos:], p)
+		p = p[n:]
+		offset += uint64(n)
+	}
+}
+
+// word32 returns the 4-byte aligned word containing the offset
+func (s *SharedMemoryBacking) word32(offset uint64) *uint32 {
+	offset &^= 3
+	page := s.loadPages()[offset>>config.DefaultMemoryPageSizeInBits]
+	return (*uint32)(unsafe.Pointer(&page[offset%config.DefaultMemoryPageSize]))
+}
+
+// word64 returns the word on the 8-byte aligned offset
+func (s *SharedMemoryBacking) word64(offset uint64) *uint64 {
+	page := s.loadPages()[offset>>config.DefaultMemoryPageSizeInBits]
+	return (*uint64)(unsafe.Pointer(&page[offset%config.DefaultMemoryPageSize]))
+}
+
+// le32 converts between the little-endian word in memory and the host word, it is its own inverse
+func le32(w uint32) uint32 {
+	if hostLittleEndian {
+		return w
+	}
+
+	return bits.ReverseBytes32(w)
+}
+
+func le64(w uint64) uint64 {
+	if hostLittleEndian {
+		return w
+	}
+
+	return bits.ReverseBytes64(w)
+}
+
+// sizeMask returns the mask of the lowest size bytes
+func sizeMask(size uint64) uint64 {
+	if size == 8 {
+		return ^uint64(0)
+	}
+
+	return 1<<(size*8) - 1
+}
+
+// load reads the size bytes on the aligned offset atomically
+func (s *SharedMemoryBacking) load(offset, size uint64) uint64 {
+	if size == 8 {
+		return le64(atomic.LoadUint64(s.word64(offset)))
+	}
+
+	shift := (offset & 3) * 8
+	w := le32(atomic.LoadUint32(s.word32(offset)))
+	return uint64(w>>shift) & sizeMask(size)
+}
+
+// rmw replaces the size bytes on the aligned offset with f(old) atomically, and returns the old ones
+func (s *SharedMemoryBacking) rmw(offset, size uint64, f func(old uint64) uint64) uint64 {
+	if size == 8 {
+		p := s.word64(offset)
+		for {
+			w := atomic.LoadUint64(p)
+			old := le64(w)
+			if atomic.CompareAndSwapUint64(p, w, le64(f(old))) {
+				return old
+			}
+		}
+	}
+
+	p := s.word32(offset)
+	shift, mask := (offset&3)*8, uint32(sizeMask(size))
+	for {
+		w := atomic.LoadUint32(p)
+		v := le32(w)
+		old := v >> shift & mask
+		next := v&^(mask<<shift) | (uint32(f(uint64(old)))&mask)<<shift
+		if atomic.CompareAndSwapUint32(p, w, le32(next)) {
+			return uint64(old)
+		}
+	}
+}
+
+// wait blocks until notified on the offset, unless the loaded size bytes mismatch the expected.
+// It returns 0 when notified, 1 when mismatched, 2 when timed out, a negative timeout never times out.
+// The wait gives up without the result once the interrupt is closed
+func (s *SharedMemoryBacking) wait(offset, size, expected uint64, timeout int64, interrupt <-chan struct{}) (result uint64, interrupted bool) {
+	s.mu.Lock()
+	if s.load(offset, size) != expected {
+		s.mu.Unlock()
+		return 1, false
+	}
+
+	ch := make(chan struct{})
+	s.waiters[offset] = append(s.waiters[offset], ch)
+	s.mu.Unlock()
+
+	var timedOut <-chan time.Time // never if nil
+	if timeout >= 0 {
+		timer := time.NewTimer(time.Duration(timeout))
+		defer timer.Stop()
+		timedOut = timer.C
+	}
+
+	select {
+	case <-ch:
+		return 0, false
+	case <-timedOut:
+		if s.removeWaiter(offset, ch) {
+			return 2, false
+		}
+	case <-interrupt:
+		if s.removeWaiter(offset, ch) {
+			return 0, true
+		}
+	}
+
+	return 0, false // notified after timed out or interrupted
+}
+
+// removeWaiter removes the ch from the waiters on the offset, and returns false if it is notified already
+func (s *SharedMemoryBacking) removeWaiter(offset uint64, ch chan struct{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	waiters := s.waiters[offset]
+	for i, w := range waiters {
+		if w == ch {
+			s.waiters[offset] = append(waiters[:i:i], waiters[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// notify wakes up at most count waiters on the offset, and returns the number of them
+func (s *SharedMemoryBacking) notify(offset uint64, count uint32) uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	waiters := s.waiters[offset]
+	n := uint32(len(waiters))
+	if count < n {
+		n = count
+	}
+
+	for _, ch := range waiters[:n] {
+		close(ch)
+	}
+
+	if rest := waiters[n:]; len(rest) > 0 {
+		s.waiters[offset] = rest
+	} else {
+		delete(s.waiters, offset)
+	}
+
+	return n
+}
@@ -0,0 +1,95 @@
+package wasm
+
+import (
+	"github.com/c0mm4nd/wasman/config"
+)
+
+// SparseMemoryBacking is a MemoryBacking which only allocates the pages having been written,
+// all the others are read as zero. It suits the memory64 which can be far larger than the host RAM
+type SparseMemoryBacking struct {
+	size  uint64
+	pages map[uint64][]byte
+}
+
+// NewSparseMemoryBacking creates a SparseMemoryBacking with the initial size in bytes
+func NewSparseMemoryBacking(size uint64) *SparseMemoryBacking {
+	return &SparseMemoryBacking{
+		size:  size,
+		pages: make(map[uint64][]byte),
+	}
+}
+
+// Len returns the current length in bytes
+func (s *SparseMemoryBacking) Len() uint64 {
+	return s.size
+}
+
+// Grow extends the storage by n zero bytes, without allocating
+func (s *SparseMemoryBacking) Grow(n uint64) {
+	s.size += n
+}
+
+// ReadAt fills p with the bytes starting at the offset
+func (s *SparseMemoryBacking) ReadAt(p []byte, offset uint64) {
+	for len(p) > 0 {
+		index, pos := offset>>config.DefaultMemoryPageSizeInBits, offset%config.DefaultMemoryPageSize
+
+		var n int
+		if page, ok := s.pages[index]; ok {
+			n = copy(p, page[pos:])
+		} else {
+			n = len(p)
+			if rest := config.DefaultMemoryPageSize - pos; uint64(n) > rest {
+				n = int(rest)
+			}
+			for i := range p[:n] {
+				p[i] = 0
+			}
+		}
+
+		p = p[n:]
+		offset += uint64(n)
+	}
+}
+
+// WriteAt copies p to the bytes starting at the offset
+func (s *SparseMemoryBacking) WriteAt(p []byte, offset uint64) {
+	for len(p) > 0 {
+		index, pos := offset>>config.DefaultMemoryPageSizeInBits, offset%config.DefaultMemoryPageSize
+
+		page, ok := s.pages[index]
+		if !ok {
+			page = make([]byte, config.DefaultMemoryPageSize)
+			s.pages[index] = page
+		}
+
+		n := copy(page[pos:], p)
+		p = p[n:]
+		offset += uint64(n)
+	}
+}
+
+// fill sets the n bytes starting at the offset to the val, leaving the pages never written alone on the zero
+func (s *SparseMemoryBacking) fill(offset, n uint64, val byte) {
+	for n > 0 {
+		index, pos := offset>>config.DefaultMemoryPageSizeInBits, offset%config.DefaultMemoryPageSize
+		size := config.DefaultMemoryPageSize - pos
+		if n < size {
+			size = n
+		}
+
+		page, ok := s.pages[index]
+		if !ok && val != 0 {
+			page = make([]byte, config.DefaultMemoryPageSize)
+			s.pages[index] = page
+		}
+		if page != nil {
+			region := page[pos : pos+size]
+			for i := range region {
+				region[i] = val
+			}
+		}
+
+		offset, n = offset+size, n-size
+	}
+}
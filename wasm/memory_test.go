@@ -0,0 +1,245 @@
+package wasm
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c0mm4nd/wasman/config"
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/stacks"
+	"github.com/c0mm4nd/wasman/types"
+	"github.com/c0mm4nd/wasman/utils"
+)
+
+func TestSparseMemoryBacking(t *testing.T) {
+	s := NewSparseMemoryBacking(1 << 40)
+	if s.Len() != 1<<40 {
+		t.Fail()
+	}
+
+	// write across the page boundary
+	offset := uint64(1<<36 - 2)
+	s.WriteAt([]byte{1, 2, 3, 4}, offset)
+	if len(s.pages) != 2 {
+		t.Fail()
+	}
+
+	buf := make([]byte, 6)
+	s.ReadAt(buf, offset-1)
+	if !bytes.Equal(buf, []byte{0, 1, 2, 3, 4, 0}) {
+		t.Fail()
+	}
+
+	// reading the unwritten pages allocates nothing
+	buf = make([]byte, config.DefaultMemoryPageSize*2)
+	s.ReadAt(buf, 1<<20)
+	if !bytes.Equal(buf, make([]byte, len(buf))) || len(s.pages) != 2 {
+		t.Fail()
+	}
+
+	s.Grow(10)
+	if s.Len() != 1<<40+10 {
+		t.Fail()
+	}
+}
+
+func TestMemory_Grow(t *testing.T) {
+	for _, c := range []struct {
+		mem      *Memory
+		newPages uint64
+		exp      uint64
+	}{
+		{mem: &Memory{}, newPages: 1, exp: 0},
+		{mem: &Memory{}, newPages: config.DefaultMemoryMaxPages + 1, exp: MemoryGrowFailed},
+		{
+			mem:      &Memory{MemoryType: types.MemoryType{Max: utils.Uint64Ptr(1)}},
+			newPages: 2,
+			exp:      MemoryGrowFailed,
+		},
+		{
+			mem: &Memory{
+				MemoryType: types.MemoryType{Is64: true},
+				Backing:    NewSparseMemoryBacking(MemoryPagesToBytesNum(1)),
+			},
+			newPages: 1 << 32,
+			exp:      1,
+		},
+		{
+			mem: &Memory{
+				MemoryType: types.MemoryType{Is64: true},
+				Backing:    NewSparseMemoryBacking(MemoryPagesToBytesNum(1)),
+			},
+			newPages: memory64MaxPages,
+			exp:      MemoryGrowFailed,
+		},
+		{
+			mem: &Memory{
+				MemoryType: types.MemoryType{Is64: true},
+				Backing:    NewSparseMemoryBacking(MemoryPagesToBytesNum(1)),
+				limit:      2,
+			},
+			newPages: 2,
+			exp:      MemoryGrowFailed,
+		},
+	} {
+		if c.mem.Grow(c.newPages) != c.exp {
+			t.Fail()
+		}
+	}
+}
+
+func TestMemory_Grow_memory64(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		mem      *Memory
+		newPages uint64
+	}{
+		// the bytes of the Value cannot be allocated at once
+		{name: "value", mem: &Memory{MemoryType: types.MemoryType{Is64: true}}, newPages: 1 << 47},
+		{name: "limit", mem: &Memory{MemoryType: types.MemoryType{Is64: true}, limit: 1 << 20}, newPages: 1<<20 + 1},
+		// the 2^64 bytes wrap to 0
+		{name: "wrap", mem: &Memory{MemoryType: types.MemoryType{Is64: true}, Backing: NewSparseMemoryBacking(0)}, newPages: 1 << 48},
+		{name: "wrap value", mem: &Memory{MemoryType: types.MemoryType{Is64: true}}, newPages: 1 << 48},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			vm := &Instance{
+				Active:       &Frame{Func: compiled(&wasmFunc{body: []byte{expr.OpCodeMemoryGrow, 0x00}})},
+				Memories:     []*Memory{c.mem},
+				Memory:       c.mem,
+				OperandStack: stacks.NewOperandStack(),
+			}
+			vm.OperandStack.Push(c.newPages)
+			if err := memoryGrow(vm); err != nil {
+				t.Fatal(err)
+			}
+			if r := vm.OperandStack.Pop(); r != MemoryGrowFailed || c.mem.Len() != 0 {
+				t.Errorf("got %d, %d bytes", r, c.mem.Len())
+			}
+		})
+	}
+}
+
+func TestSharedMemoryBacking(t *testing.T) {
+	s := NewSharedMemoryBacking(MemoryPagesToBytesNum(1))
+	if s.Len() != config.DefaultMemoryPageSize {
+		t.Fail()
+	}
+
+	// growing keeps the pages in use
+	first := s.loadPages()[0]
+	if s.growPages(2, 2) != MemoryGrowFailed {
+		t.Fail()
+	}
+	if s.growPages(1, 2) != 1 || s.Len() != 2*config.DefaultMemoryPageSize || s.loadPages()[0] != first {
+		t.Fail()
+	}
+
+	// write across the page boundary
+	offset := uint64(config.DefaultMemoryPageSize - 2)
+	s.WriteAt([]byte{1, 2, 3, 4}, offset)
+	buf := make([]byte, 6)
+	s.ReadAt(buf, offset-1)
+	if !bytes.Equal(buf, []byte{0, 1, 2, 3, 4, 0}) {
+		t.Fail()
+	}
+
+	// the sub-word accesses keep the neighbours
+	s.rmw(offset, 1, func(old uint64) uint64 { return old + 0xff })
+	if s.load(offset, 1) != 0 || s.load(offset+1, 1) != 2 || s.load(offset-2, 4) != 0x02000000 {
+		t.Fail()
+	}
+	s.rmw(8, 8, func(uint64) uint64 { return 0x0807060504030201 })
+	if s.load(10, 2) != 0x0403 || s.load(12, 4) != 0x08070605 {
+		t.Fail()
+	}
+}
+
+func TestSharedMemoryBacking_wait(t *testing.T) {
+	s := NewSharedMemoryBacking(MemoryPagesToBytesNum(1))
+	s.rmw(0, 4, func(uint64) uint64 { return 1 })
+
+	if v, _ := s.wait(0, 4, 0, -1, nil); v != 1 { // not equal
+		t.Fail()
+	}
+	if v, _ := s.wait(0, 4, 1, int64(time.Millisecond), nil); v != 2 { // timed out
+		t.Fail()
+	}
+	if s.notify(0, 1) != 0 {
+		t.Fail()
+	}
+
+	done := make(chan uint64)
+	for i := 0; i < 2; i++ {
+		go func() {
+			v, _ := s.wait(0, 4, 1, -1, nil)
+			done <- v
+		}()
+	}
+
+	for woken := uint32(0); woken < 2; {
+		woken += s.notify(0, 1)
+		runtime.Gosched()
+	}
+	if <-done != 0 || <-done != 0 {
+		t.Fail()
+	}
+
+	interrupt := make(chan struct{})
+	close(interrupt)
+	if _, interrupted := s.wait(0, 4, 1, -1, interrupt); !interrupted || len(s.waiters[0]) != 0 {
+		t.Fail()
+	}
+}
+
+func TestSharedMemoryBacking_growConcurrently(t *testing.T) {
+	mem := NewSharedMemory(0, 100)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if prev := mem.Grow(1); prev != MemoryGrowFailed {
+					mem.atomicRMW(MemoryPagesToBytesNum(prev), 4, func(uint64) uint64 { return prev })
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if mem.PageSize() != 100 {
+		t.Errorf("got %d pages", mem.PageSize())
+	}
+	for i := uint64(0); i < 100; i++ {
+		if mem.atomicLoad(MemoryPagesToBytesNum(i), 4) != i {
+			t.Errorf("page %d is lost", i)
+		}
+	}
+}
+
+func TestNewInstance_memoryLimit(t *testing.T) {
+	bin := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	bin = append(bin, benchSection(0x05, 0x01, 0x04, 0x02)...) // memory64 of the min 2
+
+	for _, c := range []struct {
+		limit uint64
+		ok    bool
+	}{{limit: 1}, {limit: 2, ok: true}} {
+		m, err := NewModule(config.ModuleConfig{MemoryLimitPages: &c.limit}, bytes.NewReader(bin))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ins, err := NewInstance(m, nil)
+		if (err == nil) != c.ok {
+			t.Fatalf("limit %d: got %v", c.limit, err)
+		}
+		if c.ok && (ins.Memory.PageSize() != 2 || ins.Memory.Grow(1) != MemoryGrowFailed) {
+			t.Errorf("limit %d: grown over the limit", c.limit)
+		}
+	}
+}
@@ -33,6 +33,7 @@ type Module struct {
 	FunctionSection []uint32
 	TableSection    []*types.TableType
 	MemorySection   []*types.MemoryType
+	TagSection      []*types.TagType
 	GlobalSection   []*segments.GlobalSegment
 	ExportSection   map[string]*segments.ExportSegment
 	StartSection    []uint32
@@ -40,6 +41,12 @@ type Module struct {
 	CodeSection     []*segments.CodeSegment
 	DataSection     []*segments.DataSegment
 
+	DataCountSection *uint32 // optional, required by memory.init and data.drop
+
+	FunctionNames map[uint32]string // the func names in the custom name section, nil without it
+
+	duplicateExports []string // the names exported more than once, which are rejected by Validate
+
 	// index spaces
 	IndexSpace *IndexSpace
 }
@@ -50,6 +57,7 @@ type IndexSpace struct {
 	Globals   []*Global
 	Tables    []*Table
 	Memories  []*Memory
+	Tags      []*Tag
 }
 
 // NewModule reads bytes from the io.Reader and read all sections, finally return a wasman.Module entity if no error
@@ -73,6 +81,18 @@ func NewModule(config config.ModuleConfig, r *bytes.Reader) (*Module, error) {
 		return nil, fmt.Errorf("readSections failed: %w", err)
 	}
 
+	if config.EnableValidation {
+		if err := module.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.DisableFloatPoint && !config.TrapFloatPoint {
+		if err := module.checkFloatPoint(); err != nil {
+			return nil, err
+		}
+	}
+
 	return module, nil
 }
 
@@ -81,3 +101,23 @@ func (m *Module) log(text string) {
 		m.ModuleConfig.Logger(text)
 	}
 }
+
+// funcNames returns the names of the funcs for the Trap by their indices, from the name section or else the exports.
+// The func exported as several names takes the least one
+func (m *Module) funcNames() map[uint32]string {
+	names := make(map[uint32]string, len(m.FunctionNames))
+	for _, exp := range m.ExportSection {
+		if exp.Desc.Kind != segments.KindFunction {
+			continue
+		}
+		if name, ok := names[exp.Desc.Index]; !ok || exp.Name < name {
+			names[exp.Desc.Index] = exp.Name
+		}
+	}
+
+	for i, name := range m.FunctionNames {
+		names[i] = name
+	}
+
+	return names
+}
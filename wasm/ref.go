@@ -0,0 +1,66 @@
+package wasm
+
+// the references (funcref and externref) are kept on the OperandStack as their index plus 1,
+// so that the zero value stands for the null reference
+const refNull uint64 = 0
+
+// refFromIndex converts the table entry into the reference value, nil means null
+func refFromIndex(index *uint32) uint64 {
+	if index == nil {
+		return refNull
+	}
+
+	return uint64(*index) + 1
+}
+
+// refToIndex converts the reference value into the table entry, null means nil
+func refToIndex(ref uint64) *uint32 {
+	if ref == refNull {
+		return nil
+	}
+
+	index := uint32(ref - 1)
+	return &index
+}
+
+// freedExternRef is on the slot of the externRefs freed by ReleaseExternRef
+type freedExternRef struct{}
+
+// NewExternRef registers the go value v on the instance and returns the externref
+// standing for it, which can be passed to the wasm functions as an argument.
+// The registered values are kept until released by ReleaseExternRef, or the instance is collected.
+func (ins *Instance) NewExternRef(v interface{}) uint64 {
+	if n := len(ins.externRefsFree); n > 0 {
+		i := ins.externRefsFree[n-1]
+		ins.externRefsFree = ins.externRefsFree[:n-1]
+		ins.externRefs[i] = v
+
+		return uint64(i) + 1
+	}
+
+	ins.externRefs = append(ins.externRefs, v)
+
+	return uint64(len(ins.externRefs))
+}
+
+// ReleaseExternRef frees the slot of the externref for the later NewExternRef, so the go value it stands for
+// is no longer kept by the instance. The host must release it only when no wasm value holds it any more,
+// since a later NewExternRef may return the same ref for another value.
+// Releasing the null, unknown or released one is a no-op
+func (ins *Instance) ReleaseExternRef(ref uint64) {
+	if ref == refNull || ref > uint64(len(ins.externRefs)) || ins.externRefs[ref-1] == (freedExternRef{}) {
+		return
+	}
+
+	ins.externRefs[ref-1] = freedExternRef{}
+	ins.externRefsFree = append(ins.externRefsFree, uint32(ref-1))
+}
+
+// ExternRef returns the go value which the externref stands for, nil for the null, unknown or released ones
+func (ins *Instance) ExternRef(ref uint64) interface{} {
+	if ref == refNull || ref > uint64(len(ins.externRefs)) || ins.externRefs[ref-1] == (freedExternRef{}) {
+		return nil
+	}
+
+	return ins.externRefs[ref-1]
+}
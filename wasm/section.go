@@ -14,28 +14,36 @@ import (
 type sectionID byte
 
 const (
-	sectionIDCustom   sectionID = 0
-	sectionIDType     sectionID = 1
-	sectionIDImport   sectionID = 2
-	sectionIDFunction sectionID = 3
-	sectionIDTable    sectionID = 4
-	sectionIDMemory   sectionID = 5
-	sectionIDGlobal   sectionID = 6
-	sectionIDExport   sectionID = 7
-	sectionIDStart    sectionID = 8
-	sectionIDElement  sectionID = 9
-	sectionIDCode     sectionID = 10
-	sectionIDData     sectionID = 11
+	sectionIDCustom    sectionID = 0
+	sectionIDType      sectionID = 1
+	sectionIDImport    sectionID = 2
+	sectionIDFunction  sectionID = 3
+	sectionIDTable     sectionID = 4
+	sectionIDMemory    sectionID = 5
+	sectionIDGlobal    sectionID = 6
+	sectionIDExport    sectionID = 7
+	sectionIDStart     sectionID = 8
+	sectionIDElement   sectionID = 9
+	sectionIDCode      sectionID = 10
+	sectionIDData      sectionID = 11
+	sectionIDDataCount sectionID = 12
+	sectionIDTag       sectionID = 13
 )
 
 func (m *Module) readSections(r *bytes.Reader) error {
 	for {
 		if err := m.readSection(r); errors.Is(err, io.EOF) {
-			return nil
+			break
 		} else if err != nil {
 			return err
 		}
 	}
+
+	if m.DataCountSection != nil && int(*m.DataCountSection) != len(m.DataSection) {
+		return fmt.Errorf("data count %d mismatches the number of data segments %d", *m.DataCountSection, len(m.DataSection))
+	}
+
+	return nil
 }
 
 func (m *Module) readSection(r *bytes.Reader) error {
@@ -51,9 +59,16 @@ func (m *Module) readSection(r *bytes.Reader) error {
 
 	switch sectionID(b[0]) {
 	case sectionIDCustom:
-		// Custom section is ignored here: https://www.w3.org/TR/wasm-core-1/#custom-section
+		// Custom section is ignored here except the name section: https://www.w3.org/TR/wasm-core-1/#custom-section
+		if int64(ss) > int64(r.Len()) {
+			err = fmt.Errorf("read custom section: %w", io.ErrUnexpectedEOF)
+			break
+		}
 		bb := make([]byte, ss)
 		_, err = io.ReadFull(r, bb)
+		if err == nil {
+			m.readSectionCustom(bytes.NewReader(bb))
+		}
 	case sectionIDType:
 		err = m.readSectionTypes(r)
 	case sectionIDImport:
@@ -76,6 +91,10 @@ func (m *Module) readSection(r *bytes.Reader) error {
 		err = m.readSectionCodes(r)
 	case sectionIDData:
 		err = m.readSectionData(r)
+	case sectionIDDataCount:
+		err = m.readSectionDataCount(r)
+	case sectionIDTag:
+		err = m.readSectionTags(r)
 	default:
 		err = errors.New("invalid section id")
 	}
@@ -86,10 +105,76 @@ func (m *Module) readSection(r *bytes.Reader) error {
 	return nil
 }
 
-func (m *Module) readSectionTypes(r *bytes.Reader) error {
+// readSectionCustom reads the func names in the name section, https://webassembly.github.io/spec/core/appendix/custom.html#name-section.
+// The malformed name section is ignored like the other custom sections
+func (m *Module) readSectionCustom(r *bytes.Reader) {
+	name, err := types.ReadNameValue(r)
+	if err != nil || name != "name" {
+		return
+	}
+
+	for r.Len() > 0 {
+		id, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		size, _, err := leb128decode.DecodeUint32(r)
+		if err != nil || int(size) > r.Len() {
+			return
+		}
+		sub := make([]byte, size)
+		_, _ = io.ReadFull(r, sub)
+		if id != 1 { // only the function names
+			continue
+		}
+
+		names, err := readNameMap(bytes.NewReader(sub))
+		if err != nil {
+			return
+		}
+		m.FunctionNames = names
+	}
+}
+
+// readVectorSize reads the size of the vector, which is bounded by the remaining bytes
+// as each element takes one byte at least, so that the untrusted size never allocates more than the module
+func readVectorSize(r *bytes.Reader) (uint32, error) {
 	vs, _, err := leb128decode.DecodeUint32(r)
 	if err != nil {
-		return fmt.Errorf("get size of vector: %w", err)
+		return 0, fmt.Errorf("get size of vector: %w", err)
+	}
+	if int64(vs) > int64(r.Len()) {
+		return 0, fmt.Errorf("size of vector %d over the remaining %d bytes: %w", vs, r.Len(), io.ErrUnexpectedEOF)
+	}
+
+	return vs, nil
+}
+
+func readNameMap(r *bytes.Reader) (map[uint32]string, error) {
+	vs, err := readVectorSize(r)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[uint32]string{}
+	for i := uint32(0); i < vs; i++ {
+		index, _, err := leb128decode.DecodeUint32(r)
+		if err != nil {
+			return nil, fmt.Errorf("read index: %w", err)
+		}
+		names[index], err = types.ReadNameValue(r)
+		if err != nil {
+			return nil, fmt.Errorf("read name: %w", err)
+		}
+	}
+
+	return names, nil
+}
+
+func (m *Module) readSectionTypes(r *bytes.Reader) error {
+	vs, err := readVectorSize(r)
+	if err != nil {
+		return err
 	}
 
 	m.TypeSection = make([]*types.FuncType, vs)
@@ -104,9 +189,9 @@ func (m *Module) readSectionTypes(r *bytes.Reader) error {
 }
 
 func (m *Module) readSectionImports(r *bytes.Reader) error {
-	vs, _, err := leb128decode.DecodeUint32(r)
+	vs, err := readVectorSize(r)
 	if err != nil {
-		return fmt.Errorf("get size of vector: %w", err)
+		return err
 	}
 
 	m.ImportSection = make([]*segments.ImportSegment, vs)
@@ -121,9 +206,9 @@ func (m *Module) readSectionImports(r *bytes.Reader) error {
 }
 
 func (m *Module) readSectionFunctions(r *bytes.Reader) error {
-	vs, _, err := leb128decode.DecodeUint32(r)
+	vs, err := readVectorSize(r)
 	if err != nil {
-		return fmt.Errorf("get size of vector: %w", err)
+		return err
 	}
 
 	m.FunctionSection = make([]uint32, vs)
@@ -138,9 +223,9 @@ func (m *Module) readSectionFunctions(r *bytes.Reader) error {
 }
 
 func (m *Module) readSectionTables(r *bytes.Reader) error {
-	vs, _, err := leb128decode.DecodeUint32(r)
+	vs, err := readVectorSize(r)
 	if err != nil {
-		return fmt.Errorf("get size of vector: %w", err)
+		return err
 	}
 
 	m.TableSection = make([]*types.TableType, vs)
@@ -155,9 +240,9 @@ func (m *Module) readSectionTables(r *bytes.Reader) error {
 }
 
 func (m *Module) readSectionMemories(r *bytes.Reader) error {
-	vs, _, err := leb128decode.DecodeUint32(r)
+	vs, err := readVectorSize(r)
 	if err != nil {
-		return fmt.Errorf("get size of vector: %w", err)
+		return err
 	}
 
 	m.MemorySection = make([]*types.MemoryType, vs)
@@ -171,10 +256,27 @@ func (m *Module) readSectionMemories(r *bytes.Reader) error {
 	return nil
 }
 
+func (m *Module) readSectionTags(r *bytes.Reader) error {
+	vs, err := readVectorSize(r)
+	if err != nil {
+		return err
+	}
+
+	m.TagSection = make([]*types.TagType, vs)
+	for i := range m.TagSection {
+		m.TagSection[i], err = types.ReadTagType(r)
+		if err != nil {
+			return fmt.Errorf("read tag type: %w", err)
+		}
+	}
+
+	return nil
+}
+
 func (m *Module) readSectionGlobals(r *bytes.Reader) error {
-	vs, _, err := leb128decode.DecodeUint32(r)
+	vs, err := readVectorSize(r)
 	if err != nil {
-		return fmt.Errorf("get size of vector: %w", err)
+		return err
 	}
 
 	m.GlobalSection = make([]*segments.GlobalSegment, vs)
@@ -189,9 +291,9 @@ func (m *Module) readSectionGlobals(r *bytes.Reader) error {
 }
 
 func (m *Module) readSectionExports(r *bytes.Reader) error {
-	vs, _, err := leb128decode.DecodeUint32(r)
+	vs, err := readVectorSize(r)
 	if err != nil {
-		return fmt.Errorf("get size of vector: %w", err)
+		return err
 	}
 
 	m.ExportSection = make(map[string]*segments.ExportSegment, vs)
@@ -201,6 +303,9 @@ func (m *Module) readSectionExports(r *bytes.Reader) error {
 			return fmt.Errorf("read export: %w", err)
 		}
 
+		if _, ok := m.ExportSection[expDesc.Name]; ok {
+			m.duplicateExports = append(m.duplicateExports, expDesc.Name)
+		}
 		m.ExportSection[expDesc.Name] = expDesc
 	}
 
@@ -208,9 +313,9 @@ func (m *Module) readSectionExports(r *bytes.Reader) error {
 }
 
 func (m *Module) readSectionStart(r *bytes.Reader) error {
-	vs, _, err := leb128decode.DecodeUint32(r)
+	vs, err := readVectorSize(r)
 	if err != nil {
-		return fmt.Errorf("get size of vector: %w", err)
+		return err
 	}
 
 	m.StartSection = make([]uint32, vs)
@@ -225,9 +330,9 @@ func (m *Module) readSectionStart(r *bytes.Reader) error {
 }
 
 func (m *Module) readSectionElement(r *bytes.Reader) error {
-	vs, _, err := leb128decode.DecodeUint32(r)
+	vs, err := readVectorSize(r)
 	if err != nil {
-		return fmt.Errorf("get size of vector: %w", err)
+		return err
 	}
 
 	m.ElementsSection = make([]*segments.ElemSegment, vs)
@@ -242,12 +347,12 @@ func (m *Module) readSectionElement(r *bytes.Reader) error {
 }
 
 func (m *Module) readSectionCodes(r *bytes.Reader) error {
-	vs, _, err := leb128decode.DecodeUint32(r)
+	vs, err := readVectorSize(r)
 	if err != nil {
-		return fmt.Errorf("get size of vector: %w", err)
+		return err
 	}
 
-	m.CodeSection = make([]*segments.CodeSegment, vs)	
+	m.CodeSection = make([]*segments.CodeSegment, vs)
 	for i := range m.CodeSection {
 		m.CodeSection[i], err = segments.ReadCodeSegment(r)
 		if err != nil {
@@ -259,9 +364,9 @@ func (m *Module) readSectionCodes(r *bytes.Reader) error {
 }
 
 func (m *Module) readSectionData(r *bytes.Reader) error {
-	vs, _, err := leb128decode.DecodeUint32(r)
+	vs, err := readVectorSize(r)
 	if err != nil {
-		return fmt.Errorf("get size of vector: %w", err)
+		return err
 	}
 
 	m.DataSection = make([]*segments.DataSegment, vs)
@@ -274,3 +379,14 @@ func (m *Module) readSectionData(r *bytes.Reader) error {
 
 	return nil
 }
+
+func (m *Module) readSectionDataCount(r *bytes.Reader) error {
+	dc, _, err := leb128decode.DecodeUint32(r)
+	if err != nil {
+		return fmt.Errorf("get data count: %w", err)
+	}
+
+	m.DataCountSection = &dc
+
+	return nil
+}
@@ -1,9 +1,48 @@
 package wasm
 
-import "github.com/c0mm4nd/wasman/types"
+import (
+	"math"
+
+	"github.com/c0mm4nd/wasman/config"
+	"github.com/c0mm4nd/wasman/types"
+)
 
 // Table is an instance of the table value
 type Table struct {
 	types.TableType
 	Value []*uint32 // vec of addr to func
+
+	// limit is the max elements allowed by the host, set by ModuleConfig.TableLimit on instantiation.
+	// When it is 0, the table is limited by config.DefaultTableLimit
+	limit uint64
+}
+
+// limitSize returns the max of elements it can grow to, within the max and the limit of the host
+func (table *Table) limitSize() uint64 {
+	max := uint64(math.MaxUint32)
+	if table.Limits != nil && table.Limits.Max != nil {
+		max = *table.Limits.Max
+	}
+
+	limit := table.limit
+	if limit == 0 {
+		limit = config.DefaultTableLimit
+	}
+	if limit < max {
+		max = limit
+	}
+
+	return max
+}
+
+// grow appends n elements of the ref, in one allocation
+func (table *Table) grow(n uint64, ref *uint32) {
+	next := make([]*uint32, uint64(len(table.Value))+n)
+	copy(next, table.Value)
+	if ref != nil {
+		for i := len(table.Value); i < len(next); i++ {
+			next[i] = ref
+		}
+	}
+	table.Value = next
 }
@@ -0,0 +1,189 @@
+package wasm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/c0mm4nd/wasman/stacks"
+	"github.com/c0mm4nd/wasman/tollstation"
+)
+
+// TrapKind classifies the Trap by its cause
+type TrapKind int
+
+// kinds of the Trap
+const (
+	TrapUnknown                  TrapKind = iota // the others, like the errors returned by the host funcs
+	TrapUnreachable                              // ErrUnreachable
+	TrapMemoryOutOfBounds                        // ErrPtrOutOfBounds
+	TrapTableOutOfBounds                         // ErrTableIndexOutOfRange
+	TrapUninitializedElement                     // ErrTableInstanceNotInitialized
+	TrapIndirectCallTypeMismatch                 // ErrFuncSignMismatch
+	TrapUndefinedResult                          // ErrUndefined, the integer division by zero or overflow
+	TrapUnalignedAtomic                          // ErrUnalignedAtomic
+	TrapNullReference                            // ErrNullExnRef
+	TrapCallStackExhausted                       // ErrCallStackExhausted
+	TrapStackOverflow                            // stacks.ErrStackOverflow
+	TrapInterrupted                              // ErrInterrupted
+	TrapFloatPoint                               // ErrFloatPointDisabled
+	TrapTollOverflow                             // tollstation.ErrTollOverflow
+	TrapUnsupportedOpCode                        // ErrUnsupportedOpCode
+	TrapRuntimeError                             // the go panic recovered with ModuleConfig.Recover
+)
+
+var trapKindNames = [...]string{
+	TrapUnknown:                  "unknown",
+	TrapUnreachable:              "unreachable",
+	TrapMemoryOutOfBounds:        "memory out of bounds",
+	TrapTableOutOfBounds:         "table out of bounds",
+	TrapUninitializedElement:     "uninitialized element",
+	TrapIndirectCallTypeMismatch: "indirect call type mismatch",
+	TrapUndefinedResult:          "undefined result",
+	TrapUnalignedAtomic:          "unaligned atomic",
+	TrapNullReference:            "null reference",
+	TrapCallStackExhausted:       "call stack exhausted",
+	TrapStackOverflow:            "stack overflow",
+	TrapInterrupted:              "interrupted",
+	TrapFloatPoint:               "float point",
+	TrapTollOverflow:             "toll overflow",
+	TrapUnsupportedOpCode:        "unsupported opcode",
+	TrapRuntimeError:             "runtime error",
+}
+
+func (k TrapKind) String() string {
+	if k < 0 || int(k) >= len(trapKindNames) {
+		return fmt.Sprintf("TrapKind(%d)", int(k))
+	}
+
+	return trapKindNames[k]
+}
+
+// trapKinds are the causes of the TrapKind, matched by errors.Is in order
+var trapKinds = []struct {
+	err  error
+	kind TrapKind
+}{
+	{ErrUnreachable, TrapUnreachable},
+	{ErrPtrOutOfBounds, TrapMemoryOutOfBounds},
+	{ErrTableIndexOutOfRange, TrapTableOutOfBounds},
+	{ErrTableInstanceNotInitialized, TrapUninitializedElement},
+	{ErrFuncSignMismatch, TrapIndirectCallTypeMismatch},
+	{ErrUndefined, TrapUndefinedResult},
+	{ErrUnalignedAtomic, TrapUnalignedAtomic},
+	{ErrNullExnRef, TrapNullReference},
+	{ErrCallStackExhausted, TrapCallStackExhausted},
+	{stacks.ErrStackOverflow, TrapStackOverflow},
+	{ErrInterrupted, TrapInterrupted},
+	{ErrFloatPointDisabled, TrapFloatPoint},
+	{tollstation.ErrTollOverflow, TrapTollOverflow},
+	{ErrUnsupportedOpCode, TrapUnsupportedOpCode},
+}
+
+func trapKindOf(err error) TrapKind {
+	for _, k := range trapKinds {
+		if errors.Is(err, k.err) {
+			return k.kind
+		}
+	}
+
+	return TrapUnknown
+}
+
+// TrapFrame is one wasm func on the call stack of the Trap
+type TrapFrame struct {
+	Func   uint32 // the index of the func in the function index space of its module
+	Name   string // the name of the func in the name section, or its export name, empty if unknown
+	Offset uint64 // the offset of the active instruction in the func body, the trapping one or the call
+}
+
+func (f TrapFrame) String() string {
+	if f.Name != "" {
+		return fmt.Sprintf("func %d <%s> at %#x", f.Func, f.Name, f.Offset)
+	}
+
+	return fmt.Sprintf("func %d at %#x", f.Func, f.Offset)
+}
+
+// Trap is the error of the execution stopped by a trap, which locates the trap on the guest call stack.
+// It unwraps to the cause, so it is still comparable with ErrUnreachable, ErrPtrOutOfBounds and the others by errors.Is.
+// The uncaught Exception is not a Trap, which goes on as it is
+type Trap struct {
+	TrapFrame // the innermost frame where the trap occurs, zero when no wasm func is running
+
+	Kind  TrapKind
+	Err   error       // the cause
+	Stack []TrapFrame // the guest call stack from the innermost frame, empty when no wasm func is running
+}
+
+func (t *Trap) Error() string {
+	if len(t.Stack) == 0 {
+		return t.Err.Error()
+	}
+
+	return fmt.Sprintf("%v in %s", t.Err, t.TrapFrame)
+}
+
+// Unwrap makes the Trap comparable with its cause by errors.Is and errors.As
+func (t *Trap) Unwrap() error {
+	return t.Err
+}
+
+// StackTrace returns the guest call stack in lines from the innermost frame
+func (t *Trap) StackTrace() string {
+	var sb strings.Builder
+	for _, f := range t.Stack {
+		sb.WriteString(f.String())
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+// newTrap wraps the err into the Trap on the frames, the outermost first like on the FrameStack.
+// The err which is already a Trap or an Exception is returned as it is
+func newTrap(err error, frames []*Frame) error {
+	switch err.(type) {
+	case *Trap, *Exception:
+		return err
+	}
+
+	t := &Trap{Kind: trapKindOf(err), Err: err, Stack: make([]TrapFrame, len(frames))}
+	for i, frame := range frames {
+		f := TrapFrame{Func: frame.Func.index, Name: frame.Func.name}
+		if code := frame.Func.code; frame.PC < uint64(len(code)) {
+			f.Offset = code[frame.PC].pos
+		}
+		t.Stack[len(frames)-1-i] = f
+	}
+	if len(t.Stack) > 0 {
+		t.TrapFrame = t.Stack[0]
+	}
+
+	return t
+}
+
+// recoveredTrap wraps the panic recovered with ModuleConfig.Recover into the Trap on the frames,
+// which is the TrapRuntimeError unless the panic is of a known cause like stacks.ErrStackOverflow
+func recoveredTrap(v interface{}, frames []*Frame) error {
+	err, ok := v.(error)
+	if !ok {
+		err = fmt.Errorf("runtime error: %v", v)
+	}
+
+	err = newTrap(err, frames)
+	if t, ok := err.(*Trap); ok && t.Kind == TrapUnknown {
+		t.Kind = TrapRuntimeError
+	}
+
+	return err
+}
+
+// trap wraps the err into the Trap on the running frames, or on the Active frame alone without the FrameStack
+func (ins *Instance) trap(err error) error {
+	if ins.FrameStack == nil {
+		return newTrap(err, []*Frame{ins.Active})
+	}
+
+	return newTrap(err, ins.FrameStack.Values[:ins.FrameStack.Ptr+1])
+}
@@ -0,0 +1,146 @@
+package wasm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/c0mm4nd/wasman/config"
+	"github.com/c0mm4nd/wasman/expr"
+)
+
+// trapInstance instantiates the module with the func 0 named "inner" in the name section
+//
+//	(func $inner (nop) (unreachable))
+//	(func $outer (export "outer") (nop) (call $inner))
+//	(func $div (export "div") (result i32) (i32.div_u (i32.const 1) (i32.const 0)))
+func trapInstance(t *testing.T, conf config.ModuleConfig) *Instance {
+	funcs := [][]byte{
+		{0x00, byte(expr.OpCodeNop), byte(expr.OpCodeUnreachable), byte(expr.OpCodeEnd)},
+		{0x00, byte(expr.OpCodeNop), byte(expr.OpCodeCall), 0x00, byte(expr.OpCodeEnd)},
+		{0x00, byte(expr.OpCodeI32Const), 0x01, byte(expr.OpCodeI32Const), 0x00, byte(expr.OpCodeI32DivU), byte(expr.OpCodeEnd)},
+	}
+
+	bin := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	bin = append(bin, benchSection(0x01, 0x02, 0x60, 0x00, 0x00, 0x60, 0x00, 0x01, 0x7f)...) // type
+	bin = append(bin, benchSection(0x03, 0x03, 0x00, 0x00, 0x01)...)                         // function
+	bin = append(bin, benchSection(0x07, 0x02, 0x05, 'o', 'u', 't', 'e', 'r', 0x00, 0x01, 0x03, 'd', 'i', 'v', 0x00, 0x02)...)
+	code := []byte{byte(len(funcs))}
+	for _, f := range funcs {
+		code = append(append(code, byte(len(f))), f...)
+	}
+	bin = append(bin, benchSection(0x0a, code...)...)
+	bin = append(bin, benchSection(0x00, 0x04, 'n', 'a', 'm', 'e', 0x01, 0x08, 0x01, 0x00, 0x05, 'i', 'n', 'n', 'e', 'r')...)
+
+	m, err := NewModule(conf, bytes.NewReader(bin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins, err := NewInstance(m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ins
+}
+
+func TestTrap(t *testing.T) {
+	for _, optimize := range []bool{false, true} {
+		ins := trapInstance(t, config.ModuleConfig{Optimize: optimize})
+		_, _, err := ins.CallExportedFunc("outer")
+		if !errors.Is(err, ErrUnreachable) {
+			t.Fatalf("got %v", err)
+		}
+
+		var trap *Trap
+		if !errors.As(err, &trap) || trap.Kind != TrapUnreachable {
+			t.Fatalf("got %v", err)
+		}
+		exp := []TrapFrame{{Func: 0, Name: "inner", Offset: 1}, {Func: 1, Name: "outer", Offset: 1}}
+		if !reflect.DeepEqual(trap.Stack, exp) || trap.TrapFrame != exp[0] {
+			t.Errorf("got %v, want %v", trap.Stack, exp)
+		}
+		if s := trap.StackTrace(); s != "func 0 <inner> at 0x1\nfunc 1 <outer> at 0x1\n" {
+			t.Errorf("got %q", s)
+		}
+		if s := err.Error(); s != "unreachable in func 0 <inner> at 0x1" {
+			t.Errorf("got %q", s)
+		}
+	}
+
+	t.Run("recover", func(t *testing.T) {
+		ins := trapInstance(t, config.ModuleConfig{Recover: true})
+		_, _, err := ins.CallExportedFunc("div")
+
+		var trap *Trap
+		var re runtime.Error
+		if !errors.As(err, &trap) || trap.Kind != TrapRuntimeError || !errors.As(err, &re) {
+			t.Fatalf("got %v", err)
+		}
+		if exp := []TrapFrame{{Func: 2, Name: "div", Offset: 4}}; !reflect.DeepEqual(trap.Stack, exp) {
+			t.Errorf("got %v, want %v", trap.Stack, exp)
+		}
+		if ins.FrameStack.Ptr != -1 || ins.OperandStack.Ptr != -1 {
+			t.Errorf("the stacks are left on %d, %d", ins.FrameStack.Ptr, ins.OperandStack.Ptr)
+		}
+	})
+
+	t.Run("kinds", func(t *testing.T) {
+		for _, c := range []struct {
+			err error
+			exp TrapKind
+		}{
+			{err: ErrPtrOutOfBounds, exp: TrapMemoryOutOfBounds},
+			{err: &FloatPointError{}, exp: TrapFloatPoint},
+			{err: &InterruptedError{}, exp: TrapInterrupted},
+			{err: errors.New("host"), exp: TrapUnknown},
+		} {
+			err := newTrap(c.err, nil)
+			if trap := err.(*Trap); trap.Kind != c.exp || err.Error() != c.err.Error() {
+				t.Errorf("%v: got %v", c.err, trap.Kind)
+			}
+		}
+
+		exc := &Exception{}
+		if newTrap(exc, nil) != exc {
+			t.Error("the exception is wrapped")
+		}
+	})
+}
+
+func TestModule_readSectionCustom(t *testing.T) {
+	m := &Module{}
+	m.readSectionCustom(bytes.NewReader([]byte{0x04, 'n', 'a', 'm', 'e', 0x00, 0x02, 0x01, 'm', 0x01, 0x04, 0x01, 0x03, 0x01, 'f'}))
+	if exp := map[uint32]string{3: "f"}; !reflect.DeepEqual(m.FunctionNames, exp) {
+		t.Errorf("got %v, want %v", m.FunctionNames, exp)
+	}
+
+	// the malformed one is ignored
+	m = &Module{}
+	m.readSectionCustom(bytes.NewReader([]byte{0x04, 'n', 'a', 'm', 'e', 0x01, 0x05, 0x02, 0x03, 0x01, 'f'}))
+	if m.FunctionNames != nil {
+		t.Errorf("got %v", m.FunctionNames)
+	}
+}
+
+func TestNewModule_hugeVectorSize(t *testing.T) {
+	// the name section of 2^32-1 func names is ignored, without allocating for them
+	bin := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	bin = append(bin, benchSection(0x00, 0x04, 'n', 'a', 'm', 'e', 0x01, 0x05, 0xff, 0xff, 0xff, 0xff, 0x0f)...)
+	m, err := NewModule(config.ModuleConfig{}, bytes.NewReader(bin))
+	if err != nil || m.FunctionNames != nil {
+		t.Fatalf("got %v, %v", m, err)
+	}
+
+	// the other vectors fail
+	for _, id := range []byte{0x01, 0x02, 0x03, 0x07, 0x0a, 0x0b} {
+		bin := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+		bin = append(bin, benchSection(id, 0xff, 0xff, 0xff, 0xff, 0x0f)...)
+		if _, err := NewModule(config.ModuleConfig{}, bytes.NewReader(bin)); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("section %d: got %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"math"
+	"unsafe"
+
+	"github.com/c0mm4nd/wasman/types"
+)
+
+// V128 is the value of the v128 type, made of the low and high 64 bits of its 16 little-endian bytes.
+// On the OperandStack the Lo is kept in the slot and the Hi in the high half of the slot
+type V128 struct {
+	Lo, Hi uint64
+}
+
+// v128FromBytes reads the V128 from the 16 little-endian bytes
+func v128FromBytes(b []byte) V128 {
+	return V128{
+		Lo: binary.LittleEndian.Uint64(b[0:8]),
+		Hi: binary.LittleEndian.Uint64(b[8:16]),
+	}
+}
+
+// Bytes returns the 16 little-endian bytes of the V128
+func (v V128) Bytes() (b [16]byte) {
+	binary.LittleEndian.PutUint64(b[0:8], v.Lo)
+	binary.LittleEndian.PutUint64(b[8:16], v.Hi)
+
+	return b
+}
+
+// intLane is the type of one lane in the integer shapes i8x16, i16x8, i32x4 and i64x2,
+// both the signed and unsigned interpretation
+type intLane interface {
+	int8 | uint8 | int16 | uint16 | int32 | uint32 | int64 | uint64
+}
+
+// floatLane is the type of one lane in the float shapes f32x4 and f64x2
+type floatLane interface {
+	float32 | float64
+}
+
+type lane interface {
+	intLane | floatLane
+}
+
+// laneNum returns how many lanes of the type a V128 holds
+func laneNum[T lane]() int {
+	return 16 / int(unsafe.Sizeof(T(0)))
+}
+
+// getLane returns the i-th lane of the V128 in the shape of T
+func getLane[T lane](v V128, i int) T {
+	size := uint(unsafe.Sizeof(T(0)))
+	n := 8 / int(size)
+	half := v.Lo
+	if i >= n {
+		half, i = v.Hi, i-n
+	}
+	raw := half >> (uint(i) * size * 8)
+
+	switch any(T(0)).(type) {
+	case float32:
+		return T(math.Float32frombits(uint32(raw)))
+	case float64:
+		return T(math.Float64frombits(raw))
+	}
+
+	return T(raw)
+}
+
+// setLane replaces the i-th lane of the V128 in the shape of T with x
+func setLane[T lane](v *V128, i int, x T) {
+	size := uint(unsafe.Sizeof(T(0)))
+	n := 8 / int(size)
+	half := &v.Lo
+	if i >= n {
+		half, i = &v.Hi, i-n
+	}
+
+	var raw uint64
+	switch f := any(x).(type) {
+	case float32:
+		raw = uint64(math.Float32bits(f))
+	case float64:
+		raw = math.Float64bits(f)
+	default:
+		raw = uint64(x)
+	}
+
+	shift := uint(i) * size * 8
+	mask := uint64(1)<<(size*8) - 1
+	*half = *half&^(mask<<shift) | (raw&mask)<<shift
+}
+
+// splatLane creates the V128 whose lanes in the shape of T are all x
+func splatLane[T lane](x T) (v V128) {
+	for i := 0; i < laneNum[T](); i++ {
+		setLane(&v, i, x)
+	}
+
+	return v
+}
+
+// hasV128 reports whether any of the value types is v128
+func hasV128(vts []types.ValueType) bool {
+	for _, vt := range vts {
+		if vt == types.ValueTypeV128 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ins *Instance) pushV128(v V128) {
+	ins.OperandStack.PushV128(v.Lo, v.Hi)
+}
+
+func (ins *Instance) popV128() V128 {
+	lo, hi := ins.OperandStack.PopV128()
+
+	return V128{Lo: lo, Hi: hi}
+}
@@ -0,0 +1,1449 @@
+package wasm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/c0mm4nd/wasman/config"
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/leb128decode"
+	"github.com/c0mm4nd/wasman/segments"
+	"github.com/c0mm4nd/wasman/types"
+)
+
+// ErrInvalidModule is the base of the errors returned by Module.Validate
+var ErrInvalidModule = errors.New("invalid module")
+
+// FuncValidationError is the error on validating the body of a function
+type FuncValidationError struct {
+	FuncIndex uint32 // in the function index space, counting the imported functions
+	Offset    uint64 // of the instruction from the beginning of the body, excluding the locals
+	Err       error
+}
+
+func (e *FuncValidationError) Error() string {
+	return fmt.Sprintf("%v: function %d at offset %#x: %v", ErrInvalidModule, e.FuncIndex, e.Offset, e.Err)
+}
+
+func (e *FuncValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes the FuncValidationError comparable with ErrInvalidModule by errors.Is
+func (e *FuncValidationError) Is(target error) bool {
+	return target == ErrInvalidModule
+}
+
+// unknownType is the type of the operands popped from the polymorphic stack of the unreachable code
+const unknownType types.ValueType = 0
+
+// moduleContext is the context of the validation, which holds the types of the index spaces
+type moduleContext struct {
+	*Module
+
+	funcs   []*types.FuncType
+	tables  []*types.TableType
+	mems    []*types.MemoryType
+	globals []*types.GlobalType
+	tags    []*types.FuncType
+
+	refs map[uint32]bool // the functions declared outside of the function bodies, which ref.func can reference
+}
+
+// Validate checks the module by the validation rules of the spec without instantiating it,
+// including the typing of the function bodies on the operand and control stacks.
+// An error on a function body is a *FuncValidationError, and all the errors are ErrInvalidModule by errors.Is
+func (m *Module) Validate() error {
+	c := &moduleContext{Module: m, refs: map[uint32]bool{}}
+
+	for _, step := range []func() error{
+		c.validateImports,
+		c.validateDefinitions,
+		c.validateGlobals,
+		c.validateElems,
+		c.validateData,
+		c.validateStart,
+		c.validateExports,
+	} {
+		if err := step(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidModule, err)
+		}
+	}
+
+	return c.validateCodes()
+}
+
+func (c *moduleContext) funcType(index uint32) (*types.FuncType, error) {
+	if index >= uint32(len(c.TypeSection)) {
+		return nil, fmt.Errorf("type index %d out of range", index)
+	}
+
+	return c.TypeSection[index], nil
+}
+
+func (c *moduleContext) tagType(tt *types.TagType) (*types.FuncType, error) {
+	ft, err := c.funcType(tt.TypeIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ft.ReturnTypes) != 0 {
+		return nil, fmt.Errorf("tag type has results")
+	}
+
+	return ft, nil
+}
+
+func validateTableType(tt *types.TableType) error {
+	if tt.Limits.Max != nil && *tt.Limits.Max < tt.Limits.Min {
+		return fmt.Errorf("table max %d is less than min %d", *tt.Limits.Max, tt.Limits.Min)
+	}
+
+	return nil
+}
+
+func validateMemoryType(mt *types.MemoryType) error {
+	limit := uint64(config.DefaultMemoryMaxPages)
+	if mt.Is64 {
+		limit = 1 << 48
+	}
+
+	if mt.Min > limit || mt.Max != nil && *mt.Max > limit {
+		return fmt.Errorf("memory size must be at most %d pages", limit)
+	}
+
+	if mt.Max != nil && *mt.Max < mt.Min {
+		return fmt.Errorf("memory max %d is less than min %d", *mt.Max, mt.Min)
+	}
+
+	if mt.Shared && mt.Max == nil {
+		return fmt.Errorf("shared memory must have a max")
+	}
+
+	return nil
+}
+
+func (c *moduleContext) validateImports() error {
+	for i, is := range c.ImportSection {
+		var err error
+		switch is.Desc.Kind {
+		case segments.KindFunction:
+			var ft *types.FuncType
+			if ft, err = c.funcType(*is.Desc.TypeIndexPtr); err == nil {
+				c.funcs = append(c.funcs, ft)
+			}
+		case segments.KindTable:
+			if err = validateTableType(is.Desc.TableTypePtr); err == nil {
+				c.tables = append(c.tables, is.Desc.TableTypePtr)
+			}
+		case segments.KindMem:
+			if err = validateMemoryType(is.Desc.MemTypePtr); err == nil {
+				c.mems = append(c.mems, is.Desc.MemTypePtr)
+			}
+		case segments.KindGlobal:
+			c.globals = append(c.globals, is.Desc.GlobalTypePtr)
+		case segments.KindTag:
+			var ft *types.FuncType
+			if ft, err = c.tagType(is.Desc.TagTypePtr); err == nil {
+				c.tags = append(c.tags, ft)
+			}
+		default:
+			err = fmt.Errorf("invalid kind %#x", is.Desc.Kind)
+		}
+
+		if err != nil {
+			return fmt.Errorf("import %d (%s.%s): %w", i, is.Module, is.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateDefinitions checks the functions, tables, memories and tags defined in the module
+func (c *moduleContext) validateDefinitions() error {
+	if len(c.FunctionSection) != len(c.CodeSection) {
+		return fmt.Errorf("function and code section have inconsistent lengths: %d != %d", len(c.FunctionSection), len(c.CodeSection))
+	}
+
+	for i, typeIndex := range c.FunctionSection {
+		ft, err := c.funcType(typeIndex)
+		if err != nil {
+			return fmt.Errorf("function %d: %w", len(c.funcs), err)
+		}
+		if uint64(len(ft.InputTypes))+uint64(c.CodeSection[i].NumLocals) > math.MaxUint32 {
+			return fmt.Errorf("function %d: too many locals", len(c.funcs))
+		}
+		c.funcs = append(c.funcs, ft)
+	}
+
+	for _, tt := range c.TableSection {
+		if err := validateTableType(tt); err != nil {
+			return fmt.Errorf("table %d: %w", len(c.tables), err)
+		}
+		c.tables = append(c.tables, tt)
+	}
+
+	for _, mt := range c.MemorySection {
+		if err := validateMemoryType(mt); err != nil {
+			return fmt.Errorf("memory %d: %w", len(c.mems), err)
+		}
+		c.mems = append(c.mems, mt)
+	}
+
+	for _, tt := range c.TagSection {
+		ft, err := c.tagType(tt)
+		if err != nil {
+			return fmt.Errorf("tag %d: %w", len(c.tags), err)
+		}
+		c.tags = append(c.tags, ft)
+	}
+
+	return nil
+}
+
+// validateGlobals checks the init expressions of the globals, which can only get the immutable globals before them
+func (c *moduleContext) validateGlobals() error {
+	for _, gs := range c.GlobalSection {
+		if err := c.validateConstExpr(gs.Init, gs.Type.ValType, len(c.globals)); err != nil {
+			return fmt.Errorf("global %d: %w", len(c.globals), err)
+		}
+		c.globals = append(c.globals, gs.Type)
+	}
+
+	return nil
+}
+
+func (c *moduleContext) validateElems() error {
+	for i, elem := range c.ElementsSection {
+		if !elem.Type.IsRefType() {
+			return fmt.Errorf("element %d: invalid element type %#x", i, elem.Type)
+		}
+
+		for _, index := range elem.Init {
+			if index >= uint32(len(c.funcs)) {
+				return fmt.Errorf("element %d: function index %d out of range", i, index)
+			}
+			c.refs[index] = true
+		}
+
+		for _, e := range elem.InitExprs {
+			if err := c.validateConstExpr(e, elem.Type, len(c.globals)); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+
+		if elem.Mode != segments.SegmentModeActive {
+			continue
+		}
+
+		if elem.TableIndex >= uint32(len(c.tables)) {
+			return fmt.Errorf("element %d: table index %d out of range", i, elem.TableIndex)
+		}
+
+		if table := c.tables[elem.TableIndex]; table.Elem != elem.Type {
+			return fmt.Errorf("element %d: type mismatch on table: %s != %s", i, elem.Type, table.Elem)
+		}
+
+		if err := c.validateConstExpr(elem.OffsetExpr, types.ValueTypeI32, len(c.globals)); err != nil {
+			return fmt.Errorf("element %d: offset: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *moduleContext) validateData() error {
+	for i, d := range c.DataSection {
+		if d.Mode != segments.SegmentModeActive {
+			continue
+		}
+
+		if d.MemoryIndex >= uint32(len(c.mems)) {
+			return fmt.Errorf("data %d: memory index %d out of range", i, d.MemoryIndex)
+		}
+
+		if err := c.validateConstExpr(d.OffsetExpression, addressType(c.mems[d.MemoryIndex]), len(c.globals)); err != nil {
+			return fmt.Errorf("data %d: offset: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *moduleContext) validateStart() error {
+	if len(c.StartSection) > 1 {
+		return fmt.Errorf("multiple start functions")
+	}
+
+	for _, index := range c.StartSection {
+		if index >= uint32(len(c.funcs)) {
+			return fmt.Errorf("start function index %d out of range", index)
+		}
+
+		if ft := c.funcs[index]; len(ft.InputTypes) != 0 || len(ft.ReturnTypes) != 0 {
+			return fmt.Errorf("start function must have no params and results")
+		}
+	}
+
+	return nil
+}
+
+func (c *moduleContext) validateExports() error {
+	if len(c.duplicateExports) > 0 {
+		return fmt.Errorf("duplicate export name %q", c.duplicateExports[0])
+	}
+
+	for name, es := range c.ExportSection {
+		var num int
+		switch es.Desc.Kind {
+		case segments.KindFunction:
+			num = len(c.funcs)
+			if es.Desc.Index < uint32(num) {
+				c.refs[es.Desc.Index] = true
+			}
+		case segments.KindTable:
+			num = len(c.tables)
+		case segments.KindMem:
+			num = len(c.mems)
+		case segments.KindGlobal:
+			num = len(c.globals)
+		case segments.KindTag:
+			num = len(c.tags)
+		}
+
+		if es.Desc.Index >= uint32(num) {
+			return fmt.Errorf("export %q: index %d out of range", name, es.Desc.Index)
+		}
+	}
+
+	return nil
+}
+
+func (c *moduleContext) validateCodes() error {
+	numImported := uint32(len(c.funcs) - len(c.CodeSection))
+	for i, code := range c.CodeSection {
+		index := numImported + uint32(i)
+		ft := c.funcs[index]
+
+		locals := make([]types.ValueType, 0, len(ft.InputTypes)+int(code.NumLocals))
+		locals = append(locals, ft.InputTypes...)
+		locals = append(locals, code.LocalTypes()...)
+
+		v := c.newCodeValidator(code.Body, locals, ft.ReturnTypes)
+		if err := v.validate(); err != nil {
+			return &FuncValidationError{FuncIndex: index, Offset: v.at, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// validateConstExpr checks the expression is constant and results in a value of the type,
+// where only the immutable globals before the numGlobals can be got
+func (c *moduleContext) validateConstExpr(e *expr.Expression, vt types.ValueType, numGlobals int) error {
+	body := append([]byte{e.OpCode}, e.Data...)
+	v := c.newCodeValidator(body, nil, []types.ValueType{vt})
+	v.constant, v.numGlobals = true, numGlobals
+	if err := v.validate(); err != nil {
+		return fmt.Errorf("constant expression at offset %#x: %w", v.at, err)
+	}
+
+	return nil
+}
+
+// addressType returns the type of the addresses on the memory, which is i64 for the memory64
+func addressType(mt *types.MemoryType) types.ValueType {
+	if mt.Is64 {
+		return types.ValueTypeI64
+	}
+
+	return types.ValueTypeI32
+}
+
+// ctrlFrame is an entry of the control stack in the validation algorithm
+type ctrlFrame struct {
+	opcode      expr.OpCode
+	startTypes  []types.ValueType
+	endTypes    []types.ValueType
+	height      int  // of the operand stack on entering the block
+	unreachable bool // the rest operands are polymorphic after an unconditional branch
+}
+
+// labelTypes returns the types of the values passed by the branches to the frame
+func (f *ctrlFrame) labelTypes() []types.ValueType {
+	if f.opcode == expr.OpCodeLoop {
+		return f.startTypes
+	}
+
+	return f.endTypes
+}
+
+// codeValidator checks the instructions of a function body or a constant expression
+// by typing them on the operand and control stacks
+type codeValidator struct {
+	*moduleContext
+
+	r      *bytes.Reader
+	body   []byte
+	at     uint64 // the offset of the instruction being validated
+	locals []types.ValueType
+
+	vals  []types.ValueType
+	ctrls []*ctrlFrame
+
+	constant   bool // only the constant instructions are allowed
+	numGlobals int  // the globals accessible by the constant expression
+}
+
+func (c *moduleContext) newCodeValidator(body []byte, locals, results []types.ValueType) *codeValidator {
+	v := &codeValidator{
+		moduleContext: c,
+		r:             bytes.NewReader(body),
+		body:          body,
+		locals:        locals,
+	}
+	v.pushCtrl(expr.OpCodeBlock, nil, results)
+
+	return v
+}
+
+// validate checks the whole body, which is ended implicitly as the final end is not kept
+func (v *codeValidator) validate() error {
+	for v.r.Len() > 0 {
+		v.at = uint64(len(v.body) - v.r.Len())
+		op, _ := v.r.ReadByte()
+		if err := v.validateInstr(op); err != nil {
+			return err
+		}
+	}
+
+	v.at = uint64(len(v.body))
+	if len(v.ctrls) != 1 {
+		return fmt.Errorf("%d blocks are not ended", len(v.ctrls)-1)
+	}
+
+	_, err := v.popCtrl()
+
+	return err
+}
+
+func (v *codeValidator) push(vts ...types.ValueType) {
+	v.vals = append(v.vals, vts...)
+}
+
+func (v *codeValidator) pop() (types.ValueType, error) {
+	f := v.ctrls[len(v.ctrls)-1]
+	if len(v.vals) == f.height {
+		if f.unreachable {
+			return unknownType, nil
+		}
+		return 0, fmt.Errorf("operand stack underflow")
+	}
+
+	vt := v.vals[len(v.vals)-1]
+	v.vals = v.vals[:len(v.vals)-1]
+
+	return vt, nil
+}
+
+func (v *codeValidator) popExpect(expected types.ValueType) (types.ValueType, error) {
+	actual, err := v.pop()
+	if err != nil {
+		return 0, err
+	}
+
+	if actual != expected && actual != unknownType && expected != unknownType {
+		return 0, fmt.Errorf("type mismatch: expected %s but got %s", expected, actual)
+	}
+
+	return actual, nil
+}
+
+// popTypes pops the operands of the types from the top, and returns them in the stack order
+func (v *codeValidator) popTypes(vts []types.ValueType) ([]types.ValueType, error) {
+	ret := make([]types.ValueType, len(vts))
+	for i := len(vts) - 1; i >= 0; i-- {
+		vt, err := v.popExpect(vts[i])
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = vt
+	}
+
+	return ret, nil
+}
+
+// apply pops the operands and pushes the results of the instruction of the signature
+func (v *codeValidator) apply(sig *types.FuncType) error {
+	if _, err := v.popTypes(sig.InputTypes); err != nil {
+		return err
+	}
+
+	v.push(sig.ReturnTypes...)
+
+	return nil
+}
+
+func (v *codeValidator) pushCtrl(op expr.OpCode, in, out []types.ValueType) {
+	v.ctrls = append(v.ctrls, &ctrlFrame{
+		opcode:     op,
+		startTypes: in,
+		endTypes:   out,
+		height:     len(v.vals),
+	})
+	v.push(in...)
+}
+
+func (v *codeValidator) popCtrl() (*ctrlFrame, error) {
+	f := v.ctrls[len(v.ctrls)-1]
+	if _, err := v.popTypes(f.endTypes); err != nil {
+		return nil, err
+	}
+
+	if len(v.vals) != f.height {
+		return nil, fmt.Errorf("%d values remain on the end of block", len(v.vals)-f.height)
+	}
+
+	v.ctrls = v.ctrls[:len(v.ctrls)-1]
+
+	return f, nil
+}
+
+// setUnreachable marks the rest of the current block unreachable, where the operand stack is polymorphic
+func (v *codeValidator) setUnreachable() {
+	f := v.ctrls[len(v.ctrls)-1]
+	v.vals = v.vals[:f.height]
+	f.unreachable = true
+}
+
+func (v *codeValidator) label(index uint32) (*ctrlFrame, error) {
+	if index >= uint32(len(v.ctrls)) {
+		return nil, fmt.Errorf("label index %d out of range", index)
+	}
+
+	return v.ctrls[len(v.ctrls)-1-int(index)], nil
+}
+
+func (v *codeValidator) readUint32() (uint32, error) {
+	ret, _, err := leb128decode.DecodeUint32(v.r)
+	if err != nil {
+		return 0, fmt.Errorf("read immediate: %w", err)
+	}
+
+	return ret, nil
+}
+
+func (v *codeValidator) readFunc() (*types.FuncType, error) {
+	index, err := v.readUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	if index >= uint32(len(v.funcs)) {
+		return nil, fmt.Errorf("function index %d out of range", index)
+	}
+
+	return v.funcs[index], nil
+}
+
+func (v *codeValidator) readTable() (*types.TableType, error) {
+	index, err := v.readUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	if index >= uint32(len(v.tables)) {
+		return nil, fmt.Errorf("table index %d out of range", index)
+	}
+
+	return v.tables[index], nil
+}
+
+func (v *codeValidator) readMemory() (*types.MemoryType, error) {
+	index, err := v.readUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	return v.memory(index)
+}
+
+func (v *codeValidator) memory(index uint32) (*types.MemoryType, error) {
+	if index >= uint32(len(v.mems)) {
+		return nil, fmt.Errorf("memory index %d out of range", index)
+	}
+
+	return v.mems[index], nil
+}
+
+// readMemArg reads the memarg immediates of the access to the size bytes, and returns the memory accessed.
+// The alignment must not be larger than the size, or must equal to it when exact
+func (v *codeValidator) readMemArg(size uint64, exact bool) (*types.MemoryType, error) {
+	align, err := v.readUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	var index uint32
+	if align&memArgHasMemoryIndex != 0 {
+		align &^= memArgHasMemoryIndex
+		if index, err = v.readUint32(); err != nil {
+			return nil, err
+		}
+	}
+
+	offset, _, err := leb128decode.DecodeUint64(v.r)
+	if err != nil {
+		return nil, fmt.Errorf("read memory offset: %w", err)
+	}
+
+	mt, err := v.memory(index)
+	if err != nil {
+		return nil, err
+	}
+
+	if align >= 64 || uint64(1)<<align > size {
+		return nil, fmt.Errorf("alignment must not be larger than natural")
+	}
+
+	if exact && uint64(1)<<align != size {
+		return nil, fmt.Errorf("alignment of atomic access must equal to natural")
+	}
+
+	if !mt.Is64 && offset > math.MaxUint32 {
+		return nil, fmt.Errorf("offset %d out of range of 32-bit memory", offset)
+	}
+
+	return mt, nil
+}
+
+// readLane reads the lane index, which must be less than the number of lanes
+func (v *codeValidator) readLane(lanes byte) error {
+	lane, err := v.r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("read lane index: %w", err)
+	}
+
+	if lane >= lanes {
+		return fmt.Errorf("lane index %d out of range", lane)
+	}
+
+	return nil
+}
+
+// isConstInstr tells whether the instruction is allowed in the constant expressions, v128.const is checked on its sub opcode
+func isConstInstr(op expr.OpCode) bool {
+	switch op {
+	case expr.OpCodeI32Const, expr.OpCodeI64Const, expr.OpCodeF32Const, expr.OpCodeF64Const, expr.OpCodeSIMDPrefix,
+		expr.OpCodeNull, expr.OpCodeFunc, expr.OpCodeGlobalGet,
+		expr.OpCodeI32Add, expr.OpCodeI32Sub, expr.OpCodeI32Mul, expr.OpCodeI64Add, expr.OpCodeI64Sub, expr.OpCodeI64Mul:
+		return true
+	default:
+		return false
+	}
+}
+
+func (v *codeValidator) validateInstr(op expr.OpCode) error {
+	if v.constant && !isConstInstr(op) {
+		return fmt.Errorf("instruction %s is not constant", expr.GetOpCodeName(op))
+	}
+
+	if sig := opSignatures[op]; sig != nil {
+		return v.apply(sig)
+	}
+
+	if expr.OpCodeI32Load <= op && op <= expr.OpCodeI64Store32 {
+		return v.validateMemoryAccess(op)
+	}
+
+	switch op {
+	case expr.OpCodeUnreachable:
+		v.setUnreachable()
+	case expr.OpCodeNop:
+	case expr.OpCodeBlock, expr.OpCodeLoop, expr.OpCodeIf:
+		bt, _, err := v.readBlockType(v.r)
+		if err != nil {
+			return err
+		}
+		if op == expr.OpCodeIf {
+			if _, err := v.popExpect(types.ValueTypeI32); err != nil {
+				return err
+			}
+		}
+		if _, err := v.popTypes(bt.InputTypes); err != nil {
+			return err
+		}
+		v.pushCtrl(op, bt.InputTypes, bt.ReturnTypes)
+	case expr.OpCodeTryTable:
+		bt, _, err := v.readBlockType(v.r)
+		if err != nil {
+			return err
+		}
+		catches, _, err := readCatches(v.r)
+		if err != nil {
+			return err
+		}
+		for _, c := range catches {
+			if err := v.validateCatch(c.Kind, c.Tag, c.Label); err != nil {
+				return err
+			}
+		}
+		if _, err := v.popTypes(bt.InputTypes); err != nil {
+			return err
+		}
+		v.pushCtrl(op, bt.InputTypes, bt.ReturnTypes)
+	case expr.OpCodeElse:
+		f, err := v.popCtrl()
+		if err != nil {
+			return err
+		}
+		if f.opcode != expr.OpCodeIf {
+			return fmt.Errorf("else without if")
+		}
+		v.pushCtrl(expr.OpCodeElse, f.startTypes, f.endTypes)
+	case expr.OpCodeEnd:
+		if len(v.ctrls) == 1 {
+			return fmt.Errorf("unexpected end of the function body")
+		}
+		f, err := v.popCtrl()
+		if err != nil {
+			return err
+		}
+		if f.opcode == expr.OpCodeIf && !types.HasSameSignature(f.startTypes, f.endTypes) {
+			return fmt.Errorf("if without else must have the same params and results")
+		}
+		v.push(f.endTypes...)
+	case expr.OpCodeBr, expr.OpCodeBrIf:
+		index, err := v.readUint32()
+		if err != nil {
+			return err
+		}
+		l, err := v.label(index)
+		if err != nil {
+			return err
+		}
+		if op == expr.OpCodeBrIf {
+			if _, err := v.popExpect(types.ValueTypeI32); err != nil {
+				return err
+			}
+			return v.apply(&types.FuncType{InputTypes: l.labelTypes(), ReturnTypes: l.labelTypes()})
+		}
+		if _, err := v.popTypes(l.labelTypes()); err != nil {
+			return err
+		}
+		v.setUnreachable()
+	case expr.OpCodeBrTable:
+		return v.validateBrTable()
+	case expr.OpCodeReturn:
+		if _, err := v.popTypes(v.ctrls[0].endTypes); err != nil {
+			return err
+		}
+		v.setUnreachable()
+	case expr.OpCodeCall, expr.OpCodeReturnCall:
+		ft, err := v.readFunc()
+		if err != nil {
+			return err
+		}
+		return v.validateCall(ft, op == expr.OpCodeReturnCall)
+	case expr.OpCodeCallIndirect, expr.OpCodeReturnCallIndirect:
+		index, err := v.readUint32()
+		if err != nil {
+			return err
+		}
+		ft, err := v.funcType(index)
+		if err != nil {
+			return err
+		}
+		tt, err := v.readTable()
+		if err != nil {
+			return err
+		}
+		if tt.Elem != types.ValueTypeFuncRef {
+			return fmt.Errorf("call_indirect on the table of %s", tt.Elem)
+		}
+		if _, err := v.popExpect(types.ValueTypeI32); err != nil {
+			return err
+		}
+		return v.validateCall(ft, op == expr.OpCodeReturnCallIndirect)
+	case expr.OpCodeThrow:
+		index, err := v.readUint32()
+		if err != nil {
+			return err
+		}
+		if index >= uint32(len(v.tags)) {
+			return fmt.Errorf("tag index %d out of range", index)
+		}
+		if _, err := v.popTypes(v.tags[index].InputTypes); err != nil {
+			return err
+		}
+		v.setUnreachable()
+	case expr.OpCodeThrowRef:
+		if _, err := v.popExpect(types.ValueTypeExnRef); err != nil {
+			return err
+		}
+		v.setUnreachable()
+	case expr.OpCodeDrop:
+		_, err := v.pop()
+		return err
+	case expr.OpCodeSelect:
+		if _, err := v.popExpect(types.ValueTypeI32); err != nil {
+			return err
+		}
+		t1, err := v.pop()
+		if err != nil {
+			return err
+		}
+		t2, err := v.pop()
+		if err != nil {
+			return err
+		}
+		if t1.IsRefType() || t2.IsRefType() {
+			return fmt.Errorf("select without the value type on references")
+		}
+		if t1 != t2 && t1 != unknownType && t2 != unknownType {
+			return fmt.Errorf("type mismatch on select: %s != %s", t1, t2)
+		}
+		if t1 == unknownType {
+			t1 = t2
+		}
+		v.push(t1)
+	case expr.OpCodeSelectT:
+		n, err := v.readUint32()
+		if err != nil {
+			return err
+		}
+		if n != 1 {
+			return fmt.Errorf("select must have exactly one value type")
+		}
+		vts, err := types.ReadValueTypes(v.r, n)
+		if err != nil {
+			return err
+		}
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{vts[0], vts[0], types.ValueTypeI32}, ReturnTypes: vts})
+	case expr.OpCodeLocalGet, expr.OpCodeLocalSet, expr.OpCodeLocalTee:
+		index, err := v.readUint32()
+		if err != nil {
+			return err
+		}
+		if index >= uint32(len(v.locals)) {
+			return fmt.Errorf("local index %d out of range", index)
+		}
+		vt := v.locals[index]
+		switch op {
+		case expr.OpCodeLocalGet:
+			v.push(vt)
+		case expr.OpCodeLocalSet:
+			_, err = v.popExpect(vt)
+		default:
+			err = v.apply(&types.FuncType{InputTypes: []types.ValueType{vt}, ReturnTypes: []types.ValueType{vt}})
+		}
+		return err
+	case expr.OpCodeGlobalGet, expr.OpCodeGlobalSet:
+		index, err := v.readUint32()
+		if err != nil {
+			return err
+		}
+		if index >= uint32(len(v.globals)) || v.constant && index >= uint32(v.numGlobals) {
+			return fmt.Errorf("global index %d out of range", index)
+		}
+		gt := v.globals[index]
+		if op == expr.OpCodeGlobalGet {
+			if v.constant && gt.Mutable {
+				return fmt.Errorf("constant expression gets the mutable global %d", index)
+			}
+			v.push(gt.ValType)
+			return nil
+		}
+		if !gt.Mutable {
+			return fmt.Errorf("global %d is immutable", index)
+		}
+		_, err = v.popExpect(gt.ValType)
+		return err
+	case expr.OpCodeTableGet, expr.OpCodeTableSet:
+		tt, err := v.readTable()
+		if err != nil {
+			return err
+		}
+		if op == expr.OpCodeTableGet {
+			return v.apply(&types.FuncType{InputTypes: []types.ValueType{types.ValueTypeI32}, ReturnTypes: []types.ValueType{tt.Elem}})
+		}
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{types.ValueTypeI32, tt.Elem}})
+	case expr.OpCodeMemorySize, expr.OpCodeMemoryGrow:
+		mt, err := v.readMemory()
+		if err != nil {
+			return err
+		}
+		at := addressType(mt)
+		if op == expr.OpCodeMemoryGrow {
+			_, err = v.popExpect(at)
+		}
+		v.push(at)
+		return err
+	case expr.OpCodeI32Const:
+		if _, _, err := leb128decode.DecodeInt32(v.r); err != nil {
+			return fmt.Errorf("read immediate: %w", err)
+		}
+		v.push(types.ValueTypeI32)
+	case expr.OpCodeI64Const:
+		if _, _, err := leb128decode.DecodeInt64(v.r); err != nil {
+			return fmt.Errorf("read immediate: %w", err)
+		}
+		v.push(types.ValueTypeI64)
+	case expr.OpCodeF32Const:
+		if _, err := io.ReadFull(v.r, make([]byte, 4)); err != nil {
+			return fmt.Errorf("read immediate: %w", err)
+		}
+		v.push(types.ValueTypeF32)
+	case expr.OpCodeF64Const:
+		if _, err := io.ReadFull(v.r, make([]byte, 8)); err != nil {
+			return fmt.Errorf("read immediate: %w", err)
+		}
+		v.push(types.ValueTypeF64)
+	case expr.OpCodeNull:
+		b, err := v.r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("read reference type: %w", err)
+		}
+		if vt := types.ValueType(b); !vt.IsRefType() {
+			return fmt.Errorf("invalid reference type %#x", b)
+		}
+		v.push(types.ValueType(b))
+	case expr.OpCodeIsNull:
+		vt, err := v.pop()
+		if err != nil {
+			return err
+		}
+		if vt != unknownType && !vt.IsRefType() {
+			return fmt.Errorf("type mismatch: expected reference but got %s", vt)
+		}
+		v.push(types.ValueTypeI32)
+	case expr.OpCodeFunc:
+		index, err := v.readUint32()
+		if err != nil {
+			return err
+		}
+		if index >= uint32(len(v.funcs)) {
+			return fmt.Errorf("function index %d out of range", index)
+		}
+		if v.constant {
+			v.refs[index] = true
+		} else if !v.refs[index] {
+			return fmt.Errorf("function %d is not declared to be referenced", index)
+		}
+		v.push(types.ValueTypeFuncRef)
+	case expr.OpCodeMiscPrefix:
+		return v.validateMiscInstr()
+	case expr.OpCodeSIMDPrefix:
+		return v.validateSIMDInstr()
+	case expr.OpCodeAtomicPrefix:
+		return v.validateAtomicInstr()
+	default:
+		return fmt.Errorf("invalid opcode %#x", op)
+	}
+
+	return nil
+}
+
+// validateCall checks the call to the function of the signature, the tail call returns its results instead
+func (v *codeValidator) validateCall(ft *types.FuncType, tail bool) error {
+	if !tail {
+		return v.apply(ft)
+	}
+
+	if !types.HasSameSignature(ft.ReturnTypes, v.ctrls[0].endTypes) {
+		return fmt.Errorf("tail call to the function of different results")
+	}
+
+	if _, err := v.popTypes(ft.InputTypes); err != nil {
+		return err
+	}
+	v.setUnreachable()
+
+	return nil
+}
+
+// validateCatch checks the label of the catch clause takes the values passed by it
+func (v *codeValidator) validateCatch(kind expr.CatchKind, tag, label uint32) error {
+	var passed []types.ValueType
+	if kind == expr.CatchKindCatch || kind == expr.CatchKindCatchRef {
+		if tag >= uint32(len(v.tags)) {
+			return fmt.Errorf("tag index %d out of range", tag)
+		}
+		passed = append(passed, v.tags[tag].InputTypes...)
+	}
+	if kind == expr.CatchKindCatchRef || kind == expr.CatchKindCatchAllRef {
+		passed = append(passed, types.ValueTypeExnRef)
+	}
+
+	l, err := v.label(label)
+	if err != nil {
+		return err
+	}
+
+	if !types.HasSameSignature(passed, l.labelTypes()) {
+		return fmt.Errorf("type mismatch on the label of catch clause")
+	}
+
+	return nil
+}
+
+func (v *codeValidator) validateBrTable() error {
+	n, err := v.readUint32()
+	if err != nil {
+		return err
+	}
+
+	labels := make([]*ctrlFrame, n+1) // the default one is the last
+	for i := range labels {
+		index, err := v.readUint32()
+		if err != nil {
+			return err
+		}
+		if labels[i], err = v.label(index); err != nil {
+			return err
+		}
+	}
+
+	if _, err := v.popExpect(types.ValueTypeI32); err != nil {
+		return err
+	}
+
+	def := labels[n].labelTypes()
+	for _, l := range labels[:n] {
+		if len(l.labelTypes()) != len(def) {
+			return fmt.Errorf("br_table targets the labels of different arities")
+		}
+		vals, err := v.popTypes(l.labelTypes())
+		if err != nil {
+			return err
+		}
+		v.push(vals...)
+	}
+
+	if _, err := v.popTypes(def); err != nil {
+		return err
+	}
+	v.setUnreachable()
+
+	return nil
+}
+
+// memoryAccess is the type of the value and the natural size of a memory access
+type memoryAccess struct {
+	Type types.ValueType
+	Size uint64
+}
+
+// memoryAccesses holds the accesses of the load and store instructions from i32.load
+var memoryAccesses = [...]memoryAccess{
+	{types.ValueTypeI32, 4}, {types.ValueTypeI64, 8}, {types.ValueTypeF32, 4}, {types.ValueTypeF64, 8}, // loads
+	{types.ValueTypeI32, 1}, {types.ValueTypeI32, 1}, {types.ValueTypeI32, 2}, {types.ValueTypeI32, 2},
+	{types.ValueTypeI64, 1}, {types.ValueTypeI64, 1}, {types.ValueTypeI64, 2}, {types.ValueTypeI64, 2},
+	{types.ValueTypeI64, 4}, {types.ValueTypeI64, 4},
+	{types.ValueTypeI32, 4}, {types.ValueTypeI64, 8}, {types.ValueTypeF32, 4}, {types.ValueTypeF64, 8}, // stores
+	{types.ValueTypeI32, 1}, {types.ValueTypeI32, 2},
+	{types.ValueTypeI64, 1}, {types.ValueTypeI64, 2}, {types.ValueTypeI64, 4},
+}
+
+func (v *codeValidator) validateMemoryAccess(op expr.OpCode) error {
+	a := memoryAccesses[op-expr.OpCodeI32Load]
+	mt, err := v.readMemArg(a.Size, false)
+	if err != nil {
+		return err
+	}
+
+	if op < expr.OpCodeI32Store {
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{addressType(mt)}, ReturnTypes: []types.ValueType{a.Type}})
+	}
+
+	return v.apply(&types.FuncType{InputTypes: []types.ValueType{addressType(mt), a.Type}})
+}
+
+func (v *codeValidator) validateMiscInstr() error {
+	op, err := v.readUint32()
+	if err != nil {
+		return err
+	}
+
+	i32 := types.ValueTypeI32
+	switch op {
+	case expr.OpCodeI32TruncSatF32S, expr.OpCodeI32TruncSatF32U:
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{types.ValueTypeF32}, ReturnTypes: []types.ValueType{i32}})
+	case expr.OpCodeI32TruncSatF64S, expr.OpCodeI32TruncSatF64U:
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{types.ValueTypeF64}, ReturnTypes: []types.ValueType{i32}})
+	case expr.OpCodeI64TruncSatF32S, expr.OpCodeI64TruncSatF32U:
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{types.ValueTypeF32}, ReturnTypes: []types.ValueType{types.ValueTypeI64}})
+	case expr.OpCodeI64TruncSatF64S, expr.OpCodeI64TruncSatF64U:
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{types.ValueTypeF64}, ReturnTypes: []types.ValueType{types.ValueTypeI64}})
+	case expr.OpCodeMemoryInit, expr.OpCodeDataDrop:
+		index, err := v.readUint32()
+		if err != nil {
+			return err
+		}
+		if v.DataCountSection == nil {
+			return fmt.Errorf("data count section is required")
+		}
+		if index >= *v.DataCountSection {
+			return fmt.Errorf("data index %d out of range", index)
+		}
+		if op == expr.OpCodeDataDrop {
+			return nil
+		}
+		mt, err := v.readMemory()
+		if err != nil {
+			return err
+		}
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{addressType(mt), i32, i32}})
+	case expr.OpCodeMemoryCopy:
+		dst, err := v.readMemory()
+		if err != nil {
+			return err
+		}
+		src, err := v.readMemory()
+		if err != nil {
+			return err
+		}
+		n := types.ValueTypeI64
+		if !dst.Is64 || !src.Is64 {
+			n = i32
+		}
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{addressType(dst), addressType(src), n}})
+	case expr.OpCodeMemoryFill:
+		mt, err := v.readMemory()
+		if err != nil {
+			return err
+		}
+		at := addressType(mt)
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{at, i32, at}})
+	case expr.OpCodeTableInit, expr.OpCodeElemDrop:
+		index, err := v.readUint32()
+		if err != nil {
+			return err
+		}
+		if index >= uint32(len(v.ElementsSection)) {
+			return fmt.Errorf("element index %d out of range", index)
+		}
+		if op == expr.OpCodeElemDrop {
+			return nil
+		}
+		tt, err := v.readTable()
+		if err != nil {
+			return err
+		}
+		if et := v.ElementsSection[index].Type; et != tt.Elem {
+			return fmt.Errorf("type mismatch on table.init: %s != %s", et, tt.Elem)
+		}
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{i32, i32, i32}})
+	case expr.OpCodeTableCopy:
+		dst, err := v.readTable()
+		if err != nil {
+			return err
+		}
+		src, err := v.readTable()
+		if err != nil {
+			return err
+		}
+		if dst.Elem != src.Elem {
+			return fmt.Errorf("type mismatch on table.copy: %s != %s", src.Elem, dst.Elem)
+		}
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{i32, i32, i32}})
+	case expr.OpCodeTableGrow:
+		tt, err := v.readTable()
+		if err != nil {
+			return err
+		}
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{tt.Elem, i32}, ReturnTypes: []types.ValueType{i32}})
+	case expr.OpCodeTableSize:
+		if _, err := v.readTable(); err != nil {
+			return err
+		}
+		v.push(i32)
+	case expr.OpCodeTableFill:
+		tt, err := v.readTable()
+		if err != nil {
+			return err
+		}
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{i32, tt.Elem, i32}})
+	default:
+		return fmt.Errorf("invalid misc opcode %#x", op)
+	}
+
+	return nil
+}
+
+func (v *codeValidator) validateSIMDInstr() error {
+	op, err := v.readUint32()
+	if err != nil {
+		return err
+	}
+
+	if v.constant && op != expr.OpCodeV128Const {
+		return fmt.Errorf("instruction %s is not constant", expr.GetSIMDOpCodeName(op))
+	}
+
+	v128 := types.ValueTypeV128
+	switch {
+	case op == expr.OpCodeV128Const:
+		if _, err := io.ReadFull(v.r, make([]byte, 16)); err != nil {
+			return fmt.Errorf("read immediate: %w", err)
+		}
+		v.push(v128)
+	case op == expr.OpCodeI8x16Shuffle:
+		for i := 0; i < 16; i++ {
+			if err := v.readLane(32); err != nil {
+				return err
+			}
+		}
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{v128, v128}, ReturnTypes: []types.ValueType{v128}})
+	case op <= expr.OpCodeV128Load64Splat, op == expr.OpCodeV128Load32Zero, op == expr.OpCodeV128Load64Zero:
+		mt, err := v.readMemArg(simdLoadSize(op), false)
+		if err != nil {
+			return err
+		}
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{addressType(mt)}, ReturnTypes: []types.ValueType{v128}})
+	case op == expr.OpCodeV128Store:
+		mt, err := v.readMemArg(16, false)
+		if err != nil {
+			return err
+		}
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{addressType(mt), v128}})
+	case expr.OpCodeV128Load8Lane <= op && op <= expr.OpCodeV128Store64Lane:
+		size := uint64(1) << ((op - expr.OpCodeV128Load8Lane) % 4)
+		mt, err := v.readMemArg(size, false)
+		if err != nil {
+			return err
+		}
+		if err := v.readLane(byte(16 / size)); err != nil {
+			return err
+		}
+		sig := &types.FuncType{InputTypes: []types.ValueType{addressType(mt), v128}}
+		if op < expr.OpCodeV128Store8Lane {
+			sig.ReturnTypes = []types.ValueType{v128}
+		}
+		return v.apply(sig)
+	case expr.OpCodeI8x16ExtractLaneS <= op && op <= expr.OpCodeF64x2ReplaceLane:
+		lanes, vt, replace := simdLane(op)
+		if err := v.readLane(lanes); err != nil {
+			return err
+		}
+		if replace {
+			return v.apply(&types.FuncType{InputTypes: []types.ValueType{v128, vt}, ReturnTypes: []types.ValueType{v128}})
+		}
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{v128}, ReturnTypes: []types.ValueType{vt}})
+	case op < uint32(len(simdSignatures)) && simdSignatures[op] != nil:
+		return v.apply(simdSignatures[op])
+	default:
+		return fmt.Errorf("invalid simd opcode %#x", op)
+	}
+
+	return nil
+}
+
+// simdLoadSize returns the natural size of the v128 load instructions
+func simdLoadSize(op expr.SIMDOpCode) uint64 {
+	switch op {
+	case expr.OpCodeV128Load:
+		return 16
+	case expr.OpCodeV128Load8Splat:
+		return 1
+	case expr.OpCodeV128Load16Splat:
+		return 2
+	case expr.OpCodeV128Load32Splat, expr.OpCodeV128Load32Zero:
+		return 4
+	default: // the extending loads, load64_splat and load64_zero
+		return 8
+	}
+}
+
+// simdLane returns the number of lanes and the type of the lane accessed by the extract_lane or replace_lane instruction
+func simdLane(op expr.SIMDOpCode) (lanes byte, vt types.ValueType, replace bool) {
+	switch op {
+	case expr.OpCodeI8x16ExtractLaneS, expr.OpCodeI8x16ExtractLaneU, expr.OpCodeI8x16ReplaceLane:
+		return 16, types.ValueTypeI32, op == expr.OpCodeI8x16ReplaceLane
+	case expr.OpCodeI16x8ExtractLaneS, expr.OpCodeI16x8ExtractLaneU, expr.OpCodeI16x8ReplaceLane:
+		return 8, types.ValueTypeI32, op == expr.OpCodeI16x8ReplaceLane
+	case expr.OpCodeI32x4ExtractLane, expr.OpCodeI32x4ReplaceLane:
+		return 4, types.ValueTypeI32, op == expr.OpCodeI32x4ReplaceLane
+	case expr.OpCodeI64x2ExtractLane, expr.OpCodeI64x2ReplaceLane:
+		return 2, types.ValueTypeI64, op == expr.OpCodeI64x2ReplaceLane
+	case expr.OpCodeF32x4ExtractLane, expr.OpCodeF32x4ReplaceLane:
+		return 4, types.ValueTypeF32, op == expr.OpCodeF32x4ReplaceLane
+	default:
+		return 2, types.ValueTypeF64, op == expr.OpCodeF64x2ReplaceLane
+	}
+}
+
+// atomicAccesses holds the accesses of each group of the atomic loads, stores and read-modify-writes in the order of the opcodes
+var atomicAccesses = [7]memoryAccess{
+	{types.ValueTypeI32, 4}, {types.ValueTypeI64, 8},
+	{types.ValueTypeI32, 1}, {types.ValueTypeI32, 2},
+	{types.ValueTypeI64, 1}, {types.ValueTypeI64, 2}, {types.ValueTypeI64, 4},
+}
+
+func (v *codeValidator) validateAtomicInstr() error {
+	op, err := v.readUint32()
+	if err != nil {
+		return err
+	}
+
+	if op >= uint32(len(atomicInstructions)) || atomicInstructions[op] == nil {
+		return fmt.Errorf("invalid atomic opcode %#x", op)
+	}
+
+	i32, i64 := types.ValueTypeI32, types.ValueTypeI64
+	switch {
+	case op == expr.OpCodeAtomicFence:
+		b, err := v.r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("read immediate: %w", err)
+		}
+		if b != 0x00 {
+			return fmt.Errorf("atomic.fence must have the zero byte")
+		}
+		return nil
+	case op == expr.OpCodeMemoryAtomicNotify:
+		mt, err := v.readMemArg(4, true)
+		if err != nil {
+			return err
+		}
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{addressType(mt), i32}, ReturnTypes: []types.ValueType{i32}})
+	case op == expr.OpCodeMemoryAtomicWait32, op == expr.OpCodeMemoryAtomicWait64:
+		a := atomicAccesses[op-expr.OpCodeMemoryAtomicWait32]
+		mt, err := v.readMemArg(a.Size, true)
+		if err != nil {
+			return err
+		}
+		return v.apply(&types.FuncType{InputTypes: []types.ValueType{addressType(mt), a.Type, i64}, ReturnTypes: []types.ValueType{i32}})
+	}
+
+	var sig *types.FuncType
+	var a memoryAccess
+	switch {
+	case op <= expr.OpCodeI64AtomicLoad32U:
+		a = atomicAccesses[op-expr.OpCodeI32AtomicLoad]
+		sig = &types.FuncType{ReturnTypes: []types.ValueType{a.Type}}
+	case op <= expr.OpCodeI64AtomicStore32:
+		a = atomicAccesses[op-expr.OpCodeI32AtomicStore]
+		sig = &types.FuncType{InputTypes: []types.ValueType{a.Type}}
+	case op < expr.OpCodeI32AtomicRmwCmpxchg:
+		a = atomicAccesses[(op-expr.OpCodeI32AtomicRmwAdd)%7]
+		sig = &types.FuncType{InputTypes: []types.ValueType{a.Type}, ReturnTypes: []types.ValueType{a.Type}}
+	default:
+		a = atomicAccesses[op-expr.OpCodeI32AtomicRmwCmpxchg]
+		sig = &types.FuncType{InputTypes: []types.ValueType{a.Type, a.Type}, ReturnTypes: []types.ValueType{a.Type}}
+	}
+
+	mt, err := v.readMemArg(a.Size, true)
+	if err != nil {
+		return err
+	}
+	sig.InputTypes = append([]types.ValueType{addressType(mt)}, sig.InputTypes...)
+
+	return v.apply(sig)
+}
+
+// opSignatures holds the types of the operands and results of the numeric instructions without immediates
+var opSignatures = func() (ret [256]*types.FuncType) {
+	set := func(from, to expr.OpCode, in []types.ValueType, out types.ValueType) {
+		for op := int(from); op <= int(to); op++ {
+			ret[op] = &types.FuncType{InputTypes: in, ReturnTypes: []types.ValueType{out}}
+		}
+	}
+	i32, i64, f32, f64 := types.ValueTypeI32, types.ValueTypeI64, types.ValueTypeF32, types.ValueTypeF64
+	unary := func(vt types.ValueType) []types.ValueType { return []types.ValueType{vt} }
+	binary := func(vt types.ValueType) []types.ValueType { return []types.ValueType{vt, vt} }
+
+	set(expr.OpCodeI32Eqz, expr.OpCodeI32Eqz, unary(i32), i32)
+	set(expr.OpCodeI32Eq, expr.OpCodeI32GeU, binary(i32), i32)
+	set(expr.OpCodeI64Eqz, expr.OpCodeI64Eqz, unary(i64), i32)
+	set(expr.OpCodeI64Eq, expr.OpCodeI64GeU, binary(i64), i32)
+	set(expr.OpCodeF32Eq, expr.OpCodeF32Ge, binary(f32), i32)
+	set(expr.OpCodeF64Eq, expr.OpCodeF64Ge, binary(f64), i32)
+
+	set(expr.OpCodeI32Clz, expr.OpCodeI32PopCnt, unary(i32), i32)
+	set(expr.OpCodeI32Add, expr.OpCodeI32RotR, binary(i32), i32)
+	set(expr.OpCodeI64Clz, expr.OpCodeI64PopCnt, unary(i64), i64)
+	set(expr.OpCodeI64Add, expr.OpCodeI64RotR, binary(i64), i64)
+	set(expr.OpCodeF32Abs, expr.OpCodeF32Sqrt, unary(f32), f32)
+	set(expr.OpCodeF32Add, expr.OpCodeF32CopySign, binary(f32), f32)
+	set(expr.OpCodeF64Abs, expr.OpCodeF64Sqrt, unary(f64), f64)
+	set(expr.OpCodeF64Add, expr.OpCodeF64CopySign, binary(f64), f64)
+
+	set(expr.OpCodeI32WrapI64, expr.OpCodeI32WrapI64, unary(i64), i32)
+	set(expr.OpCodeI32TruncF32S, expr.OpCodeI32TruncF32U, unary(f32), i32)
+	set(expr.OpCodeI32truncF64S, expr.OpCodeI32truncF64U, unary(f64), i32)
+	set(expr.OpCodeI64ExtendI32S, expr.OpCodeI64ExtendI32U, unary(i32), i64)
+	set(expr.OpCodeI64TruncF32S, expr.OpCodeI64TruncF32U, unary(f32), i64)
+	set(expr.OpCodeI64TruncF64S, expr.OpCodeI64TruncF64U, unary(f64), i64)
+	set(expr.OpCodeF32ConvertI32S, expr.OpCodeF32ConvertI32U, unary(i32), f32)
+	set(expr.OpCodeF32ConvertI64S, expr.OpCodeF32ConvertI64U, unary(i64), f32)
+	set(expr.OpCodeF32DemoteF64, expr.OpCodeF32DemoteF64, unary(f64), f32)
+	set(expr.OpCodeF64ConvertI32S, expr.OpCodeF64ConvertI32U, unary(i32), f64)
+	set(expr.OpCodeF64ConvertI64S, expr.OpCodeF64ConvertI64U, unary(i64), f64)
+	set(expr.OpCodeF64PromoteF32, expr.OpCodeF64PromoteF32, unary(f32), f64)
+	set(expr.OpCodeI32ReinterpretF32, expr.OpCodeI32ReinterpretF32, unary(f32), i32)
+	set(expr.OpCodeI64ReinterpretF64, expr.OpCodeI64ReinterpretF64, unary(f64), i64)
+	set(expr.OpCodeF32ReinterpretI32, expr.OpCodeF32ReinterpretI32, unary(i32), f32)
+	set(expr.OpCodeF64ReinterpretI64, expr.OpCodeF64ReinterpretI64, unary(i64), f64)
+
+	set(expr.OpCodeI32Extend8S, expr.OpCodeI32Extend16S, unary(i32), i32)
+	set(expr.OpCodeI64Extend8S, expr.OpCodeI64Extend32S, unary(i64), i64)
+
+	return ret
+}()
+
+// simdSignatures holds the types of the operands and results of the simd instructions without immediates,
+// which are binary on v128 unless listed otherwise
+var simdSignatures = func() (ret [256]*types.FuncType) {
+	v128 := types.ValueTypeV128
+	for op := expr.OpCodeI8x16Swizzle; op < uint32(len(simdInstructions)); op++ {
+		if simdInstructions[op] != nil {
+			ret[op] = &types.FuncType{InputTypes: []types.ValueType{v128, v128}, ReturnTypes: []types.ValueType{v128}}
+		}
+	}
+
+	set := func(in []types.ValueType, out types.ValueType, ops ...expr.SIMDOpCode) {
+		for _, op := range ops {
+			ret[op] = &types.FuncType{InputTypes: in, ReturnTypes: []types.ValueType{out}}
+		}
+	}
+
+	set([]types.ValueType{types.ValueTypeI32}, v128, expr.OpCodeI8x16Splat, expr.OpCodeI16x8Splat, expr.OpCodeI32x4Splat)
+	set([]types.ValueType{types.ValueTypeI64}, v128, expr.OpCodeI64x2Splat)
+	set([]types.ValueType{types.ValueTypeF32}, v128, expr.OpCodeF32x4Splat)
+	set([]types.ValueType{types.ValueTypeF64}, v128, expr.OpCodeF64x2Splat)
+	set([]types.ValueType{v128, v128, v128}, v128, expr.OpCodeV128Bitselect)
+	set([]types.ValueType{v128}, types.ValueTypeI32,
+		expr.OpCodeV128AnyTrue,
+		expr.OpCodeI8x16AllTrue, expr.OpCodeI8x16Bitmask,
+		expr.OpCodeI16x8AllTrue, expr.OpCodeI16x8Bitmask,
+		expr.OpCodeI32x4AllTrue, expr.OpCodeI32x4Bitmask,
+		expr.OpCodeI64x2AllTrue, expr.OpCodeI64x2Bitmask)
+	set([]types.ValueType{v128, types.ValueTypeI32}, v128,
+		expr.OpCodeI8x16Shl, expr.OpCodeI8x16ShrS, expr.OpCodeI8x16ShrU,
+		expr.OpCodeI16x8Shl, expr.OpCodeI16x8ShrS, expr.OpCodeI16x8ShrU,
+		expr.OpCodeI32x4Shl, expr.OpCodeI32x4ShrS, expr.OpCodeI32x4ShrU,
+		expr.OpCodeI64x2Shl, expr.OpCodeI64x2ShrS, expr.OpCodeI64x2ShrU)
+	set([]types.ValueType{v128}, v128,
+		expr.OpCodeV128Not, expr.OpCodeF32x4DemoteF64x2Zero, expr.OpCodeF64x2PromoteLowF32x4,
+		expr.OpCodeI8x16Abs, expr.OpCodeI8x16Neg, expr.OpCodeI8x16Popcnt,
+		expr.OpCodeF32x4Ceil, expr.OpCodeF32x4Floor, expr.OpCodeF32x4Trunc, expr.OpCodeF32x4Nearest,
+		expr.OpCodeF64x2Ceil, expr.OpCodeF64x2Floor, expr.OpCodeF64x2Trunc, expr.OpCodeF64x2Nearest,
+		expr.OpCodeI16x8ExtaddPairwiseI8x16S, expr.OpCodeI16x8ExtaddPairwiseI8x16U,
+		expr.OpCodeI32x4ExtaddPairwiseI16x8S, expr.OpCodeI32x4ExtaddPairwiseI16x8U,
+		expr.OpCodeI16x8Abs, expr.OpCodeI16x8Neg,
+		expr.OpCodeI16x8ExtendLowI8x16S, expr.OpCodeI16x8ExtendHighI8x16S, expr.OpCodeI16x8ExtendLowI8x16U, expr.OpCodeI16x8ExtendHighI8x16U,
+		expr.OpCodeI32x4Abs, expr.OpCodeI32x4Neg,
+		expr.OpCodeI32x4ExtendLowI16x8S, expr.OpCodeI32x4ExtendHighI16x8S, expr.OpCodeI32x4ExtendLowI16x8U, expr.OpCodeI32x4ExtendHighI16x8U,
+		expr.OpCodeI64x2Abs, expr.OpCodeI64x2Neg,
+		expr.OpCodeI64x2ExtendLowI32x4S, expr.OpCodeI64x2ExtendHighI32x4S, expr.OpCodeI64x2ExtendLowI32x4U, expr.OpCodeI64x2ExtendHighI32x4U,
+		expr.OpCodeF32x4Abs, expr.OpCodeF32x4Neg, expr.OpCodeF32x4Sqrt,
+		expr.OpCodeF64x2Abs, expr.OpCodeF64x2Neg, expr.OpCodeF64x2Sqrt,
+		expr.OpCodeI32x4TruncSatF32x4S, expr.OpCodeI32x4TruncSatF32x4U, expr.OpCodeF32x4ConvertI32x4S, expr.OpCodeF32x4ConvertI32x4U,
+		expr.OpCodeI32x4TruncSatF64x2SZero, expr.OpCodeI32x4TruncSatF64x2UZero, expr.OpCodeF64x2ConvertLowI32x4S, expr.OpCodeF64x2ConvertLowI32x4U)
+
+	return ret
+}()
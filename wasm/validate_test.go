@@ -0,0 +1,384 @@
+package wasm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/c0mm4nd/wasman/config"
+	"github.com/c0mm4nd/wasman/expr"
+	"github.com/c0mm4nd/wasman/segments"
+	"github.com/c0mm4nd/wasman/types"
+	"github.com/c0mm4nd/wasman/utils"
+)
+
+func TestModule_ValidateFunc(t *testing.T) {
+	i32, i64 := types.ValueTypeI32, types.ValueTypeI64
+	v0i32 := &types.FuncType{ReturnTypes: []types.ValueType{i32}}
+	vi32i32 := &types.FuncType{InputTypes: []types.ValueType{i32}, ReturnTypes: []types.ValueType{i32}}
+	newModule := func(sig *types.FuncType, body []byte) *Module {
+		return &Module{
+			TypeSection:     []*types.FuncType{sig, {}},
+			FunctionSection: []uint32{0},
+			CodeSection:     []*segments.CodeSegment{{NumLocals: 1, Locals: []segments.LocalEntry{{Count: 1, Type: i64}}, Body: body}},
+			MemorySection:   []*types.MemoryType{{Min: 1, Max: utils.Uint64Ptr(1), Shared: true}},
+			TableSection:    []*types.TableType{{Elem: types.ValueTypeFuncRef, Limits: &types.Limits{}}},
+			GlobalSection: []*segments.GlobalSegment{{
+				Type: &types.GlobalType{ValType: i32},
+				Init: &expr.Expression{OpCode: expr.OpCodeI32Const, Data: []byte{0x00}},
+			}},
+		}
+	}
+
+	for _, c := range []struct {
+		name string
+		sig  *types.FuncType
+		body []byte
+	}{
+		{
+			name: "block and branches",
+			sig:  vi32i32,
+			// (block (result i32) (loop (br_if 1 (local.get 0) (local.get 0))) (i32.const 1))
+			body: []byte{
+				byte(expr.OpCodeBlock), 0x7f,
+				byte(expr.OpCodeLoop), 0x40,
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeBrIf), 0x01,
+				byte(expr.OpCodeDrop),
+				byte(expr.OpCodeEnd),
+				byte(expr.OpCodeI32Const), 0x01,
+				byte(expr.OpCodeEnd),
+			},
+		},
+		{
+			name: "if else",
+			sig:  vi32i32,
+			body: []byte{
+				byte(expr.OpCodeLocalGet), 0x00,
+				byte(expr.OpCodeIf), 0x7f,
+				byte(expr.OpCodeI32Const), 0x01,
+				byte(expr.OpCodeElse),
+				byte(expr.OpCodeI32Const), 0x02,
+				byte(expr.OpCodeEnd),
+			},
+		},
+		{
+			name: "unreachable makes the stack polymorphic",
+			sig:  v0i32,
+			body: []byte{
+				byte(expr.OpCodeUnreachable),
+				byte(expr.OpCodeI32Add),
+				byte(expr.OpCodeSelect),
+			},
+		},
+		{
+			name: "br_table",
+			sig:  v0i32,
+			body: []byte{
+				byte(expr.OpCodeBlock), 0x7f,
+				byte(expr.OpCodeI32Const), 0x01,
+				byte(expr.OpCodeI32Const), 0x00,
+				byte(expr.OpCodeBrTable), 0x01, 0x00, 0x01,
+				byte(expr.OpCodeEnd),
+			},
+		},
+		{
+			name: "memory, locals and globals",
+			sig:  v0i32,
+			body: []byte{
+				byte(expr.OpCodeGlobalGet), 0x00,
+				byte(expr.OpCodeI64Load32u), 0x02, 0x00,
+				byte(expr.OpCodeLocalSet), 0x00,
+				byte(expr.OpCodeI32Const), 0x00,
+				expr.OpCodeAtomicPrefix, byte(expr.OpCodeI32AtomicLoad), 0x02, 0x00,
+				byte(expr.OpCodeMemorySize), 0x00,
+				byte(expr.OpCodeI32Add),
+			},
+		},
+		{
+			name: "simd",
+			sig:  v0i32,
+			body: append(append([]byte{byte(expr.OpCodeI32Const), 0x01, expr.OpCodeSIMDPrefix, byte(expr.OpCodeI32x4Splat),
+				expr.OpCodeSIMDPrefix, byte(expr.OpCodeV128Const)}, make([]byte, 16)...),
+				expr.OpCodeSIMDPrefix, byte(expr.OpCodeI32x4Add), 0x01,
+				expr.OpCodeSIMDPrefix, byte(expr.OpCodeI32x4ExtractLane), 0x03),
+		},
+		{
+			name: "tail call",
+			sig:  v0i32,
+			body: []byte{byte(expr.OpCodeReturnCall), 0x00},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if err := newModule(c.sig, c.body).Validate(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	for _, c := range []struct {
+		name   string
+		sig    *types.FuncType
+		body   []byte
+		offset uint64
+	}{
+		{
+			name:   "type mismatch",
+			sig:    v0i32,
+			body:   []byte{byte(expr.OpCodeI32Const), 0x01, byte(expr.OpCodeI64Const), 0x01, byte(expr.OpCodeI32Add)},
+			offset: 4,
+		},
+		{
+			name:   "stack underflow",
+			sig:    v0i32,
+			body:   []byte{byte(expr.OpCodeI32Const), 0x01, byte(expr.OpCodeI32Add)},
+			offset: 2,
+		},
+		{
+			name:   "wrong results",
+			sig:    v0i32,
+			body:   []byte{byte(expr.OpCodeI64Const), 0x01},
+			offset: 2,
+		},
+		{
+			name:   "values remain",
+			sig:    &types.FuncType{},
+			body:   []byte{byte(expr.OpCodeBlock), 0x40, byte(expr.OpCodeI32Const), 0x01, byte(expr.OpCodeEnd)},
+			offset: 4,
+		},
+		{
+			name:   "block not ended",
+			sig:    &types.FuncType{},
+			body:   []byte{byte(expr.OpCodeBlock), 0x40},
+			offset: 2,
+		},
+		{
+			name:   "unexpected end",
+			sig:    &types.FuncType{},
+			body:   []byte{byte(expr.OpCodeNop), byte(expr.OpCodeEnd)},
+			offset: 1,
+		},
+		{
+			name:   "else without if",
+			sig:    &types.FuncType{},
+			body:   []byte{byte(expr.OpCodeBlock), 0x40, byte(expr.OpCodeElse), byte(expr.OpCodeEnd)},
+			offset: 2,
+		},
+		{
+			name:   "if without else",
+			sig:    vi32i32,
+			body:   []byte{byte(expr.OpCodeLocalGet), 0x00, byte(expr.OpCodeIf), 0x7f, byte(expr.OpCodeI32Const), 0x01, byte(expr.OpCodeEnd)},
+			offset: 6,
+		},
+		{
+			name:   "label out of range",
+			sig:    &types.FuncType{},
+			body:   []byte{byte(expr.OpCodeBr), 0x01},
+			offset: 0,
+		},
+		{
+			name: "br_table arity",
+			sig:  &types.FuncType{},
+			body: []byte{
+				byte(expr.OpCodeBlock), 0x7f,
+				byte(expr.OpCodeI32Const), 0x00,
+				byte(expr.OpCodeBrTable), 0x01, 0x00, 0x01,
+				byte(expr.OpCodeEnd),
+				byte(expr.OpCodeDrop),
+			},
+			offset: 4,
+		},
+		{
+			name:   "local out of range",
+			sig:    &types.FuncType{},
+			body:   []byte{byte(expr.OpCodeLocalGet), 0x01, byte(expr.OpCodeDrop)},
+			offset: 0,
+		},
+		{
+			name:   "immutable global",
+			sig:    &types.FuncType{},
+			body:   []byte{byte(expr.OpCodeI32Const), 0x01, byte(expr.OpCodeGlobalSet), 0x00},
+			offset: 2,
+		},
+		{
+			name:   "alignment",
+			sig:    v0i32,
+			body:   []byte{byte(expr.OpCodeI32Const), 0x00, byte(expr.OpCodeI32Load), 0x03, 0x00},
+			offset: 2,
+		},
+		{
+			name:   "atomic alignment",
+			sig:    v0i32,
+			body:   []byte{byte(expr.OpCodeI32Const), 0x00, expr.OpCodeAtomicPrefix, byte(expr.OpCodeI32AtomicLoad), 0x01, 0x00},
+			offset: 2,
+		},
+		{
+			name:   "memory out of range",
+			sig:    v0i32,
+			body:   []byte{byte(expr.OpCodeMemorySize), 0x01},
+			offset: 0,
+		},
+		{
+			name:   "undeclared ref.func",
+			sig:    &types.FuncType{},
+			body:   []byte{byte(expr.OpCodeFunc), 0x00, byte(expr.OpCodeDrop)},
+			offset: 0,
+		},
+		{
+			name:   "memory.init without data count",
+			sig:    &types.FuncType{},
+			body:   []byte{expr.OpCodeMiscPrefix, byte(expr.OpCodeDataDrop), 0x00},
+			offset: 0,
+		},
+		{
+			name:   "tail call with different results",
+			sig:    vi32i32,
+			body:   []byte{byte(expr.OpCodeReturnCall), 0x00},
+			offset: 0,
+		},
+		{
+			name:   "lane out of range",
+			sig:    v0i32,
+			body:   append([]byte{expr.OpCodeSIMDPrefix, byte(expr.OpCodeV128Const)}, append(make([]byte, 16), expr.OpCodeSIMDPrefix, byte(expr.OpCodeI32x4ExtractLane), 0x04)...),
+			offset: 18,
+		},
+		{
+			name:   "invalid opcode",
+			sig:    &types.FuncType{},
+			body:   []byte{byte(expr.OpCodeNop), 0x06},
+			offset: 1,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			err := newModule(c.sig, c.body).Validate()
+			if !errors.Is(err, ErrInvalidModule) {
+				t.Fatalf("got %v", err)
+			}
+
+			var fe *FuncValidationError
+			if !errors.As(err, &fe) {
+				t.Fatalf("not a FuncValidationError: %v", err)
+			}
+			if fe.FuncIndex != 0 || fe.Offset != c.offset {
+				t.Errorf("got %v", err)
+			}
+		})
+	}
+}
+
+func TestModule_Validate(t *testing.T) {
+	i32 := types.ValueTypeI32
+	newModule := func() *Module {
+		return &Module{
+			TypeSection: []*types.FuncType{{}, {InputTypes: []types.ValueType{i32}}},
+			ImportSection: []*segments.ImportSegment{{
+				Module: "env", Name: "g",
+				Desc: &segments.ImportDesc{Kind: segments.KindGlobal, GlobalTypePtr: &types.GlobalType{ValType: i32}},
+			}},
+			FunctionSection: []uint32{0, 1},
+			CodeSection:     []*segments.CodeSegment{{}, {}},
+			MemorySection:   []*types.MemoryType{{Min: 1}},
+			TableSection:    []*types.TableType{{Elem: types.ValueTypeFuncRef, Limits: &types.Limits{Min: 1}}},
+			GlobalSection: []*segments.GlobalSegment{{
+				Type: &types.GlobalType{ValType: i32},
+				// (i32.add (global.get 0) (i32.const 1))
+				Init: &expr.Expression{OpCode: expr.OpCodeGlobalGet, Data: []byte{0x00, byte(expr.OpCodeI32Const), 0x01, byte(expr.OpCodeI32Add)}},
+			}},
+			ElementsSection: []*segments.ElemSegment{{
+				Type:       types.ValueTypeFuncRef,
+				OffsetExpr: &expr.Expression{OpCode: expr.OpCodeGlobalGet, Data: []byte{0x01}},
+				Init:       []uint32{0},
+			}},
+			DataSection: []*segments.DataSegment{{
+				OffsetExpression: &expr.Expression{OpCode: expr.OpCodeI32Const, Data: []byte{0x00}},
+			}},
+			StartSection: []uint32{0},
+			ExportSection: map[string]*segments.ExportSegment{
+				"f": {Name: "f", Desc: &segments.ExportDesc{Kind: segments.KindFunction, Index: 1}},
+			},
+		}
+	}
+
+	if err := newModule().Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name   string
+		modify func(m *Module)
+	}{
+		{name: "function type out of range", modify: func(m *Module) { m.FunctionSection[0] = 2 }},
+		{name: "function and code mismatch", modify: func(m *Module) { m.CodeSection = m.CodeSection[:1] }},
+		{name: "memory max less than min", modify: func(m *Module) { m.MemorySection[0].Max = utils.Uint64Ptr(0) }},
+		{name: "memory too large", modify: func(m *Module) { m.MemorySection[0].Min = 65537 }},
+		{name: "shared memory without max", modify: func(m *Module) { m.MemorySection[0].Shared = true }},
+		{name: "global type mismatch", modify: func(m *Module) { m.GlobalSection[0].Type.ValType = types.ValueTypeI64 }},
+		{name: "global gets mutable global", modify: func(m *Module) { m.ImportSection[0].Desc.GlobalTypePtr.Mutable = true }},
+		{name: "global gets itself", modify: func(m *Module) { m.GlobalSection[0].Init.Data[0] = 0x01 }},
+		{name: "non-constant global", modify: func(m *Module) {
+			m.GlobalSection[0].Init = &expr.Expression{OpCode: expr.OpCodeI32Const, Data: []byte{0x00, byte(expr.OpCodeI32Eqz)}}
+		}},
+		{name: "element function out of range", modify: func(m *Module) { m.ElementsSection[0].Init[0] = 2 }},
+		{name: "element table out of range", modify: func(m *Module) { m.ElementsSection[0].TableIndex = 1 }},
+		{name: "element type mismatch", modify: func(m *Module) { m.TableSection[0].Elem = types.ValueTypeExternRef }},
+		{name: "data offset on memory64", modify: func(m *Module) { m.MemorySection[0].Is64 = true }},
+		{name: "multiple start", modify: func(m *Module) { m.StartSection = []uint32{0, 0} }},
+		{name: "start with params", modify: func(m *Module) { m.StartSection[0] = 1 }},
+		{name: "export out of range", modify: func(m *Module) { m.ExportSection["f"].Desc.Index = 2 }},
+		{name: "duplicate export", modify: func(m *Module) { m.duplicateExports = []string{"f"} }},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			m := newModule()
+			c.modify(m)
+			if err := m.Validate(); !errors.Is(err, ErrInvalidModule) {
+				t.Errorf("got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewModule_EnableValidation(t *testing.T) {
+	// (func (result i32) (i64.const 0))
+	bin := []byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+		0x01, 0x05, 0x01, 0x60, 0x00, 0x01, 0x7f, // type section
+		0x03, 0x02, 0x01, 0x00, // function section
+		0x07, 0x09, 0x02, 0x01, 'f', 0x00, 0x00, 0x01, 'f', 0x00, 0x00, // export section with a duplicate
+		0x0a, 0x06, 0x01, 0x04, 0x00, byte(expr.OpCodeI64Const), 0x00, byte(expr.OpCodeEnd), // code section
+	}
+
+	m, err := NewModule(config.ModuleConfig{}, bytes.NewReader(bin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ExportSection["f"] == nil || len(m.duplicateExports) != 1 {
+		t.Errorf("duplicate export is not recorded: %v", m.duplicateExports)
+	}
+
+	_, err = NewModule(config.ModuleConfig{EnableValidation: true}, bytes.NewReader(bin))
+	if !errors.Is(err, ErrInvalidModule) {
+		t.Errorf("got %v", err)
+	}
+
+	m.duplicateExports = nil
+	var fe *FuncValidationError
+	if err := m.Validate(); !errors.As(err, &fe) || fe.FuncIndex != 0 || fe.Offset != 2 {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestNewModule_tooManyLocals(t *testing.T) {
+	// the func declaring 2^32-1 i32 locals, in 30 bytes
+	bin := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	bin = append(bin, benchSection(0x01, 0x01, 0x60, 0x00, 0x00)...)
+	bin = append(bin, benchSection(0x03, 0x01, 0x00)...)
+	bin = append(bin, benchSection(0x0a, 0x01, 0x08, 0x01, 0xff, 0xff, 0xff, 0xff, 0x0f, 0x7f, 0x0b)...)
+	if len(bin) != 30 {
+		t.Fatalf("got %d bytes", len(bin))
+	}
+
+	if _, err := NewModule(config.ModuleConfig{}, bytes.NewReader(bin)); !errors.Is(err, segments.ErrTooManyLocals) {
+		t.Errorf("got %v", err)
+	}
+}